@@ -0,0 +1,123 @@
+package soap
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HandlerOption configures a handler, see Server.RegisterHandler.
+type HandlerOption func(*operationHandler)
+
+// ActionOptional lets a handler also serve requests without action, e.g. of
+// SOAP 1.2 clients omitting the action parameter or of .NET clients sending
+// an empty quoted SOAPAction, which are matched by their Body element alone.
+// Requests with an action still have to carry the registered one, unless it
+// is empty: a handler registered for the empty action with ActionOptional
+// serves the element for any action without a handler of its own.
+func ActionOptional() HandlerOption {
+	return func(h *operationHandler) {
+		h.actionOptional = true
+	}
+}
+
+// optionalActionHandler returns the ActionOptional handler at path for the
+// request element of a request with action, which has no handler of its own.
+// A request without action is ambiguous if several handlers would take it.
+func (s *Server) optionalActionHandler(path, action, element string) (*operationHandler, error) {
+	if action != "" {
+		if h := s.handlers[path][""][element]; h != nil && h.actionOptional {
+			return h, nil
+		}
+		return nil, nil
+	}
+	var (
+		found   *operationHandler
+		actions []string
+	)
+	for _, a := range sortedKeys(s.handlers[path]) {
+		if h := s.handlers[path][a][element]; h != nil && h.actionOptional {
+			found = h
+			actions = append(actions, fmt.Sprintf("%q", a))
+		}
+	}
+	if len(actions) > 1 {
+		return nil, fmt.Errorf("request without action for content type %q is ambiguous, handled by actions %s", element, strings.Join(actions, ", "))
+	}
+	return found, nil
+}
+
+// hasOptionalActions reports whether a handler at path has been registered
+// with ActionOptional.
+func (s *Server) hasOptionalActions(path string) bool {
+	for _, elements := range s.handlers[path] {
+		for _, h := range elements {
+			if h.actionOptional {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ActionError is returned for a SOAPAction which can't be sent, e.g. one with
+// a line break read from a configuration file. Calls fail with it before
+// anything is sent.
+type ActionError struct {
+	Action string
+	Reason string
+}
+
+func (ae *ActionError) Error() string {
+	return fmt.Sprintf("invalid SOAPAction %q: %s", ae.Action, ae.Reason)
+}
+
+// normalizeAction returns action without surrounding whitespace and quotes,
+// which newRequest adds according to QuoteSOAPAction. Control characters,
+// characters outside of ASCII, which a URI can't hold unescaped, and quotes
+// within the action are rejected with an *ActionError.
+func normalizeAction(action string) (string, error) {
+	normalized := trimAction(action)
+	for i, r := range normalized {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			return "", &ActionError{Action: action, Reason: fmt.Sprintf("control character %U at %d", r, i)}
+		case r > 0x7f:
+			return "", &ActionError{Action: action, Reason: fmt.Sprintf("non-ASCII character %U at %d, percent-encode it", r, i)}
+		case r == '"':
+			return "", &ActionError{Action: action, Reason: "unbalanced quotes"}
+		}
+	}
+	return normalized, nil
+}
+
+type rawActionKey struct{}
+
+// RawSOAPAction returns the SOAPAction header of a request as received,
+// before the server trimmed surrounding whitespace and quotes to match it
+// with the registered actions. Use it with the context of the *http.Request
+// passed to an OperationHandlerFunc.
+func RawSOAPAction(ctx context.Context) string {
+	action, _ := ctx.Value(rawActionKey{}).(string)
+	return action
+}
+
+// withRawAction returns r with its SOAPAction header in its context, see
+// RawSOAPAction.
+func withRawAction(r *http.Request) *http.Request {
+	action, ok := r.Header["Soapaction"]
+	if !ok || len(action) == 0 {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), rawActionKey{}, action[0]))
+}
+
+// trimAction trims whitespace and quotes surrounding an action.
+func trimAction(action string) string {
+	action = strings.TrimSpace(action)
+	if len(action) >= 2 && strings.HasPrefix(action, `"`) && strings.HasSuffix(action, `"`) {
+		action = strings.TrimSpace(action[1 : len(action)-1])
+	}
+	return action
+}
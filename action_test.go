@@ -0,0 +1,238 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_ActionOptional(t *testing.T) {
+	handler := func(bar string) OperationHandlerFunc {
+		return func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			return &FooResponse{Bar: bar}, nil
+		}
+	}
+	factory := func() interface{} { return &FooRequest{} }
+	const (
+		envelope11 = `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><fooRequest><Foo>foo</Foo></fooRequest></Body></Envelope>`
+		envelope12 = `<Envelope xmlns="http://www.w3.org/2003/05/soap-envelope"><Body><fooRequest><Foo>foo</Foo></fooRequest></Body></Envelope>`
+	)
+
+	for name, tc := range map[string]struct {
+		register    func(s *Server)
+		soap12      bool
+		soapAction  string // SOAPAction header
+		contentType string // Content-Type header
+		wantBar     string // "" if the request must be rejected
+		wantErr     string
+	}{
+		"1.2 with action": {
+			register: func(s *Server) {
+				s.RegisterHandler("/pathTo", "urn:foo#Do", "fooRequest", factory, handler("do"), ActionOptional())
+			},
+			soap12:      true,
+			contentType: `application/soap+xml; charset=utf-8; action="urn:foo#Do"`,
+			wantBar:     "do",
+		},
+		"1.2 without action": {
+			register: func(s *Server) {
+				s.RegisterHandler("/pathTo", "urn:foo#Do", "fooRequest", factory, handler("do"), ActionOptional())
+			},
+			soap12:      true,
+			contentType: `application/soap+xml; charset=utf-8`,
+			wantBar:     "do",
+		},
+		"1.2 with another action": {
+			register: func(s *Server) {
+				s.RegisterHandler("/pathTo", "urn:foo#Do", "fooRequest", factory, handler("do"), ActionOptional())
+			},
+			soap12:      true,
+			contentType: `application/soap+xml; charset=utf-8; action="urn:foo#Other"`,
+			wantErr:     `unknown action &#34;urn:foo#Other&#34;`,
+		},
+		"1.2 without action, action required": {
+			register:    func(s *Server) { s.RegisterHandler("/pathTo", "urn:foo#Do", "fooRequest", factory, handler("do")) },
+			soap12:      true,
+			contentType: `application/soap+xml; charset=utf-8`,
+			wantErr:     `unknown action &#34;&#34;`,
+		},
+		"1.1 empty quoted SOAPAction": {
+			register: func(s *Server) {
+				s.RegisterHandler("/pathTo", "foo", "fooRequest", factory, handler("foo"), ActionOptional())
+			},
+			soapAction:  `""`,
+			contentType: `text/xml; charset=utf-8`,
+			wantBar:     "foo",
+		},
+		"1.1 handler of the empty action": {
+			register: func(s *Server) {
+				s.RegisterHandler("/pathTo", "", "fooRequest", factory, handler("any"), ActionOptional())
+			},
+			soapAction:  "whatever",
+			contentType: `text/xml; charset=utf-8`,
+			wantBar:     "any",
+		},
+		"1.1 exact action first": {
+			register: func(s *Server) {
+				s.RegisterHandler("/pathTo", "", "fooRequest", factory, handler("any"), ActionOptional())
+				s.RegisterHandler("/pathTo", "foo", "fooRequest", factory, handler("foo"))
+			},
+			soapAction:  "foo",
+			contentType: `text/xml; charset=utf-8`,
+			wantBar:     "foo",
+		},
+		"1.1 ambiguous": {
+			register: func(s *Server) {
+				s.RegisterHandler("/pathTo", "foo", "fooRequest", factory, handler("foo"), ActionOptional())
+				s.RegisterHandler("/pathTo", "bar", "fooRequest", factory, handler("bar"), ActionOptional())
+			},
+			contentType: `text/xml; charset=utf-8`,
+			wantErr:     `request without action for content type &#34;fooRequest&#34; is ambiguous, handled by actions &#34;bar&#34;, &#34;foo&#34;`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			soapSrv := NewServer()
+			body := envelope11
+			if tc.soap12 {
+				soapSrv.UseSoap12()
+				body = envelope12
+			}
+			tc.register(soapSrv)
+
+			r := httptest.NewRequest(http.MethodPost, "/pathTo", strings.NewReader(body))
+			r.Header.Set("Content-Type", tc.contentType)
+			if tc.soapAction != "" {
+				r.Header.Set("SOAPAction", tc.soapAction)
+			}
+			w := httptest.NewRecorder()
+			soapSrv.ServeHTTP(w, r)
+
+			if tc.wantErr != "" {
+				assert.Contains(t, w.Body.String(), tc.wantErr)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			assert.Contains(t, w.Body.String(), "<Bar>"+tc.wantBar+"</Bar>")
+		})
+	}
+}
+
+func TestClient_Call_actionNormalization(t *testing.T) {
+	for _, tc := range []struct {
+		name, action string
+		quote        bool
+		want         string // SOAPAction header
+		wantErr      string // "" if the call must be made
+	}{
+		{name: "plain", action: "urn:foo", want: "urn:foo"},
+		{name: "trailing newline from a config file", action: "urn:foo\n", want: "urn:foo"},
+		{name: "CRLF", action: "urn:foo\r\n", want: "urn:foo"},
+		{name: "surrounding blanks", action: " \turn:foo ", want: "urn:foo"},
+		{name: "no-break space pasted from a wiki", action: "\u00a0urn:foo", want: "urn:foo"},
+		{name: "quoted", action: `"urn:foo"`, want: "urn:foo"},
+		{name: "quoted, QuoteSOAPAction", action: `"urn:foo"`, quote: true, want: `"urn:foo"`},
+		{name: "blanks in quotes", action: `" urn:foo "`, want: "urn:foo"},
+		{name: "QuoteSOAPAction", action: " urn:foo\n", quote: true, want: `"urn:foo"`},
+		{name: "empty", action: "", want: ""},
+		{name: "header injection", action: "urn:foo\r\nX-Admin: 1", wantErr: `invalid SOAPAction "urn:foo\r\nX-Admin: 1": control character U+000D at 7`},
+		{name: "unbalanced", action: `"urn:foo`, wantErr: `invalid SOAPAction "\"urn:foo": unbalanced quotes`},
+		{name: "embedded tab", action: "urn:\tfoo", wantErr: `control character U+0009 at 4`},
+		{name: "NUL", action: "urn:foo\x00", wantErr: `control character U+0000 at 7`},
+		{name: "DEL", action: "urn:foo\x7f", wantErr: `control character U+007F at 7`},
+		{name: "zero-width space", action: "urn:foo\u200b", wantErr: `non-ASCII character U+200B at 7, percent-encode it`},
+		{name: "umlaut", action: "urn:bestellung#lösche", wantErr: `non-ASCII character U+00F6 at 16`},
+		{name: "closing quote only", action: `urn:foo"`, wantErr: `unbalanced quotes`},
+		{name: "single quote", action: `"`, wantErr: `unbalanced quotes`},
+		{name: "quote inside", action: `urn:"foo"`, wantErr: `unbalanced quotes`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var sent *http.Request
+			c := NewClient("http://localhorst.ch", nil)
+			c.QuoteSOAPAction = tc.quote
+			c.HTTPClientDoFn = func(req *http.Request) (*http.Response, error) {
+				sent = req
+				return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+			}
+
+			_, err := c.Call(context.Background(), tc.action, &FooRequest{}, nil)
+			if tc.wantErr != "" {
+				var ae *ActionError
+				require.True(t, errors.As(err, &ae), "%v", err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				assert.Equal(t, tc.action, ae.Action)
+				assert.Equal(t, ErrorKindProtocol, KindOf(err))
+				assert.Nil(t, sent, "nothing is sent")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, sent.Header.Get("SOAPAction"))
+		})
+	}
+
+	c := NewClient("http://localhorst.ch", nil)
+	c.UseSoap12()
+	plan, err := c.Explain(" urn:foo\n", &FooRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, `application/soap+xml; charset="utf-8"; action="urn:foo"`, plan.ContentType)
+	_, err = c.Explain("urn:foo\nbar", &FooRequest{})
+	assert.Error(t, err)
+}
+
+func TestServer_actionNormalization(t *testing.T) {
+	var raw string
+	soapSrv := NewServer()
+	soapSrv.RegisterHandler("/pathTo", "urn:foo", "fooRequest",
+		func() interface{} { return &FooRequest{} },
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			raw = RawSOAPAction(httpRequest.Context())
+			return &FooResponse{Bar: "foo"}, nil
+		},
+	)
+	const envelope = `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><fooRequest><Foo>foo</Foo></fooRequest></Body></Envelope>`
+
+	for _, action := range []string{"urn:foo", `"urn:foo"`, ` "urn:foo" `, `" urn:foo"`, "urn:foo ", "\turn:foo"} {
+		r := httptest.NewRequest(http.MethodPost, "/pathTo", strings.NewReader(envelope))
+		r.Header.Set("Content-Type", "text/xml; charset=utf-8")
+		r.Header.Set("SOAPAction", action)
+		w := httptest.NewRecorder()
+		soapSrv.ServeHTTP(w, r)
+		assert.Contains(t, w.Body.String(), "<Bar>foo</Bar>", "%q", action)
+		assert.Equal(t, action, raw)
+	}
+
+	report, err := soapSrv.DryRun(context.Background(), func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/pathTo", strings.NewReader(envelope))
+		r.Header.Set("SOAPAction", ` "urn:foo"`)
+		return r
+	}())
+	require.NoError(t, err)
+	assert.Equal(t, "urn:foo", report.Action)
+	assert.Empty(t, RawSOAPAction(context.Background()))
+}
+
+func TestServer_RegisterHandler_quotedAction(t *testing.T) {
+	soapSrv := NewServer()
+	soapSrv.RegisterHandler("/pathTo", `"urn:foo"`, "fooRequest",
+		func() interface{} { return &FooRequest{} },
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			return &FooResponse{Bar: "foo"}, nil
+		},
+	)
+	soapSrv.Alias("/pathTo", `"urn:old"`, "fooRequest", `"urn:foo"`)
+	const envelope = `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><fooRequest><Foo>foo</Foo></fooRequest></Body></Envelope>`
+
+	for _, action := range []string{"urn:foo", `"urn:foo"`, "urn:old", `"urn:old"`} {
+		r := httptest.NewRequest(http.MethodPost, "/pathTo", strings.NewReader(envelope))
+		r.Header.Set("Content-Type", "text/xml; charset=utf-8")
+		r.Header.Set("SOAPAction", action)
+		w := httptest.NewRecorder()
+		soapSrv.ServeHTTP(w, r)
+		assert.Contains(t, w.Body.String(), "<Bar>foo</Bar>", "%q", action)
+	}
+}
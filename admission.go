@@ -0,0 +1,40 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrAdmissionRejected matches, using errors.Is, every AdmissionError.
+var ErrAdmissionRejected = errors.New("call rejected by admission")
+
+// AdmissionError is returned by Client calls rejected by Client.Admission.
+type AdmissionError struct {
+	Action string
+	Err    error // as returned by Client.Admission
+}
+
+func (ae *AdmissionError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", ErrAdmissionRejected, ae.Action, ae.Err)
+}
+
+func (ae *AdmissionError) Unwrap() error {
+	return ae.Err
+}
+
+// Is reports whether target is ErrAdmissionRejected.
+func (ae *AdmissionError) Is(target error) bool {
+	return target == ErrAdmissionRejected
+}
+
+// admit runs Client.Admission once per call, before any work is done.
+func (c *Client) admit(ctx context.Context, action string) error {
+	if c.Admission == nil {
+		return nil
+	}
+	if err := c.Admission(ctx, action, c.InFlight()); err != nil {
+		return &AdmissionError{Action: action, Err: err}
+	}
+	return nil
+}
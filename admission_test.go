@@ -0,0 +1,105 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Admission(t *testing.T) {
+	errShed := errors.New("shedding load")
+
+	t.Run("rejected", func(t *testing.T) {
+		var requests int
+		c := NewClient("http://localhorst.ch", nil)
+		c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+			requests++
+			return nil, errors.New("unexpected request")
+		})}).Do
+		c.Admission = func(ctx context.Context, action string, inFlight int) error {
+			assert.Equal(t, "MySOAPAction", action)
+			return errShed
+		}
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+		assert.True(t, errors.Is(err, ErrAdmissionRejected))
+		assert.True(t, errors.Is(err, errShed))
+		var ae *AdmissionError
+		require.True(t, errors.As(err, &ae))
+		assert.Equal(t, "MySOAPAction", ae.Action)
+
+		_, err = c.CallExtract(context.Background(), "MySOAPAction", &FooRequest{}, map[string]interface{}{})
+		assert.True(t, errors.Is(err, ErrAdmissionRejected))
+		assert.Zero(t, requests)
+	})
+
+	t.Run("once per call", func(t *testing.T) {
+		var admissions, attempts int
+		c := NewClient("http://localhorst.ch", nil)
+		c.Clock = &sleepRecorder{}
+		c.RetryPolicy = &RetryPolicy{MaxAttempts: 3}
+		c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+			attempts++
+			return nil, syscall.ECONNREFUSED
+		})}).Do
+		c.Admission = func(ctx context.Context, action string, inFlight int) error {
+			admissions++
+			return nil
+		}
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+		assert.Error(t, err)
+		assert.False(t, errors.Is(err, ErrAdmissionRejected))
+		assert.Equal(t, 3, attempts)
+		assert.Equal(t, 1, admissions)
+	})
+
+	t.Run("with MaxInFlight", func(t *testing.T) {
+		var (
+			started = make(chan struct{})
+			unblock = make(chan struct{})
+		)
+		c := NewClient("http://localhorst.ch", nil)
+		c.MaxInFlight = 1
+		c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+			close(started)
+			<-unblock
+			return &http.Response{
+				StatusCode: 200,
+				Body: ioutil.NopCloser(strings.NewReader(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+<Body><FooResponse><Bar>ok</Bar></FooResponse></Body></Envelope>`)),
+			}, nil
+		})}).Do
+		c.Admission = func(ctx context.Context, action string, inFlight int) error {
+			if inFlight >= c.MaxInFlight {
+				return errShed
+			}
+			return nil
+		}
+
+		done := make(chan error)
+		go func() {
+			_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+			done <- err
+		}()
+		<-started
+		assert.Equal(t, 1, c.InFlight())
+
+		// shed instead of queueing for the slot
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err := c.Call(ctx, "MySOAPAction", &FooRequest{}, &FooResponse{})
+		assert.True(t, errors.Is(err, ErrAdmissionRejected))
+		assert.NoError(t, ctx.Err(), "didn't wait for a slot")
+
+		close(unblock)
+		assert.NoError(t, <-done)
+		assert.Equal(t, 0, c.InFlight())
+	})
+}
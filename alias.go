@@ -0,0 +1,137 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+)
+
+// operationAlias routes requests of a deprecated operation to the handler of
+// its successor.
+type operationAlias struct {
+	action      string // the action of the handler requests are routed to
+	requestTag  string // optional, the request element name of that handler
+	responseTag string // optional, the response element name old clients expect
+}
+
+// AliasOption configures an alias, see Server.Alias.
+type AliasOption func(*operationAlias)
+
+// AliasRequestTag renames the request element to newTag before it is
+// unmarshalled, so the request reaches the handler registered for newTag.
+func AliasRequestTag(newTag string) AliasOption {
+	return func(a *operationAlias) {
+		a.requestTag = newTag
+	}
+}
+
+// AliasResponseTag renames the response element to oldTag after it has been
+// marshalled, so old clients find the element they expect.
+func AliasResponseTag(oldTag string) AliasOption {
+	return func(a *operationAlias) {
+		a.responseTag = oldTag
+	}
+}
+
+// Alias routes requests for the deprecated oldAction with the request element
+// oldTag to the handler registered for newAction at path. Without
+// AliasRequestTag the handler registered for oldTag is used. Requests using an
+// alias are logged with "deprecated_alias" to track remaining usage. Handlers
+// registered for oldAction and oldTag take precedence over an alias. Quotes
+// around actions are dropped, see RegisterHandler. This function must not be
+// called after the server has been started.
+func (s *Server) Alias(path, oldAction, oldTag, newAction string, opts ...AliasOption) {
+	oldAction, newAction = trimAction(oldAction), trimAction(newAction)
+	if s.aliases == nil {
+		s.aliases = make(map[string]map[string]map[string]*operationAlias)
+	}
+	if _, ok := s.aliases[path]; !ok {
+		s.aliases[path] = make(map[string]map[string]*operationAlias)
+	}
+	if _, ok := s.aliases[path][oldAction]; !ok {
+		s.aliases[path][oldAction] = make(map[string]*operationAlias)
+	}
+	alias := &operationAlias{action: newAction}
+	for _, opt := range opts {
+		opt(alias)
+	}
+	s.aliases[path][oldAction][oldTag] = alias
+}
+
+// RemoveAlias removes an alias added by Alias, handler registrations are left
+// untouched. This function must not be called after the server has been
+// started.
+func (s *Server) RemoveAlias(path, oldAction, oldTag string) {
+	oldAction = trimAction(oldAction)
+	delete(s.aliases[path][oldAction], oldTag)
+	if len(s.aliases[path][oldAction]) == 0 {
+		delete(s.aliases[path], oldAction)
+	}
+	if len(s.aliases[path]) == 0 {
+		delete(s.aliases, path)
+	}
+}
+
+// aliasedHandler returns the handler alias routes requests with the request
+// element tag to.
+func (s *Server) aliasedHandler(path, tag string, alias *operationAlias) (*operationHandler, bool) {
+	if alias.requestTag != "" {
+		tag = alias.requestTag
+	}
+	actionHandler, ok := s.handlers[path][alias.action][tag]
+	return actionHandler, ok
+}
+
+// renameBodyElement renames the first element inside the Body of envelope to
+// name keeping its prefix. The envelope is returned unchanged if it has no
+// Body content.
+func renameBodyElement(envelope []byte, name string) []byte {
+	d := xml.NewDecoder(bytes.NewReader(envelope))
+	var (
+		depth  int
+		inBody bool
+		start  int64
+	)
+	for {
+		offset := d.InputOffset()
+		token, err := d.RawToken()
+		if err != nil {
+			return envelope
+		}
+		switch tt := token.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case depth == 2 && tt.Name.Local == "Body":
+				inBody = true
+			case depth == 3 && inBody:
+				start = offset
+			}
+		case xml.EndElement:
+			if depth == 3 && inBody {
+				return replaceElementName(envelope, start, offset, tt.Name, name)
+			}
+			if depth == 2 {
+				inBody = false
+			}
+			depth--
+		}
+	}
+}
+
+// replaceElementName replaces the name of the element with the start tag at
+// start and the end tag at end, which is the end of the start tag for empty
+// elements.
+func replaceElementName(envelope []byte, start, end int64, old xml.Name, local string) []byte {
+	oldName := rawName(old)
+	newName := rawName(xml.Name{Space: old.Space, Local: local})
+
+	out := make([]byte, 0, len(envelope)+2*(len(newName)-len(oldName)))
+	out = append(out, envelope[:start+1]...)
+	out = append(out, newName...)
+	out = append(out, envelope[start+1+int64(len(oldName)):end]...)
+	if bytes.HasPrefix(envelope[end:], []byte("</"+oldName)) {
+		out = append(out, "</"+newName...)
+		end += int64(len("</" + oldName))
+	}
+	return append(out, envelope[end:]...)
+}
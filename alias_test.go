@@ -0,0 +1,112 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Alias(t *testing.T) {
+	type fetchFooRequest struct {
+		XMLName xml.Name `xml:"http://tempuri.org/ fetchFooRequest"`
+		Foo     string   `xml:"http://tempuri.org/ Foo"`
+	}
+	type fetchFooResponse struct {
+		XMLName xml.Name `xml:"http://tempuri.org/ fetchFooResponse"`
+		Bar     string   `xml:"http://tempuri.org/ Bar"`
+	}
+	type getFooRequest struct {
+		XMLName xml.Name `xml:"http://tempuri.org/ getFooRequest"`
+		Foo     string   `xml:"http://tempuri.org/ Foo"`
+	}
+	type getFooResponse struct {
+		XMLName xml.Name `xml:"http://tempuri.org/ getFooResponse"`
+		Bar     string   `xml:"http://tempuri.org/ Bar"`
+	}
+
+	var logged []string
+	soapSrv := NewServer()
+	soapSrv.Log = func(args ...interface{}) {
+		logged = append(logged, fmt.Sprint(args...))
+	}
+	soapSrv.RegisterHandler("/foo", "fetchFoo", "fetchFooRequest",
+		func() interface{} {
+			return &fetchFooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			return &fetchFooResponse{Bar: "Hello " + request.(*fetchFooRequest).Foo}, nil
+		},
+	)
+	soapSrv.Alias("/foo", "getFoo", "getFooRequest", "fetchFoo",
+		AliasRequestTag("fetchFooRequest"),
+		AliasResponseTag("getFooResponse"),
+	)
+
+	c := NewClient("http://in-process/foo", nil)
+	c.HTTPClientDoFn = NewLoopback(soapSrv)
+
+	t.Run("primary", func(t *testing.T) {
+		logged = nil
+		response := &fetchFooResponse{}
+		_, err := c.Call(context.Background(), "fetchFoo", &fetchFooRequest{Foo: "new"}, response)
+		require.NoError(t, err)
+		assert.Exactly(t, "Hello new", response.Bar)
+		assert.NotContains(t, fmt.Sprint(logged), "deprecated_alias")
+	})
+
+	t.Run("alias", func(t *testing.T) {
+		logged = nil
+		response := &getFooResponse{}
+		_, err := c.Call(context.Background(), "getFoo", &getFooRequest{Foo: "old"}, response)
+		require.NoError(t, err)
+		assert.Exactly(t, "Hello old", response.Bar)
+		assert.Contains(t, fmt.Sprint(logged), "deprecated_alias")
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		soapSrv.RemoveAlias("/foo", "getFoo", "getFooRequest")
+		_, err := c.Call(context.Background(), "getFoo", &getFooRequest{Foo: "old"}, &getFooResponse{})
+		var fe *FaultError
+		require.ErrorAs(t, err, &fe)
+		assert.Exactly(t, `unknown action "getFoo"`, fe.Fault.String)
+
+		response := &fetchFooResponse{}
+		_, err = c.Call(context.Background(), "fetchFoo", &fetchFooRequest{Foo: "new"}, response)
+		require.NoError(t, err)
+		assert.Exactly(t, "Hello new", response.Bar)
+	})
+}
+
+func TestRenameBodyElement(t *testing.T) {
+	tests := []struct {
+		name     string
+		envelope string
+		want     string
+	}{
+		{
+			name:     "prefixed",
+			envelope: `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Header><t:old xmlns:t="urn:t"/></s:Header><s:Body><t:old xmlns:t="urn:t"><t:old/></t:old></s:Body></s:Envelope>`,
+			want:     `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Header><t:old xmlns:t="urn:t"/></s:Header><s:Body><t:new xmlns:t="urn:t"><t:old/></t:new></s:Body></s:Envelope>`,
+		},
+		{
+			name:     "empty element",
+			envelope: `<Envelope><Body><old a="1"/></Body></Envelope>`,
+			want:     `<Envelope><Body><new a="1"/></Body></Envelope>`,
+		},
+		{
+			name:     "empty body",
+			envelope: `<Envelope><Body></Body></Envelope>`,
+			want:     `<Envelope><Body></Body></Envelope>`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Exactly(t, test.want, string(renameBodyElement([]byte(test.envelope), "new")))
+		})
+	}
+}
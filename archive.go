@@ -0,0 +1,92 @@
+package soap
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+)
+
+// MessageDirection tells whether a MessageRecord is of a request or a
+// response.
+type MessageDirection string
+
+// Directions of MessageRecords
+const (
+	MessageRequest  MessageDirection = "request"
+	MessageResponse MessageDirection = "response"
+)
+
+// MessageRecord is a message a Client has sent or received, see Archiver.
+type MessageRecord struct {
+	Time      time.Time
+	Direction MessageDirection
+	// ID is shared by the request and the response of an attempt.
+	ID       string
+	Endpoint string
+	Action   string
+	// StatusCode is the HTTP status of responses, 0 for requests.
+	StatusCode  int
+	ContentType string
+	// Body is the HTTP body as sent or received, owned by the Archiver.
+	Body []byte
+}
+
+// Archiver persists the messages of a Client, e.g. for compliance. Archive is
+// called on the calling goroutine, so it must not block.
+type Archiver interface {
+	Archive(record MessageRecord)
+}
+
+// archiveRequest archives req with body and returns the ID of the attempt, ""
+// if there is no Archiver.
+func (c *Client) archiveRequest(req *http.Request, action string, body []byte) string {
+	if c.Archiver == nil {
+		return ""
+	}
+	id := c.newID(IDArchive)
+	c.Archiver.Archive(MessageRecord{
+		Time:        clockOrDefault(c.Clock).Now(),
+		Direction:   MessageRequest,
+		ID:          id,
+		Endpoint:    c.maskURL(req.URL),
+		Action:      action,
+		ContentType: req.Header.Get("Content-Type"),
+		Body:        append([]byte(nil), body...),
+	})
+	return id
+}
+
+// archiveResponse makes the body of resp recorded while it's read and returns
+// the function archiving it, to be called once the body has been read.
+func (c *Client) archiveResponse(id string, req *http.Request, action string, resp *http.Response) func() {
+	if id == "" {
+		return func() {}
+	}
+	recorder := &recordingBody{ReadCloser: resp.Body}
+	resp.Body = recorder
+	return func() {
+		c.Archiver.Archive(MessageRecord{
+			Time:        clockOrDefault(c.Clock).Now(),
+			Direction:   MessageResponse,
+			ID:          id,
+			Endpoint:    c.maskURL(req.URL),
+			Action:      action,
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			Body:        recorder.buf.Bytes(),
+		})
+	}
+}
+
+// recordingBody keeps a copy of what has been read.
+type recordingBody struct {
+	io.ReadCloser
+	buf bytes.Buffer
+}
+
+func (rb *recordingBody) Read(p []byte) (int, error) {
+	n, err := rb.ReadCloser.Read(p)
+	rb.buf.Write(p[:n])
+	return n, err
+}
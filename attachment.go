@@ -0,0 +1,91 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// Attachment is a MIME part of a multipart/related SOAP message, besides the
+// envelope.
+type Attachment struct {
+	ContentID        string // without angle brackets
+	ContentType      string
+	TransferEncoding string // the Content-Transfer-Encoding, the Body is encoded with it
+	Body             io.Reader
+}
+
+// AttachmentReader yields the attachments of a message one by one, so they
+// can be streamed: the Body of an attachment must be read before the next one
+// is requested. The attachments of a request received by the Server, see
+// RequestAttachments, can be forwarded as they are with WithAttachments.
+type AttachmentReader struct {
+	next func() (*Attachment, error)
+	used bool
+}
+
+// NewAttachmentReader returns an AttachmentReader yielding attachments.
+func NewAttachmentReader(attachments ...*Attachment) *AttachmentReader {
+	return &AttachmentReader{next: func() (*Attachment, error) {
+		if len(attachments) == 0 {
+			return nil, io.EOF
+		}
+		a := attachments[0]
+		attachments = attachments[1:]
+		return a, nil
+	}}
+}
+
+// Next returns the next attachment, io.EOF after the last one.
+func (ar *AttachmentReader) Next() (*Attachment, error) {
+	ar.used = true
+	return ar.next()
+}
+
+type requestAttachmentsKey struct{}
+
+// RequestAttachments returns the attachments of the multipart/related SOAP
+// request the Server dispatches, nil for single part requests. Use it with the
+// context of the *http.Request passed to an OperationHandlerFunc. The
+// attachments are read from the live request body, Server.MaxRequestBytes
+// applies to them as well.
+func RequestAttachments(ctx context.Context) *AttachmentReader {
+	attachments, _ := ctx.Value(requestAttachmentsKey{}).(*AttachmentReader)
+	return attachments
+}
+
+// withRequestAttachments returns r with attachments in its context, see
+// RequestAttachments.
+func withRequestAttachments(r *http.Request, attachments *AttachmentReader) *http.Request {
+	if attachments == nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), requestAttachmentsKey{}, attachments))
+}
+
+var errAttachmentsSent = errors.New("attachments have already been sent, they can't be sent again")
+
+// attach turns req into a multipart/related request with the envelope xmlBytes
+// as root part, followed by attachments. The parts are streamed, attachments
+// can't be sent again, e.g. by retries.
+func (c *Client) attach(req *http.Request, xmlBytes []byte, attachments *AttachmentReader) error {
+	if attachments.used {
+		return protocolError(errAttachmentsSent)
+	}
+	rootType := req.Header.Get("Content-Type")
+	opts := MultipartOptions{
+		EnvelopeContentType: rootType,
+		Boundary:            c.newID(IDBoundary),
+	}
+	req.Header.Set("Content-Type", opts.contentType())
+	pr, pw := io.Pipe()
+	req.Body = pr
+	req.GetBody = nil
+	req.ContentLength = -1
+	go func() {
+		// The transport closes the body, if it stops sending early.
+		pw.CloseWithError(writeMultipartRelated(pw, xmlBytes, attachments, opts))
+	}()
+	return nil
+}
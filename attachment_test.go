@@ -0,0 +1,159 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// patternReader yields a repeating byte pattern, a synthetic attachment.
+type patternReader struct{ n int }
+
+func (pr *patternReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(pr.n % 251)
+		pr.n++
+	}
+	return len(p), nil
+}
+
+// heapCeiling samples the heap until stop is called, which returns the peak
+// growth over the heap at the start.
+func heapCeiling() (stop func() uint64) {
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	base, peak := ms.HeapAlloc, ms.HeapAlloc
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+			}
+			runtime.ReadMemStats(&ms)
+			if ms.HeapAlloc > peak {
+				peak = ms.HeapAlloc
+			}
+		}
+	}()
+	return func() uint64 {
+		close(done)
+		wg.Wait()
+		return peak - base
+	}
+}
+
+func TestAttachments_gateway(t *testing.T) {
+	if testing.Short() {
+		t.Skip("moves a large attachment")
+	}
+	const size = 64 << 20
+	want := sha256.New()
+	_, err := io.Copy(want, io.LimitReader(&patternReader{}, size))
+	require.NoError(t, err)
+
+	type received struct {
+		attachment Attachment
+		size       int64
+		sum        []byte
+	}
+	var got []received
+	backend := NewServer()
+	backend.RegisterHandler("/backend", "foo", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			attachments := RequestAttachments(httpRequest.Context())
+			for attachments != nil {
+				a, err := attachments.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return nil, err
+				}
+				h := sha256.New()
+				n, err := io.Copy(h, a.Body)
+				if err != nil {
+					return nil, err
+				}
+				got = append(got, received{attachment: Attachment{ContentID: a.ContentID, ContentType: a.ContentType, TransferEncoding: a.TransferEncoding}, size: n, sum: h.Sum(nil)})
+			}
+			return &FooResponse{Bar: request.(*FooRequest).Foo}, nil
+		},
+	)
+	backendSrv := httptest.NewServer(backend)
+	defer backendSrv.Close()
+
+	gateway := NewServer()
+	gateway.RegisterHandler("/gateway", "foo", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			c := NewClient(backendSrv.URL+"/backend", nil)
+			response := &FooResponse{}
+			_, err := c.Call(httpRequest.Context(), "foo", request, response,
+				WithAttachments(RequestAttachments(httpRequest.Context())))
+			return response, err
+		},
+	)
+	gatewaySrv := httptest.NewServer(gateway)
+	defer gatewaySrv.Close()
+
+	c := NewClient(gatewaySrv.URL+"/gateway", nil)
+	response := &FooResponse{}
+	stop := heapCeiling()
+	_, err = c.Call(context.Background(), "foo", &FooRequest{Foo: "forwarded"}, response, WithAttachments(NewAttachmentReader(
+		&Attachment{ContentID: "scan@example.com", ContentType: "application/octet-stream", TransferEncoding: "binary", Body: io.LimitReader(&patternReader{}, size)},
+		&Attachment{ContentID: "note@example.com", ContentType: "text/plain; charset=utf-8", TransferEncoding: "quoted-printable", Body: strings.NewReader("caf=C3=A9")},
+	)))
+	growth := stop()
+	require.NoError(t, err)
+	assert.Equal(t, "forwarded", response.Bar)
+	assert.Less(t, growth, uint64(size/4), "the attachment has been buffered")
+
+	require.Len(t, got, 2)
+	assert.Equal(t, Attachment{ContentID: "scan@example.com", ContentType: "application/octet-stream", TransferEncoding: "binary"}, got[0].attachment)
+	assert.Equal(t, int64(size), got[0].size)
+	assert.Equal(t, want.Sum(nil), got[0].sum)
+	assert.Equal(t, Attachment{ContentID: "note@example.com", ContentType: "text/plain; charset=utf-8", TransferEncoding: "quoted-printable"}, got[1].attachment)
+	sum := sha256.Sum256([]byte("caf=C3=A9"))
+	assert.Equal(t, sum[:], got[1].sum, "encoded bodies are forwarded as they are")
+}
+
+func TestAttachments_notResent(t *testing.T) {
+	attempts := 0
+	c := NewClient("http://localhorst.ch", nil)
+	c.HTTPClientDoFn = func(req *http.Request) (*http.Response, error) {
+		attempts++
+		assert.True(t, strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/related;"), req.Header.Get("Content-Type"))
+		_, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		return nil, errors.New("connection reset")
+	}
+	attachments := NewAttachmentReader(&Attachment{ContentID: "a", Body: bytes.NewReader([]byte("a"))})
+	_, err := c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{}, WithAttachments(attachments),
+		WithRetryPolicy(&RetryPolicy{MaxAttempts: 3}))
+	assert.True(t, errors.Is(err, errAttachmentsSent), "%v", err)
+	assert.Equal(t, 1, attempts)
+}
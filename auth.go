@@ -0,0 +1,181 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthError is returned by Client calls for HTTP 401 Unauthorized and 403
+// Forbidden responses, the body of which isn't decoded. Use errors.As to
+// retrieve it. It is not retried by DefaultRetryable, but if the Client has an
+// OnAuthError hook, a CredentialsFn or a TokenSource, the call is retried once
+// with refreshed credentials.
+type AuthError struct {
+	StatusCode int
+	// Challenge holds the WWW-Authenticate headers of the response, multiple
+	// headers are joined by ", ".
+	Challenge string
+
+	response *http.Response // for Client.OnAuthError
+}
+
+func (ae *AuthError) Error() string {
+	msg := fmt.Sprintf("authentication failed: %d %s", ae.StatusCode, http.StatusText(ae.StatusCode))
+	if ae.Challenge != "" {
+		msg += ", challenge: " + ae.Challenge
+	}
+	return msg
+}
+
+// Scheme returns the authentication scheme of the first challenge, e.g.
+// "Basic", "Bearer" or "Digest", or "" if there is no challenge.
+func (ae *AuthError) Scheme() string {
+	if i := strings.IndexAny(ae.Challenge, " ,"); i >= 0 {
+		return ae.Challenge[:i]
+	}
+	return ae.Challenge
+}
+
+// authError returns an *AuthError for 401 and 403 responses, nil otherwise.
+func authError(resp *http.Response) error {
+	if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return nil
+	}
+	return &AuthError{
+		StatusCode: resp.StatusCode,
+		Challenge:  strings.Join(resp.Header.Values("WWW-Authenticate"), ", "),
+		response:   resp,
+	}
+}
+
+// Token is an OAuth2 access token, see TokenSource.
+type Token struct {
+	AccessToken string
+	// Expiry is when the token expires, zero if it's used until the server
+	// rejects it.
+	Expiry time.Time
+}
+
+// TokenSource provides the bearer tokens of Client.TokenSource, e.g. of an
+// OAuth2 client credentials grant. Adapt a golang.org/x/oauth2.TokenSource
+// with a TokenFunc:
+//
+//	soap.TokenFunc(func(ctx context.Context) (string, error) {
+//		t, err := ts.Token()
+//		if err != nil {
+//			return "", err
+//		}
+//		return t.AccessToken, nil
+//	})
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenFunc is a TokenSource of tokens without expiry.
+type TokenFunc func(ctx context.Context) (string, error)
+
+// Token implements TokenSource.
+func (f TokenFunc) Token(ctx context.Context) (*Token, error) {
+	accessToken, err := f(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Token{AccessToken: accessToken}, nil
+}
+
+// tokenExpiryDelta is how long before its expiry a token is refreshed, so it
+// doesn't expire on the way.
+const tokenExpiryDelta = 10 * time.Second
+
+// credentialsCache caches the credentials of Client.CredentialsFn and the
+// token of Client.TokenSource. It is kept behind a pointer, so the Client can
+// still be copied.
+type credentialsCache struct {
+	mu    sync.Mutex
+	creds *BasicAuth
+	token *Token
+}
+
+// credentials returns the basic auth credentials for a request, the cached
+// ones of CredentialsFn if it is set.
+func (c *Client) credentials(ctx context.Context) (*BasicAuth, error) {
+	if c.CredentialsFn == nil {
+		return c.auth, nil
+	}
+	if c.creds == nil {
+		return c.fetchCredentials(ctx)
+	}
+	c.creds.mu.Lock()
+	defer c.creds.mu.Unlock()
+	if c.creds.creds == nil {
+		creds, err := c.fetchCredentials(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.creds.creds = creds
+	}
+	return c.creds.creds, nil
+}
+
+func (c *Client) fetchCredentials(ctx context.Context) (*BasicAuth, error) {
+	creds, err := c.CredentialsFn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get credentials: %w", err)
+	}
+	return creds, nil
+}
+
+// bearerToken returns the access token for a request, the cached one of
+// TokenSource unless it is about to expire.
+func (c *Client) bearerToken(ctx context.Context) (string, error) {
+	if c.creds == nil {
+		token, err := c.fetchToken(ctx)
+		if err != nil {
+			return "", err
+		}
+		return token.AccessToken, nil
+	}
+	c.creds.mu.Lock()
+	defer c.creds.mu.Unlock()
+	token := c.creds.token
+	if token == nil || !token.Expiry.IsZero() && !clockOrDefault(c.Clock).Now().Add(tokenExpiryDelta).Before(token.Expiry) {
+		var err error
+		if token, err = c.fetchToken(ctx); err != nil {
+			return "", err
+		}
+		c.creds.token = token
+	}
+	return token.AccessToken, nil
+}
+
+func (c *Client) fetchToken(ctx context.Context) (*Token, error) {
+	token, err := c.TokenSource.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get token: %w", err)
+	}
+	if token == nil {
+		return nil, errors.New("could not get token: token source returned none")
+	}
+	return token, nil
+}
+
+// refreshCredentials drops the cached credentials of CredentialsFn and the
+// token of TokenSource and reports whether there is a CredentialsFn or
+// TokenSource to get fresh ones.
+func (c *Client) refreshCredentials() bool {
+	if c.CredentialsFn == nil && c.TokenSource == nil {
+		return false
+	}
+	if c.creds != nil {
+		c.creds.mu.Lock()
+		defer c.creds.mu.Unlock()
+		c.creds.creds = nil
+		c.creds.token = nil
+	}
+	return true
+}
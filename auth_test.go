@@ -0,0 +1,207 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Call_authError(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		challenges []string
+		wantScheme string
+		want       string
+	}{
+		{
+			name:       "basic",
+			statusCode: http.StatusUnauthorized,
+			challenges: []string{`Basic realm="SOAP", charset="UTF-8"`},
+			wantScheme: "Basic",
+			want:       `Basic realm="SOAP", charset="UTF-8"`,
+		},
+		{
+			name:       "bearer",
+			statusCode: http.StatusUnauthorized,
+			challenges: []string{`Bearer realm="example", error="invalid_token", error_description="The access token expired"`},
+			wantScheme: "Bearer",
+			want:       `Bearer realm="example", error="invalid_token", error_description="The access token expired"`,
+		},
+		{
+			name:       "digest and basic",
+			statusCode: http.StatusUnauthorized,
+			challenges: []string{`Digest realm="SOAP", qop="auth", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`, `Basic realm="SOAP"`},
+			wantScheme: "Digest",
+			want:       `Digest realm="SOAP", qop="auth", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41", Basic realm="SOAP"`,
+		},
+		{
+			name:       "forbidden",
+			statusCode: http.StatusForbidden,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int
+			c := NewClient("http://localhorst.ch", nil)
+			c.RetryPolicy = &RetryPolicy{MaxAttempts: 3}
+			c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+				attempts++
+				return &http.Response{
+					StatusCode: test.statusCode,
+					Header:     http.Header{"Www-Authenticate": test.challenges, "Content-Type": {"text/html"}},
+					Body:       ioutil.NopCloser(strings.NewReader(`<html><form action="/login"></form></html>`)),
+				}, nil
+			})}).Do
+
+			_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+			var ae *AuthError
+			require.ErrorAs(t, err, &ae)
+			assert.Exactly(t, test.statusCode, ae.StatusCode)
+			assert.Exactly(t, test.want, ae.Challenge)
+			assert.Exactly(t, test.wantScheme, ae.Scheme())
+			assert.Exactly(t, ErrorKindProtocol, KindOf(err))
+			assert.Exactly(t, 1, attempts, "not retried")
+		})
+	}
+}
+
+func TestClient_CredentialsFn(t *testing.T) {
+	var (
+		fetched  int
+		attempts int
+		valid    = "second"
+	)
+	c := NewClient("http://localhorst.ch", &BasicAuth{Login: "ignored"})
+	c.CredentialsFn = func(ctx context.Context) (*BasicAuth, error) {
+		fetched++
+		if fetched == 1 {
+			return &BasicAuth{Login: "jane", Password: "first"}, nil
+		}
+		return &BasicAuth{Login: "jane", Password: "second"}, nil
+	}
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		attempts++
+		if _, password, _ := r.BasicAuth(); password != valid {
+			return &http.Response{
+				StatusCode: http.StatusUnauthorized,
+				Header:     http.Header{"Www-Authenticate": {`Basic realm="SOAP"`}},
+				Body:       http.NoBody,
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body: ioutil.NopCloser(strings.NewReader(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body>
+<fooResponse><Bar>ok</Bar></fooResponse></Body></Envelope>`)),
+		}, nil
+	})}).Do
+
+	t.Run("refreshed once", func(t *testing.T) {
+		response := &FooResponse{}
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, response)
+		require.NoError(t, err)
+		assert.Exactly(t, "ok", response.Bar)
+		assert.Exactly(t, 2, fetched)
+		assert.Exactly(t, 2, attempts)
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+		require.NoError(t, err)
+		assert.Exactly(t, 2, fetched)
+		assert.Exactly(t, 3, attempts)
+	})
+
+	t.Run("still rejected", func(t *testing.T) {
+		valid = "never"
+		attempts = 0
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+		var ae *AuthError
+		require.ErrorAs(t, err, &ae)
+		assert.Exactly(t, 2, attempts)
+	})
+
+	t.Run("fetch fails", func(t *testing.T) {
+		c := NewClient("http://localhorst.ch", nil)
+		failed := errors.New("vault sealed")
+		c.CredentialsFn = func(ctx context.Context) (*BasicAuth, error) {
+			return nil, failed
+		}
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+		assert.ErrorIs(t, err, failed)
+	})
+}
+
+func TestClient_TokenSource(t *testing.T) {
+	var (
+		issued   int
+		attempts int
+		valid    = "token-2"
+		clock    = &sleepRecorder{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	)
+	c := NewClient("http://localhorst.ch", &BasicAuth{Login: "ignored"})
+	c.Clock = clock
+	c.TokenSource = tokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		issued++
+		return &Token{AccessToken: fmt.Sprintf("token-%d", issued), Expiry: clock.now.Add(time.Hour)}, nil
+	})
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		attempts++
+		if r.Header.Get("Authorization") != "Bearer "+valid {
+			return &http.Response{
+				StatusCode: http.StatusUnauthorized,
+				Header:     http.Header{"Www-Authenticate": {`Bearer error="invalid_token"`}},
+				Body:       http.NoBody,
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body: ioutil.NopCloser(strings.NewReader(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body>
+<fooResponse><Bar>ok</Bar></fooResponse></Body></Envelope>`)),
+		}, nil
+	})}).Do
+
+	t.Run("rejected token is refreshed once", func(t *testing.T) {
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+		require.NoError(t, err)
+		assert.Exactly(t, 2, issued)
+		assert.Exactly(t, 2, attempts)
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+		require.NoError(t, err)
+		assert.Exactly(t, 2, issued)
+	})
+
+	t.Run("refreshed before expiry", func(t *testing.T) {
+		clock.now = clock.now.Add(time.Hour - tokenExpiryDelta)
+		valid = "token-3"
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+		require.NoError(t, err)
+		assert.Exactly(t, 3, issued)
+	})
+
+	t.Run("TokenFunc", func(t *testing.T) {
+		c := NewClient("http://localhorst.ch", nil)
+		c.TokenSource = TokenFunc(func(ctx context.Context) (string, error) {
+			return "", errors.New("token endpoint down")
+		})
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+		assert.EqualError(t, err, "could not get token: token endpoint down")
+	})
+}
+
+type tokenSourceFunc func(ctx context.Context) (*Token, error)
+
+func (f tokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
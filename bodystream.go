@@ -0,0 +1,194 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// BodyStreamDecoder is implemented by requests which decode themselves from
+// the live request stream, e.g. to stream a large base64 blob to disk instead
+// of buffering the whole envelope. d is positioned right after start, the
+// element inside the SOAP Body. Register the handler with StreamBody.
+type BodyStreamDecoder interface {
+	DecodeSOAPBody(d *xml.Decoder, start xml.StartElement) error
+}
+
+// StreamBody lets the server decode requests for the handler while they are
+// read instead of buffering them. The request of the RequestFactoryFunc gets
+// the live decoder if it is a BodyStreamDecoder. Other requests which may be
+// routed to the handler's action, directly, by an alias or as ActionOptional
+// request, are streamed as well.
+func StreamBody() HandlerOption {
+	return func(h *operationHandler) {
+		h.streaming = true
+	}
+}
+
+// streams reports whether requests to path with action may be served by a
+// StreamBody handler.
+func (s *Server) streams(path, action string) bool {
+	for _, h := range s.handlers[path][action] {
+		if h.streaming {
+			return true
+		}
+	}
+	for element, alias := range s.aliases[path][action] {
+		if h, ok := s.aliasedHandler(path, element, alias); ok && h.streaming {
+			return true
+		}
+	}
+	for a, elements := range s.handlers[path] {
+		for _, h := range elements {
+			if h.streaming && h.actionOptional && (a == "" || action == "") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// headCapture keeps what is written to it until done, the beginning of a
+// streamed envelope holding its header blocks.
+type headCapture struct {
+	buf  bytes.Buffer
+	done bool
+}
+
+func (hc *headCapture) Write(p []byte) (int, error) {
+	if !hc.done {
+		hc.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+// decodeStream decodes the request envelope while it is read from body,
+// handing the live decoder to requests implementing BodyStreamDecoder.
+// Requests are routed like those of decodeMessage.
+func (s *Server) decodeStream(r *http.Request, body io.Reader) (*decodedRequest, PreDispatchReason, error) {
+	soapAction := requestAction(r)
+	if _, reason, err := s.checkAction(r.URL.Path, soapAction); err != nil {
+		return nil, reason, err
+	}
+	head := &headCapture{}
+	d := xml.NewDecoder(io.TeeReader(body, head))
+	var ns string // of the Envelope
+	depth := 0
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return nil, PreDispatchMalformedEnvelope, fmt.Errorf("could not find soap body content:: %s", err)
+		}
+		se, ok := token.(xml.StartElement)
+		if !ok {
+			if _, ok := token.(xml.EndElement); ok {
+				depth--
+			}
+			continue
+		}
+		depth++
+
+		switch {
+		case depth == 1 && se.Name.Local == "Envelope" && namespaceVersion(se.Name.Space) != "":
+			if reason, err := s.checkVersion(namespaceVersion(se.Name.Space)); err != nil {
+				return nil, reason, err
+			}
+			ns = se.Name.Space
+		case depth == 2 && se.Name == xml.Name{Space: ns, Local: "Header"}:
+			if err := d.Skip(); err != nil {
+				return nil, PreDispatchMalformedEnvelope, fmt.Errorf("could not read soap header:: %s", err)
+			}
+			depth--
+		case depth == 2 && se.Name == xml.Name{Space: ns, Local: "Body"}:
+			// The rest of the envelope isn't kept, the header blocks precede
+			// the Body.
+			head.done = true
+		case depth == 3:
+			return s.decodeStreamedBody(r, d, se, head.buf.Bytes(), namespaceVersion(ns))
+		default:
+			return nil, PreDispatchMalformedEnvelope, fmt.Errorf("unexpected element %q, expected soap envelope", se.Name.Local)
+		}
+	}
+}
+
+// decodeStreamedBody decodes the request of the Body element start from d,
+// head is the beginning of the envelope, up to the Body, of the SOAP version.
+func (s *Server) decodeStreamedBody(r *http.Request, d *xml.Decoder, start xml.StartElement, head []byte, version string) (*decodedRequest, PreDispatchReason, error) {
+	soapAction := requestAction(r)
+	// Header blocks are handed out as received, see RequestHeaders.
+	headers, _ := headerBlocks(head)
+	t := start.Name.Local
+	s.log("found content type", t)
+	actionHandler, alias, reason, err := s.handlerFor(r.URL.Path, soapAction, t)
+	if err != nil {
+		return nil, reason, err
+	}
+	renamed := start
+	if alias != nil {
+		s.log("deprecated_alias", "action:", soapAction, ", content type:", t, ", routed to action:", alias.action)
+		if alias.requestTag != "" {
+			renamed.Name.Local = alias.requestTag
+		}
+	}
+	request := actionHandler.requestFactory()
+	if sd, ok := request.(BodyStreamDecoder); ok {
+		err = sd.DecodeSOAPBody(d, start)
+	} else {
+		err = d.DecodeElement(request, &renamed)
+	}
+	if err != nil {
+		return nil, PreDispatchMalformedEnvelope, fmt.Errorf("could not unmarshal request:: %s", err)
+	}
+	if err := endEnvelope(d); err != nil {
+		return nil, PreDispatchMalformedEnvelope, err
+	}
+	if s.features(r.Context()).ValidateEnums.on() {
+		if err := ValidateEnums(request); err != nil {
+			return nil, PreDispatchInvalidValue, err
+		}
+	}
+	return &decodedRequest{action: soapAction, element: t, handler: actionHandler, request: request, alias: alias, headers: headers, version: version}, "", nil
+}
+
+var errTrailingData = errors.New("trailing data after soap envelope")
+
+// endEnvelope reads the rest of the envelope from d, which is positioned in
+// the Body after the request element. Further Body content is skipped like
+// decodeMessage does, anything but whitespace, comments and processing
+// instructions after the envelope is rejected.
+func endEnvelope(d *xml.Decoder) error {
+	for depth := 2; depth > 0; {
+		token, err := d.Token()
+		if err != nil {
+			return fmt.Errorf("could not read soap envelope:: %s", err)
+		}
+		switch token.(type) {
+		case xml.StartElement:
+			if err := d.Skip(); err != nil {
+				return fmt.Errorf("could not read soap envelope:: %s", err)
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read soap envelope:: %s", err)
+		}
+		switch tt := token.(type) {
+		case xml.StartElement:
+			return errTrailingData
+		case xml.CharData:
+			if len(bytes.TrimSpace(tt)) > 0 {
+				return errTrailingData
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package soap
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrCircuitOpen matches, using errors.Is, every CircuitOpenError.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// Breaker is a circuit breaker guarding the calls of a Client, see
+// Client.Breaker. It's used by concurrent calls.
+type Breaker interface {
+	// Allow returns an error if a call must not be made.
+	Allow() error
+	// Record is called with the outcome of every allowed call, nil on
+	// success. err can be inspected with KindOf and errors.As, e.g. to
+	// ignore SOAP Faults.
+	Record(err error)
+}
+
+// CircuitOpenError is returned by Client calls a Client.Breaker doesn't allow.
+type CircuitOpenError struct {
+	Action string
+	Err    error // as returned by Breaker.Allow
+}
+
+func (ce *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", ErrCircuitOpen, ce.Action, ce.Err)
+}
+
+func (ce *CircuitOpenError) Unwrap() error {
+	return ce.Err
+}
+
+// Is reports whether target is ErrCircuitOpen.
+func (ce *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// allow asks Client.Breaker once per call, before the envelope is marshalled,
+// and returns the function recording the outcome of the call.
+func (c *Client) allow(action string) (func(err error), error) {
+	if c.Breaker == nil {
+		return func(error) {}, nil
+	}
+	if err := c.Breaker.Allow(); err != nil {
+		return nil, &CircuitOpenError{Action: action, Err: err}
+	}
+	return c.Breaker.Record, nil
+}
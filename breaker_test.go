@@ -0,0 +1,92 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// consecutiveBreaker opens after failures consecutive failures.
+type consecutiveBreaker struct {
+	failures, limit int
+	recorded        []error
+}
+
+func (b *consecutiveBreaker) Allow() error {
+	if b.failures >= b.limit {
+		return errors.New("backend failing")
+	}
+	return nil
+}
+
+func (b *consecutiveBreaker) Record(err error) {
+	b.recorded = append(b.recorded, err)
+	if err != nil {
+		b.failures++
+	} else {
+		b.failures = 0
+	}
+}
+
+type countingMarshaller struct {
+	XMLMarshaller
+	marshalled int
+}
+
+func (cm *countingMarshaller) Marshal(v interface{}) ([]byte, error) {
+	cm.marshalled++
+	return cm.XMLMarshaller.Marshal(v)
+}
+
+func TestClient_Breaker(t *testing.T) {
+	fail := true
+	requests := 0
+	breaker := &consecutiveBreaker{limit: 2}
+	marshaller := &countingMarshaller{XMLMarshaller: defaultMarshaller{}}
+	c := NewClient("http://localhorst.ch", nil)
+	c.Breaker = breaker
+	c.Marshaller = marshaller
+	c.RetryPolicy = &RetryPolicy{MaxAttempts: 2}
+	c.Clock = &sleepRecorder{}
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		requests++
+		if fail {
+			return nil, syscall.ECONNRESET
+		}
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	})}).Do
+
+	fail = false
+	_, err := c.Call(context.Background(), "foo", &FooRequest{}, nil)
+	require.NoError(t, err)
+	fail = true
+	for i := 0; i < 2; i++ {
+		_, err = c.Call(context.Background(), "foo", &FooRequest{}, nil)
+		assert.Equal(t, ErrorKindTransport, KindOf(err))
+	}
+	require.Len(t, breaker.recorded, 3, "one outcome per call, retries included")
+	assert.NoError(t, breaker.recorded[0])
+	assert.Error(t, breaker.recorded[2])
+	assert.Equal(t, 5, requests)
+	assert.Equal(t, 3, marshaller.marshalled)
+
+	_, err = c.Call(context.Background(), "foo", &FooRequest{}, nil)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	var ce *CircuitOpenError
+	require.ErrorAs(t, err, &ce)
+	assert.Equal(t, "foo", ce.Action)
+	assert.EqualError(t, err, "circuit open: foo: backend failing")
+	var bar string
+	_, err = c.CallExtract(context.Background(), "foo", &FooRequest{}, map[string]interface{}{"Body/fooResponse/Bar": &bar})
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	_, err = c.CallRaw(context.Background(), "foo", []byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body/></Envelope>`), nil)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 5, requests, "open circuits send nothing")
+	assert.Equal(t, 3, marshaller.marshalled, "open circuits marshal nothing")
+	assert.Len(t, breaker.recorded, 3, "rejected calls aren't recorded")
+}
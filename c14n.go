@@ -0,0 +1,167 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var errC14NNotFound = errors.New("element to canonicalize not found")
+
+// excC14N returns the Exclusive XML Canonicalization, without comments, of
+// the first element of doc match returns true for. match gets the element with
+// its namespaces resolved. Namespaces are resolved against the whole document,
+// only those the element and its descendants use are rendered.
+func excC14N(doc []byte, match func(xml.StartElement) bool) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(doc))
+	var (
+		scopes []map[string]string // in-scope namespaces by prefix
+		out    bytes.Buffer
+		// rendered are the namespaces rendered by the output ancestors, names
+		// the raw names of the open output elements.
+		rendered []map[string]string
+		names    []string
+	)
+	scope := func() map[string]string {
+		if len(scopes) == 0 {
+			return map[string]string{"xml": NamespaceXMLSpace}
+		}
+		return scopes[len(scopes)-1]
+	}
+	for {
+		token, err := d.RawToken()
+		if err == io.EOF {
+			return nil, errC14NNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tt := token.(type) {
+		case xml.StartElement:
+			ns := map[string]string{}
+			for prefix, uri := range scope() {
+				ns[prefix] = uri
+			}
+			for _, a := range tt.Attr {
+				switch {
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					ns[""] = a.Value
+				case a.Name.Space == "xmlns":
+					ns[a.Name.Local] = a.Value
+				}
+			}
+			scopes = append(scopes, ns)
+			if len(names) == 0 && !match(resolveStart(tt, ns)) {
+				continue
+			}
+			var parent map[string]string
+			if len(rendered) > 0 {
+				parent = rendered[len(rendered)-1]
+			}
+			r := writeC14NStart(&out, tt, ns, parent)
+			rendered = append(rendered, r)
+			names = append(names, rawName(tt.Name))
+		case xml.EndElement:
+			scopes = scopes[:len(scopes)-1]
+			if len(names) == 0 {
+				continue
+			}
+			out.WriteString("</" + names[len(names)-1] + ">")
+			names, rendered = names[:len(names)-1], rendered[:len(rendered)-1]
+			if len(names) == 0 {
+				return out.Bytes(), nil
+			}
+		case xml.CharData:
+			if len(names) > 0 {
+				out.WriteString(c14nTextReplacer.Replace(string(tt)))
+			}
+		case xml.ProcInst:
+			if len(names) > 0 {
+				out.WriteString("<?" + tt.Target)
+				if len(tt.Inst) > 0 {
+					out.WriteString(" " + string(tt.Inst))
+				}
+				out.WriteString("?>")
+			}
+		}
+	}
+}
+
+var (
+	c14nTextReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	c14nAttrReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+// writeC14NStart writes the canonical start tag of se, which has the
+// namespaces ns in scope, and returns the namespaces rendered for its
+// children. parent are those rendered by its output ancestors.
+func writeC14NStart(out *bytes.Buffer, se xml.StartElement, ns, parent map[string]string) map[string]string {
+	type attr struct {
+		space, local, raw, value string
+	}
+	var attrs []attr
+	utilized := map[string]bool{se.Name.Space: true}
+	for _, a := range se.Attr {
+		if a.Name.Space == "xmlns" || a.Name.Space == "" && a.Name.Local == "xmlns" {
+			continue
+		}
+		if a.Name.Space != "" {
+			utilized[a.Name.Space] = true
+		}
+		attrs = append(attrs, attr{space: ns[a.Name.Space], local: a.Name.Local, raw: rawName(a.Name), value: a.Value})
+	}
+
+	r := map[string]string{}
+	for prefix, uri := range parent {
+		r[prefix] = uri
+	}
+	var prefixes []string
+	for prefix := range utilized {
+		if prefix == "xml" {
+			continue
+		}
+		if rendered, ok := r[prefix]; ok && rendered == ns[prefix] || !ok && prefix == "" && ns[prefix] == "" {
+			continue
+		}
+		r[prefix] = ns[prefix]
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].space != attrs[j].space {
+			return attrs[i].space < attrs[j].space
+		}
+		return attrs[i].local < attrs[j].local
+	})
+
+	out.WriteString("<" + rawName(se.Name))
+	for _, prefix := range prefixes {
+		name := "xmlns"
+		if prefix != "" {
+			name += ":" + prefix
+		}
+		fmt.Fprintf(out, ` %s="%s"`, name, c14nAttrReplacer.Replace(ns[prefix]))
+	}
+	for _, a := range attrs {
+		fmt.Fprintf(out, ` %s="%s"`, a.raw, c14nAttrReplacer.Replace(a.value))
+	}
+	out.WriteString(">")
+	return r
+}
+
+// resolveStart returns se of RawToken with the namespaces ns resolved.
+func resolveStart(se xml.StartElement, ns map[string]string) xml.StartElement {
+	resolved := xml.StartElement{Name: xml.Name{Space: ns[se.Name.Space], Local: se.Name.Local}}
+	for _, a := range se.Attr {
+		name := a.Name
+		if name.Space != "" {
+			name.Space = ns[name.Space]
+		}
+		resolved.Attr = append(resolved.Attr, xml.Attr{Name: name, Value: a.Value})
+	}
+	return resolved
+}
@@ -0,0 +1,64 @@
+package soap
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExcC14N(t *testing.T) {
+	elem2 := func(se xml.StartElement) bool {
+		return se.Name == xml.Name{Space: "http://example.net", Local: "elem2"}
+	}
+	// the examples of section 2.2 of the Exclusive XML Canonicalization spec
+	const want = `<n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+     <n3:stuff xmlns:n3="ftp://example.org"></n3:stuff>
+  </n1:elem2>`
+	tests := []struct {
+		name  string
+		doc   string
+		match func(xml.StartElement) bool
+		want  string
+	}{
+		{
+			name: "spec example 1",
+			doc: `<n0:local xmlns:n0="foo:bar" xmlns:n3="ftp://example.org">
+  <n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+     <n3:stuff xmlns:n3="ftp://example.org"/>
+  </n1:elem2>
+</n0:local>`,
+			match: elem2,
+			want:  want,
+		},
+		{
+			name: "spec example 2",
+			doc: `<n2:pdu xmlns:n1="http://example.com" xmlns:n2="http://foo.example" xml:lang="fr" xml:space="retain">
+  <n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+     <n3:stuff xmlns:n3="ftp://example.org"/>
+  </n1:elem2>
+</n2:pdu>`,
+			match: elem2,
+			want:  want,
+		},
+		{
+			name: "default namespace, sorting and escaping",
+			doc:  `<a xmlns="urn:a" xmlns:y="urn:y"><!-- c --><b b="2" a="1" xmlns:z="urn:z" z:c="&quot;&#10;" y:d="x">x &amp; y &gt;<![CDATA[<]]><c xmlns=""/></b></a>`,
+			match: func(se xml.StartElement) bool {
+				return se.Name.Local == "b"
+			},
+			want: `<b xmlns="urn:a" xmlns:y="urn:y" xmlns:z="urn:z" a="1" b="2" y:d="x" z:c="&quot;&#xA;">x &amp; y &gt;&lt;<c xmlns=""></c></b>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := excC14N([]byte(tt.doc), tt.match)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+
+	_, err := excC14N([]byte(`<a/>`), func(xml.StartElement) bool { return false })
+	assert.Equal(t, errC14NNotFound, err)
+}
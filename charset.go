@@ -0,0 +1,154 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// xmlDeclEncodingRe matches the encoding of an XML declaration.
+var xmlDeclEncodingRe = regexp.MustCompile(`^<\?xml[^>]*?\sencoding\s*=\s*["']([^"']*)["']`)
+
+// charsetOf returns the charset parameter of contentType, "" if it has none.
+func charsetOf(contentType string) string {
+	_, params, _ := mime.ParseMediaType(contentType)
+	return params["charset"]
+}
+
+// isUTF8 tells whether charset is UTF-8 or unknown.
+func isUTF8(charset string) bool {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8":
+		return true
+	}
+	return false
+}
+
+// undecodableCharset is the result of a response whose body can't be
+// converted by toUTF8. Error pages, e.g. of a proxy, are reported by their
+// status rather than their charset.
+func undecodableCharset(httpResponse *http.Response, body []byte, err error) (*http.Response, error) {
+	if httpResponse.StatusCode >= 300 {
+		return httpResponse, statusError(httpResponse, body)
+	}
+	return nil, protocolError(err)
+}
+
+// toUTF8 converts the envelope body, sent with charset, to UTF-8. A UTF-16
+// byte order mark takes precedence over charset, which in turn takes
+// precedence over the encoding of the XML declaration. The XML declaration of
+// a converted envelope is changed to UTF-8. Byte order marks and whitespace
+// preceding the XML are stripped, see trimPreamble.
+func (c *Client) toUTF8(body []byte, charset string) ([]byte, error) {
+	if !strings.HasPrefix(strings.ToLower(charset), "utf-16") {
+		body = trimPreamble(body)
+	}
+	switch {
+	case bytes.HasPrefix(body, []byte{0xff, 0xfe}):
+		charset = "utf-16le"
+	case bytes.HasPrefix(body, []byte{0xfe, 0xff}):
+		charset = "utf-16be"
+	case charset == "":
+		if m := xmlDeclEncodingRe.FindSubmatch(body); m != nil {
+			charset = string(m[1])
+		}
+	}
+	if isUTF8(charset) {
+		return body, nil
+	}
+	r, err := c.charsetReader()(charset, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	converted, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert from charset %q: %w", charset, err)
+	}
+	converted = trimPreamble(converted)
+	if m := xmlDeclEncodingRe.FindSubmatchIndex(converted); m != nil {
+		converted = append(append(append([]byte(nil), converted[:m[2]]...), "UTF-8"...), converted[m[3]:]...)
+	}
+	return converted, nil
+}
+
+// utf8BOM is the UTF-8 byte order mark.
+var utf8BOM = []byte("\uFEFF")
+
+// trimPreamble strips a UTF-8 byte order mark and whitespace preceding the XML
+// of body. Some servers send them before the XML declaration, which must come
+// first.
+func trimPreamble(body []byte) []byte {
+	return bytes.TrimLeft(bytes.TrimPrefix(body, utf8BOM), " \t\r\n")
+}
+
+// charsetReader returns CharsetReader or the builtin one.
+func (c *Client) charsetReader() func(charset string, input io.Reader) (io.Reader, error) {
+	if c.CharsetReader != nil {
+		return c.CharsetReader
+	}
+	return builtinCharsetReader
+}
+
+// streamCharset prepares the streamed envelope r, sent with charset, for an
+// xml.Decoder: r is converted right away, if charset isn't UTF-8, otherwise
+// the returned CharsetReader converts according to the XML declaration.
+func (c *Client) streamCharset(r io.Reader, charset string) (io.Reader, func(string, io.Reader) (io.Reader, error), error) {
+	if isUTF8(charset) {
+		return r, c.charsetReader(), nil
+	}
+	converted, err := c.charsetReader()(charset, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return converted, func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}, nil
+}
+
+// builtinCharsetReader converts ISO-8859-1, US-ASCII and UTF-16 to UTF-8, see
+// Client.CharsetReader.
+func builtinCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "iso8859-1", "latin1", "l1", "us-ascii", "ascii":
+		data, err := ioutil.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, 0, len(data)*2)
+		for _, b := range data {
+			out = utf8.AppendRune(out, rune(b))
+		}
+		return bytes.NewReader(out), nil
+	case "utf-16", "utf-16le", "utf-16be":
+		data, err := ioutil.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		var order binary.ByteOrder = binary.BigEndian
+		switch {
+		case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+			order, data = binary.LittleEndian, data[2:]
+		case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+			data = data[2:]
+		case strings.EqualFold(charset, "utf-16le"):
+			order = binary.LittleEndian
+		}
+		if len(data)%2 != 0 {
+			return nil, fmt.Errorf("odd number of bytes in %s content", charset)
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = order.Uint16(data[2*i:])
+		}
+		return strings.NewReader(string(utf16.Decode(units))), nil
+	}
+	return nil, fmt.Errorf("unsupported charset %q, set Client.CharsetReader", charset)
+}
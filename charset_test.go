@@ -0,0 +1,152 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Call_charset(t *testing.T) {
+	latin1, err := ioutil.ReadFile("testdata/charset/latin1.response.xml")
+	require.NoError(t, err)
+	utf16le, err := ioutil.ReadFile("testdata/charset/utf16le.response.xml")
+	require.NoError(t, err)
+	const want = "Crème brûlée für Zoë"
+
+	for name, tc := range map[string]struct {
+		contentType   string
+		body          []byte
+		charsetReader func(string, io.Reader) (io.Reader, error)
+		wantErr       string
+	}{
+		"Latin-1":                     {contentType: "text/xml; charset=ISO-8859-1", body: latin1},
+		"Latin-1 declared":            {contentType: "text/xml", body: latin1},
+		"UTF-16LE with BOM":           {contentType: "text/xml", body: utf16le},
+		"UTF-16LE with BOM, labelled": {contentType: `text/xml; charset="UTF-16"`, body: utf16le},
+		"unsupported": {
+			contentType: "text/xml; charset=windows-1252",
+			body:        latin1,
+			wantErr:     `unsupported charset "windows-1252", set Client.CharsetReader`,
+		},
+		"CharsetReader": {
+			contentType: "text/xml; charset=windows-1252",
+			body:        latin1,
+			charsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+				return builtinCharsetReader("latin1", input)
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewClient("http://localhorst.ch", nil)
+			c.CharsetReader = tc.charsetReader
+			c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: 200,
+					Header:     http.Header{"Content-Type": {tc.contentType}},
+					Body:       ioutil.NopCloser(bytes.NewReader(tc.body)),
+				}, nil
+			})}).Do
+
+			response := &FooResponse{}
+			_, err := c.Call(context.Background(), "foo", &FooRequest{}, response)
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				assert.Equal(t, ErrorKindProtocol, KindOf(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, want, response.Bar)
+
+			var bar string
+			_, err = c.CallExtract(context.Background(), "foo", &FooRequest{}, map[string]interface{}{"Body/FooResponse/Bar": &bar})
+			if tc.body[0] == 0xff {
+				return // CallExtract streams, it doesn't detect byte order marks
+			}
+			require.NoError(t, err)
+			assert.Equal(t, want, bar)
+		})
+	}
+}
+
+func TestClient_Call_charsetErrorPage(t *testing.T) {
+	const page = "<html><body>Service Unavailable \x96 try again later</body></html>"
+	c := NewClient("http://localhorst.ch", nil)
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Header:     http.Header{"Content-Type": {"text/html; charset=windows-1252"}},
+			Body:       ioutil.NopCloser(strings.NewReader(page)),
+		}, nil
+	})}).Do
+
+	httpResponse, err := c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{})
+	var se *StatusError
+	require.True(t, errors.As(err, &se), "%v", err)
+	assert.Equal(t, http.StatusServiceUnavailable, se.StatusCode)
+	require.NotNil(t, httpResponse)
+	assert.Equal(t, http.StatusServiceUnavailable, httpResponse.StatusCode)
+}
+
+func TestClient_Call_preamble(t *testing.T) {
+	latin1, err := ioutil.ReadFile("testdata/charset/latin1.response.xml")
+	require.NoError(t, err)
+	const want = "Crème brûlée für Zoë"
+
+	for name, preamble := range map[string]string{
+		"BOM":                "\xef\xbb\xbf",
+		"blank line":         "\r\n",
+		"BOM and blank line": "\xef\xbb\xbf\n \n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			body := append([]byte(preamble), latin1...)
+			for _, multipart := range []bool{false, true} {
+				c := NewClient("http://localhorst.ch", nil)
+				c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+					if !multipart {
+						return &http.Response{
+							StatusCode: 200,
+							Header:     http.Header{"Content-Type": {"text/xml"}},
+							Body:       ioutil.NopCloser(bytes.NewReader(body)),
+						}, nil
+					}
+					buf, mw := createMultiPart(t, body)
+					return &http.Response{
+						StatusCode: 200,
+						Header:     http.Header{"Content-Type": {mw.FormDataContentType()}},
+						Body:       ioutil.NopCloser(buf),
+					}, nil
+				})}).Do
+
+				response := &FooResponse{}
+				_, err := c.Call(context.Background(), "foo", &FooRequest{}, response)
+				require.NoError(t, err, "multipart: %v", multipart)
+				assert.Equal(t, want, response.Bar, "the XML declaration is honored, multipart: %v", multipart)
+			}
+		})
+	}
+}
+
+func TestClient_Call_notXML(t *testing.T) {
+	c := NewClient("http://localhorst.ch", nil)
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte("\x00\x01<Envelope xmlns=\"" + NamespaceSoap11 + "\">"))),
+		}, nil
+	})}).Do
+
+	_, err := c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{})
+	require.Error(t, err)
+	assert.Equal(t, ErrorKindProtocol, KindOf(err))
+	assert.Contains(t, err.Error(), "COULD NOT UNMARSHAL")
+	assert.Contains(t, err.Error(), "00000000  00 01 3c 45 6e 76 65 6c  6f 70 65 20 78 6d 6c 6e  |..<Envelope xmln|")
+}
@@ -4,15 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/xml"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"math/rand"
 	"mime"
-	"mime/multipart"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strings"
 	"time"
 )
@@ -28,14 +26,46 @@ type XMLMarshaller interface {
 
 type defaultMarshaller struct{}
 
+// defaultIndent is the indentation of envelopes of the defaultMarshaller.
+const defaultIndent = "\t"
+
 func (dm defaultMarshaller) Marshal(v interface{}) ([]byte, error) {
-	return xml.MarshalIndent(v, "", "	")
+	return MarshalIndent(v, "", defaultIndent)
 }
 
 func (dm defaultMarshaller) Unmarshal(xmlBytes []byte, v interface{}) error {
 	return xml.Unmarshal(xmlBytes, v)
 }
 
+// BodyDecoder lets you inject a custom XML implementation for the content of
+// a SOAP response Body. The envelope framing (Envelope, Header, Body and Fault)
+// is always decoded by this package.
+//
+// Decode receives exactly one element: the single child of the response Body,
+// as it was sent by the peer (after SOAP 1.2 envelope namespaces have been
+// mapped to SOAP 1.1, see replaceSoap12to11). Namespace declarations in scope
+// on the Envelope and Body elements are copied onto the start tag of that
+// element, so the fragment is self-contained and prefixes are preserved. xsi
+// attributes (xsi:type, xsi:nil) are passed through untouched, interpreting
+// them is up to the implementation, see ResolveXSIType. target is the
+// response passed to Call and is never nil. Decode is not invoked for SOAP
+// Faults, empty Bodies, slice targets and CallMulti.
+type BodyDecoder interface {
+	Decode(data []byte, target interface{}) error
+}
+
+// BodyEncoder lets you inject a custom XML implementation for the content of
+// a SOAP request Body.
+//
+// Encode must return a single well-formed element (or nothing for an empty
+// Body) which is embedded verbatim as the child of the Body. The Body element
+// declares the SOAP envelope namespace as default namespace, so the element
+// must declare its own default namespace (or xmlns="") and every prefix it
+// uses, including xsi if it emits xsi attributes.
+type BodyEncoder interface {
+	Encode(v interface{}) ([]byte, error)
+}
+
 // BasicAuth credentials for the client
 type BasicAuth struct {
 	Login    string
@@ -46,33 +76,230 @@ type BasicAuth struct {
 type Client struct {
 	Log             func(msg string, keyString_ValueInterface ...interface{}) // optional
 	url             string
-	urlMasked       string
 	tls             bool
 	auth            *BasicAuth
 	Marshaller      XMLMarshaller
 	UserAgent       string            // optional, falls back to "go-soap-0.1"
-	ContentType     string            // optional, falls back to SOAP 1.1
 	RequestHeaderFn func(http.Header) // optional, allows to modify the request header before it gets submitted.
 	SoapVersion     string
 	HTTPClientDoFn  func(req *http.Request) (*http.Response, error)
+	BodyDecoder     BodyDecoder // optional, decodes the response Body content instead of encoding/xml
+	BodyEncoder     BodyEncoder // optional, encodes the request Body content instead of Marshaller
+	// QueryParams are merged into the query of the endpoint URL, replacing
+	// parameters of the same key. See WithQueryParam for single calls.
+	QueryParams url.Values
+	// RedactedQueryParams are masked in logs, e.g. API keys.
+	RedactedQueryParams []string
+	// ContentType is the Content-Type header of requests, set by UseSoap11
+	// and UseSoap12.
+	//
+	// Deprecated: use ContentTypeOverride or CharsetParam.
+	ContentType string
+	// ContentTypeOverride replaces the Content-Type header built from the
+	// SOAP version and CharsetParam, e.g. "text/xml;charset=UTF-8".
+	ContentTypeOverride string
+	// CharsetParam is the charset parameter of the Content-Type header, ""
+	// omits the parameter. NewClient sets it to "utf-8".
+	CharsetParam string
+	// QuoteCharset quotes CharsetParam, e.g. charset="utf-8". NewClient sets
+	// it, some servers only accept a token, e.g. charset=UTF-8.
+	QuoteCharset bool
+	// ParamSeparator separates the parameters of the Content-Type header
+	// built from CharsetParam and the SOAP 1.2 action, "" falls back to "; ".
+	// Some servers only accept ";", e.g. "text/xml;charset=UTF-8".
+	ParamSeparator string
+	Clock          Clock // optional, falls back to the system clock
+	// RequirePeerCertSHA256 pins the SHA-256 fingerprints (hex, see
+	// CertificateSHA256) of the leaf certificates the server may present.
+	// Calls fail with a *PeerCertificateError otherwise: connections of an
+	// http.Transport are closed right after the TLS handshake, before the
+	// request is written. HTTPClientDoFn implementations without one are
+	// checked on the response only, use PinnedTransport for them.
+	RequirePeerCertSHA256 []string
+	// Accept is the Accept header of requests, by default the media type of
+	// the SoapVersion and multipart/related, e.g. "text/xml, multipart/related".
+	Accept string
+	// RetryPolicy enables retries, nil disables them.
+	RetryPolicy *RetryPolicy
+	// RetryableFaults are SOAP Faults which are retried according to the
+	// RetryPolicy, e.g. faults signaling a transient condition. Other faults
+	// are never retried.
+	RetryableFaults []FaultMatcher
+	// CredentialsFn provides basic auth credentials instead of the ones given
+	// to NewClient. They are cached until a call fails with an *AuthError,
+	// then the call is retried once with credentials fetched again.
+	CredentialsFn func(ctx context.Context) (*BasicAuth, error)
+	// TokenSource provides OAuth2 bearer tokens, which are sent in the
+	// Authorization header instead of basic auth credentials. A token is
+	// cached until shortly before its expiry or until a call fails with an
+	// *AuthError, then the call is retried once with a fresh token.
+	TokenSource TokenSource
+	// DigestAuth enables HTTP Digest authentication (RFC 7616) with MD5 or
+	// SHA-256: a request challenged by a 401 response is sent once more with
+	// the answer to the challenge, replaying the body. The challenge is
+	// answered right away by subsequent requests.
+	DigestAuth *DigestAuth
+	// Reauthenticate is run when a call fails with a SOAP Fault matching
+	// ReauthenticateFaults, e.g. of an expired session, to log in again. The
+	// call is then made once more with its envelope built anew and the
+	// credentials of CredentialsFn fetched again, so header blocks reading a
+	// session token when they are marshaled pick up the fresh one. Calls made
+	// with the context passed to Reauthenticate don't reauthenticate. Calls
+	// failing while it runs share the run. Requires a Client created by
+	// NewClient for sharing.
+	Reauthenticate       func(ctx context.Context, c *Client, fault *FaultError) error
+	ReauthenticateFaults []FaultMatcher
+	// OnAuthError is run when a call fails with an *AuthError, i.e. an HTTP
+	// 401 or 403 response, whose body has been closed, e.g. to refresh a
+	// session token set by RequestHeaderFn. The call is then made once more
+	// with the same envelope. Calls made with the context passed to it don't
+	// run it, calls failing while it runs share the run, like for
+	// Reauthenticate. Streamed attachments can't be sent again.
+	OnAuthError func(ctx context.Context, resp *http.Response) error
+	// EnvelopeAttrs and BodyAttrs are added to the Envelope and Body elements
+	// of requests, e.g. EncodingStyle. See WithEnvelopeAttrs and WithBodyAttrs
+	// for single calls.
+	EnvelopeAttrs []xml.Attr
+	BodyAttrs     []xml.Attr
+	// ValidateEnums rejects requests with values outside of their enumeration
+	// before they are sent, see Enum.
+	ValidateEnums bool
+	// DeterministicOutput writes the attributes of every element of request
+	// envelopes in a stable order, whatever the order of map iteration or the
+	// Go version: the default namespace declaration first, then the prefix
+	// declarations by prefix, the attributes without namespace by name and
+	// the namespaced attributes by namespace URI and name. Header blocks are
+	// written in a fixed order anyway: WSAddressing, Headers, WithHeaders.
+	// Generated values, e.g. ids and timestamps, follow the IDGenerator and
+	// Clock. Use it to pin envelopes as golden files.
+	DeterministicOutput bool
+	// ResponseIdleTimeout aborts reading a response with ErrResponseStalled,
+	// if no data arrives for this long, independent of the deadline of the
+	// call. 0 means no limit.
+	ResponseIdleTimeout time.Duration
+	// Headers are the header blocks of the SOAP Header of every request, e.g.
+	// a *Security. See WithHeaders for single calls.
+	Headers []interface{}
+	// WSAddressing adds WS-Addressing header blocks to every request, before
+	// Headers. See WithWSAddressing for single calls.
+	WSAddressing *WSAddressing
+	// QuoteSOAPAction sends the SOAPAction header in double quotes as
+	// required by SOAP 1.1, e.g. "urn:getQuote". Otherwise it's sent without:
+	// quotes around the action passed to Call are dropped, so callers who
+	// quoted actions themselves must set QuoteSOAPAction to keep sending them
+	// quoted.
+	QuoteSOAPAction bool
+	// ResolveMultiRefs inlines SOAP-encoded multiRef elements of responses,
+	// as sent by rpc/encoded services of Apache Axis 1, before decoding.
+	ResolveMultiRefs bool
+	// ZeroResponseTarget resets the response passed to Call before decoding,
+	// so that elements omitted by the response don't keep the values of a
+	// previous call, e.g. if responses are pooled.
+	ZeroResponseTarget bool
+	// PartialResultMode selects the handling of response Bodies holding both a
+	// result and Faults, see PartialResultError.
+	PartialResultMode PartialResultMode
+
+	// MaxInFlight caps the number of concurrent requests, further calls wait
+	// for a slot until their context is done. 0 means no limit. Requires a
+	// Client created by NewClient.
+	MaxInFlight int
+	// FailFastInFlight makes calls fail with ErrTooManyInFlight instead of
+	// waiting for a slot.
+	FailFastInFlight bool
+	// Admission, if set, is asked before each call, with the number of requests
+	// in flight, see InFlight. A call it returns an error for is rejected with
+	// an AdmissionError. Retries of a call are not asked again.
+	Admission func(ctx context.Context, action string, inFlight int) error
+	// FeatureResolver, if set, switches Features per call, e.g. by action or
+	// by a tenant of ctx. Flags left at FeatureDefault keep the fields of the
+	// Client.
+	FeatureResolver func(ctx context.Context, action string) Features
+	// Breaker, if set, is asked before each call, after Admission, and told
+	// its outcome, including retries. A call it doesn't allow is rejected with
+	// a CircuitOpenError before the envelope is marshalled.
+	Breaker Breaker
+
+	// Policies configures calls by SOAPAction, DefaultPolicy those of other
+	// actions, see CallPolicy. Requires a Client created by NewClient for
+	// rate limits.
+	Policies map[string]CallPolicy
+
+	// IDGenerator mints the identifiers of the Client: log trace and archive
+	// IDs, MIME boundaries, Digest and NTLM nonces, as well as the identifiers
+	// of WSAddressing, WS-Security headers and an *X509Signer without their
+	// own. It falls back to RandomIDs.
+	IDGenerator IDGenerator
+
+	// Signer, if set, signs the envelopes of Call and CallExtract, e.g. an
+	// *X509Signer.
+	Signer EnvelopeSigner
+
+	// Archiver, if set, receives every request and response, see
+	// MessageRecord. Responses of CallExtract are recorded as far as they have
+	// been read.
+	Archiver Archiver
+
+	// CharsetReader, if set, converts responses in other charsets than UTF-8
+	// to UTF-8, like xml.Decoder.CharsetReader, e.g. charset.NewReaderLabel of
+	// golang.org/x/net/html/charset. ISO-8859-1, US-ASCII and UTF-16 are
+	// converted without it. The charset is taken from a UTF-16 byte order
+	// mark, the Content-Type or the XML declaration.
+	CharsetReader func(charset string, input io.Reader) (io.Reader, error)
+
+	// CompressRequest gzips request envelopes and sets Content-Encoding, e.g.
+	// for large envelopes to endpoints accepting it. Multipart requests, see
+	// WithAttachments, are sent uncompressed.
+	CompressRequest bool
+
+	// IntegrityHeader is the name of an HTTP header carrying the hex encoded
+	// SHA-256 of the request envelope, which the server must echo in the same
+	// header of its response, otherwise Call and CallExtract fail with an
+	// *IntegrityError. "" disables the check. The hash is recorded in
+	// CallStats.IntegrityHash.
+	IntegrityHeader string
+
+	// StreamThreshold, if set, makes Call stream request envelopes whose Body
+	// content is estimated at this many bytes or more, see SizeHinter. Smaller
+	// requests are buffered as usual. Streamed envelopes are encoded while
+	// they are sent, without Content-Length, but are the same as buffered
+	// ones. The call isn't retried by the RetryPolicy. Requests are buffered
+	// anyway if a feature needs the whole envelope, e.g. a Signer, an
+	// Archiver or CompressRequest, which is logged. The decision is recorded
+	// in CallStats.Streamed.
+	StreamThreshold int64
+
+	// Instrumentation, if set, traces Call, CallExtract and CallRaw, e.g.
+	// with OpenTelemetry, including calls rejected by Admission, the Breaker
+	// or a rate limit. Calls aren't traced without it, at no cost.
+	Instrumentation Instrumentation
+
+	metrics  *expvarMetrics    // set by EnableExpvar
+	creds    *credentialsCache // set by NewClient, nil disables caching
+	digest   *digestState      // set by NewClient, nil disables caching
+	reauth   *reauthState      // set by NewClient, nil disables sharing
+	inFlight *inFlightLimiter  // set by NewClient
+	limiters *rateLimiters     // set by NewClient
+
+	middleware []func(next CallFunc) CallFunc // added by Use
 }
 
 // NewClient constructor. SOAP 1.1 is used by default. Switch to SOAP 1.2 with
 // UseSoap12(). Argument rt can be nil and it will fall back to the default
 // http.Transport.
 func NewClient(postToURL string, auth *BasicAuth) *Client {
-	var urlMasked string
-	if pURL, err := url.Parse(postToURL); err == nil {
-		pURL.User = url.UserPassword(pURL.User.Username(), "********")
-		urlMasked = pURL.String()
-	}
-
 	return &Client{
 		url:            postToURL,
-		urlMasked:      urlMasked,
 		auth:           auth,
+		creds:          &credentialsCache{},
+		digest:         &digestState{},
+		reauth:         &reauthState{},
+		inFlight:       &inFlightLimiter{},
+		limiters:       &rateLimiters{},
 		Marshaller:     defaultMarshaller{},
 		ContentType:    SoapContentType11, // default is SOAP 1.1
+		CharsetParam:   "utf-8",
+		QuoteCharset:   true,
 		SoapVersion:    SoapVersion11,
 		HTTPClientDoFn: http.DefaultClient.Do,
 	}
@@ -83,42 +310,158 @@ func (c *Client) UseSoap11() {
 	c.ContentType = SoapContentType11
 }
 
+// UseSoap12 makes the client send SOAP 1.2 envelopes, with the action as
+// parameter of the Content-Type instead of a SOAPAction header.
 func (c *Client) UseSoap12() {
 	c.SoapVersion = SoapVersion12
 	c.ContentType = SoapContentType12
 }
 
-// Call makes a SOAP call
-func (c *Client) Call(ctx context.Context, soapAction string, request, response interface{}) (*http.Response, error) {
-	envelope := Envelope{
-		Body: Body{Content: request},
+// contentType returns the Content-Type header of requests.
+func (c *Client) contentType() string {
+	if c.ContentTypeOverride != "" {
+		return c.ContentTypeOverride
+	}
+	// ContentType has been set by hand, before there was ContentTypeOverride
+	if c.ContentType != "" && c.ContentType != SoapContentType11 && c.ContentType != SoapContentType12 {
+		return c.ContentType
 	}
 
-	xmlBytes, err := c.Marshaller.Marshal(envelope)
-	if err != nil {
-		return nil, err
+	mediaType := mediaTypeSoap11
+	if c.SoapVersion == SoapVersion12 {
+		mediaType = mediaTypeSoap12
+	}
+	if c.CharsetParam == "" {
+		return mediaType
+	}
+	if c.QuoteCharset {
+		return mediaType + c.paramSeparator() + `charset="` + c.CharsetParam + `"`
+	}
+	return mediaType + c.paramSeparator() + "charset=" + c.CharsetParam
+}
+
+// paramSeparator returns the separator of Content-Type parameters, see
+// ParamSeparator.
+func (c *Client) paramSeparator() string {
+	if c.ParamSeparator == "" {
+		return "; "
+	}
+	return c.ParamSeparator
+}
+
+// accept returns the Accept header of requests.
+func (c *Client) accept() string {
+	if c.Accept != "" {
+		return c.Accept
 	}
-	// Adjust namespaces for SOAP 1.2
 	if c.SoapVersion == SoapVersion12 {
-		xmlBytes = replaceSoap11to12(xmlBytes)
+		return mediaTypeSoap12 + ", multipart/related"
 	}
+	return mediaTypeSoap11 + ", multipart/related"
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(xmlBytes))
+// marshalEnvelope returns the request envelope for request to soapAction.
+func (c *Client) marshalEnvelope(soapAction string, request interface{}, o *callOptions) ([]byte, error) {
+	ew := c.requestEnvelopeWriter(soapAction, o)
+	if o.features.ValidateEnums.on() {
+		if err := ValidateEnums(request); err != nil {
+			return nil, protocolError(err)
+		}
+	}
+	var (
+		xmlBytes []byte
+		err      error
+	)
+	if raw, ok := request.(rawRequest); ok {
+		if len(raw) > 0 {
+			if err := wellFormed(raw); err != nil {
+				return nil, protocolError(fmt.Errorf("invalid raw body: %w", err))
+			}
+		}
+		xmlBytes, err = ew.writeRaw(raw)
+	} else if c.BodyEncoder != nil {
+		content, encodeErr := c.BodyEncoder.Encode(request)
+		if encodeErr != nil {
+			return nil, protocolError(encodeErr)
+		}
+		xmlBytes, err = ew.writeRaw(content)
+	} else {
+		xmlBytes, err = ew.write(request)
+	}
 	if err != nil {
-		return nil, err
+		return nil, protocolError(err)
 	}
-	if c.auth != nil {
-		req.SetBasicAuth(c.auth.Login, c.auth.Password)
+	if c.Signer != nil {
+		if xmlBytes, err = signerWithIDs(c.Signer, c.ids()).SignEnvelope(xmlBytes); err != nil {
+			return nil, protocolError(err)
+		}
 	}
+	return xmlBytes, nil
+}
 
-	req.Header.Add("Content-Type", c.ContentType)
+// requestEnvelopeWriter returns the writer of the request envelope of a call
+// of soapAction.
+func (c *Client) requestEnvelopeWriter(soapAction string, o *callOptions) envelopeWriter {
+	envelopeAttrs, bodyAttrs := c.EnvelopeAttrs, c.BodyAttrs
+	if o.envelopeAttrs != nil {
+		envelopeAttrs = o.envelopeAttrs
+	}
+	if o.bodyAttrs != nil {
+		bodyAttrs = o.bodyAttrs
+	}
+	headers := withIDs(append(append([]interface{}(nil), c.Headers...), o.headers...), c.ids())
+	wsa := c.WSAddressing
+	if o.wsAddressing != nil {
+		wsa = o.wsAddressing
+	}
+	if wsa != nil {
+		var wsaHeaders []interface{}
+		wsaHeaders, o.stats.MessageID = wsa.headers(c.callURL(o), soapAction, c.ids())
+		headers = append(wsaHeaders, headers...)
+	}
+	return envelopeWriter{
+		Version:       c.SoapVersion,
+		Marshaller:    c.Marshaller,
+		EnvelopeAttrs: envelopeAttrs,
+		BodyAttrs:     bodyAttrs,
+		Headers:       headers,
+		Deterministic: o.features.DeterministicOutput.on(),
+	}
+}
+
+// newRequest builds the HTTP request posting the envelope xmlBytes.
+func (c *Client) newRequest(ctx context.Context, endpoint, soapAction string, xmlBytes []byte, o *callOptions) (*http.Request, error) {
+	if c.IDGenerator != nil {
+		ctx = withIDGenerator(ctx, c.IDGenerator)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(xmlBytes))
+	if err != nil {
+		return nil, protocolError(err)
+	}
+	if isExplaining(ctx) {
+		c.explainAuthorization(req)
+	} else if err := c.authorize(ctx, req); err != nil {
+		return nil, err
+	}
+
+	contentType := c.contentType()
+	if c.SoapVersion == SoapVersion12 && c.ContentTypeOverride == "" && soapAction != "" {
+		// SOAP 1.2 carries the action in the Content-Type, not in SOAPAction.
+		contentType += c.paramSeparator() + `action="` + strings.ReplaceAll(soapAction, `"`, `\"`) + `"`
+		soapAction = ""
+	}
+	req.Header.Add("Content-Type", contentType)
 	ua := c.UserAgent
 	if ua == "" {
 		ua = userAgent
 	}
 	req.Header.Set("User-Agent", ua)
+	req.Header.Set("Accept", c.accept())
 
 	if soapAction != "" {
+		if o.features.QuoteSOAPAction.on() {
+			soapAction = `"` + soapAction + `"`
+		}
 		req.Header.Add("SOAPAction", soapAction)
 	}
 
@@ -126,20 +469,256 @@ func (c *Client) Call(ctx context.Context, soapAction string, request, response
 	if c.RequestHeaderFn != nil {
 		c.RequestHeaderFn(req.Header)
 	}
+	return req, nil
+}
+
+// prepareRequest builds the HTTP request of a call posting the envelope
+// xmlBytes with the header of WithHTTPHeader and its attachments or
+// compressed.
+func (c *Client) prepareRequest(ctx context.Context, endpoint, soapAction string, xmlBytes []byte, o *callOptions) (*http.Request, error) {
+	req, err := c.newRequest(ctx, endpoint, soapAction, xmlBytes, o)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range o.httpHeader {
+		req.Header[key] = append([]string(nil), values...)
+	}
+	c.setIntegrityHeader(req, xmlBytes, o)
+	if o.trace != nil {
+		o.trace.Endpoint = c.maskURL(req.URL)
+		o.trace.RequestBytes = int64(len(xmlBytes))
+		c.Instrumentation.Inject(req.Context(), req.Header)
+	}
+	if o.attachments != nil {
+		if err := c.attach(req, xmlBytes, o.attachments); err != nil {
+			return nil, err
+		}
+	} else if o.features.CompressRequest.on() {
+		if err := compressRequest(req, xmlBytes); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// authorize sets the Authorization header of req with the credentials of the
+// Client.
+func (c *Client) authorize(ctx context.Context, req *http.Request) error {
+	auth, err := c.credentials(ctx)
+	if err != nil {
+		return err
+	}
+	if auth != nil {
+		req.SetBasicAuth(auth.Login, auth.Password)
+	}
+	if c.TokenSource != nil {
+		token, err := c.bearerToken(ctx)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// logRequest logs req and returns the trace ID for the log entries of the
+// call.
+func (c *Client) logRequest(req *http.Request, xmlBytes []byte) string {
 	var logTraceID string
 	if c.Log != nil {
-		logTraceID = randString(12)
-		c.Log("Request", "log_trace_id", logTraceID, "url", c.urlMasked, "request_bytes", string(xmlBytes))
+		logTraceID = c.newID(IDLogTrace)
+		c.Log("Request", "log_trace_id", logTraceID, "url", c.maskURL(req.URL), "request_bytes", string(xmlBytes))
 		hdr := req.Header.Clone()
 		hdr.Set("Authorization", "removed")
 		c.Log("Header", "log_trace_id", logTraceID, "Header", hdr)
 	}
-	httpResponse, err := c.HTTPClientDoFn(req)
+	return logTraceID
+}
+
+// do sends req, the response body must be closed by the caller.
+func (c *Client) do(req *http.Request, o *callOptions) (httpResponse *http.Response, err error) {
+	release, err := c.acquire(req.Context(), o.features.FailFastInFlight.on())
 	if err != nil {
 		return nil, err
 	}
+	defer func() {
+		if httpResponse == nil {
+			release()
+		}
+	}()
+
+	req, pinErr := c.pinConnections(req)
+	if c.DigestAuth != nil {
+		httpResponse, err = c.doDigest(req)
+	} else {
+		httpResponse, err = c.HTTPClientDoFn(req)
+	}
+	if err != nil {
+		if *pinErr != nil {
+			return nil, protocolError(*pinErr)
+		}
+		if KindOf(err) != ErrorKindUnknown {
+			return nil, err
+		}
+		return nil, transportError(err)
+	}
+	if httpResponse.Body == nil {
+		httpResponse.Body = http.NoBody
+	}
+	if o.trace != nil {
+		o.trace.StatusCode = httpResponse.StatusCode
+		o.trace.ResponseBytes = 0
+	}
+	if c.ResponseIdleTimeout > 0 {
+		httpResponse.Body = newIdleBody(httpResponse.Body, c.ResponseIdleTimeout, clockOrDefault(c.Clock))
+	}
+	httpResponse.Body = &releasingBody{ReadCloser: httpResponse.Body, release: release}
+
+	o.stats.TLS = httpResponse.TLS
+	if err := c.checkPeerCertificate(httpResponse.TLS); err != nil {
+		httpResponse.Body.Close()
+		return nil, protocolError(err)
+	}
+	if err := authError(httpResponse); err != nil {
+		httpResponse.Body.Close()
+		return nil, protocolError(err)
+	}
+	if err := decompressResponse(httpResponse); err != nil {
+		httpResponse.Body.Close()
+		return nil, protocolError(err)
+	}
+	if o.trace != nil {
+		httpResponse.Body = &countingBody{ReadCloser: httpResponse.Body, n: &o.trace.ResponseBytes}
+	}
+	return httpResponse, nil
+}
+
+// Call makes a SOAP call. An empty Body, e.g. of an operation answering only
+// in the Header, is not an error, response is left untouched. A SOAP Fault is
+// returned as *FaultError, which unwraps to the *Fault, together with the
+// *http.Response it came with. Other responses with an HTTP status of 300 or
+// above fail with a *StatusError, also together with the *http.Response. A
+// Body holding both a result and Faults is handled according to
+// PartialResultMode.
+func (c *Client) Call(ctx context.Context, soapAction string, request, response interface{}, opts ...CallOption) (*http.Response, error) {
+	return c.chain(func(ctx context.Context, action string, request, response interface{}) (*http.Response, error) {
+		return c.call(ctx, action, request, response, opts...)
+	})(ctx, soapAction, request, response)
+}
+
+// callScope is what begin sets up for a call.
+type callScope struct {
+	ctx      context.Context
+	action   string
+	o        *callOptions
+	endpoint string
+	ends     []func(err error)
+}
+
+// end finishes the call with its outcome err.
+func (cs *callScope) end(err error) {
+	for i := len(cs.ends) - 1; i >= 0; i-- {
+		cs.ends[i](err)
+	}
+}
+
+// begin runs the steps shared by Call, CallExtract and CallRaw before the
+// envelope is sent: it normalizes action, observes the call, resolves opts
+// and features, starts the instrumentation, so rejected calls are traced too,
+// admits and allows the call, resolves its policy and the endpoint. The
+// callScope must be ended, also if begin fails.
+func (c *Client) begin(ctx context.Context, action string, opts []CallOption) (*callScope, error) {
+	cs := &callScope{ctx: ctx}
+	var err error
+	if cs.action, err = normalizeAction(action); err != nil {
+		return cs, protocolError(err)
+	}
+	cs.ends = append(cs.ends, c.observe(cs.action))
+	cs.o = newCallOptions(opts)
+	c.resolveFeatures(ctx, cs.action, cs.o)
+	ctx, end := c.instrument(ctx, cs.action, cs.o)
+	cs.ends = append(cs.ends, end)
+	if err := c.admit(ctx, cs.action); err != nil {
+		return cs, err
+	}
+	record, err := c.allow(cs.action)
+	if err != nil {
+		return cs, err
+	}
+	cs.ends = append(cs.ends, record)
+	ctx, cancel, err := c.applyPolicy(ctx, cs.action, cs.o)
+	if err != nil {
+		return cs, err
+	}
+	cs.ends = append(cs.ends, func(error) { cancel() })
+	cs.ctx = ctx
+	if cs.endpoint, err = c.endpoint(cs.o); err != nil {
+		return cs, protocolError(err)
+	}
+	return cs, nil
+}
+
+// call makes the SOAP call of Call, after the middleware of Use.
+func (c *Client) call(ctx context.Context, soapAction string, request, response interface{}, opts ...CallOption) (httpResponse *http.Response, err error) {
+	cs, err := c.begin(ctx, soapAction, opts)
+	defer func() { cs.end(err) }()
+	if err != nil {
+		return nil, err
+	}
+	ctx, soapAction, o, endpoint := cs.ctx, cs.action, cs.o, cs.endpoint
+	if c.streams(soapAction, request, o) {
+		return c.withReauthentication(ctx, func() (*http.Response, error) {
+			return c.retry(ctx, nil, func() (*http.Response, error) {
+				return c.roundTripStream(ctx, endpoint, soapAction, request, response, o)
+			})
+		})
+	}
+	return c.withReauthentication(ctx, func() (*http.Response, error) {
+		xmlBytes, err := c.marshalEnvelope(soapAction, request, o)
+		if err != nil {
+			return nil, err
+		}
+		return c.retry(ctx, o.retryPolicy, func() (*http.Response, error) {
+			return c.roundTrip(ctx, endpoint, soapAction, xmlBytes, response, o)
+		})
+	})
+}
+
+// roundTrip makes a single attempt of a SOAP call posting the envelope
+// xmlBytes and decoding the response into response.
+func (c *Client) roundTrip(ctx context.Context, endpoint, soapAction string, xmlBytes []byte, response interface{}, o *callOptions) (*http.Response, error) {
+	req, err := c.prepareRequest(ctx, endpoint, soapAction, xmlBytes, o)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(req, soapAction, xmlBytes, response, o)
+}
+
+// send sends req posting the envelope xmlBytes and decodes the response into
+// response.
+func (c *Client) send(req *http.Request, soapAction string, xmlBytes []byte, response interface{}, o *callOptions) (*http.Response, error) {
+	logTraceID := c.logRequest(req, xmlBytes)
+	archiveID := c.archiveRequest(req, soapAction, xmlBytes)
+	httpResponse, err := c.do(req, o)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkIntegrity(httpResponse, o); err != nil {
+		httpResponse.Body.Close()
+		return nil, err
+	}
 	defer httpResponse.Body.Close()
+	defer c.archiveResponse(archiveID, req, soapAction, httpResponse)()
+
+	if httpResponse, err = c.decodeResponse(httpResponse, response, o, logTraceID); err != nil {
+		return httpResponse, err
+	}
+	return httpResponse, c.checkResponseHeaders(soapAction, o)
+}
 
+// decodeResponse reads the SOAP envelope from httpResponse and decodes it into
+// response.
+func (c *Client) decodeResponse(httpResponse *http.Response, response interface{}, o *callOptions, logTraceID string) (*http.Response, error) {
 	if c.Log != nil {
 		c.Log("Response header", "log_trace_id", logTraceID, "header", httpResponse.Header)
 	}
@@ -153,41 +732,40 @@ func (c *Client) Call(ctx context.Context, soapAction string, request, response
 		c.Log("MIMETYPE", "log_trace_id", logTraceID, "mediaType", mediaType)
 	}
 	var rawBody []byte
-	if strings.HasPrefix(mediaType, "multipart/") { // MULTIPART MESSAGE
-		mr := multipart.NewReader(httpResponse.Body, params["boundary"])
-		// If this is a multipart message, search for the soapy part
-		foundSoap := false
-		for {
-			p, err := mr.NextPart()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return nil, err
-			}
-			slurp, err := ioutil.ReadAll(p)
-			if err != nil {
-				return nil, err
-			}
-			if bytes.HasPrefix(slurp, soapPrefixTagLC) || bytes.HasPrefix(slurp, soapPrefixTagUC) {
-				rawBody = slurp
-				foundSoap = true
-				break
-			}
+	body, boundary, isMultipart := c.sniffMultipart(httpResponse.Body, mediaType, params["boundary"], logTraceID)
+	if isMultipart { // MULTIPART MESSAGE
+		rawBody, o.stats.Multipart, err = soapPart(body, boundary)
+		c.logMultipart(o.stats.Multipart, logTraceID)
+		if err != nil {
+			return nil, err
 		}
-		if !foundSoap {
-			return nil, errors.New("multipart message does contain a soapy part")
+		envelopePart := o.stats.Multipart.Parts[o.stats.Multipart.Envelope]
+		var converted []byte
+		if converted, err = c.toUTF8(rawBody, charsetOf(envelopePart.ContentType)); err != nil {
+			return undecodableCharset(httpResponse, rawBody, err)
 		}
+		rawBody = converted
 	} else { // SINGLE PART MESSAGE
-		rawBody, err = ioutil.ReadAll(httpResponse.Body)
+		rawBody, err = ioutil.ReadAll(body)
 		if err != nil {
-			return httpResponse, err // return both
+			if len(rawBody) > 0 {
+				err = bodyConsumedError{err}
+			}
+			return httpResponse, readError(err) // return both
+		}
+		var converted []byte
+		if converted, err = c.toUTF8(rawBody, params["charset"]); err != nil {
+			return undecodableCharset(httpResponse, rawBody, err)
 		}
+		rawBody = converted
 		// Check if there is a body and if yes if it's a soapy one.
 		if len(rawBody) == 0 {
 			if c.Log != nil {
 				c.Log("INFO: Response Body is empty!", "log_trace_id", logTraceID)
 			}
+			if httpResponse.StatusCode >= 300 {
+				return httpResponse, statusError(httpResponse, rawBody)
+			}
 			return httpResponse, nil // Empty responses are ok. Sometimes Sometimes only a Status 200 or 202 comes back
 		}
 		// There is a message body, but it's not SOAP. We cannot handle this!
@@ -197,14 +775,20 @@ func (c *Client) Call(ctx context.Context, soapAction string, request, response
 				if c.Log != nil {
 					c.Log("This is not a 1.2 SOAP-Message", "log_trace_id", logTraceID, "response_bytes", rawBody)
 				}
-				return nil, fmt.Errorf("this is not a 1.2 SOAP-Message: %q", string(rawBody))
+				if httpResponse.StatusCode >= 300 {
+					return httpResponse, statusError(httpResponse, rawBody)
+				}
+				return nil, protocolError(fmt.Errorf("this is not a 1.2 SOAP-Message: %q", PrettyXML(rawBody, excerptBytes)))
 			}
 		default:
 			if !bytes.Contains(rawBody, bNamespaceSoap11) && !bytes.Contains(rawBody, bNamespaceSoap12) {
 				if c.Log != nil {
 					c.Log("This is not a 1.1 SOAP-Message", "log_trace_id", logTraceID, "response_bytes", rawBody)
 				}
-				return nil, fmt.Errorf("this is not a 1.1 SOAP-Message: %q", string(rawBody))
+				if httpResponse.StatusCode >= 300 {
+					return httpResponse, statusError(httpResponse, rawBody)
+				}
+				return nil, protocolError(fmt.Errorf("this is not a 1.1 SOAP-Message: %q", PrettyXML(rawBody, excerptBytes)))
 			}
 		}
 	}
@@ -214,32 +798,237 @@ func (c *Client) Call(ctx context.Context, soapAction string, request, response
 		c.Log("response raw body", "log_trace_id", logTraceID, "response_bytes", rawBody)
 	}
 
+	if raw, ok := response.(*rawResponse); ok {
+		raw.envelope = rawBody
+	}
+
+	// Header blocks are handed out as received, see CallStats.ResponseHeaders.
+	o.stats.ResponseHeaders, _ = headerBlocks(rawBody)
+
 	// Our structs for Envelope, Header, Body and Fault are tagged with namespace
 	// for SOAP 1.1. Therefore we must adjust namespaces for incoming SOAP 1.2
 	// messages
 	rawBody = replaceSoap12to11(rawBody)
 
+	if o.responseHeader != nil {
+		if err := decodeHeader(rawBody, o.responseHeader); err != nil {
+			return nil, protocolError(fmt.Errorf("could not decode response header: %w", err))
+		}
+	}
+
+	if o.features.ResolveMultiRefs.on() {
+		if rawBody, err = resolveMultiRefs(rawBody); err != nil {
+			return nil, protocolError(fmt.Errorf("could not resolve multiRefs: %w", err))
+		}
+	}
+	if o.unwrapResponse != "" {
+		if rawBody, err = unwrapResponse(rawBody, o.unwrapResponse); err != nil {
+			return nil, protocolError(fmt.Errorf("could not unwrap response: %w", err))
+		}
+	}
+
 	respEnvelope := &Envelope{
 		Body: Body{Content: response},
 	}
 	// Response struct may be nil, e.g. if only a Status 200 is expected. In this
 	// case, we need a Dummy response to avoid a nil pointer if we receive a
 	// SOAP-Fault instead of the empty message (unmarshalling would fail).
-	if response == nil {
+	// The same applies if a BodyDecoder or DecodeGeneric takes care of the
+	// content, we only need the framing to detect a SOAP-Fault.
+	generic, useGeneric := response.(*map[string]interface{})
+	_, useRaw := response.(*rawResponse)
+	useBodyDecoder := !useGeneric && !useRaw && c.BodyDecoder != nil && response != nil && newContentCollector(response) == nil
+	if response == nil || useBodyDecoder || useGeneric || useRaw {
 		respEnvelope.Body = Body{Content: &dummyContent{}} // must be a pointer in dummyContent
 	}
+	if o.features.ZeroResponseTarget.on() {
+		zeroTarget(response)
+	}
 	if err := xml.Unmarshal(rawBody, respEnvelope); err != nil {
-		return nil, fmt.Errorf("soap/client.go Call(): COULD NOT UNMARSHAL: %w\n", err)
+		// Don't let a malformed fault mask its message.
+		if fe := recoverFault(rawBody); fe != nil {
+			return httpResponse, applicationError(fe)
+		}
+		if httpResponse.StatusCode >= 300 {
+			return httpResponse, statusError(httpResponse, rawBody)
+		}
+		return nil, protocolError(fmt.Errorf("soap/client.go Call(): COULD NOT UNMARSHAL: %w\nfirst bytes of the body:\n%s", err, hexExcerpt(rawBody)))
 	}
 
 	// If a SOAP Fault is received, try to jsonMarshal it and return it via the
 	// error.
-	if fault := respEnvelope.Body.Fault; fault != nil {
-		return nil, fmt.Errorf("SOAP FAULT: %q", formatFaultXML(rawBody, 1))
+	if fault := respEnvelope.Body.Fault; fault != nil && respEnvelope.Body.faults == nil {
+		return httpResponse, applicationError(&FaultError{
+			Fault:     fault,
+			Raw:       rawFault(rawBody),
+			formatted: formatFaultXML(rawBody, 1),
+		})
+	}
+	if faults := respEnvelope.Body.faults; faults != nil && c.PartialResultMode != PartialResultPreferResult {
+		raw := faultElementRe.Find(rawBody)
+		fe := &FaultError{Fault: faults[0], Raw: raw, formatted: formatFaultXML(raw, 0)}
+		if c.PartialResultMode == PartialResultPreferFault {
+			return httpResponse, applicationError(fe)
+		}
+		return httpResponse, applicationError(&PartialResultError{Response: response, Faults: faults, Err: fe})
+	} else if faults != nil && c.Log != nil {
+		c.Log("dropping faults of a partial result", "log_trace_id", logTraceID, "faults", len(faults))
+	}
+	if httpResponse.StatusCode >= 300 {
+		return httpResponse, statusError(httpResponse, rawBody)
+	}
+
+	if useGeneric {
+		content, err := bodyContent(rawBody)
+		if err != nil {
+			return nil, protocolError(fmt.Errorf("soap/client.go Call(): COULD NOT UNMARSHAL: %w\n", err))
+		}
+		if content != nil {
+			if *generic, err = DecodeGeneric(content); err != nil {
+				return nil, protocolError(fmt.Errorf("soap/client.go Call(): COULD NOT UNMARSHAL: %w\n", err))
+			}
+		}
+	}
+	if useBodyDecoder {
+		content, err := bodyContent(rawBody)
+		if err != nil {
+			return nil, protocolError(fmt.Errorf("soap/client.go Call(): COULD NOT UNMARSHAL: %w\n", err))
+		}
+		if content != nil {
+			if err := c.BodyDecoder.Decode(content, response); err != nil {
+				return nil, protocolError(fmt.Errorf("soap/client.go Call(): COULD NOT UNMARSHAL: %w\n", err))
+			}
+		}
 	}
 	return httpResponse, nil
 }
 
+// CallMulti makes a SOAP call whose response Body contains several elements,
+// e.g. repeated records without a wrapper element. factory is invoked once per
+// Body element and the decoded values are returned in document order.
+func (c *Client) CallMulti(ctx context.Context, soapAction string, request interface{}, factory ElementFactory, opts ...CallOption) ([]interface{}, *http.Response, error) {
+	content := &multiContent{factory: factory}
+	httpResponse, err := c.Call(ctx, soapAction, request, content, opts...)
+	return content.values, httpResponse, err
+}
+
+// CallRawBody makes a SOAP call with body, a serialized XML element, embedded
+// verbatim as the child of the request Body. Envelope, headers and
+// authentication are as for Call. The SOAP envelope of the response is
+// returned as received, i.e. the SOAP part of a multipart response, also
+// together with a *FaultError or *StatusError. Use CallRaw to post a whole
+// envelope.
+func (c *Client) CallRawBody(ctx context.Context, soapAction string, body []byte, opts ...CallOption) (*http.Response, []byte, error) {
+	response := &rawResponse{}
+	httpResponse, err := c.Call(ctx, soapAction, rawRequest(body), response, opts...)
+	return httpResponse, response.envelope, err
+}
+
+// CallEnvelope makes a SOAP call like Call, but returns the whole response
+// envelope as received, e.g. to inspect attributes of the Envelope and Body
+// elements. The Body content is an AnyXML, the Header content is in
+// Header.Raw. The envelope is also returned together with a *FaultError and,
+// if it could be decoded, a *StatusError.
+func (c *Client) CallEnvelope(ctx context.Context, soapAction string, request interface{}, opts ...CallOption) (*EnvelopeV2, *http.Response, error) {
+	response := &rawResponse{}
+	httpResponse, err := c.Call(ctx, soapAction, request, response, opts...)
+	if response.envelope == nil {
+		return nil, httpResponse, err
+	}
+	env := &EnvelopeV2{}
+	if decodeErr := xml.Unmarshal(response.envelope, env); decodeErr != nil {
+		if err == nil {
+			err = protocolError(fmt.Errorf("could not decode envelope: %w", decodeErr))
+		}
+		return nil, httpResponse, err
+	}
+	if env.Body.Fault == nil {
+		content, decodeErr := bodyContent(response.envelope)
+		if decodeErr != nil && err == nil {
+			err = protocolError(fmt.Errorf("could not decode envelope: %w", decodeErr))
+		}
+		if content != nil {
+			env.Body.Content = AnyXML(content)
+		}
+	}
+	return env, httpResponse, err
+}
+
+// rawRequest is a serialized request Body element, see CallRawBody.
+type rawRequest []byte
+
+// rawResponse receives the response envelope, see CallRawBody.
+type rawResponse struct {
+	envelope []byte
+}
+
+// endpoint returns the URL to post to, see WithURL, with QueryParams and the
+// query parameters of o merged in. Call options win over QueryParams, which
+// win over the parameters of the URL.
+func (c *Client) endpoint(o *callOptions) (string, error) {
+	if o.url != "" {
+		if err := checkEndpoint(o.url); err != nil {
+			return "", err
+		}
+	}
+	if len(c.QueryParams) == 0 && len(o.queryParams) == 0 {
+		return c.callURL(o), nil
+	}
+	pURL, err := url.Parse(c.callURL(o))
+	if err != nil {
+		return "", err
+	}
+	query := pURL.Query()
+	for _, params := range []url.Values{c.QueryParams, o.queryParams} {
+		for key, values := range params {
+			query[key] = append([]string(nil), values...)
+		}
+	}
+	pURL.RawQuery = query.Encode()
+	return pURL.String(), nil
+}
+
+// callURL returns the URL of WithURL or the one passed to NewClient.
+func (c *Client) callURL(o *callOptions) string {
+	if o.url != "" {
+		return o.url
+	}
+	return c.url
+}
+
+// checkEndpoint tells whether endpoint is an absolute http or https URL.
+func checkEndpoint(endpoint string) error {
+	pURL, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint: %w", err)
+	}
+	if pURL.Scheme != "http" && pURL.Scheme != "https" || pURL.Host == "" {
+		return fmt.Errorf("invalid endpoint %q: want an absolute http or https URL", endpoint)
+	}
+	return nil
+}
+
+// maskURL returns u without password and with the values of
+// RedactedQueryParams masked for logging.
+func (c *Client) maskURL(u *url.URL) string {
+	masked := *u
+	if masked.User != nil {
+		masked.User = url.UserPassword(masked.User.Username(), "********")
+	}
+	if len(c.RedactedQueryParams) > 0 && masked.RawQuery != "" {
+		query := masked.Query()
+		for _, key := range c.RedactedQueryParams {
+			if values, ok := query[key]; ok {
+				for i := range values {
+					values[i] = "REDACTED"
+				}
+			}
+		}
+		masked.RawQuery = query.Encode()
+	}
+	return masked.String()
+}
+
 // Format the Soap Fault as indented string. Namespaces are dropped for better
 // readability. Tags with lower level than start level is omitted.
 func formatFaultXML(xmlBytes []byte, startLevel int) string {
@@ -314,6 +1103,17 @@ var (
 	soapPrefixTagLC = []byte("<soap")
 )
 
+// zeroTarget sets the value response points to to its zero value.
+func zeroTarget(response interface{}) {
+	if _, ok := response.(*multiContent); ok {
+		return // holds the factory of CallMulti
+	}
+	v := reflect.ValueOf(response)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+}
+
 func replaceSoap12to11(data []byte) []byte {
 	return bytes.ReplaceAll(data, bNamespaceSoap12, bNamespaceSoap11)
 }
@@ -321,17 +1121,3 @@ func replaceSoap12to11(data []byte) []byte {
 func replaceSoap11to12(data []byte) []byte {
 	return bytes.ReplaceAll(data, bNamespaceSoap11, bNamespaceSoap12)
 }
-
-const charset = "abcdefghijklmnopqrstuvwxyz" +
-	"ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-
-var seededRand = rand.New(
-	rand.NewSource(time.Now().UnixNano()))
-
-func randString(length int) string {
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[seededRand.Intn(len(charset))]
-	}
-	return string(b)
-}
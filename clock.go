@@ -0,0 +1,58 @@
+package soap
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the source of time of the Client and Server, inject your own for
+// deterministic tests, e.g. soaptest.FakeClock.
+type Clock interface {
+	Now() time.Time
+	// Sleep pauses for d or until ctx is done, in which case it returns
+	// ctx.Err().
+	Sleep(ctx context.Context, d time.Duration) error
+	// AfterFunc calls f after d, unless the returned Timer is stopped first,
+	// like time.AfterFunc.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer started by Clock.AfterFunc, see time.Timer.
+type Timer interface {
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// SystemClock is the Clock of the system, the default of the Client and
+// Server.
+type SystemClock struct{}
+
+// Now implements Clock
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Sleep implements Clock
+func (SystemClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// AfterFunc implements Clock
+func (SystemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// clockOrDefault returns c or the system clock, if c is nil.
+func clockOrDefault(c Clock) Clock {
+	if c == nil {
+		return SystemClock{}
+	}
+	return c
+}
@@ -0,0 +1,17 @@
+package soap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRealClock_Sleep(t *testing.T) {
+	assert.NoError(t, SystemClock{}.Sleep(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, SystemClock{}.Sleep(ctx, time.Hour), context.Canceled)
+}
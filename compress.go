@@ -0,0 +1,99 @@
+package soap
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// compressRequest replaces the body of req, the envelope xmlBytes, by its gzip
+// compressed form, see Client.CompressRequest.
+func compressRequest(req *http.Request, xmlBytes []byte) error {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(xmlBytes); err != nil {
+		return protocolError(err)
+	}
+	if err := zw.Close(); err != nil {
+		return protocolError(err)
+	}
+	body := compressed.Bytes()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Encoding", "gzip")
+	return nil
+}
+
+// decompressResponse replaces the body of httpResponse by its decoded form,
+// according to its Content-Encoding, as net/http does for gzip only and only
+// for requests it has added Accept-Encoding to.
+func decompressResponse(httpResponse *http.Response) error {
+	encoding := httpResponse.Header.Get("Content-Encoding")
+	if encoding == "" {
+		return nil
+	}
+	// Empty bodies, e.g. of 202 or 204 responses, are left alone, as there's
+	// no gzip header to read.
+	br := bufio.NewReader(httpResponse.Body)
+	if _, err := br.Peek(1); err == io.EOF {
+		return nil
+	}
+	body, err := decompress(br, encoding)
+	if err != nil {
+		return err
+	}
+	httpResponse.Body = &decompressedBody{Reader: body, Closer: httpResponse.Body}
+	httpResponse.Header.Del("Content-Encoding")
+	httpResponse.Header.Del("Content-Length")
+	httpResponse.ContentLength = -1
+	httpResponse.Uncompressed = true
+	return nil
+}
+
+type decompressedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// decompress returns the decoded form of r, which has been encoded with the
+// comma separated Content-Encodings encoding in order.
+func decompress(r io.Reader, encoding string) (io.Reader, error) {
+	encodings := strings.Split(encoding, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		switch strings.ToLower(strings.TrimSpace(encodings[i])) {
+		case "", "identity":
+		case "gzip", "x-gzip":
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, fmt.Errorf("could not decompress gzip encoded content: %w", err)
+			}
+			r = zr
+		case "deflate":
+			// deflate means zlib (RFC 1950), but some servers send bare
+			// deflate (RFC 1951) data.
+			br := bufio.NewReader(r)
+			if header, err := br.Peek(2); err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+				zr, err := zlib.NewReader(br)
+				if err != nil {
+					return nil, fmt.Errorf("could not decompress deflate encoded content: %w", err)
+				}
+				r = zr
+			} else {
+				r = flate.NewReader(br)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported Content-Encoding %q", encodings[i])
+		}
+	}
+	return r, nil
+}
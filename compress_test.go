@@ -0,0 +1,162 @@
+package soap
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_CompressRequest(t *testing.T) {
+	soapSrv := NewServer()
+	soapSrv.RegisterHandler("/pathTo", "foo", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			return &FooResponse{Bar: request.(*FooRequest).Foo}, nil
+		},
+	)
+	var (
+		encoding      string
+		contentLength int64
+		compressed    int
+		soapAction    string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding, contentLength, soapAction = r.Header.Get("Content-Encoding"), r.ContentLength, r.Header.Get("SOAPAction")
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		compressed = len(body)
+		if encoding == "gzip" {
+			zr, err := gzip.NewReader(strings.NewReader(string(body)))
+			require.NoError(t, err)
+			r.Body = zr
+			r.Header.Del("Content-Encoding")
+		} else {
+			r.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+		}
+		soapSrv.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL+"/pathTo", nil)
+	c.CompressRequest = true
+	foo := strings.Repeat("compressible ", 1000)
+	response := &FooResponse{}
+	_, err := c.Call(context.Background(), "foo", &FooRequest{Foo: foo}, response)
+	require.NoError(t, err)
+	assert.Equal(t, foo, response.Bar)
+	assert.Equal(t, "gzip", encoding)
+	assert.Equal(t, "foo", soapAction)
+	assert.Equal(t, int64(compressed), contentLength)
+	assert.Less(t, compressed, len(foo)/10)
+
+	_, err = c.Call(context.Background(), "foo", &FooRequest{Foo: "foo"}, response,
+		WithAttachments(NewAttachmentReader(&Attachment{ContentID: "a", Body: strings.NewReader("attached")})))
+	require.NoError(t, err)
+	assert.Empty(t, encoding, "multipart requests aren't compressed")
+}
+
+func TestClient_Call_compressedResponse(t *testing.T) {
+	const envelope = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><FooResponse><Bar>decompressed</Bar></FooResponse></soap:Body></soap:Envelope>`
+	compress := func(newWriter func(w io.Writer) io.WriteCloser) []byte {
+		var buf bytes.Buffer
+		w := newWriter(&buf)
+		_, err := w.Write([]byte(envelope))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		return buf.Bytes()
+	}
+	gzipped := compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+
+	var multipartBody bytes.Buffer
+	mw := multipart.NewWriter(&multipartBody)
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/xml"}, "Content-Encoding": {"gzip"}})
+	require.NoError(t, err)
+	_, err = part.Write(gzipped)
+	require.NoError(t, err)
+	part, err = mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/octet-stream"}, "Content-Encoding": {"deflate"}})
+	require.NoError(t, err)
+	_, err = part.Write([]byte("not even compressed"))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	for name, tc := range map[string]struct {
+		header  http.Header
+		body    []byte
+		wantErr string
+	}{
+		"gzip": {
+			header: http.Header{"Content-Encoding": {"gzip"}},
+			body:   gzipped,
+		},
+		"deflate": {
+			header: http.Header{"Content-Encoding": {"deflate"}},
+			body:   compress(func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }),
+		},
+		"bare deflate": {
+			header: http.Header{"Content-Encoding": {"Deflate"}},
+			body: compress(func(w io.Writer) io.WriteCloser {
+				fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+				return fw
+			}),
+		},
+		"gzip and identity": {
+			header: http.Header{"Content-Encoding": {"gzip, identity"}},
+			body:   gzipped,
+		},
+		"multipart": {
+			header: http.Header{"Content-Type": {"multipart/related; boundary=" + mw.Boundary()}},
+			body:   multipartBody.Bytes(),
+		},
+		"empty gzip": {
+			header: http.Header{"Content-Encoding": {"gzip"}},
+		},
+		"unknown": {
+			header:  http.Header{"Content-Encoding": {"br"}},
+			body:    []byte("\x1b\x00"),
+			wantErr: `unsupported Content-Encoding "br"`,
+		},
+		"broken gzip": {
+			header:  http.Header{"Content-Encoding": {"gzip"}},
+			body:    []byte(envelope),
+			wantErr: "could not decompress gzip encoded content",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewClient("http://localhorst.ch", nil)
+			c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: 200, Header: tc.header, Body: ioutil.NopCloser(bytes.NewReader(tc.body))}, nil
+			})}).Do
+
+			response := &FooResponse{}
+			httpResponse, err := c.Call(context.Background(), "foo", &FooRequest{}, response)
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				assert.Equal(t, ErrorKindProtocol, KindOf(err))
+				return
+			}
+			require.NoError(t, err)
+			if tc.body == nil {
+				assert.Empty(t, response.Bar)
+				return
+			}
+			assert.Equal(t, "decompressed", response.Bar)
+			assert.Empty(t, httpResponse.Header.Get("Content-Encoding"))
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package soap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDeadLetterMaxBytes is the size cap of the body of a FailedRequest, if
+// Server.DeadLetterMaxBytes is 0.
+const DefaultDeadLetterMaxBytes = 64 << 10
+
+// FailureCategory tells why a request failed, see FailedRequest.
+type FailureCategory string
+
+// Categories of FailedRequests
+const (
+	// FailureDecode is a request which couldn't be read or parsed.
+	FailureDecode FailureCategory = "decode"
+	// FailureRouting is a request without a handler, e.g. of an unknown
+	// action.
+	FailureRouting FailureCategory = "routing"
+	// FailureValidation is a request with invalid values, see
+	// Server.ValidateEnums.
+	FailureValidation FailureCategory = "validation"
+	// FailurePanic is a request the handler of which panicked.
+	FailurePanic FailureCategory = "panic"
+)
+
+// failureCategories are the categories of the PreDispatchReasons.
+var failureCategories = map[PreDispatchReason]FailureCategory{
+	PreDispatchMethodNotAllowed:     FailureRouting,
+	PreDispatchUnsupportedMediaType: FailureDecode,
+	PreDispatchVersionMismatch:      FailureDecode,
+	PreDispatchBodyTooLarge:         FailureDecode,
+	PreDispatchReadFailed:           FailureDecode,
+	PreDispatchUnknownPath:          FailureRouting,
+	PreDispatchUnknownAction:        FailureRouting,
+	PreDispatchMalformedEnvelope:    FailureDecode,
+	PreDispatchNoHandler:            FailureRouting,
+	PreDispatchInvalidValue:         FailureValidation,
+}
+
+// FailedRequest is a request the Server failed to decode or dispatch, see
+// Server.DeadLetter.
+type FailedRequest struct {
+	Time     time.Time
+	Category FailureCategory
+	// Reason is the reason of requests rejected before dispatch, "" for
+	// panics.
+	Reason PreDispatchReason
+	Method string
+	URL    string
+	// Header is the request header, the values of
+	// Server.DeadLetterRedactHeaders replaced by "REDACTED".
+	Header     http.Header
+	RemoteAddr string
+	// Body is the request body up to Server.DeadLetterMaxBytes, Truncated
+	// tells whether there has been more. The text of RedactedElements, e.g.
+	// wsse:Password, is masked.
+	Body      []byte
+	Truncated bool
+	Err       error
+	// Fault is the Fault sent in response, nil if the response has been a
+	// plain HTTP error or, for panics, none has been sent.
+	Fault *Fault
+}
+
+// capturedBody keeps the first bytes read from a request body for
+// Server.DeadLetter.
+type capturedBody struct {
+	io.ReadCloser
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (cb *capturedBody) Read(p []byte) (int, error) {
+	n, err := cb.ReadCloser.Read(p)
+	keep := n
+	if room := cb.max - len(cb.buf); keep > room {
+		keep = room
+		cb.truncated = true
+	}
+	cb.buf = append(cb.buf, p[:keep]...)
+	return n, err
+}
+
+// captureBody makes r keep the beginning of its body for DeadLetter. Without
+// a DeadLetter it returns nil.
+func (s *Server) captureBody(r *http.Request) *capturedBody {
+	if s.DeadLetter == nil {
+		return nil
+	}
+	cb := &capturedBody{ReadCloser: r.Body, max: s.deadLetterMaxBytes()}
+	r.Body = cb
+	return cb
+}
+
+// capturedBytes returns the beginning of a request body which has already
+// been read for DeadLetter. Without a DeadLetter it returns nil.
+func (s *Server) capturedBytes(body []byte) *capturedBody {
+	if s.DeadLetter == nil {
+		return nil
+	}
+	cb := &capturedBody{ReadCloser: http.NoBody, max: s.deadLetterMaxBytes()}
+	cb.buf = body
+	if len(body) > cb.max {
+		cb.buf, cb.truncated = body[:cb.max], true
+	}
+	return cb
+}
+
+func (s *Server) deadLetterMaxBytes() int {
+	if s.DeadLetterMaxBytes <= 0 {
+		return DefaultDeadLetterMaxBytes
+	}
+	return int(s.DeadLetterMaxBytes)
+}
+
+// defaultDeadLetterRedactHeaders are the headers redacted if
+// Server.DeadLetterRedactHeaders is nil.
+var defaultDeadLetterRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// deadLetterHeader returns a copy of h with the values of the
+// DeadLetterRedactHeaders replaced.
+func (s *Server) deadLetterHeader(h http.Header) http.Header {
+	redact := s.DeadLetterRedactHeaders
+	if redact == nil {
+		redact = defaultDeadLetterRedactHeaders
+	}
+	h = h.Clone()
+	for _, name := range redact {
+		values := h.Values(name)
+		for i := range values {
+			values[i] = "REDACTED"
+		}
+	}
+	return h
+}
+
+// redactBody masks the text content of the RedactedElements in body, which
+// may be truncated and thus not well formed.
+func redactBody(body []byte) []byte {
+	names := make([]string, len(RedactedElements))
+	for i, name := range RedactedElements {
+		names[i] = regexp.QuoteMeta(name)
+	}
+	re := regexp.MustCompile(`(<(?:[\w.-]+:)?(?:` + strings.Join(names, "|") + `)(?:\s[^>]*[^/])?>)[^<]+`)
+	return re.ReplaceAll(body, []byte("${1}"+redactedValue))
+}
+
+// deadLetter hands the request r, which failed with err, to DeadLetter. body
+// is the captured request body, the rest of which is read up to the size cap.
+func (s *Server) deadLetter(r *http.Request, body *capturedBody, category FailureCategory, reason PreDispatchReason, err error, fault *Fault) {
+	if s.DeadLetter == nil {
+		return
+	}
+	fr := FailedRequest{
+		Time:       clockOrDefault(s.Clock).Now(),
+		Category:   category,
+		Reason:     reason,
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		Header:     s.deadLetterHeader(r.Header),
+		RemoteAddr: r.RemoteAddr,
+		Err:        err,
+		Fault:      fault,
+	}
+	if body != nil {
+		if room := body.max - len(body.buf); room >= 0 {
+			io.Copy(ioutil.Discard, io.LimitReader(body, int64(room)+1))
+		}
+		fr.Body, fr.Truncated = redactBody(body.buf), body.truncated
+	}
+	s.DeadLetter(r.Context(), fr)
+}
+
+// deadLetterRejected hands a request rejected with pe to DeadLetter.
+func (s *Server) deadLetterRejected(r *http.Request, body *capturedBody, pe error) {
+	if s.DeadLetter == nil {
+		return
+	}
+	reason := PreDispatchReason("")
+	if e, ok := pe.(PreDispatchError); ok {
+		reason = e.Reason
+	}
+	var fault *Fault
+	if s.rejectsWithFault() {
+		fault = s.faultFor(pe)
+	}
+	s.deadLetter(r, body, failureCategories[reason], reason, pe, fault)
+}
+
+// deadLetterPanic hands a request the handler of which panicked to
+// DeadLetter, the panic goes on. It must be deferred.
+func (s *Server) deadLetterPanic(r *http.Request, body *capturedBody) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	s.deadLetter(r, body, FailurePanic, "", fmt.Errorf("handler panicked: %v", v), nil)
+	panic(v)
+}
+
+// rejectsWithFault tells whether requests rejected before dispatch get a
+// Fault, see PreDispatchErrorMode.
+func (s *Server) rejectsWithFault() bool {
+	switch {
+	case s.PreDispatchErrorMode == PreDispatchErrorPlain:
+		return false
+	case s.PreDispatchErrorMode == PreDispatchErrorCustom && s.PreDispatchErrorFn != nil:
+		return false
+	}
+	return true
+}
+
+// DeadLetterSpool is a Server.DeadLetter writing FailedRequests as JSON files
+// to a directory, keeping the newest MaxFiles of them.
+type DeadLetterSpool struct {
+	Dir string
+	// MaxFiles is the number of files kept, older ones are removed. 0 means
+	// no limit.
+	MaxFiles int
+	// Log receives errors writing the spool, which are dropped otherwise.
+	Log func(...interface{})
+
+	mu  sync.Mutex
+	seq int
+}
+
+// NewDeadLetterSpool returns a DeadLetterSpool writing to dir, which is
+// created if missing.
+func NewDeadLetterSpool(dir string, maxFiles int) (*DeadLetterSpool, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &DeadLetterSpool{Dir: dir, MaxFiles: maxFiles}, nil
+}
+
+// deadLetterFile is the JSON document of a FailedRequest.
+type deadLetterFile struct {
+	Time       time.Time         `json:"time"`
+	Category   FailureCategory   `json:"category"`
+	Reason     PreDispatchReason `json:"reason,omitempty"`
+	Method     string            `json:"method"`
+	URL        string            `json:"url"`
+	Header     http.Header       `json:"header"`
+	RemoteAddr string            `json:"remote_addr"`
+	Body       []byte            `json:"body"`
+	Truncated  bool              `json:"truncated,omitempty"`
+	Error      string            `json:"error"`
+	Fault      *Fault            `json:"fault,omitempty"`
+}
+
+// DeadLetter writes fr to a new file of the spool, it can be used as
+// Server.DeadLetter.
+func (ds *DeadLetterSpool) DeadLetter(ctx context.Context, fr FailedRequest) {
+	doc := deadLetterFile{
+		Time:       fr.Time.UTC(),
+		Category:   fr.Category,
+		Reason:     fr.Reason,
+		Method:     fr.Method,
+		URL:        fr.URL,
+		Header:     fr.Header,
+		RemoteAddr: fr.RemoteAddr,
+		Body:       fr.Body,
+		Truncated:  fr.Truncated,
+		Fault:      fr.Fault,
+	}
+	if fr.Err != nil {
+		doc.Error = fr.Err.Error()
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		ds.log("could not encode dead letter:", err)
+		return
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.seq++
+	// Names sort by time, which rotation relies on.
+	name := fmt.Sprintf("%s-%06d.json", doc.Time.Format("20060102T150405.000000000Z"), ds.seq)
+	if err := ioutil.WriteFile(filepath.Join(ds.Dir, name), data, 0o640); err != nil {
+		ds.log("could not write dead letter:", err)
+		return
+	}
+	ds.rotate()
+}
+
+// rotate removes the oldest files beyond MaxFiles.
+func (ds *DeadLetterSpool) rotate() {
+	if ds.MaxFiles <= 0 {
+		return
+	}
+	entries, err := ioutil.ReadDir(ds.Dir)
+	if err != nil {
+		ds.log("could not rotate dead letters:", err)
+		return
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	for len(names) > ds.MaxFiles {
+		if err := os.Remove(filepath.Join(ds.Dir, names[0])); err != nil {
+			ds.log("could not rotate dead letters:", err)
+		}
+		names = names[1:]
+	}
+}
+
+func (ds *DeadLetterSpool) log(args ...interface{}) {
+	if ds.Log != nil {
+		ds.Log(args...)
+	}
+}
@@ -0,0 +1,235 @@
+package soap
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func deadLetterServer(letters *[]FailedRequest) *Server {
+	soapSrv := NewServer()
+	soapSrv.ValidateEnums = true
+	soapSrv.DeadLetter = func(ctx context.Context, r FailedRequest) {
+		*letters = append(*letters, r)
+	}
+	soapSrv.RegisterHandler("/pathTo", "order", "orderRequest",
+		func() interface{} {
+			return &orderRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			if request.(*orderRequest).Status == orderStatusClosed {
+				panic("closed")
+			}
+			return &FooResponse{Bar: "ok"}, nil
+		},
+	)
+	return soapSrv
+}
+
+func TestServer_DeadLetter(t *testing.T) {
+	const envelope = `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body>%s</Body></Envelope>`
+	tests := []struct {
+		name         string
+		action       string
+		body         string
+		wantCategory FailureCategory
+		wantReason   PreDispatchReason
+		wantFault    bool
+	}{
+		{
+			name:         "malformed envelope",
+			action:       "order",
+			body:         `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><orderRequest>`,
+			wantCategory: FailureDecode,
+			wantReason:   PreDispatchMalformedEnvelope,
+			wantFault:    true,
+		},
+		{
+			name:         "unknown action",
+			action:       "unknown",
+			body:         strings.Replace(envelope, "%s", "<orderRequest/>", 1),
+			wantCategory: FailureRouting,
+			wantReason:   PreDispatchUnknownAction,
+			wantFault:    true,
+		},
+		{
+			name:         "invalid value",
+			action:       "order",
+			body:         strings.Replace(envelope, "%s", "<orderRequest><status>PENDING</status></orderRequest>", 1),
+			wantCategory: FailureValidation,
+			wantReason:   PreDispatchInvalidValue,
+			wantFault:    true,
+		},
+		{
+			name:         "panic",
+			action:       "order",
+			body:         strings.Replace(envelope, "%s", "<orderRequest><status>CLOSED</status></orderRequest>", 1),
+			wantCategory: FailurePanic,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var letters []FailedRequest
+			soapSrv := deadLetterServer(&letters)
+			r := httptest.NewRequest("POST", "/pathTo", strings.NewReader(tt.body))
+			r.Header.Set("SOAPAction", tt.action)
+			r.RemoteAddr = "192.0.2.1:4711"
+			w := httptest.NewRecorder()
+			if tt.wantCategory == FailurePanic {
+				assert.PanicsWithValue(t, "closed", func() { soapSrv.ServeHTTP(w, r) }, "the panic goes on")
+			} else {
+				soapSrv.ServeHTTP(w, r)
+			}
+
+			require.Len(t, letters, 1)
+			fr := letters[0]
+			assert.Equal(t, tt.wantCategory, fr.Category)
+			assert.Equal(t, tt.wantReason, fr.Reason)
+			assert.Equal(t, "POST", fr.Method)
+			assert.Equal(t, "/pathTo", fr.URL)
+			assert.Equal(t, tt.action, fr.Header.Get("SOAPAction"))
+			assert.Equal(t, "192.0.2.1:4711", fr.RemoteAddr)
+			assert.Equal(t, tt.body, string(fr.Body))
+			assert.False(t, fr.Truncated)
+			assert.Error(t, fr.Err)
+			if tt.wantFault {
+				require.NotNil(t, fr.Fault)
+				assert.Equal(t, fr.Err.Error(), fr.Fault.String)
+			} else {
+				assert.Nil(t, fr.Fault)
+			}
+		})
+	}
+}
+
+func TestServer_DeadLetter_notFailed(t *testing.T) {
+	var letters []FailedRequest
+	soapSrv := deadLetterServer(&letters)
+	srv := httptest.NewServer(soapSrv)
+	defer srv.Close()
+
+	_, err := NewClient(srv.URL+"/pathTo", nil).Call(context.Background(), "order", &orderRequest{Status: orderStatusOpen}, &FooResponse{})
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+}
+
+func TestServer_DeadLetter_maxBytes(t *testing.T) {
+	var letters []FailedRequest
+	soapSrv := deadLetterServer(&letters)
+	soapSrv.DeadLetterMaxBytes = 16
+	soapSrv.PreDispatchErrorMode = PreDispatchErrorPlain
+
+	body := "<Envelope><Body>" + strings.Repeat("x", 1024)
+	r := httptest.NewRequest("POST", "/pathTo", strings.NewReader(body))
+	r.Header.Set("SOAPAction", "order")
+	w := httptest.NewRecorder()
+	soapSrv.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	require.Len(t, letters, 1)
+	assert.Equal(t, body[:16], string(letters[0].Body))
+	assert.True(t, letters[0].Truncated)
+	assert.Nil(t, letters[0].Fault, "plain errors have no fault")
+}
+
+func TestServer_DeadLetter_unconfigured(t *testing.T) {
+	soapSrv := deadLetterServer(new([]FailedRequest))
+	soapSrv.DeadLetter = nil
+	r := httptest.NewRequest("POST", "/pathTo", strings.NewReader("<Envelope>"))
+	body := r.Body
+	soapSrv.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, body, r.Body, "bodies aren't captured without a DeadLetter")
+}
+
+func TestServer_HandleMessage_DeadLetter(t *testing.T) {
+	var letters []FailedRequest
+	soapSrv := deadLetterServer(&letters)
+	body := []byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><orderRequest/></Body></Envelope>`)
+	r := httptest.NewRequest("POST", "/pathTo", nil)
+	r.Header.Set("SOAPAction", "unknown")
+	_, err := soapSrv.HandleMessage(httptest.NewRecorder(), r, body)
+	require.Error(t, err)
+
+	require.Len(t, letters, 1)
+	assert.Equal(t, FailureRouting, letters[0].Category)
+	assert.Equal(t, body, letters[0].Body)
+}
+
+func TestDeadLetterSpool(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "spool")
+	spool, err := NewDeadLetterSpool(dir, 2)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, reason := range []PreDispatchReason{PreDispatchUnknownPath, PreDispatchUnknownAction, PreDispatchNoHandler} {
+		spool.DeadLetter(context.Background(), FailedRequest{
+			Time:     now.Add(time.Duration(i) * time.Second),
+			Category: FailureRouting,
+			Reason:   reason,
+			Method:   "POST",
+			URL:      "/pathTo",
+			Header:   http.Header{"Soapaction": {"unknown"}},
+			Body:     []byte("<Envelope/>"),
+			Err:      PreDispatchError{Reason: reason, Err: assert.AnError},
+			Fault:    &Fault{Code: "soap:Client", String: "unknown"},
+		})
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2, "the oldest file has been rotated")
+	data, err := ioutil.ReadFile(filepath.Join(dir, entries[0].Name()))
+	require.NoError(t, err)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &doc))
+	assert.Equal(t, "unknown_action", doc["reason"])
+	assert.Equal(t, "2024-03-01T12:00:01Z", doc["time"])
+	assert.Equal(t, "PEVudmVsb3BlLz4=", doc["body"])
+	assert.Equal(t, assert.AnError.Error(), doc["error"])
+}
+
+func TestServer_DeadLetter_redacted(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := NewDeadLetterSpool(dir, 0)
+	require.NoError(t, err)
+	soapSrv := deadLetterServer(new([]FailedRequest))
+	soapSrv.DeadLetter = spool.DeadLetter
+
+	body := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Header>` +
+		`<wsse:Security xmlns:wsse="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"><wsse:UsernameToken>` +
+		`<wsse:Username>alice</wsse:Username><wsse:Password Type="PasswordText">s3cr3t</wsse:Password>` +
+		`</wsse:UsernameToken></wsse:Security></soap:Header><soap:Body><orderRequest>`
+	r := httptest.NewRequest("POST", "/pathTo", strings.NewReader(body))
+	r.Header.Set("SOAPAction", "order")
+	r.Header.Set("Authorization", "Basic YWxpY2U6czNjcjN0")
+	r.Header.Set("Cookie", "session=0123456789")
+	soapSrv.ServeHTTP(httptest.NewRecorder(), r)
+
+	entries, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	data, err := ioutil.ReadFile(filepath.Join(dir, entries[0].Name()))
+	require.NoError(t, err)
+	var doc struct {
+		Header http.Header `json:"header"`
+		Body   []byte      `json:"body"`
+	}
+	require.NoError(t, json.Unmarshal(data, &doc))
+	assert.NotContains(t, string(data), "YWxpY2U6czNjcjN0")
+	assert.NotContains(t, string(data), "0123456789")
+	assert.Equal(t, "REDACTED", doc.Header.Get("Authorization"))
+	assert.Equal(t, "REDACTED", doc.Header.Get("Cookie"))
+	assert.Equal(t, "order", doc.Header.Get("SOAPAction"))
+	assert.NotContains(t, string(doc.Body), "s3cr3t")
+	assert.Contains(t, string(doc.Body), `<wsse:Password Type="PasswordText">********</wsse:Password>`)
+	assert.Contains(t, string(doc.Body), "<wsse:Username>alice</wsse:Username>")
+}
@@ -0,0 +1,50 @@
+package soap
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// ErrCallerDeadlinePassed is the error the Server sends a Fault for, if the
+// deadline of Server.DeadlineFromHeader passed before the handler would run.
+var ErrCallerDeadlinePassed = NewFault("soap:Server", "caller deadline already passed")
+
+type requestReceivedKey struct{}
+
+// withRequestReceived returns r with the time it has been received in its
+// context, see handlerContext.
+func (s *Server) withRequestReceived(r *http.Request) *http.Request {
+	if s.DeadlineFromHeader == nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), requestReceivedKey{}, clockOrDefault(s.Clock).Now()))
+}
+
+// handlerContext returns the context of the handler of r, bounded by
+// HandlerTimeout and the deadline of DeadlineFromHeader, counted from the
+// receipt of r.
+func (s *Server) handlerContext(r *http.Request) (context.Context, context.CancelFunc, error) {
+	timeout := s.HandlerTimeout
+	if s.DeadlineFromHeader != nil {
+		if ttl, ok := s.DeadlineFromHeader(RequestHeaders(r.Context())); ok {
+			now := clockOrDefault(s.Clock).Now()
+			received, ok := r.Context().Value(requestReceivedKey{}).(time.Time)
+			if !ok {
+				received = now
+			}
+			remaining := received.Add(ttl).Sub(now)
+			if remaining <= 0 {
+				return nil, nil, ErrCallerDeadlinePassed
+			}
+			if timeout <= 0 || remaining < timeout {
+				timeout = remaining
+			}
+		}
+	}
+	if timeout <= 0 {
+		return r.Context(), func() {}, nil
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return ctx, cancel, nil
+}
@@ -0,0 +1,95 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// requestTTL is a vendor header telling how long the caller waits.
+type requestTTL struct {
+	XMLName xml.Name `xml:"RequestTTL"`
+	Millis  int      `xml:",chardata"`
+}
+
+func requestTTLDeadline(headers []HeaderBlock) (time.Duration, bool) {
+	for _, h := range headers {
+		if h.Name.Local != "RequestTTL" {
+			continue
+		}
+		var s string
+		if xml.Unmarshal(h.Raw, &s) != nil {
+			return 0, false
+		}
+		millis, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, false
+		}
+		return time.Duration(millis) * time.Millisecond, true
+	}
+	return 0, false
+}
+
+func TestServer_DeadlineFromHeader(t *testing.T) {
+	var (
+		invoked     bool
+		deadline    time.Time
+		hasDeadline bool
+	)
+	soapSrv := NewServer()
+	soapSrv.DeadlineFromHeader = requestTTLDeadline
+	soapSrv.RegisterHandler("/pathTo", "foo", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			invoked = true
+			deadline, hasDeadline = httpRequest.Context().Deadline()
+			return &FooResponse{Bar: "ok"}, nil
+		},
+	)
+	srv := httptest.NewServer(soapSrv)
+	defer srv.Close()
+	c := NewClient(srv.URL+"/pathTo", nil)
+
+	for name, tc := range map[string]struct {
+		headers        []interface{}
+		handlerTimeout time.Duration
+		wantTimeout    time.Duration // 0 for no deadline
+		wantFault      bool
+	}{
+		"no header":                 {},
+		"ttl":                       {headers: []interface{}{&requestTTL{Millis: 5000}}, wantTimeout: 5 * time.Second},
+		"bounded by HandlerTimeout": {headers: []interface{}{&requestTTL{Millis: 5000}}, handlerTimeout: time.Second, wantTimeout: time.Second},
+		"HandlerTimeout only":       {handlerTimeout: time.Second, wantTimeout: time.Second},
+		"deadline passed":           {headers: []interface{}{&requestTTL{Millis: 0}}, wantFault: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			invoked, hasDeadline = false, false
+			soapSrv.HandlerTimeout = tc.handlerTimeout
+			start := time.Now()
+			_, err := c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{}, WithHeaders(tc.headers...))
+			if tc.wantFault {
+				var fe *FaultError
+				require.True(t, errors.As(err, &fe), "%v", err)
+				assert.Equal(t, "caller deadline already passed", fe.Fault.String)
+				assert.False(t, invoked)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, invoked)
+			require.Equal(t, tc.wantTimeout != 0, hasDeadline)
+			if hasDeadline {
+				assert.WithinDuration(t, start.Add(tc.wantTimeout), deadline, 500*time.Millisecond)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package soap
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	// DefaultDeflateLevel is the compression level of DeflatedBase64 values
+	// without their own Level.
+	DefaultDeflateLevel = flate.DefaultCompression
+	// DefaultMaxInflatedSize is the maximum decompressed size of
+	// DeflatedBase64 values without their own MaxInflatedSize.
+	DefaultMaxInflatedSize int64 = 64 << 20
+)
+
+// ErrInflatedTooLarge is returned when a DeflatedBase64 value decompresses to
+// more than its maximum size.
+var ErrInflatedTooLarge = errors.New("deflated value exceeds maximum inflated size")
+
+// DeflatedBase64 is binary data transmitted deflate (RFC 1951) compressed and
+// base64 encoded, as XML character data or attribute value. Data holds the
+// uncompressed bytes.
+//
+// The value is compressed and encoded in memory, as a whole, also when the
+// Client streams the request, see StreamThreshold, and it is never sent as
+// MTOM part. Send large binary data as Attachment instead.
+type DeflatedBase64 struct {
+	Data []byte
+
+	// Level is the compression level used on marshal, flate.HuffmanOnly,
+	// flate.BestSpeed, ... or flate.BestCompression. 0 falls back to
+	// DefaultDeflateLevel, unless UseLevel is set for flate.NoCompression.
+	Level    int  `xml:"-"`
+	UseLevel bool `xml:"-"`
+	// MaxInflatedSize guards against decompression bombs on unmarshal, 0 falls
+	// back to DefaultMaxInflatedSize. Set it on the target before
+	// unmarshaling.
+	MaxInflatedSize int64 `xml:"-"`
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (db DeflatedBase64) MarshalText() ([]byte, error) {
+	level := db.Level
+	if level == 0 && !db.UseLevel {
+		level = DefaultDeflateLevel
+	}
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fw.Write(db.Data); err != nil {
+		return nil, err
+	}
+	if err := fw.Close(); err != nil {
+		return nil, err
+	}
+	text := make([]byte, base64.StdEncoding.EncodedLen(compressed.Len()))
+	base64.StdEncoding.Encode(text, compressed.Bytes())
+	return text, nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (db *DeflatedBase64) UnmarshalText(text []byte) error {
+	maxSize := db.MaxInflatedSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxInflatedSize
+	}
+	compressed := base64.NewDecoder(base64.StdEncoding, bytes.NewReader(bytes.TrimSpace(text)))
+	fr := flate.NewReader(compressed)
+	defer fr.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(fr, maxSize+1))
+	if err != nil {
+		return fmt.Errorf("could not inflate value: %w", err)
+	}
+	if int64(len(data)) > maxSize {
+		return ErrInflatedTooLarge
+	}
+	db.Data = data
+	return nil
+}
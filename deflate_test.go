@@ -0,0 +1,72 @@
+package soap
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type documentRequest struct {
+	XMLName  xml.Name       `xml:"document"`
+	Checksum DeflatedBase64 `xml:"checksum,attr"`
+	Payload  DeflatedBase64 `xml:"payload"`
+}
+
+func TestDeflatedBase64(t *testing.T) {
+	payload := bytes.Repeat([]byte("SOAP is dead - long live SOAP. "), 1000)
+
+	t.Run("round trip", func(t *testing.T) {
+		xmlBytes, err := xml.Marshal(documentRequest{
+			Checksum: DeflatedBase64{Data: []byte("c0ffee")},
+			Payload:  DeflatedBase64{Data: payload, Level: flate.BestCompression},
+		})
+		require.NoError(t, err)
+		assert.Less(t, len(xmlBytes), len(payload)/10)
+
+		var have documentRequest
+		require.NoError(t, xml.Unmarshal(xmlBytes, &have))
+		assert.Exactly(t, []byte("c0ffee"), have.Checksum.Data)
+		assert.Exactly(t, payload, have.Payload.Data)
+	})
+
+	t.Run("levels", func(t *testing.T) {
+		stored, err := DeflatedBase64{Data: payload, UseLevel: true}.MarshalText()
+		require.NoError(t, err)
+		assert.Greater(t, len(stored), len(payload), "flate.NoCompression")
+
+		defaulted, err := DeflatedBase64{Data: payload}.MarshalText()
+		require.NoError(t, err)
+		assert.Less(t, len(defaulted), len(payload)/10, "DefaultDeflateLevel")
+
+		var have DeflatedBase64
+		require.NoError(t, have.UnmarshalText(stored))
+		assert.Exactly(t, payload, have.Data)
+	})
+
+	t.Run("decompression bomb", func(t *testing.T) {
+		xmlBytes, err := xml.Marshal(documentRequest{
+			Payload: DeflatedBase64{Data: payload},
+		})
+		require.NoError(t, err)
+
+		have := documentRequest{
+			Payload: DeflatedBase64{MaxInflatedSize: int64(len(payload) - 1)},
+		}
+		assert.ErrorIs(t, xml.Unmarshal(xmlBytes, &have), ErrInflatedTooLarge)
+
+		have = documentRequest{
+			Payload: DeflatedBase64{MaxInflatedSize: int64(len(payload))},
+		}
+		require.NoError(t, xml.Unmarshal(xmlBytes, &have))
+		assert.Exactly(t, payload, have.Payload.Data)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		var have documentRequest
+		assert.Error(t, xml.Unmarshal([]byte(`<document><payload>not base64!</payload></document>`), &have))
+	})
+}
@@ -0,0 +1,91 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"sort"
+)
+
+// sortAttributes rewrites the start tags of the XML document data with their
+// attributes in the order of DeterministicOutput: the default namespace
+// declaration, the prefix declarations by prefix, the attributes without
+// namespace by name, and the namespaced attributes by namespace URI and name,
+// like Exclusive XML Canonicalization. Anything else is kept byte by byte.
+func sortAttributes(data []byte) ([]byte, error) {
+	scopes := []map[string]string{{"xml": NamespaceXMLSpace}}
+	var (
+		out  bytes.Buffer
+		last int64 // data up to last has been written to out
+	)
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		offset := d.InputOffset()
+		token, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tt := token.(type) {
+		case xml.EndElement:
+			scopes = scopes[:len(scopes)-1]
+		case xml.StartElement:
+			parent := scopes[len(scopes)-1]
+			ns := make(map[string]string, len(parent))
+			for p, uri := range parent {
+				ns[p] = uri
+			}
+			for _, a := range tt.Attr {
+				if a.Name.Space == "xmlns" {
+					ns[a.Name.Local] = a.Value
+				}
+			}
+			scopes = append(scopes, ns)
+			attrs := append([]xml.Attr(nil), tt.Attr...)
+			sort.SliceStable(attrs, func(i, j int) bool {
+				ri, rj := attrRank(attrs[i]), attrRank(attrs[j])
+				if ri != rj {
+					return ri < rj
+				}
+				if ri == 3 && ns[attrs[i].Name.Space] != ns[attrs[j].Name.Space] {
+					return ns[attrs[i].Name.Space] < ns[attrs[j].Name.Space]
+				}
+				return attrs[i].Name.Local < attrs[j].Name.Local
+			})
+			if attrsEqual(attrs, tt.Attr) {
+				continue
+			}
+			end := d.InputOffset()
+			out.Write(data[last:offset])
+			writeStartTag(&out, tt.Name, attrs, bytes.HasSuffix(data[offset:end], []byte("/>")))
+			last = end
+		}
+	}
+	out.Write(data[last:])
+	return out.Bytes(), nil
+}
+
+// attrRank returns the group of a, as RawToken returns it, in the order of
+// sortAttributes.
+func attrRank(a xml.Attr) int {
+	switch {
+	case a.Name.Space == "" && a.Name.Local == "xmlns":
+		return 0
+	case a.Name.Space == "xmlns":
+		return 1
+	case a.Name.Space == "":
+		return 2
+	}
+	return 3
+}
+
+func attrsEqual(a, b []xml.Attr) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
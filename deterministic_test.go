@@ -0,0 +1,78 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortAttributes(t *testing.T) {
+	got, err := sortAttributes([]byte(`<a z="1" xmlns:y="urn:a" y:b="2" xmlns="urn:d" x:c="3" xmlns:x="urn:b" a="4"><b xmlns:w="urn:z" w:q="5" y:q="6"/></a>`))
+	require.NoError(t, err)
+	assert.Equal(t, `<a xmlns="urn:d" xmlns:x="urn:b" xmlns:y="urn:a" a="4" z="1" y:b="2" x:c="3"><b xmlns:w="urn:z" y:q="6" w:q="5"/></a>`, string(got))
+
+	sorted := []byte(`<a xmlns="urn:d" a="1">text &amp; <b/></a>`)
+	got, err = sortAttributes(sorted)
+	require.NoError(t, err)
+	assert.Equal(t, string(sorted), string(got), "sorted documents are kept byte by byte")
+}
+
+type deterministicRequest struct {
+	XMLName xml.Name    `xml:"urn:example:orders order"`
+	ID      string      `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd Id,attr"`
+	Type    string      `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
+	Kind    string      `xml:"kind,attr"`
+	Props   PropertyBag `xml:"Property" soap:"sorted"`
+}
+
+func TestClient_DeterministicOutput(t *testing.T) {
+	c := NewClient("http://localhorst.ch", nil)
+	c.DeterministicOutput = true
+	c.EnvelopeAttrs = []xml.Attr{
+		{Name: xml.Name{Space: NamespaceXLink, Local: "href"}, Value: "urn:example:trace"},
+		EncodingStyle(NamespaceSoapEncoding),
+	}
+	c.BodyAttrs = goldenBodyAttrs
+	c.Headers = []interface{}{
+		&authToken{Token: "t0k3n"},
+		&struct {
+			XMLName xml.Name `xml:"urn:example:session Session"`
+			Version string   `xml:"version,attr"`
+			ID      string   `xml:"id,attr"`
+		}{Version: "2", ID: "s-1"},
+	}
+	var (
+		mu        sync.Mutex
+		envelopes = map[string]int{}
+	)
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		envelopes[string(body)]++
+		mu.Unlock()
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	})}).Do
+
+	var wg sync.WaitGroup
+	for i := 0; i < 1000; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request := &deterministicRequest{ID: "o-1", Type: "order", Kind: "rush", Props: NewPropertyBag(map[string]string{"size": "XL", "color": "red", "qty": "3"})}
+			_, err := c.Call(context.Background(), "order", request, nil)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	require.Len(t, envelopes, 1)
+	for envelope, count := range envelopes {
+		assert.Equal(t, 1000, count)
+		assertGolden(t, "client_1.1_deterministic.xml", []byte(envelope))
+	}
+}
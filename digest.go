@@ -0,0 +1,230 @@
+package soap
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DigestAuth credentials for HTTP Digest authentication (RFC 7616), see
+// Client.DigestAuth.
+type DigestAuth struct {
+	Login    string
+	Password string
+}
+
+// digestState keeps the last Digest challenge of the server, so subsequent
+// requests answer it right away. It is kept behind a pointer, so the Client
+// can still be copied.
+type digestState struct {
+	mu        sync.Mutex
+	challenge *digestChallenge
+	nc        uint32 // requests answering challenge so far
+}
+
+// digestChallenge is a WWW-Authenticate challenge of the Digest scheme.
+type digestChallenge struct {
+	realm, nonce, opaque, algorithm string
+	qopAuth                         bool // the server offers qop=auth
+}
+
+// doDigest sends req, answering the cached challenge if there is one. If the
+// server responds with a Digest challenge, req is sent once more with the
+// answer to it, replaying the body.
+func (c *Client) doDigest(req *http.Request) (*http.Response, error) {
+	getBody, err := replayableBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetBody == nil {
+		if req.Body, err = getBody(); err != nil {
+			return nil, err
+		}
+	}
+	if challenge, nc := c.cachedDigestChallenge(); challenge != nil {
+		if err := c.authorizeDigest(req, challenge, nc); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := c.HTTPClientDoFn(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := digestChallengeOf(resp)
+	if challenge == nil {
+		return resp, nil
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	retry := req.Clone(req.Context())
+	if retry.Body, err = getBody(); err != nil {
+		return nil, err
+	}
+	if err := c.authorizeDigest(retry, challenge, c.cacheDigestChallenge(challenge)); err != nil {
+		return nil, err
+	}
+	return c.HTTPClientDoFn(retry)
+}
+
+// cachedDigestChallenge returns the cached challenge and the nonce count of
+// the next request answering it.
+func (c *Client) cachedDigestChallenge() (*digestChallenge, uint32) {
+	if c.digest == nil {
+		return nil, 0
+	}
+	c.digest.mu.Lock()
+	defer c.digest.mu.Unlock()
+	if c.digest.challenge == nil {
+		return nil, 0
+	}
+	c.digest.nc++
+	return c.digest.challenge, c.digest.nc
+}
+
+// peekDigestChallenge returns the cached challenge, leaving the nonce count
+// alone.
+func (c *Client) peekDigestChallenge() *digestChallenge {
+	if c.digest == nil {
+		return nil
+	}
+	c.digest.mu.Lock()
+	defer c.digest.mu.Unlock()
+	return c.digest.challenge
+}
+
+// cacheDigestChallenge caches challenge and returns the nonce count of the
+// first request answering it.
+func (c *Client) cacheDigestChallenge(challenge *digestChallenge) uint32 {
+	if c.digest == nil {
+		return 1
+	}
+	c.digest.mu.Lock()
+	defer c.digest.mu.Unlock()
+	c.digest.challenge, c.digest.nc = challenge, 1
+	return 1
+}
+
+// authorizeDigest sets the Authorization header of req answering challenge
+// with the nonce count nc.
+func (c *Client) authorizeDigest(req *http.Request, challenge *digestChallenge, nc uint32) error {
+	var newHash func() hash.Hash
+	switch strings.ToUpper(strings.TrimSuffix(challenge.algorithm, "-sess")) {
+	case "", "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return protocolError(fmt.Errorf("unsupported Digest algorithm %q", challenge.algorithm))
+	}
+	h := func(s string) string {
+		sum := newHash()
+		io.WriteString(sum, s)
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+	cnonce := hex.EncodeToString(idBytes(c.newID(IDNonce)))
+	ncValue := fmt.Sprintf("%08x", nc)
+	uri := req.URL.RequestURI()
+
+	ha1 := h(c.DigestAuth.Login + ":" + challenge.realm + ":" + c.DigestAuth.Password)
+	if strings.HasSuffix(strings.ToLower(challenge.algorithm), "-sess") {
+		ha1 = h(ha1 + ":" + challenge.nonce + ":" + cnonce)
+	}
+	ha2 := h(req.Method + ":" + uri)
+	var response string
+	if challenge.qopAuth {
+		response = h(strings.Join([]string{ha1, challenge.nonce, ncValue, cnonce, "auth", ha2}, ":"))
+	} else {
+		response = h(ha1 + ":" + challenge.nonce + ":" + ha2)
+	}
+
+	params := []string{
+		fmt.Sprintf("username=%q", c.DigestAuth.Login),
+		fmt.Sprintf("realm=%q", challenge.realm),
+		fmt.Sprintf("nonce=%q", challenge.nonce),
+		fmt.Sprintf("uri=%q", uri),
+		fmt.Sprintf("response=%q", response),
+	}
+	if challenge.algorithm != "" {
+		params = append(params, "algorithm="+challenge.algorithm)
+	}
+	if challenge.opaque != "" {
+		params = append(params, fmt.Sprintf("opaque=%q", challenge.opaque))
+	}
+	if challenge.qopAuth {
+		params = append(params, "qop=auth", "nc="+ncValue, fmt.Sprintf("cnonce=%q", cnonce))
+	}
+	req.Header.Set("Authorization", "Digest "+strings.Join(params, ", "))
+	return nil
+}
+
+// digestChallengeOf returns the Digest challenge of a 401 response, nil if
+// there is none. SHA-256 is preferred over MD5, if both are offered.
+func digestChallengeOf(resp *http.Response) *digestChallenge {
+	var chosen *digestChallenge
+	for _, value := range resp.Header.Values("WWW-Authenticate") {
+		if len(value) < 7 || !strings.EqualFold(value[:7], "Digest ") {
+			continue
+		}
+		params := parseAuthParams(value[7:])
+		challenge := &digestChallenge{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: params["algorithm"],
+		}
+		for _, qop := range strings.Split(params["qop"], ",") {
+			if strings.TrimSpace(qop) == "auth" {
+				challenge.qopAuth = true
+			}
+		}
+		if chosen == nil || strings.HasPrefix(strings.ToUpper(challenge.algorithm), "SHA-256") {
+			chosen = challenge
+		}
+	}
+	return chosen
+}
+
+// parseAuthParams parses the comma separated name=value pairs of a challenge,
+// values may be quoted strings.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return params
+		}
+		name := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		var value strings.Builder
+		if strings.HasPrefix(s, `"`) {
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			if i < len(s) {
+				i++ // the closing quote
+			}
+			s = s[i:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value.WriteString(strings.TrimSpace(s[:end]))
+			s = s[end:]
+		}
+		params[name] = value.String()
+	}
+}
@@ -0,0 +1,117 @@
+package soap
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// digestServer is a fake server challenging requests for Digest
+// authentication with the algorithm and qop.
+type digestServer struct {
+	algorithm, qop string
+	newHash        func() hash.Hash
+	nonce          string
+	challenges     int
+	bodies         []string
+	ncs            []string
+}
+
+func (ds *digestServer) roundTrip(r *http.Request) (*http.Response, error) {
+	body, _ := ioutil.ReadAll(r.Body)
+	ds.bodies = append(ds.bodies, string(body))
+	if ds.valid(r) {
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><FooResponse><Bar>ok</Bar></FooResponse></Body></Envelope>`))}, nil
+	}
+	ds.challenges++
+	challenges := []string{`Digest realm="soap@example.com", nonce="` + ds.nonce + `", opaque="5ccc069c403ebaf9f0171e9517f40e41"` + ds.qop + `, algorithm=` + ds.algorithm}
+	if ds.algorithm == "SHA-256" {
+		challenges = append(challenges, `Digest realm="soap@example.com", nonce="`+ds.nonce+`", opaque="5ccc069c403ebaf9f0171e9517f40e41"`+ds.qop+`, algorithm=MD5`)
+	}
+	return &http.Response{StatusCode: http.StatusUnauthorized, Header: http.Header{"Www-Authenticate": challenges}, Body: http.NoBody}, nil
+}
+
+func (ds *digestServer) valid(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Digest ") {
+		return false
+	}
+	params := parseAuthParams(auth[7:])
+	h := func(s string) string {
+		sum := ds.newHash()
+		io.WriteString(sum, s)
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+	ha1 := h("Mufasa:soap@example.com:Circle of Life")
+	ha2 := h(r.Method + ":" + r.URL.RequestURI())
+	want := h(ha1 + ":" + ds.nonce + ":" + ha2)
+	if ds.qop != "" {
+		ds.ncs = append(ds.ncs, params["nc"])
+		want = h(strings.Join([]string{ha1, ds.nonce, params["nc"], params["cnonce"], params["qop"], ha2}, ":"))
+	}
+	return params["username"] == "Mufasa" && params["uri"] == r.URL.RequestURI() && params["opaque"] == "5ccc069c403ebaf9f0171e9517f40e41" &&
+		params["nonce"] == ds.nonce && params["algorithm"] == ds.algorithm && params["response"] == want
+}
+
+func TestClient_DigestAuth(t *testing.T) {
+	for name, ds := range map[string]*digestServer{
+		"MD5":             {algorithm: "MD5", newHash: md5.New},
+		"MD5, qop":        {algorithm: "MD5", qop: `, qop="auth,auth-int"`, newHash: md5.New},
+		"SHA-256, qop":    {algorithm: "SHA-256", qop: `, qop="auth"`, newHash: sha256.New},
+		"SHA-256, no qop": {algorithm: "SHA-256", newHash: sha256.New},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ds.nonce = "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v"
+			c := NewClient("http://localhorst.ch/soap?v=1", &BasicAuth{Login: "ignored"})
+			c.DigestAuth = &DigestAuth{Login: "Mufasa", Password: "Circle of Life"}
+			c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(ds.roundTrip)}).Do
+
+			response := &FooResponse{}
+			_, err := c.Call(context.Background(), "foo", &FooRequest{Foo: "replayed"}, response)
+			require.NoError(t, err)
+			assert.Equal(t, "ok", response.Bar)
+			assert.Equal(t, 1, ds.challenges)
+			require.Len(t, ds.bodies, 2)
+			assert.Contains(t, ds.bodies[1], "replayed")
+			assert.Equal(t, ds.bodies[0], ds.bodies[1], "the body is replayed")
+
+			_, err = c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{})
+			require.NoError(t, err)
+			assert.Equal(t, 1, ds.challenges, "the challenge is answered right away")
+			if ds.qop != "" {
+				assert.Equal(t, []string{"00000001", "00000002"}, ds.ncs)
+			}
+
+			ds.nonce = "rotated"
+			_, err = c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{})
+			require.NoError(t, err)
+			assert.Equal(t, 2, ds.challenges, "a stale nonce is challenged again")
+		})
+	}
+}
+
+func TestClient_DigestAuth_rejected(t *testing.T) {
+	ds := &digestServer{algorithm: "MD5", newHash: md5.New, nonce: "n"}
+	c := NewClient("http://localhorst.ch", nil)
+	c.DigestAuth = &DigestAuth{Login: "Mufasa", Password: "wrong"}
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(ds.roundTrip)}).Do
+
+	_, err := c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{},
+		WithAttachments(NewAttachmentReader(&Attachment{ContentID: "a", ContentType: "text/plain", Body: strings.NewReader("attached")})))
+	var ae *AuthError
+	require.ErrorAs(t, err, &ae)
+	assert.Equal(t, "Digest", ae.Scheme())
+	assert.Equal(t, 2, ds.challenges)
+	require.Len(t, ds.bodies, 2)
+	assert.Contains(t, ds.bodies[1], "attached", "streamed bodies are buffered for the replay")
+}
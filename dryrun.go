@@ -0,0 +1,69 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+)
+
+// DispatchReport describes how the Server would handle a request, see DryRun.
+type DispatchReport struct {
+	Path   string
+	Action string
+	// Element is the local name of the Body element the handler has been
+	// found for.
+	Element string
+	// AliasOf is the action an alias routes the request to, "" if the request
+	// doesn't use an alias.
+	AliasOf string
+	// MediaType is the media type of the Content-Type of the request.
+	MediaType string
+	// SoapVersion is the SOAP version of the request envelope or, if it hasn't
+	// been decoded, the one its Content-Type declares, "" if unknown.
+	SoapVersion string
+	// Request is the decoded request the handler would be called with.
+	Request interface{}
+	// Rejection tells why the request would be rejected, nil if it would be
+	// dispatched. StatusCode, Header and Body are the response it would get.
+	Rejection  *PreDispatchError
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// DryRun checks the Content-Type and SOAP version of r and decodes it like
+// ServeHTTP, but reports what would happen instead of running the handler. If the request would be rejected, the report contains
+// the response and the *PreDispatchError is returned as well.
+func (s *Server) DryRun(ctx context.Context, r *http.Request) (*DispatchReport, error) {
+	r = s.withFeatures(withRawAction(r.WithContext(ctx)))
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	report := &DispatchReport{
+		Path:        r.URL.Path,
+		Action:      requestAction(r),
+		MediaType:   mediaType,
+		SoapVersion: contentTypeVersion(mediaType, params),
+	}
+	rec := httptest.NewRecorder()
+	r = s.echoHeaders(rec, r)
+	m, reason, err := s.decodeRequest(rec, r)
+	if err != nil {
+		var pe PreDispatchError
+		errors.As(s.reject(rec, r, reason, err), &pe)
+		report.Rejection = &pe
+		report.StatusCode = rec.Code
+		report.Header = rec.Header()
+		report.Body = rec.Body.Bytes()
+		return report, &pe
+	}
+	report.Element = m.element
+	report.Request = m.request
+	if m.version != "" {
+		report.SoapVersion = m.version
+	}
+	if m.alias != nil {
+		report.AliasOf = m.alias.action
+	}
+	return report, nil
+}
@@ -0,0 +1,99 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_DryRun(t *testing.T) {
+	called := false
+	soapSrv := NewServer()
+	soapSrv.RegisterHandler("/pathTo", "testPostAction", "fooRequest",
+		func() interface{} { return &FooRequest{} },
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			called = true
+			return &FooResponse{}, nil
+		},
+	)
+	soapSrv.Alias("/pathTo", "oldPostAction", "oldFooRequest", "testPostAction", AliasRequestTag("fooRequest"))
+
+	newRequest := func(method, action, contentType, body string) *http.Request {
+		r := httptest.NewRequest(method, "/pathTo", strings.NewReader(body))
+		r.Header.Set("SOAPAction", action)
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		return r
+	}
+	envelope := func(content string) string {
+		return `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body>` + content + `</Body></Envelope>`
+	}
+
+	t.Run("dispatched", func(t *testing.T) {
+		report, err := soapSrv.DryRun(context.Background(), newRequest(http.MethodPost, "testPostAction", SoapContentType11, envelope(`<fooRequest><Foo>bar</Foo></fooRequest>`)))
+		require.NoError(t, err)
+		assert.False(t, called, "handler not run")
+		assert.Equal(t, "/pathTo", report.Path)
+		assert.Equal(t, "testPostAction", report.Action)
+		assert.Equal(t, "fooRequest", report.Element)
+		assert.Empty(t, report.AliasOf)
+		assert.Equal(t, "text/xml", report.MediaType)
+		assert.Equal(t, SoapVersion11, report.SoapVersion)
+		assert.Equal(t, "bar", report.Request.(*FooRequest).Foo)
+		assert.Nil(t, report.Rejection)
+	})
+
+	t.Run("alias", func(t *testing.T) {
+		report, err := soapSrv.DryRun(context.Background(), newRequest(http.MethodPost, "oldPostAction", SoapContentType11, envelope(`<oldFooRequest><Foo>bar</Foo></oldFooRequest>`)))
+		require.NoError(t, err)
+		assert.Equal(t, "oldFooRequest", report.Element)
+		assert.Equal(t, "testPostAction", report.AliasOf)
+		assert.Equal(t, "bar", report.Request.(*FooRequest).Foo)
+	})
+
+	soap12 := `<Envelope xmlns="http://www.w3.org/2003/05/soap-envelope"><Body><fooRequest/></Body></Envelope>`
+	tests := []struct {
+		name        string
+		method      string
+		action      string
+		contentType string
+		body        string
+		wantReason  PreDispatchReason
+		wantVersion string
+	}{
+		{"method", http.MethodGet, "testPostAction", SoapContentType11, "", PreDispatchMethodNotAllowed, SoapVersion11},
+		{"media type", http.MethodPost, "testPostAction", "application/json", `{}`, PreDispatchUnsupportedMediaType, ""},
+		{"SOAP 1.2 Content-Type", http.MethodPost, "testPostAction", SoapContentType12, soap12, PreDispatchVersionMismatch, SoapVersion12},
+		{"SOAP 1.2 envelope", http.MethodPost, "testPostAction", "", soap12, PreDispatchVersionMismatch, ""},
+		{"unknown action", http.MethodPost, "fooAction", SoapContentType11, envelope(`<fooRequest/>`), PreDispatchUnknownAction, SoapVersion11},
+		{"no handler", http.MethodPost, "testPostAction", SoapContentType11, envelope(`<barRequest/>`), PreDispatchNoHandler, SoapVersion11},
+		{"malformed", http.MethodPost, "testPostAction", SoapContentType11, envelope(`<fooRequest>`), PreDispatchMalformedEnvelope, SoapVersion11},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report, err := soapSrv.DryRun(context.Background(), newRequest(test.method, test.action, test.contentType, test.body))
+			var pe *PreDispatchError
+			require.True(t, errors.As(err, &pe))
+			require.NotNil(t, report.Rejection)
+			assert.Equal(t, test.wantReason, report.Rejection.Reason)
+			assert.Equal(t, test.wantReason, pe.Reason)
+			assert.Equal(t, test.wantVersion, report.SoapVersion)
+
+			// the response ServeHTTP sends
+			rec := httptest.NewRecorder()
+			soapSrv.ServeHTTP(rec, newRequest(test.method, test.action, test.contentType, test.body))
+			assert.Equal(t, rec.Code, report.StatusCode)
+			assert.Equal(t, rec.Body.String(), string(report.Body))
+			assert.Equal(t, rec.Header(), report.Header)
+			assert.Contains(t, string(report.Body), "<faultstring>")
+		})
+	}
+	assert.False(t, called)
+}
@@ -0,0 +1,163 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// AuditFields are common fields embedded in requests.
+type AuditFields struct {
+	RequestID string
+	User      string `xml:"urn:example:audit User"`
+}
+
+type auditFields struct {
+	Tenant string
+}
+
+type namedBase struct {
+	XMLName xml.Name `xml:"urn:example:orders CreateOrder"`
+	Version string   `xml:"version,attr"`
+}
+
+type embeddedExported struct {
+	XMLName xml.Name `xml:"urn:example:orders CreateOrder"`
+	AuditFields
+	Item string
+}
+
+type embeddedUnexported struct {
+	XMLName xml.Name `xml:"urn:example:orders CreateOrder"`
+	auditFields
+	Item string
+}
+
+type embeddedPointer struct {
+	XMLName xml.Name `xml:"urn:example:orders CreateOrder"`
+	*AuditFields
+	Item string
+}
+
+type embeddedXMLName struct {
+	namedBase
+	Item string
+}
+
+type overriddenXMLName struct {
+	XMLName xml.Name `xml:"urn:example:orders CreateOrderV2"`
+	namedBase
+	Item string
+}
+
+type embeddedTagged struct {
+	XMLName     xml.Name `xml:"urn:example:orders CreateOrder"`
+	AuditFields `xml:"urn:example:audit Audit"`
+	Item        string
+}
+
+type embeddedTaggedOmitzero struct {
+	XMLName     xml.Name `xml:"urn:example:orders CreateOrder"`
+	AuditFields `xml:"urn:example:audit Audit"`
+	Note        string `soap:"omitzero"`
+	Item        string
+}
+
+type embeddedOmitzero struct {
+	XMLName xml.Name `xml:"urn:example:orders CreateOrder"`
+	auditFields
+	*AuditFields
+	Note string `soap:"omitzero"`
+	Item string
+}
+
+// TestEmbedding pins the marshalling of embedded structs, which is the same
+// for Client requests and Server responses: the fields of embedded structs,
+// exported or not, by value or by non-nil pointer, are promoted into the
+// element like encoding/xml does, even if the embedded field has an xml tag,
+// with or without soap tags. The XMLName of an embedded struct names
+// the element, unless the embedding struct has one itself.
+func TestEmbedding(t *testing.T) {
+	audit := AuditFields{RequestID: "r-1", User: "ada"}
+	for name, tc := range map[string]struct {
+		value interface{}
+		want  string
+	}{
+		"exported": {
+			value: &embeddedExported{AuditFields: audit, Item: "book"},
+			want:  `<CreateOrder xmlns="urn:example:orders"><RequestID>r-1</RequestID><User xmlns="urn:example:audit">ada</User><Item>book</Item></CreateOrder>`,
+		},
+		"unexported": {
+			value: &embeddedUnexported{auditFields: auditFields{Tenant: "acme"}, Item: "book"},
+			want:  `<CreateOrder xmlns="urn:example:orders"><Tenant>acme</Tenant><Item>book</Item></CreateOrder>`,
+		},
+		"pointer": {
+			value: &embeddedPointer{AuditFields: &audit, Item: "book"},
+			want:  `<CreateOrder xmlns="urn:example:orders"><RequestID>r-1</RequestID><User xmlns="urn:example:audit">ada</User><Item>book</Item></CreateOrder>`,
+		},
+		"nil pointer": {
+			value: &embeddedPointer{Item: "book"},
+			want:  `<CreateOrder xmlns="urn:example:orders"><Item>book</Item></CreateOrder>`,
+		},
+		"XMLName of the embedded struct": {
+			value: &embeddedXMLName{namedBase: namedBase{Version: "1"}, Item: "book"},
+			want:  `<CreateOrder xmlns="urn:example:orders" version="1"><Item>book</Item></CreateOrder>`,
+		},
+		"XMLName overridden": {
+			value: &overriddenXMLName{namedBase: namedBase{Version: "2"}, Item: "book"},
+			want:  `<CreateOrderV2 xmlns="urn:example:orders" version="2"><Item>book</Item></CreateOrderV2>`,
+		},
+		"tagged": {
+			value: &embeddedTagged{AuditFields: audit, Item: "book"},
+			want:  `<CreateOrder xmlns="urn:example:orders"><RequestID>r-1</RequestID><User xmlns="urn:example:audit">ada</User><Item>book</Item></CreateOrder>`,
+		},
+		"tagged, soap tags": {
+			value: &embeddedTaggedOmitzero{AuditFields: audit, Item: "book"},
+			want:  `<CreateOrder xmlns="urn:example:orders"><RequestID>r-1</RequestID><User xmlns="urn:example:audit">ada</User><Item>book</Item></CreateOrder>`,
+		},
+		"soap tags": {
+			value: &embeddedOmitzero{auditFields: auditFields{Tenant: "acme"}, AuditFields: &audit, Item: "book"},
+			want:  `<CreateOrder xmlns="urn:example:orders"><Tenant>acme</Tenant><RequestID>r-1</RequestID><User xmlns="urn:example:audit">ada</User><Item>book</Item></CreateOrder>`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var request []byte
+			c := NewClient("http://localhorst.ch", nil)
+			c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+				request, _ = ioutil.ReadAll(r.Body)
+				return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+			})}).Do
+			_, err := c.Call(context.Background(), "foo", tc.value, nil)
+			require.NoError(t, err)
+			clientContent, err := bodyContent(request)
+			require.NoError(t, err)
+
+			soapSrv := NewServer()
+			soapSrv.RegisterHandler("/pathTo", "foo", "fooRequest",
+				func() interface{} {
+					return &FooRequest{}
+				},
+				func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+					return tc.value, nil
+				},
+			)
+			r := httptest.NewRequest("POST", "/pathTo", strings.NewReader(`<Envelope xmlns="`+NamespaceSoap11+`"><Body><fooRequest/></Body></Envelope>`))
+			r.Header.Set("SOAPAction", "foo")
+			w := httptest.NewRecorder()
+			soapSrv.ServeHTTP(w, r)
+			serverContent, err := bodyContent(w.Body.Bytes())
+			require.NoError(t, err)
+
+			assert.Equal(t, string(clientContent), string(serverContent), "client and server agree")
+			assert.Equal(t, tc.want, regexp.MustCompile(`>\s+<`).ReplaceAllString(string(clientContent), "><"))
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testdata/header_only.response.xml is shaped like the response of a session
+// establishing operation, all its data is in the Header.
+func TestClient_Call_emptyBody(t *testing.T) {
+	envelope, err := ioutil.ReadFile(filepath.Join("testdata", "header_only.response.xml"))
+	require.NoError(t, err)
+
+	type empty struct{}
+	tests := []struct {
+		name     string
+		response interface{}
+	}{
+		{name: "nil", response: nil},
+		{name: "empty struct", response: &empty{}},
+		{name: "generic", response: &map[string]interface{}{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewClient("http://localhorst.ch", nil)
+			c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: 200,
+					Header:     http.Header{"Content-Type": {"text/xml; charset=utf-8"}},
+					Body:       ioutil.NopCloser(bytes.NewReader(envelope)),
+				}, nil
+			})}).Do
+			resp, err := c.Call(context.Background(), "CreateSession", &FooRequest{}, test.response)
+			require.NoError(t, err)
+			assert.Equal(t, 200, resp.StatusCode)
+		})
+	}
+}
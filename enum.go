@@ -0,0 +1,123 @@
+package soap
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Enum is the set of values of an XSD enumeration. Model an enumeration as a
+// string type with constants and an Enum, like generated code would:
+//
+//	type Status string
+//
+//	const (
+//		StatusActive Status = "ACTIVE"
+//		StatusClosed Status = "CLOSED"
+//	)
+//
+//	var statusEnum = soap.Enum{Name: "Status", Values: []string{"ACTIVE", "CLOSED"}}
+//
+//	func (s Status) Enum() soap.Enum { return statusEnum }
+//	func (s Status) IsValid() bool  { return statusEnum.IsValid(string(s)) }
+//
+// Fields of such types are checked by Client.ValidateEnums and
+// Server.ValidateEnums.
+type Enum struct {
+	Name   string
+	Values []string
+}
+
+// IsValid reports whether value is one of the values of e.
+func (e Enum) IsValid(value string) bool {
+	for _, v := range e.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns an *EnumError, if value isn't one of the values of e.
+func (e Enum) Validate(value string) error {
+	if e.IsValid(value) {
+		return nil
+	}
+	return &EnumError{Enum: e.Name, Value: value, Allowed: e.Values}
+}
+
+// EnumValue is implemented by string types of enumerations, see Enum.
+type EnumValue interface {
+	Enum() Enum
+}
+
+// EnumError is returned for a value outside of its enumeration.
+type EnumError struct {
+	// Field is the path of the field holding the value, e.g.
+	// "Order.Items[2].Status", if known.
+	Field   string
+	Enum    string
+	Value   string
+	Allowed []string
+}
+
+func (ee *EnumError) Error() string {
+	field := ee.Field
+	if field == "" {
+		field = ee.Enum
+	}
+	return fmt.Sprintf("%s: %q is not one of %s", field, ee.Value, strings.Join(ee.Allowed, ", "))
+}
+
+var enumValueType = reflect.TypeOf((*EnumValue)(nil)).Elem()
+
+// ValidateEnums checks every field of v implementing EnumValue and returns an
+// *EnumError for the first value outside of its enumeration. Empty values of
+// omitted elements are valid.
+func ValidateEnums(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return validateEnums(reflect.ValueOf(v), t.Name())
+}
+
+func validateEnums(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return validateEnums(v.Elem(), path)
+	case reflect.String:
+		if v.Type().Implements(enumValueType) && v.Len() > 0 {
+			if err := v.Interface().(EnumValue).Enum().Validate(v.String()); err != nil {
+				err.(*EnumError).Field = path
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" { // unexported
+				continue
+			}
+			if err := validateEnums(v.Field(i), path+"."+t.Field(i).Name); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := validateEnums(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type orderStatus string
+
+const (
+	orderStatusOpen   orderStatus = "OPEN"
+	orderStatusClosed orderStatus = "CLOSED"
+)
+
+var orderStatusEnum = Enum{Name: "orderStatus", Values: []string{"OPEN", "CLOSED"}}
+
+func (s orderStatus) Enum() Enum    { return orderStatusEnum }
+func (s orderStatus) IsValid() bool { return orderStatusEnum.IsValid(string(s)) }
+
+type orderItem struct {
+	Status orderStatus `xml:"status"`
+}
+
+type orderRequest struct {
+	XMLName xml.Name     `xml:"orderRequest"`
+	Status  orderStatus  `xml:"status"`
+	Items   []orderItem  `xml:"item"`
+	Parent  *orderStatus `xml:"parent,omitempty"`
+}
+
+func TestValidateEnums(t *testing.T) {
+	assert.True(t, orderStatusOpen.IsValid())
+	assert.False(t, orderStatus("open").IsValid())
+
+	assert.NoError(t, ValidateEnums(&orderRequest{Status: orderStatusOpen, Items: []orderItem{{Status: orderStatusClosed}}}))
+	assert.NoError(t, ValidateEnums(&orderRequest{}), "omitted values are valid")
+	assert.NoError(t, ValidateEnums(nil))
+
+	err := ValidateEnums(&orderRequest{Status: orderStatusOpen, Items: []orderItem{{}, {Status: "CLOSD"}}})
+	var ee *EnumError
+	require.True(t, errors.As(err, &ee), "%v", err)
+	assert.Equal(t, &EnumError{Field: "orderRequest.Items[1].Status", Enum: "orderStatus", Value: "CLOSD", Allowed: []string{"OPEN", "CLOSED"}}, ee)
+	assert.EqualError(t, err, `orderRequest.Items[1].Status: "CLOSD" is not one of OPEN, CLOSED`)
+
+	parent := orderStatus("X")
+	assert.EqualError(t, ValidateEnums(orderRequest{Parent: &parent}), `orderRequest.Parent: "X" is not one of OPEN, CLOSED`)
+	assert.EqualError(t, orderStatusEnum.Validate("X"), `orderStatus: "X" is not one of OPEN, CLOSED`)
+}
+
+func TestClient_ValidateEnums(t *testing.T) {
+	sent := false
+	c := NewClient("http://localhorst.ch", nil)
+	c.HTTPClientDoFn = func(req *http.Request) (*http.Response, error) {
+		sent = true
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	}
+
+	_, err := c.Call(context.Background(), "order", &orderRequest{Status: "PENDING"}, nil)
+	assert.NoError(t, err, "validation is off by default")
+	assert.True(t, sent)
+
+	sent = false
+	c.ValidateEnums = true
+	_, err = c.Call(context.Background(), "order", &orderRequest{Status: "PENDING"}, nil)
+	var ee *EnumError
+	require.True(t, errors.As(err, &ee), "%v", err)
+	assert.Equal(t, ErrorKindProtocol, KindOf(err))
+	assert.False(t, sent)
+}
+
+func TestServer_ValidateEnums(t *testing.T) {
+	soapSrv := NewServer()
+	soapSrv.RegisterHandler("/pathTo", "order", "orderRequest",
+		func() interface{} {
+			return &orderRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			return &FooResponse{Bar: string(request.(*orderRequest).Status)}, nil
+		},
+	)
+	srv := httptest.NewServer(soapSrv)
+	defer srv.Close()
+	c := NewClient(srv.URL+"/pathTo", nil)
+
+	response := &FooResponse{}
+	_, err := c.Call(context.Background(), "order", &orderRequest{Status: "PENDING"}, response)
+	require.NoError(t, err, "out-of-schema values are tolerated by default")
+	assert.Equal(t, "PENDING", response.Bar)
+
+	soapSrv.ValidateEnums = true
+	_, err = c.Call(context.Background(), "order", &orderRequest{Status: "PENDING"}, response)
+	var fe *FaultError
+	require.True(t, errors.As(err, &fe), "%v", err)
+	assert.Equal(t, `orderRequest.Status: "PENDING" is not one of OPEN, CLOSED`, fe.Fault.String)
+}
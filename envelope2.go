@@ -0,0 +1,514 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// EnvelopeV2 is a SOAP 1.1 or 1.2 envelope. Unlike Envelope it is encoded
+// with the namespace of its Version, has an optional Header and models the
+// Faults of both versions. Use EnvelopeToV2 and EnvelopeFromV2 to convert
+// from and to the legacy structs.
+type EnvelopeV2 struct {
+	// Version is SoapVersion11 or SoapVersion12, "" means SoapVersion11.
+	// Decoding sets it from the namespace of the Envelope.
+	Version string
+	Attrs   []xml.Attr
+	Header  *HeaderV2 // nil omits the Header element
+	Body    BodyV2
+}
+
+// HeaderV2 is the Header of an EnvelopeV2.
+type HeaderV2 struct {
+	Attrs []xml.Attr
+	// Content is encoded as the content of the Header. If it is set before
+	// decoding, the first header block is decoded into it.
+	Content interface{}
+	// Raw is the content of the Header as received, if Content hasn't been
+	// set before decoding.
+	Raw []byte
+}
+
+// BodyV2 is the Body of an EnvelopeV2.
+type BodyV2 struct {
+	Attrs []xml.Attr
+	// Content is the element in the Body. Set it to a pointer before
+	// decoding, other elements are skipped.
+	Content interface{}
+	Fault   *FaultV2
+}
+
+// FaultV2 is a SOAP Fault of either version.
+type FaultV2 struct {
+	// Code is the faultcode or the Code/Value, a qualified name.
+	Code string
+	// Subcodes are the values of the nested Subcodes, SOAP 1.2 only.
+	Subcodes []string
+	// Reason is the faultstring or the Reason/Text.
+	Reason string
+	// Lang is the xml:lang of the Reason/Text, SOAP 1.2 only. It defaults to
+	// "en" for encoding.
+	Lang string
+	// Node is the Node, SOAP 1.2 only.
+	Node string
+	// Role is the faultactor or the Role.
+	Role string
+	// Detail is encoded as the content of the detail element. If it is set
+	// before decoding, the first element of the detail is decoded into it.
+	Detail interface{}
+	// DetailRaw is the content of the detail element as received, it is
+	// encoded if Detail is nil.
+	DetailRaw []byte
+}
+
+// namespace returns the envelope namespace of version.
+func namespace(version string) string {
+	if version == SoapVersion12 {
+		return NamespaceSoap12
+	}
+	return NamespaceSoap11
+}
+
+// MarshalXML encodes the envelope with the namespace of its Version.
+func (env EnvelopeV2) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	ns := namespace(env.Version)
+	start := xml.StartElement{Name: xml.Name{Space: ns, Local: "Envelope"}, Attr: env.Attrs}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	if h := env.Header; h != nil {
+		out := headerOut{XMLName: xml.Name{Space: ns, Local: "Header"}, Attrs: h.Attrs, Header: h.Content}
+		if h.Content == nil {
+			out.Raw = h.Raw
+		}
+		if err := e.Encode(out); err != nil {
+			return err
+		}
+	}
+	out := bodyOut{XMLName: xml.Name{Space: ns, Local: "Body"}, Attrs: env.Body.Attrs, Content: env.Body.Content}
+	if env.Body.Fault != nil {
+		out.Fault = &faultOut{FaultV2: env.Body.Fault, version: env.Version}
+		out.Content = nil
+	}
+	if err := e.Encode(out); err != nil {
+		return err
+	}
+	return e.EncodeToken(start.End())
+}
+
+// headerOut and bodyOut encode content like the legacy Header and Body, so
+// elements without an XMLName keep the element name of the legacy field.
+type headerOut struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr  `xml:",any,attr"`
+	Header  interface{} `xml:",omitempty"`
+	Raw     []byte      `xml:",innerxml"`
+}
+
+type bodyOut struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr  `xml:",any,attr"`
+	Fault   *faultOut   `xml:",omitempty"`
+	Content interface{} `xml:",omitempty"`
+}
+
+// faultOut encodes a FaultV2 in the layout of version.
+type faultOut struct {
+	*FaultV2
+	version string
+}
+
+func (f faultOut) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	return f.encode(e, f.version)
+}
+
+// rawElement is an element with verbatim content.
+type rawElement struct {
+	Inner []byte `xml:",innerxml"`
+}
+
+// AnyXML is a serialized XML element, e.g. the Body content returned by
+// Client.CallEnvelope. The namespace declarations in scope are copied onto
+// it, so it can be decoded on its own.
+type AnyXML []byte
+
+// Unmarshal decodes the element into v like xml.Unmarshal.
+func (a AnyXML) Unmarshal(v interface{}) error {
+	return xml.Unmarshal(a, v)
+}
+
+// MarshalXML encodes the element as is.
+func (a AnyXML) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	d := xml.NewDecoder(bytes.NewReader(a))
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			// The encoder declares the namespaces itself.
+			attrs := start.Attr[:0:0]
+			for _, attr := range start.Attr {
+				if attr.Name.Space != "xmlns" && attr.Name != (xml.Name{Local: "xmlns"}) {
+					attrs = append(attrs, attr)
+				}
+			}
+			start.Attr = attrs
+			token = start
+		}
+		if err := e.EncodeToken(token); err != nil {
+			return err
+		}
+	}
+}
+
+// encode encodes the fault in the layout of version.
+func (f *FaultV2) encode(e *xml.Encoder, version string) error {
+	start := xml.StartElement{Name: xml.Name{Space: namespace(version), Local: "Fault"}}
+	var detail *faultDetail
+	if f.Detail != nil {
+		detail = &faultDetail{Content: f.Detail}
+	} else if len(f.DetailRaw) > 0 {
+		detail = &faultDetail{Inner: f.DetailRaw}
+	}
+	if version != SoapVersion12 {
+		return e.EncodeElement(fault11{Code: f.Code, String: f.Reason, Actor: f.Role, Detail: detail}, start)
+	}
+	out := fault12{Node: f.Node, Role: f.Role, Detail: detail}
+	out.Code.Value = f.Code
+	parent := &out.Code.Subcode
+	for _, value := range f.Subcodes {
+		*parent = &faultSubcode{Value: value}
+		parent = &(*parent).Subcode
+	}
+	out.Reason.Text.Value = f.Reason
+	out.Reason.Text.Lang = f.Lang
+	if out.Reason.Text.Lang == "" {
+		out.Reason.Text.Lang = "en"
+	}
+	return e.EncodeElement(out, start)
+}
+
+// faultDetail is the detail element of a Fault, Content is encoded as child
+// element, Inner verbatim.
+type faultDetail struct {
+	Content interface{} `xml:",omitempty"`
+	Inner   []byte      `xml:",innerxml"`
+}
+
+// fault11 is the layout of a SOAP 1.1 Fault.
+type fault11 struct {
+	Code   string       `xml:"faultcode,omitempty"`
+	String string       `xml:"faultstring,omitempty"`
+	Actor  string       `xml:"faultactor,omitempty"`
+	Detail *faultDetail `xml:"detail,omitempty"`
+}
+
+type faultSubcode struct {
+	Value   string        `xml:"http://www.w3.org/2003/05/soap-envelope Value"`
+	Subcode *faultSubcode `xml:"http://www.w3.org/2003/05/soap-envelope Subcode,omitempty"`
+}
+
+// subcodeIn decodes a Subcode of any namespace.
+type subcodeIn struct {
+	Value   string     `xml:"Value"`
+	Subcode *subcodeIn `xml:"Subcode"`
+}
+
+// fault12 is the layout of a SOAP 1.2 Fault.
+type fault12 struct {
+	Code struct {
+		Value   string        `xml:"http://www.w3.org/2003/05/soap-envelope Value"`
+		Subcode *faultSubcode `xml:"http://www.w3.org/2003/05/soap-envelope Subcode,omitempty"`
+	} `xml:"http://www.w3.org/2003/05/soap-envelope Code"`
+	Reason struct {
+		Text struct {
+			Lang  string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"http://www.w3.org/2003/05/soap-envelope Text"`
+	} `xml:"http://www.w3.org/2003/05/soap-envelope Reason"`
+	Node   string       `xml:"http://www.w3.org/2003/05/soap-envelope Node,omitempty"`
+	Role   string       `xml:"http://www.w3.org/2003/05/soap-envelope Role,omitempty"`
+	Detail *faultDetail `xml:"http://www.w3.org/2003/05/soap-envelope Detail,omitempty"`
+}
+
+// UnmarshalXML decodes a SOAP 1.1 or 1.2 envelope.
+func (env *EnvelopeV2) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	switch start.Name.Space {
+	case NamespaceSoap11:
+		env.Version = SoapVersion11
+	case NamespaceSoap12:
+		env.Version = SoapVersion12
+	default:
+		return fmt.Errorf("not a SOAP envelope: %s %s", start.Name.Space, start.Name.Local)
+	}
+	env.Attrs = start.Attr
+	ns := start.Name.Space
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch tt := token.(type) {
+		case xml.EndElement:
+			return nil
+		case xml.StartElement:
+			switch {
+			case tt.Name.Space == ns && tt.Name.Local == "Header":
+				if env.Header == nil {
+					env.Header = &HeaderV2{}
+				}
+				env.Header.Attrs = tt.Attr
+				if env.Header.Raw, err = decodeContent(d, tt, env.Header.Content); err != nil {
+					return err
+				}
+			case tt.Name.Space == ns && tt.Name.Local == "Body":
+				if err := env.Body.decode(d, tt, ns); err != nil {
+					return err
+				}
+			default:
+				if err := d.Skip(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// decodeContent decodes the first child element of start into content or, if
+// content is nil, returns the content of start.
+func decodeContent(d *xml.Decoder, start xml.StartElement, content interface{}) ([]byte, error) {
+	if content == nil {
+		raw := rawElement{}
+		err := d.DecodeElement(&raw, &start)
+		return raw.Inner, err
+	}
+	decoded := false
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch tt := token.(type) {
+		case xml.EndElement:
+			return nil, nil
+		case xml.StartElement:
+			if decoded {
+				err = d.Skip()
+			} else {
+				err = d.DecodeElement(content, &tt)
+				decoded = true
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (b *BodyV2) decode(d *xml.Decoder, start xml.StartElement, ns string) error {
+	b.Attrs = start.Attr
+	decoded := false
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch tt := token.(type) {
+		case xml.EndElement:
+			return nil
+		case xml.StartElement:
+			switch {
+			case tt.Name.Space == ns && tt.Name.Local == "Fault":
+				if b.Fault == nil {
+					b.Fault = &FaultV2{}
+				}
+				err = d.DecodeElement(b.Fault, &tt)
+			case b.Content != nil && !decoded:
+				err = d.DecodeElement(b.Content, &tt)
+				decoded = true
+			default:
+				err = d.Skip()
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// UnmarshalXML decodes a SOAP 1.1 or 1.2 Fault.
+func (f *FaultV2) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	_, err := f.decode(d, start)
+	return err
+}
+
+// decode decodes a Fault of either layout and reports whether it has the SOAP
+// 1.2 layout. The namespaces of the children are ignored, as legacy decoding
+// replaces SOAP 1.2 namespaces.
+func (f *FaultV2) decode(d *xml.Decoder, start xml.StartElement) (bool, error) {
+	var both struct {
+		Code    string      `xml:"faultcode"`
+		String  string      `xml:"faultstring"`
+		Actor   string      `xml:"faultactor"`
+		Detail  *rawElement `xml:"detail"`
+		Value   string      `xml:"Code>Value"`
+		Subcode *subcodeIn  `xml:"Code>Subcode"`
+		Reason  struct {
+			Text struct {
+				Lang  string `xml:"lang,attr"`
+				Value string `xml:",chardata"`
+			}
+		}
+		Node     string      `xml:"Node"`
+		Role     string      `xml:"Role"`
+		Detail12 *rawElement `xml:"Detail"`
+	}
+	if err := d.DecodeElement(&both, &start); err != nil {
+		return false, err
+	}
+	detailTarget := f.Detail
+	*f = FaultV2{Code: both.Code, Reason: both.String, Role: both.Actor}
+	detail := both.Detail
+	soap12 := both.Value != "" || both.Reason.Text.Value != ""
+	if soap12 {
+		f.Code, f.Reason, f.Lang = both.Value, both.Reason.Text.Value, both.Reason.Text.Lang
+		f.Node, f.Role = both.Node, both.Role
+		for sc := both.Subcode; sc != nil; sc = sc.Subcode {
+			f.Subcodes = append(f.Subcodes, sc.Value)
+		}
+		detail = both.Detail12
+	}
+	if detail == nil {
+		return soap12, nil
+	}
+	f.DetailRaw = detail.Inner
+	if detailTarget != nil && len(bytes.TrimSpace(detail.Inner)) > 0 {
+		if err := xml.NewDecoder(bytes.NewReader(detail.Inner)).Decode(detailTarget); err != nil && err != io.EOF {
+			return soap12, fmt.Errorf("could not decode fault detail: %w", err)
+		}
+		f.Detail = detailTarget
+	}
+	return soap12, nil
+}
+
+// EnvelopeToV2 converts the legacy envelope e of soapVersion.
+func EnvelopeToV2(e *Envelope, soapVersion string) *EnvelopeV2 {
+	env := &EnvelopeV2{
+		Version: soapVersion,
+		Attrs:   attrsNamespace(e.Attrs, NamespaceSoap11, namespace(soapVersion)),
+		Header:  &HeaderV2{Content: e.Header.Header},
+		Body: BodyV2{
+			Attrs:   attrsNamespace(e.Body.Attrs, NamespaceSoap11, namespace(soapVersion)),
+			Content: e.Body.Content,
+		},
+	}
+	if e.Body.Fault != nil {
+		env.Body.Fault = FaultToV2(e.Body.Fault)
+		env.Body.Content = nil
+	}
+	return env
+}
+
+// EnvelopeFromV2 converts env to the legacy Envelope.
+func EnvelopeFromV2(env *EnvelopeV2) *Envelope {
+	ns := namespace(env.Version)
+	e := &Envelope{
+		Attrs: attrsNamespace(env.Attrs, ns, NamespaceSoap11),
+		Body: Body{
+			Attrs:   attrsNamespace(env.Body.Attrs, ns, NamespaceSoap11),
+			Content: env.Body.Content,
+		},
+	}
+	if env.Header != nil {
+		e.Header.Header = env.Header.Content
+	}
+	if env.Body.Fault != nil {
+		e.Body.Fault = FaultFromV2(env.Body.Fault, env.Version)
+		e.Body.Content = nil
+	}
+	return e
+}
+
+// attrsNamespace returns attrs with the namespace from replaced by to, e.g. for
+// encodingStyle.
+func attrsNamespace(attrs []xml.Attr, from, to string) []xml.Attr {
+	if from == to {
+		return attrs
+	}
+	out := make([]xml.Attr, len(attrs))
+	for i, attr := range attrs {
+		if attr.Name.Space == from {
+			attr.Name.Space = to
+		}
+		out[i] = attr
+	}
+	return out
+}
+
+// FaultToV2 converts the legacy Fault f.
+func FaultToV2(f *Fault) *FaultV2 {
+	fv := &FaultV2{
+		Code:      f.Code,
+		Reason:    f.String,
+		Node:      f.Node,
+		Role:      f.Actor,
+		Detail:    f.DetailContent,
+		DetailRaw: f.detailXML,
+	}
+	if charData(f.detailXML) != f.Detail {
+		// Detail has been changed since decoding.
+		fv.DetailRaw = nil
+	}
+	if fv.DetailRaw == nil && f.Detail != "" {
+		var buf bytes.Buffer
+		xml.EscapeText(&buf, []byte(f.Detail))
+		fv.DetailRaw = buf.Bytes()
+	}
+	return fv
+}
+
+// FaultFromV2 converts fv of soapVersion to the legacy Fault. Fault.Detail is
+// the character data of the detail element.
+func FaultFromV2(fv *FaultV2, soapVersion string) *Fault {
+	return &Fault{
+		XMLName:       xml.Name{Space: NamespaceSoap11, Local: "Fault"},
+		Code:          fv.Code,
+		String:        fv.Reason,
+		Actor:         fv.Role,
+		Node:          fv.Node,
+		Detail:        charData(fv.DetailRaw),
+		DetailContent: fv.Detail,
+		soap12:        soapVersion == SoapVersion12,
+		detailXML:     fv.DetailRaw,
+	}
+}
+
+// charData returns the character data of the XML fragment raw outside of
+// elements.
+func charData(raw []byte) string {
+	var text []byte
+	d := xml.NewDecoder(bytes.NewReader(raw))
+	depth := 0
+	for {
+		token, err := d.RawToken()
+		if err != nil {
+			return string(text)
+		}
+		switch tt := token.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 0 {
+				text = append(text, tt...)
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type untaggedContent struct {
+	Value string
+}
+
+func TestEnvelopeV2WireCompatible(t *testing.T) {
+	tests := []struct {
+		name     string
+		envelope *Envelope
+	}{
+		{
+			name:     "content",
+			envelope: &Envelope{Body: Body{Content: &FooRequest{Foo: "hello"}}},
+		},
+		{
+			name:     "untagged content",
+			envelope: &Envelope{Body: Body{Content: untaggedContent{Value: "v"}}},
+		},
+		{
+			name: "attrs",
+			envelope: &Envelope{
+				Attrs: []xml.Attr{EncodingStyle(NamespaceSoapEncoding)},
+				Body:  Body{Attrs: []xml.Attr{{Name: xml.Name{Local: "id"}, Value: "b1"}}, Content: &FooRequest{Foo: "hello"}},
+			},
+		},
+		{
+			name:     "header",
+			envelope: &Envelope{Header: Header{Header: &FooRequest{Foo: "token"}}, Body: Body{Content: &FooRequest{}}},
+		},
+		{
+			name:     "fault",
+			envelope: &Envelope{Body: Body{Fault: &Fault{Code: "soap:Server", String: "boom", Actor: "urn:a", Detail: "a < b"}}},
+		},
+		{
+			name: "fault detail content",
+			envelope: &Envelope{Body: Body{Fault: &Fault{
+				Code:          "soap:Client",
+				String:        "account locked",
+				DetailContent: &accountDetail{Account: "CH93-0076", Reason: "fraud"},
+			}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			legacy, err := xml.Marshal(tt.envelope)
+			require.NoError(t, err)
+			v2, err := xml.Marshal(EnvelopeToV2(tt.envelope, SoapVersion11))
+			require.NoError(t, err)
+			assert.Equal(t, string(legacy), string(v2))
+
+			if tt.envelope.Body.Fault != nil {
+				return // Faults have a different layout in SOAP 1.2
+			}
+			v2, err = xml.Marshal(EnvelopeToV2(tt.envelope, SoapVersion12))
+			require.NoError(t, err)
+			assert.Equal(t, xmlTokens(t, replaceSoap11to12(legacy)), xmlTokens(t, v2))
+		})
+	}
+}
+
+func TestEnvelopeV2RoundTrip(t *testing.T) {
+	for _, version := range []string{SoapVersion11, SoapVersion12} {
+		t.Run(version, func(t *testing.T) {
+			data, err := xml.Marshal(EnvelopeV2{
+				Version: version,
+				Header:  &HeaderV2{Raw: []byte(`<t:Token xmlns:t="urn:t">abc</t:Token>`)},
+				Body:    BodyV2{Content: &FooRequest{Foo: "hello"}},
+			})
+			require.NoError(t, err)
+			assert.Contains(t, string(data), namespace(version))
+
+			env := &EnvelopeV2{Body: BodyV2{Content: &FooRequest{}}}
+			require.NoError(t, xml.Unmarshal(data, env))
+			assert.Equal(t, version, env.Version)
+			require.NotNil(t, env.Header)
+			assert.Contains(t, string(env.Header.Raw), "abc")
+			assert.Equal(t, "hello", env.Body.Content.(*FooRequest).Foo)
+			assert.Nil(t, env.Body.Fault)
+
+			legacy := EnvelopeFromV2(env)
+			assert.Equal(t, "hello", legacy.Body.Content.(*FooRequest).Foo)
+		})
+	}
+}
+
+func TestFaultV2RoundTrip(t *testing.T) {
+	fault := &FaultV2{
+		Code:      "env:Sender",
+		Subcodes:  []string{"b:Locked", "b:Fraud"},
+		Reason:    "account locked",
+		Lang:      "de",
+		Node:      "urn:bank:gateway",
+		Role:      "urn:bank:ledger",
+		DetailRaw: []byte(`<b:Account xmlns:b="urn:bank">CH93-0076</b:Account>`),
+	}
+	tests := []struct {
+		version string
+		want    *FaultV2
+	}{
+		{
+			version: SoapVersion11,
+			want: &FaultV2{
+				Code:      fault.Code,
+				Reason:    fault.Reason,
+				Role:      fault.Role,
+				DetailRaw: fault.DetailRaw,
+			},
+		},
+		{version: SoapVersion12, want: fault},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			data, err := xml.Marshal(EnvelopeV2{Version: tt.version, Body: BodyV2{Fault: fault}})
+			require.NoError(t, err)
+
+			env := &EnvelopeV2{}
+			require.NoError(t, xml.Unmarshal(data, env))
+			assert.Equal(t, tt.want, env.Body.Fault)
+
+			// The legacy structs see the same fault.
+			parsed, err := ParseEnvelope(bytes.NewReader(data))
+			require.NoError(t, err)
+			assert.Equal(t, fault.Code, parsed.Body.Fault.Code)
+			assert.Equal(t, fault.Reason, parsed.Body.Fault.String)
+			assert.Equal(t, fault.Role, parsed.Body.Fault.Actor)
+			assert.Equal(t, string(fault.DetailRaw), string(FaultToV2(parsed.Body.Fault).DetailRaw))
+		})
+	}
+}
+
+func TestFaultConversion(t *testing.T) {
+	legacy := &Fault{Code: "soap:Server", String: "boom", Detail: "a < b"}
+	fv := FaultToV2(legacy)
+	assert.Equal(t, "a &lt; b", string(fv.DetailRaw))
+
+	back := FaultFromV2(fv, SoapVersion11)
+	assert.Equal(t, legacy.Code, back.Code)
+	assert.Equal(t, legacy.String, back.String)
+	assert.Equal(t, legacy.Detail, back.Detail)
+
+	// A Detail changed after decoding wins over the received detail.
+	back.Detail = "changed"
+	assert.Equal(t, "changed", string(FaultToV2(back).DetailRaw))
+}
+
+// xmlTokens returns the tokens of data with namespaces resolved and namespace
+// declarations dropped, so generated prefixes don't matter.
+func xmlTokens(t *testing.T, data []byte) []xml.Token {
+	var tokens []xml.Token
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return tokens
+		}
+		require.NoError(t, err)
+		if se, ok := token.(xml.StartElement); ok {
+			se.Attr = append([]xml.Attr(nil), se.Attr...)
+			for i := len(se.Attr) - 1; i >= 0; i-- {
+				if se.Attr[i].Name.Space == "xmlns" || se.Attr[i].Name.Local == "xmlns" {
+					se.Attr = append(se.Attr[:i], se.Attr[i+1:]...)
+				}
+			}
+			token = se
+		}
+		tokens = append(tokens, xml.CopyToken(token))
+	}
+}
+
+func TestAnyXML(t *testing.T) {
+	content := AnyXML(`<v:FooResponse xmlns:v="urn:example:vendor" xmlns:s="urn:unused"><v:Bar>bar &amp; baz</v:Bar></v:FooResponse>`)
+	encoded, err := xml.Marshal(EnvelopeV2{Body: BodyV2{Content: content}})
+	require.NoError(t, err)
+	assert.Equal(t, `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body xmlns="http://schemas.xmlsoap.org/soap/envelope/">`+
+		`<FooResponse xmlns="urn:example:vendor"><Bar xmlns="urn:example:vendor">bar &amp; baz</Bar></FooResponse></Body></Envelope>`, string(encoded))
+
+	var response struct {
+		Bar string `xml:"urn:example:vendor Bar"`
+	}
+	require.NoError(t, content.Unmarshal(&response))
+	assert.Equal(t, "bar & baz", response.Bar)
+}
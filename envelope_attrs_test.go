@@ -0,0 +1,103 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_EnvelopeAttrs(t *testing.T) {
+	var requests []string
+	newClient := func() *Client {
+		c := NewClient("http://localhorst.ch", nil)
+		c.EnvelopeAttrs = []xml.Attr{EncodingStyle(NamespaceSoapEncoding)}
+		c.BodyAttrs = []xml.Attr{{Name: xml.Name{Space: "http://partner.example.com/tenant", Local: "tenant"}, Value: "acme"}}
+		c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+			body, _ := ioutil.ReadAll(r.Body)
+			requests = append(requests, string(body))
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		})}).Do
+		return c
+	}
+	c := newClient()
+
+	t.Run("encodingStyle", func(t *testing.T) {
+		requests = nil
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{Foo: "foo"}, nil)
+		require.NoError(t, err)
+		assert.Exactly(t, `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/" xmlns:envelope="http://schemas.xmlsoap.org/soap/envelope/" envelope:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+	<Header xmlns="http://schemas.xmlsoap.org/soap/envelope/"></Header>
+	<Body xmlns="http://schemas.xmlsoap.org/soap/envelope/" xmlns:tenant="http://partner.example.com/tenant" tenant:tenant="acme">
+		<fooRequest>
+			<Foo>foo</Foo>
+		</fooRequest>
+	</Body>
+</Envelope>`, requests[0])
+	})
+
+	t.Run("SOAP 1.2", func(t *testing.T) {
+		requests = nil
+		c12 := newClient()
+		c12.UseSoap12()
+		c12.EnvelopeAttrs = []xml.Attr{EncodingStyle("http://www.w3.org/2003/05/soap-encoding")}
+		c12.BodyAttrs = nil
+		_, err := c12.Call(context.Background(), "MySOAPAction", &FooRequest{Foo: "foo"}, nil)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(requests[0], `<Envelope xmlns="http://www.w3.org/2003/05/soap-envelope" xmlns:envelope="http://www.w3.org/2003/05/soap-envelope" envelope:encodingStyle="http://www.w3.org/2003/05/soap-encoding">`), requests[0])
+	})
+
+	t.Run("per call", func(t *testing.T) {
+		requests = nil
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{Foo: "foo"}, nil,
+			WithEnvelopeAttrs(),
+			WithBodyAttrs(EncodingStyle(NamespaceSoapEncoding)),
+		)
+		require.NoError(t, err)
+		assert.Contains(t, requests[0], `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">`)
+		assert.Contains(t, requests[0], `<Body xmlns="http://schemas.xmlsoap.org/soap/envelope/" xmlns:envelope="http://schemas.xmlsoap.org/soap/envelope/" envelope:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">`)
+	})
+
+	t.Run("BodyEncoder", func(t *testing.T) {
+		requests = nil
+		bc := newClient()
+		bc.BodyEncoder = &recordingBodyCodec{}
+		_, err := bc.Call(context.Background(), "MySOAPAction", &FooRequest{Foo: "foo"}, nil)
+		require.NoError(t, err)
+		assert.Contains(t, requests[0], `envelope:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"`)
+		assert.Contains(t, requests[0], `="http://partner.example.com/tenant"`)
+		assert.Contains(t, requests[0], `:tenant="acme"`)
+	})
+}
+
+func TestServer_EnvelopeAttrs(t *testing.T) {
+	soapSrv := NewServer()
+	soapSrv.EnvelopeAttrs = []xml.Attr{EncodingStyle(NamespaceSoapEncoding)}
+	soapSrv.RegisterHandler("/pathTo", "testPostAction", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			return &FooResponse{Bar: "bar"}, nil
+		},
+	)
+
+	r := httptest.NewRequest("POST", "/pathTo", strings.NewReader(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><fooRequest/></Body></Envelope>`))
+	r.Header.Set("SOAPAction", "testPostAction")
+	w := httptest.NewRecorder()
+	soapSrv.ServeHTTP(w, r)
+	assert.Exactly(t, `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/" xmlns:envelope="http://schemas.xmlsoap.org/soap/envelope/" envelope:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+	<Header xmlns="http://schemas.xmlsoap.org/soap/envelope/"></Header>
+	<Body xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+		<Content>
+			<Bar>bar</Bar>
+		</Content>
+	</Body>
+</Envelope>`, w.Body.String())
+}
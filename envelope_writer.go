@@ -0,0 +1,63 @@
+package soap
+
+import "encoding/xml"
+
+// envelopeWriter writes the envelopes of Client requests and Server
+// responses, so both sides share prefixes, attributes and SOAP 1.2 handling.
+type envelopeWriter struct {
+	Version       string // SoapVersion11 or SoapVersion12
+	Marshaller    XMLMarshaller
+	EnvelopeAttrs []xml.Attr
+	BodyAttrs     []xml.Attr
+	Headers       []interface{} // children of the Header element
+	// Deterministic sorts the attributes of every start tag, see
+	// Client.DeterministicOutput.
+	Deterministic bool
+}
+
+// write returns the envelope with content, e.g. a struct or a *Fault, as Body
+// content.
+func (ew envelopeWriter) write(content interface{}) ([]byte, error) {
+	return ew.marshal(ew.envelope(content))
+}
+
+// envelope returns the envelope with content as Body content.
+func (ew envelopeWriter) envelope(content interface{}) Envelope {
+	return Envelope{
+		Attrs:  ew.EnvelopeAttrs,
+		Header: ew.header(),
+		Body:   Body{Attrs: ew.BodyAttrs, Content: content},
+	}
+}
+
+// writeRaw returns the envelope with content, serialized XML, as Body content.
+func (ew envelopeWriter) writeRaw(content []byte) ([]byte, error) {
+	return ew.marshal(rawEnvelope{
+		Attrs:  ew.EnvelopeAttrs,
+		Header: ew.header(),
+		Body:   rawBody{Attrs: ew.BodyAttrs, Content: content},
+	})
+}
+
+func (ew envelopeWriter) header() Header {
+	if len(ew.Headers) == 0 {
+		return Header{}
+	}
+	return Header{Header: ew.Headers}
+}
+
+// marshal marshals the SOAP 1.1 envelope and adjusts its namespaces to the
+// Version.
+func (ew envelopeWriter) marshal(envelope interface{}) ([]byte, error) {
+	xmlBytes, err := ew.Marshaller.Marshal(envelope)
+	if err != nil {
+		return nil, err
+	}
+	if ew.Version == SoapVersion12 {
+		xmlBytes = replaceSoap11to12(xmlBytes)
+	}
+	if ew.Deterministic {
+		return sortAttributes(xmlBytes)
+	}
+	return xmlBytes, nil
+}
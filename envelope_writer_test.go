@@ -0,0 +1,142 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// assertGolden compares got to testdata/golden/name.
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name)
+	if *updateGolden {
+		require.NoError(t, ioutil.WriteFile(path, got, 0o644))
+	}
+	want, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(got))
+}
+
+var (
+	goldenEnvelopeAttrs = []xml.Attr{EncodingStyle(NamespaceSoapEncoding)}
+	goldenBodyAttrs     = []xml.Attr{{Name: xml.Name{Space: "http://partner.example.com/tenant", Local: "tenant"}, Value: "acme"}}
+)
+
+// authToken is a custom header block with its own namespace.
+type authToken struct {
+	XMLName xml.Name `xml:"urn:example:auth AuthToken"`
+	Token   string   `xml:",chardata"`
+}
+
+// TestEnvelopeWriter_client pins the request envelopes of the Client byte by
+// byte, run with -update to regenerate them.
+func TestEnvelopeWriter_client(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(c *Client)
+	}{
+		{name: "plain"},
+		{name: "attrs", setup: func(c *Client) {
+			c.EnvelopeAttrs = goldenEnvelopeAttrs
+			c.BodyAttrs = goldenBodyAttrs
+		}},
+		{name: "body_encoder", setup: func(c *Client) {
+			c.EnvelopeAttrs = goldenEnvelopeAttrs
+			c.BodyAttrs = goldenBodyAttrs
+			c.BodyEncoder = &recordingBodyCodec{}
+		}},
+		{name: "headers", setup: func(c *Client) {
+			c.Headers = []interface{}{
+				&authToken{Token: "t0k3n"},
+				&struct {
+					XMLName xml.Name `xml:"urn:example:session Session"`
+					ID      string   `xml:"id,attr"`
+				}{ID: "s-1"},
+			}
+		}},
+	}
+	for _, soapVersion := range []string{SoapVersion11, SoapVersion12} {
+		for _, test := range tests {
+			t.Run(soapVersion+"/"+test.name, func(t *testing.T) {
+				var request []byte
+				c := NewClient("http://localhorst.ch", nil)
+				if soapVersion == SoapVersion12 {
+					c.UseSoap12()
+				}
+				if test.setup != nil {
+					test.setup(c)
+				}
+				c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+					request, _ = ioutil.ReadAll(r.Body)
+					return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+				})}).Do
+				_, err := c.Call(context.Background(), "foo", &FooRequest{Foo: "a < b"}, nil)
+				require.NoError(t, err)
+				assertGolden(t, "client_"+soapVersion+"_"+test.name+".xml", request)
+			})
+		}
+	}
+}
+
+// TestEnvelopeWriter_server pins the response envelopes of the Server byte by
+// byte, run with -update to regenerate them.
+func TestEnvelopeWriter_server(t *testing.T) {
+	tests := []struct {
+		name  string
+		foo   string
+		attrs bool
+	}{
+		{name: "response", foo: "ok"},
+		{name: "response_attrs", foo: "ok", attrs: true},
+		{name: "fault", foo: "fail"},
+		{name: "fault_attrs", foo: "fail", attrs: true},
+		{name: "handler_fault", foo: "fault"},
+	}
+	for _, soapVersion := range []string{SoapVersion11, SoapVersion12} {
+		for _, test := range tests {
+			t.Run(soapVersion+"/"+test.name, func(t *testing.T) {
+				soapSrv := NewServer()
+				if soapVersion == SoapVersion12 {
+					soapSrv.UseSoap12()
+				}
+				if test.attrs {
+					soapSrv.EnvelopeAttrs = goldenEnvelopeAttrs
+					soapSrv.BodyAttrs = goldenBodyAttrs
+				}
+				soapSrv.RegisterHandler("/pathTo", "foo", "fooRequest",
+					func() interface{} {
+						return &FooRequest{}
+					},
+					func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+						switch request.(*FooRequest).Foo {
+						case "fail":
+							return nil, errors.New("failed <on> purpose")
+						case "fault":
+							return nil, NewFault("soap:Server", "ledger down", WithFaultActor("urn:ledger"), WithFaultDetail(&FooResponse{Bar: "detail"}))
+						}
+						return &FooResponse{Bar: "a < b"}, nil
+					},
+				)
+				ns := namespace(soapVersion)
+				r := httptest.NewRequest("POST", "/pathTo", strings.NewReader(`<Envelope xmlns="`+ns+`"><Body><fooRequest><Foo>`+test.foo+`</Foo></fooRequest></Body></Envelope>`))
+				r.Header.Set("SOAPAction", "foo")
+				w := httptest.NewRecorder()
+				soapSrv.ServeHTTP(w, r)
+				assertGolden(t, "server_"+soapVersion+"_"+test.name+".xml", w.Body.Bytes())
+			})
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// ErrorKind classifies the errors returned by Client.Call:
+//
+//   - ErrorKindTransport: the request could not be sent or the response could
+//     not be read, e.g. connection resets, timeouts or a canceled context. These
+//     are usually retryable and count against availability.
+//   - ErrorKindProtocol: the request could not be built or the response is not
+//     a valid SOAP message, e.g. bad XML or a wrong namespace. These point to a
+//     bug on either side.
+//   - ErrorKindApplication: the peer answered with a SOAP Fault. This is a
+//     business error, not an outage.
+type ErrorKind int
+
+const (
+	ErrorKindUnknown ErrorKind = iota
+	ErrorKindTransport
+	ErrorKindProtocol
+	ErrorKindApplication
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKindTransport:
+		return "transport"
+	case ErrorKindProtocol:
+		return "protocol"
+	case ErrorKindApplication:
+		return "application"
+	}
+	return "unknown"
+}
+
+// CallError is an error of Client.Call tagged with its ErrorKind.
+type CallError struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (ce *CallError) Error() string {
+	return ce.Err.Error()
+}
+
+func (ce *CallError) Unwrap() error {
+	return ce.Err
+}
+
+// KindOf returns the ErrorKind of err, ErrorKindUnknown if err has not been
+// returned by Client.Call.
+func KindOf(err error) ErrorKind {
+	var ce *CallError
+	if errors.As(err, &ce) {
+		return ce.Kind
+	}
+	return ErrorKindUnknown
+}
+
+func transportError(err error) error {
+	return &CallError{Kind: ErrorKindTransport, Err: err}
+}
+
+func protocolError(err error) error {
+	return &CallError{Kind: ErrorKindProtocol, Err: err}
+}
+
+func applicationError(err error) error {
+	return &CallError{Kind: ErrorKindApplication, Err: err}
+}
+
+// errBodyConsumed matches the errors of attempts which failed after part of
+// the response body has been read, they aren't retried.
+var errBodyConsumed = errors.New("response body partly read")
+
+type bodyConsumedError struct {
+	error
+}
+
+func (e bodyConsumedError) Unwrap() error {
+	return e.error
+}
+
+func (e bodyConsumedError) Is(target error) bool {
+	return target == errBodyConsumed
+}
+
+// readError tags err, which occurred while reading a response, as transport
+// error if the connection broke down and as protocol error otherwise.
+func readError(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, ErrResponseStalled) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return transportError(err)
+	}
+	return protocolError(err)
+}
+
+// StatusError is returned for responses with an HTTP status of 300 or above,
+// which don't carry a SOAP Fault. It is a transport error for 5xx statuses and
+// a protocol error otherwise.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	// Body is the beginning of the response body, for debugging.
+	Body []byte
+}
+
+func (se *StatusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status %q: %q", se.Status, se.Body)
+}
+
+// statusError returns the StatusError for resp with the body read so far.
+func statusError(resp *http.Response, body []byte) error {
+	if len(body) > excerptBytes {
+		body = body[:excerptBytes]
+	}
+	status := resp.Status
+	if status == "" {
+		status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	se := &StatusError{StatusCode: resp.StatusCode, Status: status, Body: append([]byte(nil), body...)}
+	if resp.StatusCode >= 500 {
+		return transportError(se)
+	}
+	return protocolError(se)
+}
@@ -0,0 +1,81 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKindOf(t *testing.T) {
+	respond := func(body string) func(r *http.Request) (*http.Response, error) {
+		return func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			}, nil
+		}
+	}
+
+	tests := []struct {
+		name     string
+		rt       func(r *http.Request) (*http.Response, error)
+		wantKind ErrorKind
+	}{
+		{
+			name: "connection reset",
+			rt: func(r *http.Request) (*http.Response, error) {
+				return nil, syscall.ECONNRESET
+			},
+			wantKind: ErrorKindTransport,
+		},
+		{
+			name:     "not SOAP",
+			rt:       respond(`<html>Bad Gateway</html>`),
+			wantKind: ErrorKindProtocol,
+		},
+		{
+			name:     "bad XML",
+			rt:       respond(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body>`),
+			wantKind: ErrorKindProtocol,
+		},
+		{
+			name: "fault",
+			rt: respond(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><Fault>
+<faultcode>Server</faultcode><faultstring>boom</faultstring></Fault></Body></Envelope>`),
+			wantKind: ErrorKindApplication,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewClient("http://localhorst.ch", nil)
+			c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(test.rt)}).Do
+			_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+			require.Error(t, err)
+			assert.Exactly(t, test.wantKind, KindOf(err))
+			assert.Exactly(t, test.wantKind, KindOf(fmt.Errorf("wrapped: %w", err)))
+		})
+	}
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		c := NewClient("http://localhorst.ch", nil)
+		_, err := c.Call(ctx, "MySOAPAction", &FooRequest{}, &FooResponse{})
+		assert.Exactly(t, ErrorKindTransport, KindOf(err))
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		assert.Exactly(t, ErrorKindUnknown, KindOf(errors.New("not from Call")))
+		assert.Exactly(t, ErrorKindUnknown, KindOf(nil))
+		assert.Exactly(t, "unknown", ErrorKindUnknown.String())
+	})
+}
@@ -0,0 +1,209 @@
+package soap_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/orirawlings/soap"
+	"github.com/orirawlings/soap/soaptest"
+)
+
+// The examples run against servers of this package, in process or on a local
+// port, and against fixture envelopes, so they need no network.
+
+type greetRequest struct {
+	XMLName xml.Name `xml:"urn:example:greeter greetRequest"`
+	Name    string   `xml:"urn:example:greeter Name"`
+}
+
+type greetResponse struct {
+	XMLName  xml.Name `xml:"urn:example:greeter greetResponse"`
+	Greeting string   `xml:"urn:example:greeter Greeting"`
+}
+
+type apiKey struct {
+	XMLName xml.Name `xml:"urn:example:auth APIKey"`
+	Key     string   `xml:",chardata"`
+}
+
+// newGreeter returns a server greeting callers which send an APIKey header.
+func newGreeter() *soap.Server {
+	srv := soap.NewServer()
+	srv.RegisterHandler("/greeter", "urn:example:greeter#Greet", "greetRequest",
+		func() interface{} {
+			return &greetRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			var key apiKey
+			for _, block := range soap.RequestHeaders(httpRequest.Context()) {
+				if block.Name.Local == "APIKey" {
+					if err := xml.Unmarshal(block.Raw, &key); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if key.Key != "s3cr3t" {
+				return nil, soap.NewFault("soap:Client", "missing or wrong APIKey")
+			}
+			return &greetResponse{Greeting: "Hello " + request.(*greetRequest).Name}, nil
+		},
+	)
+	return srv
+}
+
+// A typed call sending a header, first failing with a SOAP Fault.
+func Example_callWithHeadersAndFault() {
+	client := soap.NewClient("http://greeter.example/greeter", nil)
+	client.HTTPClientDoFn = soap.NewLoopback(newGreeter())
+
+	response := &greetResponse{}
+	_, err := client.Call(context.Background(), "urn:example:greeter#Greet", &greetRequest{Name: "Ada"}, response)
+	var fe *soap.FaultError
+	if errors.As(err, &fe) {
+		fmt.Println("fault:", fe.Fault.Code, fe.Fault.String, soap.KindOf(err) == soap.ErrorKindApplication)
+	}
+
+	client.Headers = []interface{}{&apiKey{Key: "s3cr3t"}}
+	if _, err := client.Call(context.Background(), "urn:example:greeter#Greet", &greetRequest{Name: "Ada"}, response); err != nil {
+		panic(err)
+	}
+	fmt.Println(response.Greeting)
+	// Output:
+	// fault: soap:Client missing or wrong APIKey true
+	// Hello Ada
+}
+
+type uploadRequest struct {
+	XMLName xml.Name `xml:"urn:example:files uploadRequest"`
+	Ref     string   `xml:"urn:example:files Ref"` // Content-ID of the attachment
+}
+
+type uploadResponse struct {
+	XMLName xml.Name `xml:"urn:example:files uploadResponse"`
+	Bytes   int      `xml:"urn:example:files Bytes"`
+}
+
+// Uploading a file as attachment of a multipart/related request, which the
+// handler streams.
+func Example_attachmentUpload() {
+	srv := soap.NewServer()
+	srv.RegisterHandler("/files", "upload", "uploadRequest",
+		func() interface{} {
+			return &uploadRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			attachments := soap.RequestAttachments(httpRequest.Context())
+			if attachments == nil {
+				return nil, soap.NewFault("soap:Client", "attachment missing")
+			}
+			attachment, err := attachments.Next()
+			if err != nil {
+				return nil, err
+			}
+			if attachment.ContentID != request.(*uploadRequest).Ref {
+				return nil, soap.NewFault("soap:Client", "unknown attachment "+attachment.ContentID)
+			}
+			data, err := ioutil.ReadAll(attachment.Decoded())
+			if err != nil {
+				return nil, err
+			}
+			return &uploadResponse{Bytes: len(data)}, nil
+		},
+	)
+	httpServer := httptest.NewServer(srv)
+	defer httpServer.Close()
+
+	client := soap.NewClient(httpServer.URL+"/files", nil)
+	file := soap.NewAttachmentReader(&soap.Attachment{
+		ContentID:   "report.pdf@example",
+		ContentType: "application/pdf",
+		Body:        strings.NewReader("%PDF-1.4 not really"),
+	})
+	response := &uploadResponse{}
+	if _, err := client.Call(context.Background(), "upload", &uploadRequest{Ref: "report.pdf@example"}, response, soap.WithAttachments(file)); err != nil {
+		panic(err)
+	}
+	fmt.Println("uploaded", response.Bytes, "bytes")
+	// Output:
+	// uploaded 19 bytes
+}
+
+// Testing the handlers of a server in process, without HTTP.
+func Example_testHandlers() {
+	srv := newGreeter()
+	if errs := srv.Validate(); len(errs) > 0 {
+		panic(errs)
+	}
+	_, fault, err := soaptest.Invoke(srv, "/greeter", "urn:example:greeter#Greet", &greetRequest{Name: "Ada"})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(fault.String)
+	// Output:
+	// missing or wrong APIKey
+}
+
+// A client and a server talking SOAP 1.2 over a local port, the client
+// additionally sending WS-Addressing headers.
+func Example_clientServer() {
+	srv := newGreeter()
+	srv.UseSoap12()
+	httpServer := httptest.NewServer(srv)
+	defer httpServer.Close()
+
+	client := soap.NewClient(httpServer.URL+"/greeter", nil)
+	client.UseSoap12()
+	client.Headers = []interface{}{&apiKey{Key: "s3cr3t"}}
+	client.WSAddressing = &soap.WSAddressing{IDGenerator: &soaptest.SequenceIDs{}}
+
+	stats := &soap.CallStats{}
+	response := &greetResponse{}
+	if _, err := client.Call(context.Background(), "urn:example:greeter#Greet", &greetRequest{Name: "Grace"}, response, soap.WithCallStats(stats)); err != nil {
+		panic(err)
+	}
+	fmt.Println(response.Greeting, stats.MessageID)
+	// Output:
+	// Hello Grace message-1
+}
+
+// A response of an aggregating service holding a result together with the
+// Faults of failed sub-operations, replayed from a fixture.
+func Example_partialResult() {
+	fixture, err := ioutil.ReadFile("testdata/faults/aggregator.partial.response.xml")
+	if err != nil {
+		panic(err)
+	}
+	client := soap.NewClient("http://aggregator.example", nil)
+	client.HTTPClientDoFn = func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/xml; charset=utf-8"}},
+			Body:       ioutil.NopCloser(bytes.NewReader(fixture)),
+			Request:    req,
+		}, nil
+	}
+
+	type fooResponse struct {
+		Bar string
+	}
+	response := &fooResponse{}
+	_, err = client.Call(context.Background(), "aggregate", &greetRequest{}, response)
+	var pe *soap.PartialResultError
+	if errors.As(err, &pe) {
+		fmt.Println(response.Bar)
+		for _, fault := range pe.Faults {
+			fmt.Println("-", fault.String)
+		}
+	}
+	// Output:
+	// 3 of 4 sub-operations succeeded
+	// - sub-operation inventory timed out
+	// - sub-operation pricing rejected the currency
+}
@@ -0,0 +1,156 @@
+package soap
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// CallPlan describes the request a Call would send, see Client.Explain.
+type CallPlan struct {
+	Action string
+	// URL is the endpoint with password and RedactedQueryParams masked.
+	URL string
+	// Header is the HTTP header of the request, the credentials of the
+	// Authorization header are replaced by REDACTED.
+	Header      http.Header
+	ContentType string
+	SoapVersion string
+	// Envelope is the envelope as sent, before compression or multipart
+	// encoding.
+	Envelope []byte
+	// Features are the optional features of the Client, whether the call
+	// would use them and why.
+	Features []Feature
+	// Policy is the effective policy of the call, PolicyKey the key of
+	// Client.Policies it is based on, "" if none.
+	Policy    CallPolicy
+	PolicyKey string
+}
+
+// Feature is an optional feature of a call, see CallPlan.
+type Feature struct {
+	Name   string
+	Active bool
+	Reason string
+}
+
+type explainingKey struct{}
+
+// isExplaining tells whether ctx is the context of Explain, which must not
+// touch the network, e.g. to fetch credentials.
+func isExplaining(ctx context.Context) bool {
+	return ctx.Value(explainingKey{}) != nil
+}
+
+// Explain describes the request a Call of soapAction with request and opts
+// would send, without sending it. It builds the request the way Call does,
+// but neither fetches credentials nor tokens, nor reads the attachments of
+// WithAttachments. It fails where Call would fail before sending.
+func (c *Client) Explain(soapAction string, request interface{}, opts ...CallOption) (*CallPlan, error) {
+	soapAction, err := normalizeAction(soapAction)
+	if err != nil {
+		return nil, protocolError(err)
+	}
+	ctx := context.WithValue(context.Background(), explainingKey{}, true)
+	o := newCallOptions(opts)
+	c.resolveFeatures(ctx, soapAction, o)
+	key, ok := c.resolvePolicy(soapAction, o)
+	plan := &CallPlan{
+		Action:      soapAction,
+		SoapVersion: c.SoapVersion,
+		Policy:      o.stats.Policy,
+	}
+	if ok {
+		plan.PolicyKey = key
+	}
+	if plan.SoapVersion == "" {
+		plan.SoapVersion = SoapVersion11
+	}
+	endpoint, err := c.endpoint(o)
+	if err != nil {
+		return nil, protocolError(err)
+	}
+	if plan.Envelope, err = c.marshalEnvelope(soapAction, request, o); err != nil {
+		return nil, err
+	}
+	attachments := o.attachments
+	if attachments != nil {
+		o.attachments = NewAttachmentReader()
+	}
+	req, err := c.prepareRequest(ctx, endpoint, soapAction, plan.Envelope, o)
+	if err != nil {
+		return nil, err
+	}
+	req.Body.Close()
+	if scheme, _, ok := strings.Cut(req.Header.Get("Authorization"), " "); ok {
+		// e.g. set by RequestHeaderFn
+		req.Header.Set("Authorization", scheme+" REDACTED")
+	}
+	plan.URL = c.maskURL(req.URL)
+	plan.Header = req.Header
+	plan.ContentType = req.Header.Get("Content-Type")
+	plan.Features = c.features(req, attachments != nil, o)
+	return plan, nil
+}
+
+// explainAuthorization sets the Authorization header of req like authorize,
+// without credentials.
+func (c *Client) explainAuthorization(req *http.Request) {
+	if c.auth != nil || c.CredentialsFn != nil {
+		req.Header.Set("Authorization", "Basic REDACTED")
+	}
+	if c.TokenSource != nil {
+		req.Header.Set("Authorization", "Bearer REDACTED")
+	}
+}
+
+// features reports the optional features of the call building req.
+func (c *Client) features(req *http.Request, attachments bool, o *callOptions) []Feature {
+	var features []Feature
+	add := func(name string, active bool, reason string) {
+		features = append(features, Feature{Name: name, Active: active, Reason: reason})
+	}
+
+	if attachments {
+		add("MTOM", true, "WithAttachments is set, the envelope and attachments are sent as multipart/related")
+	} else {
+		add("MTOM", false, "no WithAttachments")
+	}
+	switch {
+	case req.Header.Get("Content-Encoding") == "gzip":
+		add("compression", true, "CompressRequest is set, the envelope is sent gzip encoded")
+	case o.features.CompressRequest.on():
+		add("compression", false, "CompressRequest is set, but multipart requests are sent uncompressed")
+	default:
+		add("compression", false, "CompressRequest is not set")
+	}
+	if c.Signer != nil {
+		add("signing", true, "Signer is set, the envelope is signed")
+	} else {
+		add("signing", false, "no Signer")
+	}
+	switch {
+	case o.wsAddressing != nil:
+		add("WS-Addressing", true, "WithWSAddressing is set, MessageID "+o.stats.MessageID)
+	case c.WSAddressing != nil:
+		add("WS-Addressing", true, "WSAddressing is set, MessageID "+o.stats.MessageID)
+	default:
+		add("WS-Addressing", false, "no WSAddressing")
+	}
+	if c.IntegrityHeader != "" {
+		add("integrity", true, "IntegrityHeader is set, the response must echo "+c.IntegrityHeader)
+	} else {
+		add("integrity", false, "IntegrityHeader is not set")
+	}
+	if c.DigestAuth != nil {
+		reason := "DigestAuth is set, the challenge of the server is answered"
+		if challenge := c.peekDigestChallenge(); challenge != nil {
+			reason = "DigestAuth is set, the cached challenge of realm " + challenge.realm + " is answered right away"
+		}
+		add("Digest authentication", true, reason)
+	} else {
+		add("Digest authentication", false, "no DigestAuth")
+	}
+	return features
+}
@@ -0,0 +1,174 @@
+package soap
+
+import (
+	"errors"
+	"expvar"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// expvarLatencyBuckets are the upper bounds of the latency histogram
+// published by EnableExpvar.
+var expvarLatencyBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+var errHandlerPanicked = errors.New("handler panicked")
+
+// expvarUnknownAction is the key of the server metrics of requests for
+// actions without a handler, so clients can't add keys at will.
+const expvarUnknownAction = "unknown"
+
+// expvarMetrics are the variables published by EnableExpvar.
+type expvarMetrics struct {
+	clock    Clock
+	calls    *expvar.Map // by action
+	errors   *expvar.Map // by ErrorKind
+	faults   *expvar.Map // by action
+	inFlight *expvar.Int
+	latency  *expvar.Map // by bucket
+	// missingHeaders counts responses missing an expected header block by
+	// action, see HeaderExpected.
+	missingHeaders *expvar.Map
+}
+
+// newExpvarMetrics publishes the variables under prefix, or reuses them if
+// they have been published before.
+func newExpvarMetrics(prefix string, clock Clock) *expvarMetrics {
+	m := &expvarMetrics{
+		clock:    clockOrDefault(clock),
+		calls:    expvarMap(prefix + ".calls"),
+		errors:   expvarMap(prefix + ".errors"),
+		faults:   expvarMap(prefix + ".faults"),
+		latency:  expvarMap(prefix + ".latency_ms"),
+		inFlight: expvarInt(prefix + ".in_flight"),
+
+		missingHeaders: expvarMap(prefix + ".missing_headers"),
+	}
+	for _, bucket := range expvarBuckets() {
+		m.latency.Add(bucket, 0)
+	}
+	return m
+}
+
+func expvarMap(name string) *expvar.Map {
+	if v, ok := expvar.Get(name).(*expvar.Map); ok {
+		return v
+	}
+	return expvar.NewMap(name)
+}
+
+func expvarInt(name string) *expvar.Int {
+	if v, ok := expvar.Get(name).(*expvar.Int); ok {
+		return v
+	}
+	return expvar.NewInt(name)
+}
+
+// expvarBuckets returns the keys of the latency histogram.
+func expvarBuckets() []string {
+	keys := make([]string, 0, len(expvarLatencyBuckets)+1)
+	for _, bound := range expvarLatencyBuckets {
+		keys = append(keys, "le_"+strconv.FormatInt(bound.Milliseconds(), 10))
+	}
+	return append(keys, "le_inf")
+}
+
+// begin counts a call of action in flight and returns the function to call
+// with its outcome: err, its ErrorKind and whether a SOAP Fault has been
+// received or sent. It is safe to call on nil.
+func (m *expvarMetrics) begin(action string) func(err error, kind ErrorKind, fault bool) {
+	if m == nil {
+		return func(error, ErrorKind, bool) {}
+	}
+	start := m.clock.Now()
+	m.calls.Add(action, 1)
+	m.inFlight.Add(1)
+	return func(err error, kind ErrorKind, fault bool) {
+		m.inFlight.Add(-1)
+		if err != nil {
+			m.errors.Add(kind.String(), 1)
+		}
+		if fault {
+			m.faults.Add(action, 1)
+		}
+		elapsed := m.clock.Now().Sub(start)
+		buckets := expvarBuckets()
+		bucket := buckets[len(buckets)-1]
+		for i, bound := range expvarLatencyBuckets {
+			if elapsed <= bound {
+				bucket = buckets[i]
+				break
+			}
+		}
+		m.latency.Add(bucket, 1)
+	}
+}
+
+// missingHeader counts a response to a call of action missing an expected
+// header block. It is safe to call on nil.
+func (m *expvarMetrics) missingHeader(action string) {
+	if m != nil {
+		m.missingHeaders.Add(action, 1)
+	}
+}
+
+// EnableExpvar publishes metrics of the calls of the Client with the expvar
+// package, e.g. for /debug/vars:
+//
+//	<prefix>.calls       calls by action
+//	<prefix>.errors      failed calls by ErrorKind: transport, protocol, application or unknown
+//	<prefix>.faults      calls answered with a SOAP Fault by action
+//	<prefix>.in_flight   calls in flight
+//	<prefix>.latency_ms  calls by duration, counted in the first bucket
+//	                     le_5, le_10, le_25, le_50, le_100, le_250, le_500,
+//	                     le_1000, le_2500, le_5000, le_10000 or le_inf they fit
+//	<prefix>.missing_headers  responses missing a HeaderExpected header block by action
+//
+// The variables are shared with Clients and Servers enabling the same prefix.
+// Call it before the Client is used.
+func (c *Client) EnableExpvar(prefix string) {
+	c.metrics = newExpvarMetrics(prefix, c.Clock)
+}
+
+// observe tracks a call of action with the metrics of EnableExpvar, the
+// returned function must be called with the error of the call.
+func (c *Client) observe(action string) func(err error) {
+	end := c.metrics.begin(action)
+	return func(err error) {
+		var fe *FaultError
+		end(err, KindOf(err), errors.As(err, &fe))
+	}
+}
+
+// EnableExpvar publishes metrics of the requests served by ServeHTTP with the
+// expvar package, with the names documented at Client.EnableExpvar. Rejected
+// requests, e.g. for an unknown action, count as protocol errors, requests
+// whose handler fails as application errors. Requests for actions without a
+// handler or alias at their path are counted as action "unknown".
+func (s *Server) EnableExpvar(prefix string) {
+	s.metrics = newExpvarMetrics(prefix, s.Clock)
+}
+
+// metricsAction returns the key of the metrics of a request of r for
+// soapAction.
+func (s *Server) metricsAction(r *http.Request, soapAction string) string {
+	if _, ok := s.handlers[r.URL.Path][soapAction]; ok {
+		return soapAction
+	}
+	if s.aliases[r.URL.Path][soapAction] != nil {
+		return soapAction
+	}
+	return expvarUnknownAction
+}
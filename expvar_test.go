@@ -0,0 +1,83 @@
+package soap
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scrapeExpvar returns the variables of /debug/vars.
+func scrapeExpvar(t *testing.T) map[string]json.RawMessage {
+	w := httptest.NewRecorder()
+	expvar.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	vars := map[string]json.RawMessage{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &vars))
+	return vars
+}
+
+func TestEnableExpvar(t *testing.T) {
+	soapSrv := NewServer()
+	soapSrv.EnableExpvar("test_expvar_server")
+	soapSrv.RegisterHandler("/pathTo", "foo", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			if request.(*FooRequest).Foo == "fail" {
+				return nil, NewFault("soap:Server", "failed")
+			}
+			return &FooResponse{Bar: "ok"}, nil
+		},
+	)
+	c := NewClient("http://localhorst.ch/pathTo", nil)
+	c.EnableExpvar("test_expvar_client")
+	c.HTTPClientDoFn = NewLoopback(soapSrv)
+
+	for _, foo := range []string{"a", "b", "fail"} {
+		_, _ = c.Call(context.Background(), "foo", &FooRequest{Foo: foo}, &FooResponse{})
+	}
+	_, _ = c.Call(context.Background(), "bar", &FooRequest{}, &FooResponse{})
+
+	vars := scrapeExpvar(t)
+	for prefix, want := range map[string]struct {
+		calls, errors, faults string
+	}{
+		"test_expvar_client": {
+			calls:  `{"bar": 1, "foo": 3}`,
+			errors: `{"application": 2}`,
+			faults: `{"bar": 1, "foo": 1}`,
+		},
+		"test_expvar_server": {
+			calls:  `{"unknown": 1, "foo": 3}`,
+			errors: `{"application": 1, "protocol": 1}`,
+			faults: `{"unknown": 1, "foo": 1}`,
+		},
+	} {
+		assert.JSONEq(t, want.calls, string(vars[prefix+".calls"]), prefix)
+		assert.JSONEq(t, want.errors, string(vars[prefix+".errors"]), prefix)
+		assert.JSONEq(t, want.faults, string(vars[prefix+".faults"]), prefix)
+		assert.JSONEq(t, `0`, string(vars[prefix+".in_flight"]), prefix)
+
+		latency := map[string]int{}
+		require.NoError(t, json.Unmarshal(vars[prefix+".latency_ms"], &latency))
+		assert.Len(t, latency, len(expvarLatencyBuckets)+1, prefix)
+		total := 0
+		for _, n := range latency {
+			total += n
+		}
+		assert.Equal(t, 4, total, prefix)
+	}
+
+	other := NewClient("http://localhorst.ch/pathTo", nil)
+	other.EnableExpvar("test_expvar_client")
+	other.HTTPClientDoFn = NewLoopback(soapSrv)
+	_, err := other.Call(context.Background(), "foo", &FooRequest{Foo: "a"}, &FooResponse{})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"bar": 1, "foo": 4}`, string(scrapeExpvar(t)["test_expvar_client.calls"]), "the prefix is shared")
+}
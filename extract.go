@@ -0,0 +1,175 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// CallExtract makes a SOAP call, but instead of decoding the whole response
+// it only fills extracts. The keys of extracts are element paths of local
+// names relative to the Envelope, e.g. "Body/StatusResponse/State", the values
+// are pointers to scalars or structs the elements are decoded into. The first
+// element matching a path wins. The response body is read only until every
+// extract has been filled, the rest is discarded. This pays off for large
+// responses of which only a few values are needed. Middleware of Use is
+// passed extracts as response.
+func (c *Client) CallExtract(ctx context.Context, soapAction string, request interface{}, extracts map[string]interface{}, opts ...CallOption) (*http.Response, error) {
+	return c.chain(func(ctx context.Context, action string, request, response interface{}) (*http.Response, error) {
+		extracts, ok := response.(map[string]interface{})
+		if !ok {
+			return nil, protocolError(fmt.Errorf("CallExtract needs extracts as response, got %T", response))
+		}
+		return c.callExtract(ctx, action, request, extracts, opts...)
+	})(ctx, soapAction, request, extracts)
+}
+
+// callExtract makes the SOAP call of CallExtract, after the middleware of Use.
+func (c *Client) callExtract(ctx context.Context, soapAction string, request interface{}, extracts map[string]interface{}, opts ...CallOption) (httpResponse *http.Response, err error) {
+	cs, err := c.begin(ctx, soapAction, opts)
+	defer func() { cs.end(err) }()
+	if err != nil {
+		return nil, err
+	}
+	ctx, soapAction, o, endpoint := cs.ctx, cs.action, cs.o, cs.endpoint
+	return c.withReauthentication(ctx, func() (*http.Response, error) {
+		xmlBytes, err := c.marshalEnvelope(soapAction, request, o)
+		if err != nil {
+			return nil, err
+		}
+		return c.retry(ctx, o.retryPolicy, func() (*http.Response, error) {
+			return c.roundTripExtract(ctx, endpoint, soapAction, xmlBytes, extracts, o)
+		})
+	})
+}
+
+// roundTripExtract makes a single attempt of CallExtract.
+func (c *Client) roundTripExtract(ctx context.Context, endpoint, soapAction string, xmlBytes []byte, extracts map[string]interface{}, o *callOptions) (*http.Response, error) {
+	req, err := c.prepareRequest(ctx, endpoint, soapAction, xmlBytes, o)
+	if err != nil {
+		return nil, err
+	}
+	logTraceID := c.logRequest(req, xmlBytes)
+	archiveID := c.archiveRequest(req, soapAction, xmlBytes)
+	httpResponse, err := c.do(req, o)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkIntegrity(httpResponse, o); err != nil {
+		httpResponse.Body.Close()
+		return nil, err
+	}
+	defer httpResponse.Body.Close()
+	defer c.archiveResponse(archiveID, req, soapAction, httpResponse)()
+
+	mediaType, params, _ := mime.ParseMediaType(httpResponse.Header.Get("Content-Type"))
+	body, boundary, isMultipart := c.sniffMultipart(httpResponse.Body, mediaType, params["boundary"], logTraceID)
+	charset := params["charset"]
+	if isMultipart {
+		part, stats, err := soapPart(body, boundary)
+		o.stats.Multipart = stats
+		c.logMultipart(stats, logTraceID)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(part)
+		charset = charsetOf(stats.Parts[stats.Envelope].ContentType)
+	}
+	body, charsetReader, err := c.streamCharset(body, charset)
+	if err != nil {
+		return nil, protocolError(err)
+	}
+
+	if httpResponse.StatusCode >= 300 {
+		// Error responses are read whole, for the excerpt of the StatusError.
+		rawBody, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, readError(err)
+		}
+		if err := extract(bytes.NewReader(rawBody), extracts, charsetReader); KindOf(err) == ErrorKindApplication {
+			return httpResponse, err
+		}
+		return httpResponse, statusError(httpResponse, rawBody)
+	}
+	if err := extract(body, extracts, charsetReader); err != nil {
+		if KindOf(err) == ErrorKindApplication {
+			return httpResponse, err // the response of the fault
+		}
+		return nil, err
+	}
+	return httpResponse, nil
+}
+
+// extract decodes the elements at the paths of extracts from the envelope in
+// r, reading only until all have been found. charsetReader converts other
+// charsets than UTF-8.
+func extract(r io.Reader, extracts map[string]interface{}, charsetReader func(string, io.Reader) (io.Reader, error)) error {
+	pending := make(map[string]interface{}, len(extracts))
+	for path, target := range extracts {
+		pending[strings.Trim(path, "/")] = target
+	}
+
+	d := xml.NewDecoder(r)
+	d.CharsetReader = charsetReader
+	var path []string // local names of the open elements below the Envelope
+	depth := 0
+	for len(pending) > 0 {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return readError(err)
+		}
+
+		switch tt := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 {
+				continue // Envelope
+			}
+			path = append(path, tt.Name.Local)
+			key := strings.Join(path, "/")
+			if key == "Body/Fault" {
+				fault := &Fault{}
+				if err := d.DecodeElement(fault, &tt); err != nil {
+					return protocolError(err)
+				}
+				return applicationError(&FaultError{
+					Fault:     fault,
+					formatted: fault.String,
+				})
+			}
+			if target, ok := pending[key]; ok {
+				if err := d.DecodeElement(target, &tt); err != nil {
+					return protocolError(fmt.Errorf("could not decode %s: %w", key, err))
+				}
+				delete(pending, key)
+				path = path[:len(path)-1]
+				depth--
+			}
+		case xml.EndElement:
+			depth--
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		}
+	}
+
+	if len(pending) > 0 {
+		missing := make([]string, 0, len(pending))
+		for key := range pending {
+			missing = append(missing, key)
+		}
+		sort.Strings(missing)
+		return protocolError(fmt.Errorf("elements not found in response: %s", strings.Join(missing, ", ")))
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type statusItem struct {
+	ID   int
+	Name string
+}
+
+type statusResponse struct {
+	State    string
+	Progress int
+	Items    []statusItem `xml:"Items>Item"`
+}
+
+// largeStatusResponse returns a status poll response with n items following
+// the two scalars of interest.
+func largeStatusResponse(n int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><StatusResponse xmlns="urn:status">`)
+	buf.WriteString(`<State>RUNNING</State><Progress>42</Progress><Items>`)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&buf, "<Item><ID>%d</ID><Name>item number %d</Name></Item>", i, i)
+	}
+	buf.WriteString(`</Items></StatusResponse></soap:Body></soap:Envelope>`)
+	return buf.Bytes()
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += n
+	return n, err
+}
+
+func extractClient(body func() io.Reader) *Client {
+	c := NewClient("http://localhorst.ch", nil)
+	c.HTTPClientDoFn = (&http.Client{
+		Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(body()),
+			}, nil
+		}),
+	}).Do
+	return c
+}
+
+func TestClient_CallExtract(t *testing.T) {
+	response := largeStatusResponse(100000)
+
+	t.Run("early termination", func(t *testing.T) {
+		cr := &countingReader{r: bytes.NewReader(response)}
+		c := extractClient(func() io.Reader { return cr })
+
+		var state string
+		var progress int
+		httpResp, err := c.CallExtract(context.Background(), "GetStatus", &FooRequest{}, map[string]interface{}{
+			"Body/StatusResponse/State":     &state,
+			"/Body/StatusResponse/Progress": &progress,
+		})
+		require.NoError(t, err)
+		assert.NotNil(t, httpResp)
+		assert.Exactly(t, "RUNNING", state)
+		assert.Exactly(t, 42, progress)
+		assert.Less(t, cr.n, len(response)/100)
+	})
+
+	t.Run("missing element", func(t *testing.T) {
+		c := extractClient(func() io.Reader { return bytes.NewReader(largeStatusResponse(1)) })
+
+		var state, owner string
+		_, err := c.CallExtract(context.Background(), "GetStatus", &FooRequest{}, map[string]interface{}{
+			"Body/StatusResponse/State": &state,
+			"Body/StatusResponse/Owner": &owner,
+		})
+		assert.EqualError(t, err, "elements not found in response: Body/StatusResponse/Owner")
+		assert.Exactly(t, ErrorKindProtocol, KindOf(err))
+		assert.Exactly(t, "RUNNING", state)
+	})
+
+	t.Run("fault", func(t *testing.T) {
+		c := extractClient(func() io.Reader {
+			return strings.NewReader(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault><faultcode>soap:Server</faultcode><faultstring>no such job</faultstring></soap:Fault></soap:Body></soap:Envelope>`)
+		})
+
+		var state string
+		_, err := c.CallExtract(context.Background(), "GetStatus", &FooRequest{}, map[string]interface{}{
+			"Body/StatusResponse/State": &state,
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no such job")
+		assert.Exactly(t, ErrorKindApplication, KindOf(err))
+	})
+}
+
+func BenchmarkClient_Call_largeResponse(b *testing.B) {
+	response := largeStatusResponse(20000)
+	c := extractClient(func() io.Reader { return bytes.NewReader(response) })
+	b.SetBytes(int64(len(response)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var resp statusResponse
+		if _, err := c.Call(context.Background(), "GetStatus", &FooRequest{}, &resp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkClient_CallExtract_largeResponse(b *testing.B) {
+	response := largeStatusResponse(20000)
+	c := extractClient(func() io.Reader { return bytes.NewReader(response) })
+	b.SetBytes(int64(len(response)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var state string
+		var progress int
+		if _, err := c.CallExtract(context.Background(), "GetStatus", &FooRequest{}, map[string]interface{}{
+			"Body/StatusResponse/State":    &state,
+			"Body/StatusResponse/Progress": &progress,
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package soap
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	faultElementRe = regexp.MustCompile(`(?s)<([\w.-]+:)?Fault[\s>].*?</([\w.-]+:)?Fault\s*>`)
+	faultFieldRes  = map[string]*regexp.Regexp{
+		"faultcode":   regexp.MustCompile(`(?s)<(?:[\w.-]+:)?faultcode[^>]*>(.*?)</`),
+		"faultstring": regexp.MustCompile(`(?s)<(?:[\w.-]+:)?faultstring[^>]*>(.*?)</`),
+		"faultactor":  regexp.MustCompile(`(?s)<(?:[\w.-]+:)?faultactor[^>]*>(.*?)</`),
+		"detail":      regexp.MustCompile(`(?s)<(?:[\w.-]+:)?detail[^>]*>(.*?)</(?:[\w.-]+:)?detail\s*>`),
+		// SOAP 1.2
+		"Value":  regexp.MustCompile(`(?s)<(?:[\w.-]+:)?Code[^>]*>\s*<(?:[\w.-]+:)?Value[^>]*>(.*?)</`),
+		"Text":   regexp.MustCompile(`(?s)<(?:[\w.-]+:)?Reason[^>]*>\s*<(?:[\w.-]+:)?Text[^>]*>(.*?)</`),
+		"Node":   regexp.MustCompile(`(?s)<(?:[\w.-]+:)?Node[^>]*>(.*?)</`),
+		"Role":   regexp.MustCompile(`(?s)<(?:[\w.-]+:)?Role[^>]*>(.*?)</`),
+		"Detail": regexp.MustCompile(`(?s)<(?:[\w.-]+:)?Detail[^>]*>(.*?)</(?:[\w.-]+:)?Detail\s*>`),
+	}
+	entityReplacer = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&quot;", `"`, "&apos;", "'", "&amp;", "&")
+)
+
+// FaultOption configures a Fault built by NewFault.
+type FaultOption func(*Fault)
+
+// WithFaultActor sets the URI of the node which failed, the faultactor in
+// SOAP 1.1 and Role in SOAP 1.2. The Server falls back to its ActorURI.
+func WithFaultActor(uri string) FaultOption {
+	return func(f *Fault) {
+		f.Actor = uri
+	}
+}
+
+// WithFaultNode sets the Node of a SOAP 1.2 Fault.
+func WithFaultNode(uri string) FaultOption {
+	return func(f *Fault) {
+		f.Node = uri
+	}
+}
+
+// WithFaultDetail sets the content of the detail element.
+func WithFaultDetail(detail interface{}) FaultOption {
+	return func(f *Fault) {
+		f.DetailContent = detail
+	}
+}
+
+// NewFault returns a Fault with code and reason, the faultcode and faultstring.
+// Return it from an OperationHandlerFunc to have the Server respond with it.
+func NewFault(code, reason string, opts ...FaultOption) *Fault {
+	f := &Fault{Code: code, String: reason}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// recoverFault extracts a Fault from envelope, which couldn't be decoded, by
+// scanning for the Fault element and its fields. It returns nil, if there is
+// no Fault element.
+func recoverFault(envelope []byte) *FaultError {
+	raw := faultElementRe.Find(envelope)
+	if raw == nil {
+		return nil
+	}
+	field := func(names ...string) string {
+		for _, name := range names {
+			if m := faultFieldRes[name].FindSubmatch(raw); m != nil {
+				return strings.TrimSpace(entityReplacer.Replace(string(m[1])))
+			}
+		}
+		return ""
+	}
+	return &FaultError{
+		Fault: &Fault{
+			Code:   field("faultcode", "Value"),
+			String: field("faultstring", "Text"),
+			Actor:  field("faultactor", "Role"),
+			Node:   field("Node"),
+			Detail: field("detail", "Detail"),
+		},
+		Raw:       raw,
+		Recovered: true,
+		formatted: string(raw),
+	}
+}
+
+// rawFault returns the Fault element of envelope as received.
+func rawFault(envelope []byte) []byte {
+	if content, err := bodyContent(envelope); err == nil && content != nil {
+		return content
+	}
+	return append([]byte(nil), faultElementRe.Find(envelope)...)
+}
@@ -0,0 +1,113 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The faults in testdata/faults are shaped like the ones gateways in front of
+// a service send, identifying themselves as the node which failed.
+func TestClient_Call_intermediaryFault(t *testing.T) {
+	tests := []struct {
+		file  string
+		code  string
+		actor string
+		node  string
+	}{
+		{
+			file:  "intermediary.soap11.response.xml",
+			code:  "soapenv:Server",
+			actor: "urn:example:gateway:edge-2",
+		},
+		{
+			file:  "intermediary.soap12.response.xml",
+			code:  "env:Receiver",
+			actor: "http://www.w3.org/2003/05/soap-envelope/role/next",
+			node:  "urn:example:gateway:edge-2",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			envelope, err := ioutil.ReadFile(filepath.Join("testdata", "faults", test.file))
+			require.NoError(t, err)
+			c := NewClient("http://localhorst.ch", nil)
+			c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusInternalServerError,
+					Body:       ioutil.NopCloser(bytes.NewReader(envelope)),
+				}, nil
+			})}).Do
+
+			_, err = c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{})
+			var fe *FaultError
+			require.True(t, errors.As(err, &fe), "%v", err)
+			assert.Equal(t, test.code, fe.Fault.Code)
+			assert.Equal(t, "upstream service unavailable", fe.Fault.String)
+			assert.Equal(t, test.actor, fe.Fault.Actor)
+			assert.Equal(t, test.node, fe.Fault.Node)
+
+			parsed, err := ParseEnvelope(bytes.NewReader(envelope))
+			require.NoError(t, err)
+			fv := FaultToV2(parsed.Body.Fault)
+			assert.Equal(t, test.actor, fv.Role)
+			assert.Equal(t, test.node, fv.Node)
+		})
+	}
+}
+
+func TestServer_faultActor(t *testing.T) {
+	for _, soapVersion := range []string{SoapVersion11, SoapVersion12} {
+		t.Run(soapVersion, func(t *testing.T) {
+			soapSrv := NewServer()
+			soapSrv.ActorURI = "urn:example:service"
+			if soapVersion == SoapVersion12 {
+				soapSrv.UseSoap12()
+			}
+			soapSrv.RegisterHandler("/pathTo", "testPostAction", "fooRequest",
+				func() interface{} {
+					return &FooRequest{}
+				},
+				func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+					switch request.(*FooRequest).Foo {
+					case "hop":
+						return nil, NewFault("soap:Server", "ledger down", WithFaultActor("urn:example:ledger"), WithFaultNode("urn:example:ledger:1"))
+					default:
+						return nil, NewFault("soap:Client", "bad foo")
+					}
+				},
+			)
+			srv := httptest.NewServer(soapSrv)
+			defer srv.Close()
+			client := NewClient(srv.URL+"/pathTo", nil)
+			if soapVersion == SoapVersion12 {
+				client.UseSoap12()
+			}
+
+			_, err := client.Call(context.Background(), "testPostAction", &FooRequest{Foo: "hop"}, &FooResponse{})
+			var fe *FaultError
+			require.True(t, errors.As(err, &fe), "%v", err)
+			assert.Equal(t, "soap:Server", fe.Fault.Code)
+			assert.Equal(t, "ledger down", fe.Fault.String)
+			assert.Equal(t, "urn:example:ledger", fe.Fault.Actor)
+			if soapVersion == SoapVersion12 {
+				assert.Equal(t, "urn:example:ledger:1", fe.Fault.Node)
+			} else {
+				assert.Empty(t, fe.Fault.Node, "SOAP 1.1 has no Node")
+			}
+
+			_, err = client.Call(context.Background(), "testPostAction", &FooRequest{Foo: "bad"}, &FooResponse{})
+			require.True(t, errors.As(err, &fe), "%v", err)
+			assert.Equal(t, "bad foo", fe.Fault.String)
+			assert.Equal(t, "urn:example:service", fe.Fault.Actor)
+		})
+	}
+}
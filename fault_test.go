@@ -0,0 +1,175 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Call_malformedFault(t *testing.T) {
+	tests := []struct {
+		name     string
+		envelope string
+		want     Fault
+	}{
+		{
+			name: "unescaped ampersand in detail",
+			envelope: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>
+<faultcode>soap:Server</faultcode><faultstring>Tom &amp; Jerry not found</faultstring>
+<detail>lookup Tom & Jerry failed</detail></soap:Fault></soap:Body></soap:Envelope>`,
+			want: Fault{Code: "soap:Server", String: "Tom & Jerry not found", Detail: "lookup Tom & Jerry failed"},
+		},
+		{
+			name: "undeclared prefix",
+			envelope: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>
+<faultcode>soap:Client</faultcode><faultstring>invalid request</faultstring>
+<detail><ns1:error>bad</ns2:error></detail></soap:Fault></soap:Body></soap:Envelope>`,
+			want: Fault{Code: "soap:Client", String: "invalid request", Detail: "<ns1:error>bad</ns2:error>"},
+		},
+		{
+			name: "SOAP 1.2",
+			envelope: `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body><env:Fault>
+<env:Code><env:Value>env:Receiver</env:Value></env:Code><env:Reason><env:Text xml:lang="en">down & out</env:Text></env:Reason>
+</env:Fault></env:Body></env:Envelope>`,
+			want: Fault{Code: "env:Receiver", String: "down & out"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewClient("http://localhorst.ch", nil)
+			c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: 500,
+					Body:       ioutil.NopCloser(strings.NewReader(test.envelope)),
+				}, nil
+			})}).Do
+			_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+			var fe *FaultError
+			require.True(t, errors.As(err, &fe), "got %v", err)
+			assert.True(t, fe.Recovered)
+			assert.Equal(t, test.want.Code, fe.Fault.Code)
+			assert.Equal(t, test.want.String, fe.Fault.String)
+			assert.Equal(t, test.want.Detail, fe.Fault.Detail)
+			assert.Contains(t, test.envelope, string(fe.Raw))
+			assert.Contains(t, err.Error(), test.want.String)
+			assert.Equal(t, ErrorKindApplication, KindOf(err))
+		})
+	}
+
+	t.Run("well-formed", func(t *testing.T) {
+		c := NewClient("http://localhorst.ch", nil)
+		c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(faultResponse("soap:Server", "busy"))}).Do
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+		var fe *FaultError
+		require.True(t, errors.As(err, &fe))
+		assert.False(t, fe.Recovered)
+		assert.Contains(t, string(fe.Raw), "<faultstring>busy</faultstring>")
+	})
+}
+
+func TestClient_Call_typedFault(t *testing.T) {
+	envelope := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>
+<faultcode>soap:Client</faultcode><faultstring>account locked</faultstring><faultactor>urn:bank:ledger</faultactor>
+<detail><b:AccountFault xmlns:b="urn:bank"><b:Account>CH93-0076</b:Account></b:AccountFault></detail>
+</soap:Fault></soap:Body></soap:Envelope>`
+	c := NewClient("http://localhorst.ch", nil)
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 500,
+			Header:     http.Header{"X-Request-Id": {"r-1"}},
+			Body:       ioutil.NopCloser(strings.NewReader(envelope)),
+		}, nil
+	})}).Do
+
+	for name, call := range map[string]func() (*http.Response, error){
+		"Call": func() (*http.Response, error) {
+			return c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+		},
+		"CallExtract": func() (*http.Response, error) {
+			return c.CallExtract(context.Background(), "MySOAPAction", &FooRequest{}, map[string]interface{}{"Body/fooResponse/Bar": new(string)})
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := call()
+			var f *Fault
+			require.True(t, errors.As(err, &f), "got %v", err)
+			assert.Equal(t, "soap:Client", f.Code)
+			assert.Equal(t, "account locked", f.String)
+			assert.Equal(t, "urn:bank:ledger", f.Actor)
+			assert.Equal(t, `<b:AccountFault xmlns:b="urn:bank"><b:Account>CH93-0076</b:Account></b:AccountFault>`, string(f.DetailXML()))
+			assert.Equal(t, ErrorKindApplication, KindOf(err))
+			require.NotNil(t, resp)
+			assert.Equal(t, 500, resp.StatusCode)
+			assert.Equal(t, "r-1", resp.Header.Get("X-Request-Id"))
+		})
+	}
+}
+
+func TestClient_Call_statusError(t *testing.T) {
+	soap11Fault, err := ioutil.ReadFile("testdata/faults/intermediary.soap11.response.xml")
+	require.NoError(t, err)
+	soap12Fault, err := ioutil.ReadFile("testdata/faults/intermediary.soap12.response.xml")
+	require.NoError(t, err)
+	htmlPage := "<html><body>" + strings.Repeat("Service Unavailable ", 100) + "</body></html>"
+	for name, tc := range map[string]struct {
+		soap12      bool
+		statusCode  int
+		body        string
+		wantFault   bool
+		wantKind    ErrorKind
+		wantExcerpt string
+	}{
+		"1.1 fault on 500": {statusCode: 500, body: string(soap11Fault), wantFault: true},
+		"1.2 fault on 400": {soap12: true, statusCode: 400, body: string(soap12Fault), wantFault: true},
+		"html on 503":      {statusCode: 503, body: htmlPage, wantKind: ErrorKindTransport, wantExcerpt: htmlPage[:excerptBytes]},
+		"empty 500":        {statusCode: 500, wantKind: ErrorKindTransport},
+		"envelope on 404": {
+			statusCode:  404,
+			body:        `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body/></soap:Envelope>`,
+			wantKind:    ErrorKindProtocol,
+			wantExcerpt: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body/></soap:Envelope>`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewClient("http://localhorst.ch", nil)
+			if tc.soap12 {
+				c.UseSoap12()
+			}
+			c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: tc.statusCode,
+					Body:       ioutil.NopCloser(strings.NewReader(tc.body)),
+				}, nil
+			})}).Do
+
+			for call, fn := range map[string]func() (*http.Response, error){
+				"Call": func() (*http.Response, error) {
+					return c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+				},
+				"CallExtract": func() (*http.Response, error) {
+					return c.CallExtract(context.Background(), "MySOAPAction", &FooRequest{}, map[string]interface{}{"Body/fooResponse/Bar": new(string)})
+				},
+			} {
+				resp, err := fn()
+				require.NotNil(t, resp, call)
+				assert.Equal(t, tc.statusCode, resp.StatusCode, call)
+				if tc.wantFault {
+					var f *Fault
+					assert.True(t, errors.As(err, &f), "%s: %v", call, err)
+					continue
+				}
+				var se *StatusError
+				require.True(t, errors.As(err, &se), "%s: %v", call, err)
+				assert.Equal(t, tc.statusCode, se.StatusCode, call)
+				assert.Equal(t, tc.wantExcerpt, string(se.Body), call)
+				assert.Equal(t, tc.wantKind, KindOf(err), call)
+			}
+		})
+	}
+}
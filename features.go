@@ -0,0 +1,150 @@
+package soap
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// FeatureFlag switches a behavior in Features. FeatureDefault keeps the
+// setting of the Client or Server field of the same name.
+type FeatureFlag int8
+
+// FeatureFlags
+const (
+	FeatureDefault FeatureFlag = iota
+	FeatureOn
+	FeatureOff
+)
+
+func (f FeatureFlag) String() string {
+	switch f {
+	case FeatureOn:
+		return "on"
+	case FeatureOff:
+		return "off"
+	}
+	return "default"
+}
+
+// on tells whether the resolved flag is on.
+func (f FeatureFlag) on() bool {
+	return f == FeatureOn
+}
+
+// featureFlag returns FeatureOn or FeatureOff for b.
+func featureFlag(b bool) FeatureFlag {
+	if b {
+		return FeatureOn
+	}
+	return FeatureOff
+}
+
+// Features are the behaviors of the Client and Server which can be switched
+// per call by Client.FeatureResolver and per request by
+// Server.FeatureResolver, e.g. to roll out a change gradually by action or
+// tenant. Each flag overrides the field of the same name, fields a side
+// doesn't have are ignored by it. The Features in effect are recorded in
+// CallStats.Features.
+type Features struct {
+	ValidateEnums        FeatureFlag // Client and Server
+	DeterministicOutput  FeatureFlag // Client and Server
+	QuoteSOAPAction      FeatureFlag // Client
+	ResolveMultiRefs     FeatureFlag // Client
+	ZeroResponseTarget   FeatureFlag // Client
+	FailFastInFlight     FeatureFlag // Client
+	CompressRequest      FeatureFlag // Client
+	UnsafePartialResults FeatureFlag // Server
+}
+
+// String lists the flags which aren't FeatureDefault, e.g. for logs.
+func (f Features) String() string {
+	var flags []string
+	for _, ff := range []struct {
+		name string
+		flag FeatureFlag
+	}{
+		{"ValidateEnums", f.ValidateEnums},
+		{"DeterministicOutput", f.DeterministicOutput},
+		{"QuoteSOAPAction", f.QuoteSOAPAction},
+		{"ResolveMultiRefs", f.ResolveMultiRefs},
+		{"ZeroResponseTarget", f.ZeroResponseTarget},
+		{"FailFastInFlight", f.FailFastInFlight},
+		{"CompressRequest", f.CompressRequest},
+		{"UnsafePartialResults", f.UnsafePartialResults},
+	} {
+		if ff.flag != FeatureDefault {
+			flags = append(flags, ff.name+"="+ff.flag.String())
+		}
+	}
+	return strings.Join(flags, " ")
+}
+
+// override returns f with the flags of o which aren't FeatureDefault.
+func (f Features) override(o Features) Features {
+	for _, p := range []struct{ dst, src *FeatureFlag }{
+		{&f.ValidateEnums, &o.ValidateEnums},
+		{&f.DeterministicOutput, &o.DeterministicOutput},
+		{&f.QuoteSOAPAction, &o.QuoteSOAPAction},
+		{&f.ResolveMultiRefs, &o.ResolveMultiRefs},
+		{&f.ZeroResponseTarget, &o.ZeroResponseTarget},
+		{&f.FailFastInFlight, &o.FailFastInFlight},
+		{&f.CompressRequest, &o.CompressRequest},
+		{&f.UnsafePartialResults, &o.UnsafePartialResults},
+	} {
+		if *p.src != FeatureDefault {
+			*p.dst = *p.src
+		}
+	}
+	return f
+}
+
+// resolveFeatures resolves the Features of a call of action into o.
+func (c *Client) resolveFeatures(ctx context.Context, action string, o *callOptions) {
+	features := Features{
+		ValidateEnums:       featureFlag(c.ValidateEnums),
+		DeterministicOutput: featureFlag(c.DeterministicOutput),
+		QuoteSOAPAction:     featureFlag(c.QuoteSOAPAction),
+		ResolveMultiRefs:    featureFlag(c.ResolveMultiRefs),
+		ZeroResponseTarget:  featureFlag(c.ZeroResponseTarget),
+		FailFastInFlight:    featureFlag(c.FailFastInFlight),
+		CompressRequest:     featureFlag(c.CompressRequest),
+	}
+	if c.FeatureResolver != nil {
+		features = features.override(c.FeatureResolver(ctx, action))
+		if c.Log != nil {
+			c.Log("Features", "action", action, "features", features.String())
+		}
+	}
+	o.features = features
+	o.stats.Features = features
+}
+
+type featuresKey struct{}
+
+// withFeatures resolves the Features of r into its context.
+func (s *Server) withFeatures(r *http.Request) *http.Request {
+	features := s.fieldFeatures()
+	if s.FeatureResolver != nil {
+		features = features.override(s.FeatureResolver(r))
+		s.log("features:", features.String())
+	}
+	return r.WithContext(context.WithValue(r.Context(), featuresKey{}, features))
+}
+
+// features returns the Features of the request with ctx.
+func (s *Server) features(ctx context.Context) Features {
+	if features, ok := ctx.Value(featuresKey{}).(Features); ok {
+		return features
+	}
+	return s.fieldFeatures()
+}
+
+// fieldFeatures returns the Features set by the fields of s.
+func (s *Server) fieldFeatures() Features {
+	return Features{
+		ValidateEnums:        featureFlag(s.ValidateEnums),
+		DeterministicOutput:  featureFlag(s.DeterministicOutput),
+		UnsafePartialResults: featureFlag(s.UnsafePartialResults),
+	}
+}
@@ -0,0 +1,110 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_FeatureResolver(t *testing.T) {
+	var req *http.Request
+	c := NewClient("http://localhorst.ch", nil)
+	c.HTTPClientDoFn = func(r *http.Request) (*http.Response, error) {
+		req = r
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	}
+	var logged []interface{}
+	c.Log = func(msg string, keyString_ValueInterface ...interface{}) {
+		if msg == "Features" {
+			logged = keyString_ValueInterface
+		}
+	}
+
+	// defaults are kept without a resolver
+	stats := &CallStats{}
+	_, err := c.Call(context.Background(), "order", &orderRequest{Status: "PENDING"}, nil, WithCallStats(stats))
+	require.NoError(t, err)
+	assert.Equal(t, "order", req.Header.Get("SOAPAction"))
+	assert.Empty(t, req.Header.Get("Content-Encoding"))
+	assert.Equal(t, FeatureOff, stats.Features.ValidateEnums)
+	assert.Nil(t, logged)
+
+	c.QuoteSOAPAction = true
+	c.FeatureResolver = func(ctx context.Context, action string) Features {
+		if action != "order" {
+			return Features{}
+		}
+		return Features{ValidateEnums: FeatureOn, CompressRequest: FeatureOn, QuoteSOAPAction: FeatureOff}
+	}
+
+	stats = &CallStats{}
+	_, err = c.Call(context.Background(), "other", &FooRequest{Foo: "foo"}, nil, WithCallStats(stats))
+	require.NoError(t, err)
+	assert.Equal(t, `"other"`, req.Header.Get("SOAPAction"), "the field applies to other actions")
+	assert.Empty(t, req.Header.Get("Content-Encoding"))
+	assert.Equal(t, FeatureOn, stats.Features.QuoteSOAPAction)
+
+	stats = &CallStats{}
+	_, err = c.Call(context.Background(), "order", &orderRequest{Status: "OPEN"}, nil, WithCallStats(stats))
+	require.NoError(t, err)
+	assert.Equal(t, "order", req.Header.Get("SOAPAction"))
+	assert.Equal(t, "gzip", req.Header.Get("Content-Encoding"))
+	assert.Equal(t, Features{
+		ValidateEnums:       FeatureOn,
+		DeterministicOutput: FeatureOff,
+		QuoteSOAPAction:     FeatureOff,
+		ResolveMultiRefs:    FeatureOff,
+		ZeroResponseTarget:  FeatureOff,
+		FailFastInFlight:    FeatureOff,
+		CompressRequest:     FeatureOn,
+	}, stats.Features)
+	assert.Equal(t, []interface{}{"action", "order", "features", "ValidateEnums=on DeterministicOutput=off QuoteSOAPAction=off ResolveMultiRefs=off ZeroResponseTarget=off FailFastInFlight=off CompressRequest=on"}, logged)
+
+	_, err = c.Call(context.Background(), "order", &orderRequest{Status: "PENDING"}, nil)
+	var ee *EnumError
+	assert.True(t, errors.As(err, &ee), "%v", err)
+}
+
+func TestServer_FeatureResolver(t *testing.T) {
+	soapSrv := NewServer()
+	soapSrv.RegisterHandler("/pathTo", "order", "orderRequest",
+		func() interface{} {
+			return &orderRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			return &FooResponse{Bar: string(request.(*orderRequest).Status)}, nil
+		},
+	)
+	soapSrv.FeatureResolver = func(r *http.Request) Features {
+		if r.Header.Get("X-Tenant") == "strict" {
+			return Features{ValidateEnums: FeatureOn}
+		}
+		return Features{}
+	}
+	var logged []interface{}
+	soapSrv.Log = func(args ...interface{}) {
+		if args[0] == "features:" {
+			logged = args
+		}
+	}
+	srv := httptest.NewServer(soapSrv)
+	defer srv.Close()
+	c := NewClient(srv.URL+"/pathTo", nil)
+
+	response := &FooResponse{}
+	_, err := c.Call(context.Background(), "order", &orderRequest{Status: "PENDING"}, response)
+	require.NoError(t, err)
+	assert.Equal(t, "PENDING", response.Bar)
+	assert.Equal(t, []interface{}{"features:", "ValidateEnums=off DeterministicOutput=off UnsafePartialResults=off"}, logged)
+
+	_, err = c.Call(context.Background(), "order", &orderRequest{Status: "PENDING"}, response, WithHTTPHeader("X-Tenant", "strict"))
+	var fe *FaultError
+	require.True(t, errors.As(err, &fe), "%v", err)
+	assert.Equal(t, `orderRequest.Status: "PENDING" is not one of OPEN, CLOSED`, fe.Fault.String)
+	assert.Equal(t, []interface{}{"features:", "ValidateEnums=on DeterministicOutput=off UnsafePartialResults=off"}, logged)
+}
@@ -0,0 +1,126 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// GenericTextKey and the GenericAttrPrefix are used by DecodeGeneric for the
+// text and the attributes of an element.
+const (
+	GenericTextKey    = "#text"
+	GenericAttrPrefix = "@"
+)
+
+// GenericDecoder decodes XML without predefined types, see DecodeGeneric.
+type GenericDecoder struct {
+	// Namespaces qualifies keys of namespaced elements and attributes with
+	// their namespace in Clark notation, e.g. "{http://tempuri.org/}Foo".
+	// Namespace declarations are dropped either way.
+	Namespaces bool
+}
+
+// DecodeGeneric decodes the XML document body, e.g. the content of a SOAP
+// Body, into nested maps. Pass a *map[string]interface{} as response to
+// Client.Call to decode the first element of a response Body this way.
+//
+// The mapping rules are:
+//   - the result has a single key, the name of the root element
+//   - elements are keyed by their local name in the map of their parent
+//   - an element with neither attributes nor child elements is its text, an
+//     empty element is ""
+//   - any other element is a map[string]interface{}, its attributes are keyed
+//     by "@" followed by their local name and its text, if it contains more
+//     than white space, by "#text"
+//   - the text of mixed content is concatenated and trimmed, its position
+//     between the child elements is lost
+//   - repeated siblings with the same key become a []interface{} in document
+//     order
+func DecodeGeneric(body []byte) (map[string]interface{}, error) {
+	return GenericDecoder{}.Decode(body)
+}
+
+// Decode decodes body as described for DecodeGeneric.
+func (gd GenericDecoder) Decode(body []byte) (map[string]interface{}, error) {
+	d := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return nil, errors.New("no XML element found")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if se, ok := token.(xml.StartElement); ok {
+			value, err := gd.decodeElement(d, se)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{gd.key(se.Name): value}, nil
+		}
+	}
+}
+
+func (gd GenericDecoder) decodeElement(d *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	m := map[string]interface{}{}
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			continue
+		}
+		m[GenericAttrPrefix+gd.key(attr.Name)] = attr.Value
+	}
+
+	var (
+		text     strings.Builder
+		children bool
+	)
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch tt := token.(type) {
+		case xml.StartElement:
+			children = true
+			value, err := gd.decodeElement(d, tt)
+			if err != nil {
+				return nil, err
+			}
+			addGeneric(m, gd.key(tt.Name), value)
+		case xml.CharData:
+			text.Write(tt)
+		case xml.EndElement:
+			if len(m) == 0 && !children {
+				return text.String(), nil
+			}
+			if s := strings.TrimSpace(text.String()); s != "" {
+				m[GenericTextKey] = s
+			}
+			return m, nil
+		}
+	}
+}
+
+func (gd GenericDecoder) key(name xml.Name) string {
+	if gd.Namespaces && name.Space != "" {
+		return "{" + name.Space + "}" + name.Local
+	}
+	return name.Local
+}
+
+// addGeneric adds value under key to m, turning repeated keys into a slice.
+func addGeneric(m map[string]interface{}, key string, value interface{}) {
+	existing, ok := m[key]
+	if !ok {
+		m[key] = value
+		return
+	}
+	if values, ok := existing.([]interface{}); ok {
+		m[key] = append(values, value)
+		return
+	}
+	m[key] = []interface{}{existing, value}
+}
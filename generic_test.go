@@ -0,0 +1,89 @@
+package soap
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeGeneric(t *testing.T) {
+	const doc = `<?xml version="1.0"?>
+<ns:getOrdersResponse xmlns:ns="http://tempuri.org/" status="ok">
+	<ns:order id="1">
+		<ns:item>apple</ns:item>
+		<ns:item>pear</ns:item>
+		<ns:note>ripe <b>and</b> sweet</ns:note>
+	</ns:order>
+	<ns:order id="2">
+		<ns:item>plum</ns:item>
+		<ns:empty/>
+	</ns:order>
+</ns:getOrdersResponse>`
+
+	got, err := DecodeGeneric([]byte(doc))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"getOrdersResponse": map[string]interface{}{
+			"@status": "ok",
+			"order": []interface{}{
+				map[string]interface{}{
+					"@id":  "1",
+					"item": []interface{}{"apple", "pear"},
+					"note": map[string]interface{}{
+						"#text": "ripe  sweet",
+						"b":     "and",
+					},
+				},
+				map[string]interface{}{
+					"@id":   "2",
+					"item":  "plum",
+					"empty": "",
+				},
+			},
+		},
+	}, got)
+
+	t.Run("namespaces", func(t *testing.T) {
+		got, err := GenericDecoder{Namespaces: true}.Decode([]byte(`<a xmlns="urn:a" xmlns:x="urn:x" x:attr="1" plain="2"><x:b>text</x:b></a>`))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"{urn:a}a": map[string]interface{}{
+				"@{urn:x}attr": "1",
+				"@plain":       "2",
+				"{urn:x}b":     "text",
+			},
+		}, got)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := DecodeGeneric([]byte(``))
+		assert.Error(t, err)
+		_, err = DecodeGeneric([]byte(`<a><b></a>`))
+		assert.Error(t, err)
+	})
+}
+
+func TestClient_Call_generic(t *testing.T) {
+	c := NewClient("http://localhorst.ch", nil)
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Body: ioutil.NopCloser(strings.NewReader(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:t="http://tempuri.org/">
+<soap:Body><t:fooResponse><t:Bar>bar</t:Bar><t:Bar>baz</t:Bar></t:fooResponse></soap:Body></soap:Envelope>`)),
+		}, nil
+	})}).Do
+
+	var response map[string]interface{}
+	_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &response)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"fooResponse": map[string]interface{}{
+			"Bar": []interface{}{"bar", "baz"},
+		},
+	}, response)
+}
@@ -0,0 +1,34 @@
+package soap
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// HeadMode selects how the Server responds to HEAD requests, see
+// Server.HeadMode.
+type HeadMode int
+
+const (
+	// HeadMethodNotAllowed responds with the headers of a GET request, which
+	// is rejected as PreDispatchMethodNotAllowed (default).
+	HeadMethodNotAllowed HeadMode = iota
+	// HeadNoContent responds with 204 No Content for registered paths, e.g.
+	// for health checks of load balancers.
+	HeadNoContent
+)
+
+// serveHead responds to a HEAD request according to the HeadMode. The body
+// is discarded by the responseWriter.
+func (s *Server) serveHead(w http.ResponseWriter, r *http.Request) {
+	if s.HeadMode != HeadNoContent {
+		s.reject(w, r, PreDispatchMethodNotAllowed, errNotPOST)
+		return
+	}
+	if _, ok := s.handlers[r.URL.Path]; !ok {
+		s.reject(w, r, PreDispatchUnknownPath, fmt.Errorf("unknown path %q", r.URL.Path))
+		return
+	}
+	setContentType(w, s.ContentType)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,133 @@
+package soap
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_ContentLength(t *testing.T) {
+	soapSrv := NewServer()
+	soapSrv.ResponseBufferBytes = 1024
+	for tag, size := range map[string]int{"small": 100, "large": 5000} {
+		size := size
+		soapSrv.RegisterHandler("/pathTo", "raw", tag,
+			func() interface{} { return &dummyContent{} },
+			func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(http.StatusAccepted)
+				for i := 0; i < size; i += 50 {
+					w.Write([]byte(strings.Repeat("x", 50)))
+				}
+				return nil, nil
+			},
+		)
+	}
+	soapSrv.RegisterHandler("/pathTo", "testPostAction", "fooRequest",
+		func() interface{} { return &FooRequest{} },
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			return &FooResponse{Bar: strings.Repeat("y", 5000)}, nil
+		},
+	)
+	srv := httptest.NewServer(soapSrv)
+	defer srv.Close()
+
+	post := func(action, tag string) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/pathTo", strings.NewReader(
+			`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><`+tag+`/></Body></Envelope>`))
+		require.NoError(t, err)
+		req.Header.Set("SOAPAction", action)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, body
+	}
+
+	t.Run("small", func(t *testing.T) {
+		resp, body := post("raw", "small")
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Equal(t, int64(100), resp.ContentLength)
+		assert.Equal(t, "100", resp.Header.Get("Content-Length"))
+		assert.Empty(t, resp.TransferEncoding)
+		assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+		assert.Len(t, body, 100)
+	})
+
+	t.Run("large", func(t *testing.T) {
+		resp, body := post("raw", "large")
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Equal(t, int64(-1), resp.ContentLength)
+		assert.Empty(t, resp.Header.Get("Content-Length"))
+		assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+		assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+		assert.Len(t, body, 5000)
+	})
+
+	t.Run("large envelope", func(t *testing.T) {
+		resp, body := post("testPostAction", "fooRequest")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, int64(len(body)), resp.ContentLength)
+		assert.Empty(t, resp.TransferEncoding)
+		assert.Equal(t, SoapContentType11, resp.Header.Get("Content-Type"))
+	})
+}
+
+func TestServer_Head(t *testing.T) {
+	soapSrv := NewServer()
+	soapSrv.RegisterHandler("/pathTo", "testPostAction", "fooRequest",
+		func() interface{} { return &FooRequest{} },
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			return &FooResponse{}, nil
+		},
+	)
+	srv := httptest.NewServer(soapSrv)
+	defer srv.Close()
+
+	do := func(method, path string) (*http.Response, []byte) {
+		req, err := http.NewRequest(method, srv.URL+path, nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, body
+	}
+
+	for _, mode := range []PreDispatchErrorMode{PreDispatchErrorFault, PreDispatchErrorPlain} {
+		soapSrv.PreDispatchErrorMode = mode
+		t.Run("like GET", func(t *testing.T) {
+			get, getBody := do(http.MethodGet, "/pathTo")
+			head, headBody := do(http.MethodHead, "/pathTo")
+			assert.NotEmpty(t, getBody)
+			assert.Empty(t, headBody)
+			assert.Equal(t, get.StatusCode, head.StatusCode)
+			assert.Equal(t, int64(len(getBody)), head.ContentLength)
+			for _, name := range []string{"Content-Type", "Content-Length", "Allow"} {
+				assert.Equal(t, get.Header.Get(name), head.Header.Get(name), name)
+			}
+			assert.Equal(t, http.MethodPost, head.Header.Get("Allow"))
+		})
+	}
+	soapSrv.PreDispatchErrorMode = PreDispatchErrorFault
+
+	t.Run("no content", func(t *testing.T) {
+		soapSrv.HeadMode = HeadNoContent
+		resp, body := do(http.MethodHead, "/pathTo")
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.Equal(t, SoapContentType11, resp.Header.Get("Content-Type"))
+		assert.Empty(t, resp.Header.Get("Content-Length"))
+		assert.Empty(t, body)
+
+		soapSrv.PreDispatchErrorMode = PreDispatchErrorPlain
+		resp, _ = do(http.MethodHead, "/unknown")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
@@ -0,0 +1,120 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+)
+
+// HeaderBlock is a child element of the SOAP Header of a request.
+type HeaderBlock struct {
+	Name xml.Name
+	// Raw is the element as received, namespace declarations of the Envelope
+	// and Header elements aren't copied onto it.
+	Raw []byte
+}
+
+type requestHeadersKey struct{}
+
+// RequestHeaders returns the header blocks of the SOAP request the Server
+// dispatches. Use it with the context of the *http.Request passed to an
+// OperationHandlerFunc.
+func RequestHeaders(ctx context.Context) []HeaderBlock {
+	headers, _ := ctx.Value(requestHeadersKey{}).([]HeaderBlock)
+	return headers
+}
+
+// withRequestHeaders returns r with headers in its context, see
+// RequestHeaders.
+func withRequestHeaders(r *http.Request, headers []HeaderBlock) *http.Request {
+	if len(headers) == 0 {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), requestHeadersKey{}, headers))
+}
+
+// headerBlocks returns the children of the Header element of envelope.
+func headerBlocks(envelope []byte) ([]HeaderBlock, error) {
+	d := xml.NewDecoder(bytes.NewReader(envelope))
+	var (
+		blocks   []HeaderBlock
+		inScope  []xml.Attr
+		depth    int
+		inHeader bool
+		start    int64
+		name     xml.Name
+	)
+	for {
+		offset := d.InputOffset()
+		token, err := d.RawToken()
+		if err != nil {
+			return nil, err
+		}
+		switch tt := token.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case depth == 1:
+				inScope = append(inScope, namespaceDecls(tt.Attr)...)
+			case depth == 2 && tt.Name.Local == "Header":
+				inHeader = true
+				inScope = append(inScope, namespaceDecls(tt.Attr)...)
+			case depth == 2:
+				return blocks, nil // the Header precedes the Body
+			case depth == 3 && inHeader:
+				start = offset
+				name = resolveName(tt.Name, append(inScope, namespaceDecls(tt.Attr)...))
+			}
+		case xml.EndElement:
+			switch {
+			case depth == 3 && inHeader:
+				blocks = append(blocks, HeaderBlock{Name: name, Raw: envelope[start:d.InputOffset()]})
+			case depth == 2 && inHeader:
+				return blocks, nil
+			}
+			depth--
+		}
+	}
+}
+
+// resolveName resolves the prefix of the raw name with the namespace
+// declarations decls, later ones shadow earlier ones.
+func resolveName(name xml.Name, decls []xml.Attr) xml.Name {
+	for i := len(decls) - 1; i >= 0; i-- {
+		attr := decls[i]
+		if name.Space == "" && attr.Name.Space == "" && attr.Name.Local == "xmlns" ||
+			name.Space != "" && attr.Name.Space == "xmlns" && attr.Name.Local == name.Space {
+			return xml.Name{Space: attr.Value, Local: name.Local}
+		}
+	}
+	return xml.Name{Local: name.Local}
+}
+
+// decodeHeader decodes the Header of envelope into dst, if there is one.
+func decodeHeader(envelope []byte, dst interface{}) error {
+	d := xml.NewDecoder(bytes.NewReader(envelope))
+	depth := 0
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch tt := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				if tt.Name.Local != "Header" {
+					return nil // the Header precedes the Body
+				}
+				return d.DecodeElement(dst, &tt)
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
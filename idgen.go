@@ -0,0 +1,173 @@
+package soap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// IDKind tells what an identifier is minted for, see IDGenerator.
+type IDKind string
+
+// Kinds of identifiers
+const (
+	// IDLogTrace correlates the log entries of a call.
+	IDLogTrace IDKind = "log_trace"
+	// IDArchive correlates the MessageRecords of a request and its response.
+	IDArchive IDKind = "archive"
+	// IDMessage identifies a message, e.g. as WS-Addressing MessageID.
+	IDMessage IDKind = "message"
+	// IDNonce is a nonce, e.g. of a WS-Security UsernameToken.
+	IDNonce IDKind = "nonce"
+	// IDBoundary is a MIME multipart boundary.
+	IDBoundary IDKind = "boundary"
+	// IDElement is the wsu:Id of an element, e.g. to be referenced by a
+	// signature.
+	IDElement IDKind = "element"
+)
+
+// IDGenerator mints identifiers. Implementations must be safe for concurrent
+// use.
+type IDGenerator interface {
+	NewID(kind IDKind) string
+}
+
+// RandomIDs is the default IDGenerator, reading from crypto/rand. Message IDs
+// are "urn:uuid:" URIs of random UUIDs, nonces are base64 encoded.
+type RandomIDs struct{}
+
+const idCharset = "abcdefghijklmnopqrstuvwxyz" +
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// NewID implements IDGenerator
+func (RandomIDs) NewID(kind IDKind) string {
+	switch kind {
+	case IDMessage:
+		b := randomBytes(16)
+		b[6] = b[6]&0x0f | 0x40 // version 4
+		b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+		return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	case IDNonce:
+		return base64.StdEncoding.EncodeToString(randomBytes(16))
+	case IDBoundary:
+		return hex.EncodeToString(randomBytes(15))
+	default:
+		id := make([]byte, 0, 12)
+		for len(id) < cap(id) {
+			for _, b := range randomBytes(cap(id)) {
+				// skip the bytes which would bias the modulo
+				if int(b) < 256-256%len(idCharset) && len(id) < cap(id) {
+					id = append(id, idCharset[int(b)%len(idCharset)])
+				}
+			}
+		}
+		return string(id)
+	}
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("soap: reading crypto/rand: %s", err))
+	}
+	return b
+}
+
+// idBytes returns the bytes of id, decoded if it is base64 encoded like the
+// nonces of RandomIDs.
+func idBytes(id string) []byte {
+	if b, err := base64.StdEncoding.DecodeString(id); err == nil {
+		return b
+	}
+	return []byte(id)
+}
+
+// ids returns the IDGenerator of the Client, RandomIDs if there is none.
+func (c *Client) ids() IDGenerator {
+	if c.IDGenerator == nil {
+		return RandomIDs{}
+	}
+	return c.IDGenerator
+}
+
+// newID mints an identifier of kind with the IDGenerator of the Client.
+func (c *Client) newID(kind IDKind) string {
+	return c.ids().NewID(kind)
+}
+
+type idGeneratorKey struct{}
+
+// withIDGenerator returns ctx carrying ids to the transport of a request,
+// e.g. NTLMTransport.
+func withIDGenerator(ctx context.Context, ids IDGenerator) context.Context {
+	return context.WithValue(ctx, idGeneratorKey{}, ids)
+}
+
+// idGeneratorOf returns the IDGenerator of the Client sending a request with
+// ctx, RandomIDs if there is none.
+func idGeneratorOf(ctx context.Context) IDGenerator {
+	if ids, ok := ctx.Value(idGeneratorKey{}).(IDGenerator); ok {
+		return ids
+	}
+	return RandomIDs{}
+}
+
+// withIDs returns headers with copies of the WS-Security headers without an
+// IDGenerator, which mint their identifiers with ids.
+func withIDs(headers []interface{}, ids IDGenerator) []interface{} {
+	out := make([]interface{}, len(headers))
+	for i, h := range headers {
+		switch h := h.(type) {
+		case *WSSETimestamp:
+			ts := *h
+			if ts.IDGenerator == nil {
+				ts.IDGenerator = ids
+			}
+			ts.Security = securityWithIDs(ts.Security, ids)
+			out[i] = &ts
+		case *WSSEUsernameToken:
+			out[i] = usernameTokenWithIDs(h, ids)
+		case WSSEUsernameToken:
+			out[i] = *usernameTokenWithIDs(&h, ids)
+		case *Security:
+			out[i] = securityWithIDs(h, ids)
+		case Security:
+			out[i] = *securityWithIDs(&h, ids)
+		default:
+			out[i] = h
+		}
+	}
+	return out
+}
+
+func securityWithIDs(s *Security, ids IDGenerator) *Security {
+	if s == nil || s.UsernameToken == nil || s.UsernameToken.IDGenerator != nil {
+		return s
+	}
+	security := *s
+	security.UsernameToken = usernameTokenWithIDs(s.UsernameToken, ids)
+	return &security
+}
+
+func usernameTokenWithIDs(ut *WSSEUsernameToken, ids IDGenerator) *WSSEUsernameToken {
+	if ut.IDGenerator != nil {
+		return ut
+	}
+	token := *ut
+	token.IDGenerator = ids
+	return &token
+}
+
+// signerWithIDs returns signer, or a copy of an *X509Signer without an
+// IDGenerator, which mints its identifiers with ids.
+func signerWithIDs(signer EnvelopeSigner, ids IDGenerator) EnvelopeSigner {
+	xs, ok := signer.(*X509Signer)
+	if !ok || xs.IDGenerator != nil {
+		return signer
+	}
+	withIDs := *xs
+	withIDs.IDGenerator = ids
+	return &withIDs
+}
@@ -0,0 +1,120 @@
+package soap
+
+import (
+	"context"
+	"encoding/base64"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sequenceIDs is like soaptest.SequenceIDs, which can't be imported here.
+type sequenceIDs map[IDKind]int
+
+func (s sequenceIDs) NewID(kind IDKind) string {
+	s[kind]++
+	return string(kind) + "-" + strconv.Itoa(s[kind])
+}
+
+func TestRandomIDs(t *testing.T) {
+	ids := RandomIDs{}
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		id := ids.NewID(IDLogTrace)
+		assert.Regexp(t, `^[a-zA-Z0-9]{12}$`, id)
+		assert.False(t, seen[id])
+		seen[id] = true
+	}
+	assert.Regexp(t, `^urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, ids.NewID(IDMessage))
+	nonce, err := base64.StdEncoding.DecodeString(ids.NewID(IDNonce))
+	require.NoError(t, err)
+	assert.Len(t, nonce, 16)
+	assert.Regexp(t, `^[0-9a-f]{30}$`, ids.NewID(IDBoundary))
+}
+
+func TestClient_IDGenerator(t *testing.T) {
+	var (
+		logged  []string
+		records []MessageRecord
+	)
+	c := NewClient("http://localhorst.ch", nil)
+	c.IDGenerator = sequenceIDs{}
+	c.Log = func(msg string, keyString_ValueInterface ...interface{}) {
+		for i := 0; i+1 < len(keyString_ValueInterface); i += 2 {
+			if keyString_ValueInterface[i] == "log_trace_id" {
+				logged = append(logged, keyString_ValueInterface[i+1].(string))
+			}
+		}
+	}
+	c.Archiver = archiverFunc(func(record MessageRecord) {
+		records = append(records, record)
+	})
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(
+			`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body/></Envelope>`))}, nil
+	})}).Do
+	_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, logged)
+	for _, id := range logged {
+		assert.Equal(t, "log_trace-1", id)
+	}
+	require.Len(t, records, 2)
+	assert.Equal(t, "archive-1", records[0].ID)
+}
+
+// TestNoMathRand makes sure identifiers aren't minted with math/rand.
+func TestNoMathRand(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	require.NoError(t, err)
+	subFiles, err := filepath.Glob("*/*.go")
+	require.NoError(t, err)
+	mathRand := regexp.MustCompile(`^"math/rand(/v2)?"$`)
+	for _, file := range append(files, subFiles...) {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly)
+		require.NoError(t, err)
+		for _, imp := range f.Imports {
+			assert.False(t, mathRand.MatchString(imp.Path.Value), "%s imports %s", file, imp.Path.Value)
+		}
+	}
+}
+
+func TestClient_IDGenerator_routed(t *testing.T) {
+	var (
+		contentType string
+		body        []byte
+	)
+	c := NewClient("http://localhorst.ch", nil)
+	c.IDGenerator = sequenceIDs{}
+	c.WSAddressing = &WSAddressing{}
+	timestamp := &WSSETimestamp{Security: &Security{UsernameToken: &WSSEUsernameToken{Username: "u", Digest: true}}}
+	c.Headers = []interface{}{timestamp}
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(
+			`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body/></Envelope>`))}, nil
+	})}).Do
+
+	attachment := &Attachment{ContentID: "a", ContentType: "text/plain", Body: strings.NewReader("a")}
+	_, err := c.Call(context.Background(), "foo", &FooRequest{}, nil, WithAttachments(NewAttachmentReader(attachment)))
+	require.NoError(t, err)
+	assert.Contains(t, contentType, "boundary=boundary-1")
+	assert.Contains(t, string(body), "<MessageID xmlns=\""+NamespaceWSA+"\">message-1</MessageID>")
+	assert.Contains(t, string(body), `wsu:Id="TS-element-1"`)
+	assert.Contains(t, string(body), ">"+base64.StdEncoding.EncodeToString([]byte("nonce-1"))+"</")
+	assert.Nil(t, timestamp.IDGenerator, "the header isn't changed")
+	assert.Nil(t, timestamp.Security.UsernameToken.IDGenerator)
+}
@@ -0,0 +1,49 @@
+package soap
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ErrResponseStalled is returned, wrapped as transport error, if no data of a
+// response arrives within Client.ResponseIdleTimeout.
+var ErrResponseStalled = errors.New("response stalled")
+
+// idleBody closes the response body, if no data arrives within timeout, to
+// unblock the pending Read. Every successful read resets the watchdog.
+type idleBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   Timer
+	stalled int32 // set atomically by the watchdog
+}
+
+func newIdleBody(body io.ReadCloser, timeout time.Duration, clock Clock) *idleBody {
+	b := &idleBody{ReadCloser: body, timeout: timeout}
+	b.timer = clock.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&b.stalled, 1)
+		body.Close()
+	})
+	return b
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	if atomic.LoadInt32(&b.stalled) == 1 {
+		return 0, ErrResponseStalled
+	}
+	n, err := b.ReadCloser.Read(p)
+	if atomic.LoadInt32(&b.stalled) == 1 {
+		return n, ErrResponseStalled
+	}
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	b.timer.Stop()
+	return b.ReadCloser.Close()
+}
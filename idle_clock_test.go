@@ -0,0 +1,83 @@
+package soap_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orirawlings/soap"
+	"github.com/orirawlings/soap/soaptest"
+)
+
+// stallingBody yields data and then blocks until it is closed, signalling
+// each blocked Read on reading.
+type stallingBody struct {
+	io.Reader
+	reading chan struct{}
+	closed  chan struct{}
+}
+
+func (sb *stallingBody) Read(p []byte) (int, error) {
+	n, err := sb.Reader.Read(p)
+	if err != io.EOF {
+		return n, err
+	}
+	sb.reading <- struct{}{}
+	<-sb.closed
+	return 0, errors.New("read on closed body")
+}
+
+func (sb *stallingBody) Close() error {
+	select {
+	case <-sb.closed:
+	default:
+		close(sb.closed)
+	}
+	return nil
+}
+
+func TestClient_ResponseIdleTimeout_fakeClock(t *testing.T) {
+	clock := soaptest.NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	body := &stallingBody{
+		Reader:  strings.NewReader(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`),
+		reading: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+	c := soap.NewClient("http://localhorst.ch", nil)
+	c.Clock = clock
+	c.ResponseIdleTimeout = time.Minute
+	c.HTTPClientDoFn = func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {soap.SoapContentType11}},
+			Body:       body,
+		}, nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Call(context.Background(), "greet", &greetRequest{Name: "Ada"}, &greetResponse{})
+		done <- err
+	}()
+
+	<-body.reading
+	clock.Advance(time.Minute - time.Millisecond)
+	select {
+	case <-body.closed:
+		t.Fatal("body closed before ResponseIdleTimeout")
+	default:
+	}
+	clock.Advance(time.Millisecond)
+
+	err := <-done
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, soap.ErrResponseStalled), "%v", err)
+	assert.Equal(t, soap.ErrorKindTransport, soap.KindOf(err))
+}
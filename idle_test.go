@@ -0,0 +1,88 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowServer sends the chunks of a response, pausing pause between them, and
+// then, if stall is set, stalls until the test ends.
+func slowServer(t *testing.T, contentType string, pause time.Duration, stall bool, chunks ...string) *httptest.Server {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		for _, chunk := range chunks {
+			fmt.Fprint(w, chunk)
+			w.(http.Flusher).Flush()
+			time.Sleep(pause)
+		}
+		if stall {
+			<-done
+		}
+	}))
+	t.Cleanup(func() {
+		close(done)
+		srv.Close()
+	})
+	return srv
+}
+
+func TestClient_ResponseIdleTimeout(t *testing.T) {
+	envelope := []string{
+		`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`,
+		`<fooResponse><Bar>slow</Bar></fooResponse>`,
+		`</soap:Body></soap:Envelope>`,
+	}
+
+	t.Run("stalled", func(t *testing.T) {
+		srv := slowServer(t, SoapContentType11, 0, true, envelope[0])
+		c := NewClient(srv.URL, nil)
+		c.ResponseIdleTimeout = 50 * time.Millisecond
+		_, err := c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{})
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrResponseStalled), "%v", err)
+		assert.Equal(t, ErrorKindTransport, KindOf(err))
+	})
+
+	t.Run("multipart stalled", func(t *testing.T) {
+		srv := slowServer(t, `multipart/related; type="application/xop+xml"; boundary=b`, 0, true,
+			"--b\r\nContent-Type: application/xop+xml\r\n\r\n"+envelope[0])
+		c := NewClient(srv.URL, nil)
+		c.ResponseIdleTimeout = 50 * time.Millisecond
+		_, err := c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{})
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrResponseStalled), "%v", err)
+		assert.Equal(t, ErrorKindTransport, KindOf(err))
+	})
+
+	t.Run("slow but flowing", func(t *testing.T) {
+		// Each pause is below the idle timeout, all of them exceed it.
+		srv := slowServer(t, SoapContentType11, 40*time.Millisecond, false, envelope...)
+		c := NewClient(srv.URL, nil)
+		c.ResponseIdleTimeout = 100 * time.Millisecond
+		response := &FooResponse{}
+		_, err := c.Call(context.Background(), "foo", &FooRequest{}, response)
+		require.NoError(t, err)
+		assert.Equal(t, "slow", response.Bar)
+	})
+
+	t.Run("context deadline first", func(t *testing.T) {
+		srv := slowServer(t, SoapContentType11, 0, true, envelope[0])
+		c := NewClient(srv.URL, nil)
+		c.ResponseIdleTimeout = time.Minute
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := c.Call(ctx, "foo", &FooRequest{}, &FooResponse{})
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, ErrResponseStalled), "%v", err)
+		assert.Equal(t, ErrorKindTransport, KindOf(err))
+	})
+}
@@ -0,0 +1,93 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrTooManyInFlight is returned by Client calls, if Client.MaxInFlight
+// requests are in flight and Client.FailFastInFlight is set. It is a
+// transport error, see KindOf, retried like a 429 by a RetryPolicy.
+var ErrTooManyInFlight = errors.New("too many requests in flight")
+
+// inFlightLimiter caps the number of concurrent requests of a Client.
+type inFlightLimiter struct {
+	count int64 // requests in flight
+
+	mu       sync.Mutex
+	capacity int
+	slots    chan struct{}
+}
+
+// InFlight returns the number of requests the Client is waiting for,
+// including those queued for a slot, see MaxInFlight.
+func (c *Client) InFlight() int {
+	if c.inFlight == nil {
+		return 0
+	}
+	return int(atomic.LoadInt64(&c.inFlight.count))
+}
+
+// acquire waits for a slot for a request and returns the function releasing
+// it, which may be called more than once.
+func (c *Client) acquire(ctx context.Context, failFast bool) (func(), error) {
+	if c.inFlight == nil {
+		return func() {}, nil
+	}
+	l := c.inFlight
+	atomic.AddInt64(&l.count, 1)
+	var once sync.Once
+	done := func() { atomic.AddInt64(&l.count, -1) }
+	if c.MaxInFlight <= 0 {
+		return func() { once.Do(done) }, nil
+	}
+
+	slots := l.slotsFor(c.MaxInFlight)
+	select {
+	case slots <- struct{}{}:
+	default:
+		if failFast {
+			done()
+			return nil, transportError(ErrTooManyInFlight)
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			done()
+			return nil, transportError(ctx.Err())
+		}
+	}
+	return func() {
+		once.Do(func() {
+			<-slots
+			done()
+		})
+	}, nil
+}
+
+// slotsFor returns the semaphore for capacity, replacing the current one if
+// MaxInFlight has been changed.
+func (l *inFlightLimiter) slotsFor(capacity int) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.capacity != capacity {
+		l.capacity = capacity
+		l.slots = make(chan struct{}, capacity)
+	}
+	return l.slots
+}
+
+// releasingBody releases the slot of a request when the response body is
+// closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (rb *releasingBody) Close() error {
+	defer rb.release()
+	return rb.ReadCloser.Close()
+}
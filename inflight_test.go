@@ -0,0 +1,139 @@
+package soap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_MaxInFlight(t *testing.T) {
+	var (
+		current, peak int64
+		unblock       = make(chan struct{})
+	)
+	soapSrv := NewServer()
+	soapSrv.RegisterHandler("/pathTo", "testPostAction", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			n := atomic.AddInt64(&current, 1)
+			defer atomic.AddInt64(&current, -1)
+			for {
+				p := atomic.LoadInt64(&peak)
+				if n <= p || atomic.CompareAndSwapInt64(&peak, p, n) {
+					break
+				}
+			}
+			if request.(*FooRequest).Foo == "block" {
+				<-unblock
+			} else {
+				time.Sleep(5 * time.Millisecond)
+			}
+			return &FooResponse{Bar: "ok"}, nil
+		},
+	)
+	srv := httptest.NewServer(soapSrv)
+	defer srv.Close()
+
+	c := NewClient(srv.URL+"/pathTo", nil)
+	c.MaxInFlight = 3
+
+	t.Run("hammer", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 30)
+		for i := 0; i < 30; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := c.Call(context.Background(), "testPostAction", &FooRequest{}, &FooResponse{})
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			assert.NoError(t, err)
+		}
+		assert.LessOrEqual(t, atomic.LoadInt64(&peak), int64(3))
+		assert.Exactly(t, 0, c.InFlight())
+	})
+
+	block := func() *sync.WaitGroup {
+		var wg sync.WaitGroup
+		for i := 0; i < c.MaxInFlight; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.Call(context.Background(), "testPostAction", &FooRequest{Foo: "block"}, &FooResponse{})
+			}()
+		}
+		require.Eventually(t, func() bool {
+			return atomic.LoadInt64(&current) == int64(c.MaxInFlight)
+		}, 5*time.Second, time.Millisecond)
+		return &wg
+	}
+
+	t.Run("queued until canceled", func(t *testing.T) {
+		wg := block()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := c.Call(ctx, "testPostAction", &FooRequest{}, &FooResponse{})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Exactly(t, ErrorKindTransport, KindOf(err))
+		assert.Exactly(t, 3, c.InFlight())
+		unblock <- struct{}{}
+		unblock <- struct{}{}
+		unblock <- struct{}{}
+		wg.Wait()
+		assert.Exactly(t, 0, c.InFlight())
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		c.FailFastInFlight = true
+		defer func() { c.FailFastInFlight = false }()
+		wg := block()
+		_, err := c.Call(context.Background(), "testPostAction", &FooRequest{}, &FooResponse{})
+		assert.ErrorIs(t, err, ErrTooManyInFlight)
+		assert.Exactly(t, ErrorKindTransport, KindOf(err))
+		close(unblock)
+		wg.Wait()
+		assert.Exactly(t, 0, c.InFlight())
+	})
+
+	t.Run("released on panic", func(t *testing.T) {
+		pc := NewClient("http://localhorst.ch", nil)
+		pc.MaxInFlight = 1
+		pc.HTTPClientDoFn = func(req *http.Request) (*http.Response, error) {
+			panic("transport panicked")
+		}
+		for i := 0; i < 2; i++ {
+			assert.Panics(t, func() {
+				pc.Call(context.Background(), "testPostAction", &FooRequest{}, &FooResponse{})
+			})
+			assert.Exactly(t, 0, pc.InFlight())
+		}
+
+		pc.HTTPClientDoFn = http.DefaultClient.Do
+		pc.url = srv.URL + "/pathTo"
+		pc.Log = func(msg string, keyString_ValueInterface ...interface{}) {
+			if msg == "MIMETYPE" {
+				panic("log hook panicked")
+			}
+		}
+		assert.Panics(t, func() {
+			pc.Call(context.Background(), "testPostAction", &FooRequest{}, &FooResponse{})
+		})
+		assert.Exactly(t, 0, pc.InFlight())
+		pc.Log = nil
+		_, err := pc.Call(context.Background(), "testPostAction", &FooRequest{}, &FooResponse{})
+		assert.NoError(t, err)
+	})
+}
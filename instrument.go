@@ -0,0 +1,71 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// Instrumentation traces the calls of a Client, e.g. as OpenTelemetry spans
+// named after the action, without this package depending on a tracing
+// library, see Client.Instrumentation.
+type Instrumentation interface {
+	// Start is called when a call of action starts. The call and its HTTP
+	// requests use the returned context, e.g. carrying a span.
+	Start(ctx context.Context, action string) context.Context
+	// Inject is called with the context of every HTTP request of the call and
+	// its header, e.g. to propagate the span with a TextMapPropagator.
+	Inject(ctx context.Context, header http.Header)
+	// End is called with the context returned by Start when the call is done.
+	End(ctx context.Context, trace CallTrace)
+}
+
+// CallTrace describes a call to Instrumentation.End. Sizes and the status
+// are those of the last attempt.
+type CallTrace struct {
+	Action string
+	// Endpoint is the URL posted to, with password and RedactedQueryParams
+	// masked, "" if the call failed before.
+	Endpoint string
+	// RequestBytes is the size of the request envelope, 0 if it was
+	// streamed, see Client.StreamThreshold. ResponseBytes is the number of
+	// bytes of the response body read, after decompression.
+	RequestBytes  int64
+	ResponseBytes int64
+	// StatusCode is the HTTP status of the response, 0 if none was received.
+	StatusCode int
+	// FaultCode is the faultcode of a SOAP Fault response.
+	FaultCode string
+	Err       error
+}
+
+// instrument starts tracing a call of action with the Instrumentation, if
+// set. The returned function must be called with the error of the call.
+func (c *Client) instrument(ctx context.Context, action string, o *callOptions) (context.Context, func(err error)) {
+	if c.Instrumentation == nil {
+		return ctx, func(error) {}
+	}
+	o.trace = &CallTrace{Action: action}
+	ctx = c.Instrumentation.Start(ctx, action)
+	return ctx, func(err error) {
+		o.trace.Err = err
+		var fe *FaultError
+		if errors.As(err, &fe) {
+			o.trace.FaultCode = fe.Fault.Code
+		}
+		c.Instrumentation.End(ctx, *o.trace)
+	}
+}
+
+// countingBody counts the bytes read into n.
+type countingBody struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (cb *countingBody) Read(p []byte) (int, error) {
+	n, err := cb.ReadCloser.Read(p)
+	*cb.n += int64(n)
+	return n, err
+}
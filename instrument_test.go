@@ -0,0 +1,126 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type spanKey struct{}
+
+// recordingInstrumentation records spans in the way of an OpenTelemetry
+// tracer and propagator.
+type recordingInstrumentation struct {
+	started []string
+	ended   []CallTrace
+}
+
+func (ri *recordingInstrumentation) Start(ctx context.Context, action string) context.Context {
+	ri.started = append(ri.started, action)
+	return context.WithValue(ctx, spanKey{}, "span-"+action)
+}
+
+func (ri *recordingInstrumentation) Inject(ctx context.Context, header http.Header) {
+	header.Set("Traceparent", ctx.Value(spanKey{}).(string))
+}
+
+func (ri *recordingInstrumentation) End(ctx context.Context, trace CallTrace) {
+	ri.ended = append(ri.ended, trace)
+}
+
+func TestClient_Instrumentation(t *testing.T) {
+	const (
+		result = `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><FooResponse><Bar>bar</Bar></FooResponse></Body></Envelope>`
+		fault  = `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><Fault><faultcode>Server</faultcode><faultstring>boom</faultstring></Fault></Body></Envelope>`
+	)
+	var (
+		sent  []int64
+		reply = result
+	)
+	c := NewClient("https://localhorst.ch/ws", nil)
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		span, _ := r.Context().Value(spanKey{}).(string)
+		assert.Equal(t, span, r.Header.Get("Traceparent"), "the span of the context of the request is propagated")
+		if span != "" {
+			assert.Equal(t, "span-"+r.Header.Get("SOAPAction"), span)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		sent = append(sent, int64(len(body)))
+		status := http.StatusOK
+		if reply == fault {
+			status = http.StatusInternalServerError
+		}
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": {"text/xml"}},
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(reply))),
+		}, nil
+	})}).Do
+
+	_, err := c.Call(context.Background(), "untraced", &FooRequest{}, &FooResponse{})
+	require.NoError(t, err, "no Instrumentation is fine")
+
+	ri := &recordingInstrumentation{}
+	c.Instrumentation = ri
+	_, err = c.Call(context.Background(), "foo", &FooRequest{Foo: "foo"}, &FooResponse{})
+	require.NoError(t, err)
+	reply = fault
+	_, err = c.CallRaw(context.Background(), "raw", []byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body/></Envelope>`), nil)
+	var fe *FaultError
+	require.True(t, errors.As(err, &fe), "%v", err)
+	_, err = c.Call(context.Background(), "broken", &FooRequest{}, nil, WithURL("ftp://localhorst.ch"))
+	require.Error(t, err)
+
+	assert.Equal(t, []string{"foo", "raw", "broken"}, ri.started)
+	require.Len(t, ri.ended, 3)
+	assert.Equal(t, CallTrace{
+		Action:        "foo",
+		Endpoint:      "https://localhorst.ch/ws",
+		RequestBytes:  sent[1],
+		ResponseBytes: int64(len(result)),
+		StatusCode:    http.StatusOK,
+	}, ri.ended[0])
+	trace := ri.ended[1]
+	assert.True(t, errors.As(trace.Err, &fe), "%v", trace.Err)
+	trace.Err = nil
+	assert.Equal(t, CallTrace{
+		Action:        "raw",
+		Endpoint:      "https://localhorst.ch/ws",
+		RequestBytes:  sent[2],
+		ResponseBytes: int64(len(fault)),
+		StatusCode:    http.StatusInternalServerError,
+		FaultCode:     "Server",
+	}, trace)
+	assert.Equal(t, "broken", ri.ended[2].Action)
+	assert.Empty(t, ri.ended[2].Endpoint, "failed before sending")
+	assert.Zero(t, ri.ended[2].StatusCode)
+	assert.Error(t, ri.ended[2].Err)
+}
+
+func TestClient_Instrumentation_rejected(t *testing.T) {
+	c := NewClient("https://localhorst.ch/ws", nil)
+	c.HTTPClientDoFn = func(req *http.Request) (*http.Response, error) {
+		t.Fatal("no request expected")
+		return nil, nil
+	}
+	denied := errors.New("denied")
+	c.Admission = func(ctx context.Context, action string, inFlight int) error {
+		assert.Equal(t, "span-foo", ctx.Value(spanKey{}), "admission sees the span")
+		return denied
+	}
+	ri := &recordingInstrumentation{}
+	c.Instrumentation = ri
+
+	_, err := c.Call(context.Background(), "foo", &FooRequest{}, nil)
+	require.ErrorIs(t, err, denied)
+	assert.Equal(t, []string{"foo"}, ri.started)
+	require.Len(t, ri.ended, 1)
+	assert.ErrorIs(t, ri.ended[0].Err, denied)
+	assert.Empty(t, ri.ended[0].Endpoint, "not sent")
+}
@@ -0,0 +1,53 @@
+package soap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrIntegrityMismatch is matched by the *IntegrityError of a response which
+// doesn't echo the hash of the request, see Client.IntegrityHeader.
+var ErrIntegrityMismatch = errors.New("response doesn't echo the integrity hash of the request")
+
+// IntegrityError is returned for a response whose IntegrityHeader doesn't
+// carry the hash sent with the request, e.g. the response to another request
+// served from a cache. The response body isn't decoded.
+type IntegrityError struct {
+	Header   string
+	Sent     string
+	Received string
+}
+
+func (ie *IntegrityError) Error() string {
+	return fmt.Sprintf("%s: sent %s %s, received %q", ErrIntegrityMismatch, ie.Header, ie.Sent, ie.Received)
+}
+
+func (ie *IntegrityError) Unwrap() error {
+	return ErrIntegrityMismatch
+}
+
+// setIntegrityHeader sends the hex encoded SHA-256 of the envelope xmlBytes in
+// IntegrityHeader and records it in the CallStats of o.
+func (c *Client) setIntegrityHeader(req *http.Request, xmlBytes []byte, o *callOptions) {
+	if c.IntegrityHeader == "" {
+		return
+	}
+	sum := sha256.Sum256(xmlBytes)
+	o.stats.IntegrityHash = hex.EncodeToString(sum[:])
+	req.Header.Set(c.IntegrityHeader, o.stats.IntegrityHash)
+}
+
+// checkIntegrity verifies that the response echoes the hash of the request in
+// IntegrityHeader.
+func (c *Client) checkIntegrity(resp *http.Response, o *callOptions) error {
+	if c.IntegrityHeader == "" {
+		return nil
+	}
+	if received := resp.Header.Get(c.IntegrityHeader); received != o.stats.IntegrityHash {
+		return protocolError(&IntegrityError{Header: c.IntegrityHeader, Sent: o.stats.IntegrityHash, Received: received})
+	}
+	return nil
+}
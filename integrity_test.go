@@ -0,0 +1,68 @@
+package soap
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_IntegrityHeader(t *testing.T) {
+	const response = `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><FooResponse><Bar>mine</Bar></FooResponse></Body></Envelope>`
+	var (
+		echo     = true
+		attempts []string
+	)
+	c := NewClient("http://localhorst.ch", nil)
+	c.IntegrityHeader = "X-Request-Hash"
+	c.RetryPolicy = &RetryPolicy{MaxAttempts: 2}
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		body, _ := ioutil.ReadAll(r.Body)
+		sum := sha256.Sum256(body)
+		assert.Equal(t, hex.EncodeToString(sum[:]), r.Header.Get("X-Request-Hash"))
+		attempts = append(attempts, r.Header.Get("X-Request-Hash"))
+		if len(attempts) == 1 {
+			return nil, errors.New("connection reset")
+		}
+		header := http.Header{}
+		if echo {
+			header.Set("X-Request-Hash", r.Header.Get("X-Request-Hash"))
+		} else {
+			header.Set("X-Request-Hash", "someone else's")
+		}
+		return &http.Response{StatusCode: 200, Header: header, Body: ioutil.NopCloser(strings.NewReader(response))}, nil
+	})}).Do
+
+	stats := &CallStats{}
+	result := &FooResponse{}
+	_, err := c.Call(context.Background(), "foo", &FooRequest{Foo: "a"}, result, WithCallStats(stats))
+	require.NoError(t, err)
+	assert.Equal(t, "mine", result.Bar)
+	require.Len(t, attempts, 2, "each attempt sends the hash")
+	assert.Equal(t, attempts[1], stats.IntegrityHash)
+
+	echo = false
+	attempts = nil
+	result = &FooResponse{}
+	_, err = c.Call(context.Background(), "foo", &FooRequest{Foo: "b"}, result, WithCallStats(stats))
+	assert.True(t, errors.Is(err, ErrIntegrityMismatch), "%v", err)
+	var ie *IntegrityError
+	require.True(t, errors.As(err, &ie))
+	assert.Equal(t, stats.IntegrityHash, ie.Sent)
+	assert.Equal(t, "someone else's", ie.Received)
+	assert.Equal(t, ErrorKindProtocol, KindOf(err))
+	assert.Empty(t, result.Bar, "the body isn't decoded")
+
+	var bar string
+	attempts = nil
+	_, err = c.CallExtract(context.Background(), "foo", &FooRequest{}, map[string]interface{}{"Body/FooResponse/Bar": &bar})
+	assert.True(t, errors.Is(err, ErrIntegrityMismatch), "%v", err)
+	assert.Empty(t, bar)
+}
@@ -0,0 +1,23 @@
+// Package interop contains the interoperability test harness of the soap
+// package. The tests are gated behind the interop build tag:
+//
+//	go test -tags interop ./interop/...
+//
+// By default the Client is run against cassettes in testdata/<service>,
+// messages in the style the reference implementations (.NET WCF, Apache CXF
+// and PHP SoapServer) produce. Cassettes ending in .xml are envelopes, the
+// ones ending in .http raw HTTP messages, e.g. MTOM responses. The cassettes
+// cover plain calls, faults, MTOM and UsernameToken requests; requests the
+// Client signs with an X509Signer are checked like the reference services
+// verify them. PHP SoapServer doesn't speak MTOM.
+//
+// The reference services are defined in docker-compose.yml, their sources are
+// in reference/<service>:
+//
+//	docker compose -f interop/docker-compose.yml up -d --build
+//	SOAP_INTEROP_COMPOSE=1 go test -tags interop ./interop/...
+//
+// Set SOAP_INTEROP_<SERVICE>_URL (e.g. SOAP_INTEROP_WCF_URL) to run the
+// Client against another live reference service instead. The Server is always
+// run against the cassette requests of the reference clients.
+package interop
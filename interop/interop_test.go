@@ -0,0 +1,457 @@
+//go:build interop
+// +build interop
+
+package interop
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/orirawlings/soap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoRequest matches the echo operation request of every reference service,
+// whatever the parameter is called.
+type echoRequest struct {
+	XMLName xml.Name
+	Text    string `xml:",any"`
+}
+
+// echoResponse matches the echo operation response of every reference service.
+type echoResponse struct {
+	Result string `xml:",any"`
+}
+
+// referenceService describes a reference SOAP implementation and how it names
+// the echo operations.
+type referenceService struct {
+	name       string
+	soapAction string // as sent by the reference client, including quotes
+	request    xml.Name
+	response   xml.Name
+	fault      referenceFault
+	// binaryAction and binaryRequest are the echoBinary operation answered
+	// with MTOM, the binaryRequest is empty if the service doesn't speak MTOM.
+	binaryAction  string
+	binaryRequest xml.Name
+	// composeURL is the endpoint of the service of docker-compose.yml,
+	// mtomPath is appended for MTOM.
+	composeURL string
+	mtomPath   string
+}
+
+// referenceFault is the Fault a reference service raises for an empty text.
+type referenceFault struct {
+	code   string
+	string string
+	// detail is the element inside the detail, fields are the text of its
+	// children. A detail without element holds text.
+	detail xml.Name
+	fields map[string]string
+	text   string
+}
+
+var referenceServices = []referenceService{
+	{
+		name:       "wcf",
+		soapAction: `"http://tempuri.org/IEchoService/Echo"`,
+		request:    xml.Name{Space: "http://tempuri.org/", Local: "Echo"},
+		response:   xml.Name{Space: "http://tempuri.org/", Local: "EchoResponse"},
+		fault: referenceFault{
+			code:   "a:InternalServiceFault",
+			string: "text missing",
+			detail: xml.Name{Space: "http://schemas.datacontract.org/2004/07/System.ServiceModel", Local: "ExceptionDetail"},
+			fields: map[string]string{"Message": "text missing", "Type": "System.InvalidOperationException"},
+		},
+		binaryAction:  `"http://tempuri.org/IEchoService/EchoBinary"`,
+		binaryRequest: xml.Name{Space: "http://tempuri.org/", Local: "EchoBinary"},
+		composeURL:    "http://localhost:8081/EchoService.svc",
+		mtomPath:      "/mtom",
+	},
+	{
+		name:       "cxf",
+		soapAction: `""`,
+		request:    xml.Name{Space: "http://interop.example.org/", Local: "echo"},
+		response:   xml.Name{Space: "http://interop.example.org/", Local: "echoResponse"},
+		fault: referenceFault{
+			code:   "soap:Server",
+			string: "text missing",
+			detail: xml.Name{Space: "http://interop.example.org/", Local: "EchoFault"},
+			fields: map[string]string{"message": "text missing"},
+		},
+		binaryAction:  `""`,
+		binaryRequest: xml.Name{Space: "http://interop.example.org/", Local: "echoBinary"},
+		composeURL:    "http://localhost:8082/echo",
+	},
+	{
+		name:       "php",
+		soapAction: `"http://interop.example.org/#echo"`,
+		request:    xml.Name{Space: "http://interop.example.org/", Local: "echo"},
+		response:   xml.Name{Space: "http://interop.example.org/", Local: "echoResponse"},
+		fault: referenceFault{
+			code:   "SOAP-ENV:Server",
+			string: "text missing",
+			text:   "text missing",
+		},
+		composeURL: "http://localhost:8083/server.php",
+	},
+}
+
+func (rs referenceService) fixture(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", rs.name, name))
+	require.NoError(t, err)
+	return data
+}
+
+// liveURL returns the endpoint of the live reference service, "" if none is
+// configured.
+func (rs referenceService) liveURL() string {
+	if url := os.Getenv("SOAP_INTEROP_" + strings.ToUpper(rs.name) + "_URL"); url != "" {
+		return url
+	}
+	if os.Getenv("SOAP_INTEROP_COMPOSE") != "" {
+		return rs.composeURL
+	}
+	return ""
+}
+
+// client returns a Client talking to the live reference service at path, if
+// configured, or to the cassette returned by cassette. Cassettes ending in
+// .http are raw HTTP responses, others are envelopes. The requests sent to a
+// cassette are checked with assertEnvelope and check, if set.
+func (rs referenceService) client(t *testing.T, path, cassette string, check func(t *testing.T, envelope []byte)) *soap.Client {
+	if url := rs.liveURL(); url != "" {
+		return soap.NewClient(url+path, nil)
+	}
+
+	data := rs.fixture(t, cassette)
+	c := soap.NewClient("http://"+rs.name+".interop.invalid"+path, nil)
+	c.HTTPClientDoFn = func(r *http.Request) (*http.Response, error) {
+		envelope, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		assertEnvelope(t, envelope)
+		if check != nil {
+			check(t, envelope)
+		}
+
+		if strings.HasSuffix(cassette, ".http") {
+			resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), r)
+			require.NoError(t, err)
+			return resp, nil
+		}
+		hdr := http.Header{}
+		hdr.Set("Content-Type", soap.SoapContentType11)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     hdr,
+			Body:       ioutil.NopCloser(bytes.NewReader(data)),
+			Request:    r,
+		}, nil
+	}
+	return c
+}
+
+// httpRequest returns the cassette request of the reference client. Cassettes
+// ending in .http are raw HTTP requests, others are envelopes sent with the
+// SOAPAction of the echo operation.
+func (rs referenceService) httpRequest(t *testing.T, cassette string) *http.Request {
+	data := rs.fixture(t, cassette)
+	if strings.HasSuffix(cassette, ".http") {
+		r, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+		require.NoError(t, err)
+		return r
+	}
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	r.Header.Set("Content-Type", soap.SoapContentType11)
+	r.Header.Set("SOAPAction", rs.soapAction)
+	return r
+}
+
+// assertEnvelope checks what every reference implementation requires from
+// an inbound envelope.
+func assertEnvelope(t *testing.T, envelope []byte) {
+	probe := struct {
+		XMLName xml.Name
+		Body    struct {
+			XMLName xml.Name
+		} `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+	}{}
+	require.NoError(t, xml.Unmarshal(envelope, &probe))
+	assert.Exactly(t, xml.Name{Space: soap.NamespaceSoap11, Local: "Envelope"}, probe.XMLName)
+	assert.Exactly(t, xml.Name{Space: soap.NamespaceSoap11, Local: "Body"}, probe.Body.XMLName)
+}
+
+// assertFault checks the Fault of err against the one of the reference
+// service, the detail element by element.
+func assertFault(t *testing.T, err error, want referenceFault) {
+	var fe *soap.FaultError
+	require.True(t, errors.As(err, &fe), "%v", err)
+	assert.Exactly(t, want.code, fe.Fault.Code)
+	assert.Exactly(t, want.string, fe.Fault.String)
+
+	var detail struct {
+		XMLName xml.Name
+		Fields  []struct {
+			XMLName xml.Name
+			Value   string `xml:",chardata"`
+		} `xml:",any"`
+	}
+	if want.detail == (xml.Name{}) {
+		assert.Exactly(t, want.text, fe.Fault.Detail)
+		return
+	}
+	require.NoError(t, xml.Unmarshal(fe.Fault.DetailXML(), &detail))
+	assert.Exactly(t, want.detail, detail.XMLName)
+	fields := map[string]string{}
+	for _, f := range detail.Fields {
+		if _, ok := want.fields[f.XMLName.Local]; ok {
+			fields[f.XMLName.Local] = f.Value
+		}
+	}
+	assert.Exactly(t, want.fields, fields)
+}
+
+// testCertificate returns a self-signed certificate for X509Signer.
+func testCertificate(t *testing.T) tls.Certificate {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "soap interop"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// assertSigned checks what the reference services require from an envelope
+// signed by the X.509 Token Profile: a BinarySecurityToken with cert, a
+// Signature referencing the Body by its wsu:Id and the token by a
+// SecurityTokenReference, and a SignatureValue over the SignedInfo, which is
+// sent canonicalized.
+func assertSigned(cert tls.Certificate) func(t *testing.T, envelope []byte) {
+	return func(t *testing.T, envelope []byte) {
+		var doc struct {
+			Header struct {
+				Security struct {
+					XMLName xml.Name
+					Token   struct {
+						ID        string `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd Id,attr"`
+						ValueType string `xml:"ValueType,attr"`
+						Value     string `xml:",chardata"`
+					} `xml:"BinarySecurityToken"`
+					Signature struct {
+						Reference struct {
+							URI string `xml:"URI,attr"`
+						} `xml:"SignedInfo>Reference"`
+						Value    string `xml:"SignatureValue"`
+						TokenRef struct {
+							URI string `xml:"URI,attr"`
+						} `xml:"KeyInfo>SecurityTokenReference>Reference"`
+					}
+				} `xml:"Security"`
+			}
+			Body struct {
+				ID string `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd Id,attr"`
+			}
+		}
+		require.NoError(t, xml.Unmarshal(envelope, &doc))
+		security := doc.Header.Security
+		assert.Exactly(t, soap.QNameSecurity, security.XMLName)
+		assert.True(t, strings.HasSuffix(security.Token.ValueType, "#X509v3"), security.Token.ValueType)
+		der, err := base64.StdEncoding.DecodeString(security.Token.Value)
+		require.NoError(t, err)
+		assert.Exactly(t, cert.Certificate[0], der)
+		assert.Exactly(t, "#"+security.Token.ID, security.Signature.TokenRef.URI)
+		require.NotEmpty(t, doc.Body.ID)
+		assert.Exactly(t, "#"+doc.Body.ID, security.Signature.Reference.URI)
+
+		start := bytes.Index(envelope, []byte("<ds:SignedInfo"))
+		end := bytes.Index(envelope, []byte("</ds:SignedInfo>"))
+		require.True(t, start >= 0 && end > start, "SignedInfo missing")
+		hashed := sha256.Sum256(envelope[start : end+len("</ds:SignedInfo>")])
+		signature, err := base64.StdEncoding.DecodeString(security.Signature.Value)
+		require.NoError(t, err)
+		parsed, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		assert.NoError(t, rsa.VerifyPKCS1v15(parsed.PublicKey.(*rsa.PublicKey), crypto.SHA256, hashed[:], signature))
+	}
+}
+
+func TestClientAgainstReferenceServices(t *testing.T) {
+	for _, rs := range referenceServices {
+		rs := rs
+		t.Run(rs.name, func(t *testing.T) {
+			t.Run("envelope", func(t *testing.T) {
+				c := rs.client(t, "", "echo.response.xml", nil)
+				var resp echoResponse
+				httpResp, err := c.Call(context.Background(), strings.Trim(rs.soapAction, `"`), &echoRequest{
+					XMLName: rs.request,
+					Text:    "hello interop",
+				}, &resp)
+				require.NoError(t, err)
+				assert.Exactly(t, http.StatusOK, httpResp.StatusCode)
+				assert.Exactly(t, "hello interop", resp.Result)
+			})
+
+			t.Run("fault", func(t *testing.T) {
+				c := rs.client(t, "", "fault.response.xml", nil)
+				var resp echoResponse
+				_, err := c.Call(context.Background(), strings.Trim(rs.soapAction, `"`), &echoRequest{
+					XMLName: rs.request,
+				}, &resp)
+				require.Error(t, err)
+				assertFault(t, err, rs.fault)
+			})
+
+			t.Run("mtom", func(t *testing.T) {
+				if rs.binaryRequest == (xml.Name{}) {
+					t.Skip(rs.name, "doesn't speak MTOM")
+				}
+				c := rs.client(t, rs.mtomPath, "mtom.response.http", nil)
+				var (
+					resp  echoResponse
+					stats soap.CallStats
+				)
+				_, err := c.Call(context.Background(), strings.Trim(rs.binaryAction, `"`), &echoRequest{
+					XMLName: rs.binaryRequest,
+					Text:    base64.StdEncoding.EncodeToString([]byte("hello interop")),
+				}, &resp, soap.WithCallStats(&stats))
+				require.NoError(t, err)
+				require.NotNil(t, stats.Multipart)
+				assert.Len(t, stats.Multipart.Parts, 2)
+				assert.Exactly(t, 0, stats.Multipart.Envelope)
+				assert.Exactly(t, 1, stats.Multipart.XOPIncludes)
+				assert.Exactly(t, 0, stats.Multipart.DanglingXOPIncludes)
+			})
+
+			t.Run("x509", func(t *testing.T) {
+				cert := testCertificate(t)
+				c := rs.client(t, "", "echo.response.xml", assertSigned(cert))
+				c.Signer = &soap.X509Signer{Certificate: cert}
+				var resp echoResponse
+				_, err := c.Call(context.Background(), strings.Trim(rs.soapAction, `"`), &echoRequest{
+					XMLName: rs.request,
+					Text:    "hello interop",
+				}, &resp)
+				require.NoError(t, err)
+				assert.Exactly(t, "hello interop", resp.Result)
+			})
+		})
+	}
+}
+
+func TestServerAgainstReferenceClients(t *testing.T) {
+	verifier := &soap.UsernameTokenVerifier{
+		Password: func(username string) (string, bool) {
+			return "s3cr3t", username == "interop"
+		},
+	}
+	for _, rs := range referenceServices {
+		rs := rs
+		t.Run(rs.name, func(t *testing.T) {
+			srv := soap.NewServer()
+			srv.RegisterHandler("/", strings.Trim(rs.soapAction, `"`), rs.request.Local,
+				func() interface{} {
+					return &echoRequest{}
+				},
+				func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+					text := request.(*echoRequest).Text
+					if headers := soap.RequestHeaders(httpRequest.Context()); len(headers) > 0 {
+						username, err := verifier.Verify(headers)
+						if err != nil {
+							return nil, err
+						}
+						text = username
+					}
+					return &echoRequest{
+						XMLName: rs.response,
+						Text:    text,
+					}, nil
+				},
+			)
+			if rs.binaryRequest != (xml.Name{}) {
+				srv.RegisterHandler("/", strings.Trim(rs.binaryAction, `"`), rs.binaryRequest.Local,
+					func() interface{} {
+						return &echoRequest{}
+					},
+					func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+						attachments := soap.RequestAttachments(httpRequest.Context())
+						if attachments == nil {
+							return nil, errors.New("attachment missing")
+						}
+						attachment, err := attachments.Next()
+						if err != nil {
+							return nil, err
+						}
+						data, err := ioutil.ReadAll(attachment.Body)
+						if err != nil {
+							return nil, err
+						}
+						return &echoRequest{
+							XMLName: rs.response,
+							Text:    string(data),
+						}, nil
+					},
+				)
+			}
+
+			for _, tc := range []struct {
+				name     string
+				cassette string
+				want     string
+			}{
+				{"envelope", "echo.request.xml", "hello interop"},
+				{"usernameToken", "usernametoken.request.xml", "interop"},
+				{"mtom", "mtom.request.http", "hello interop"},
+			} {
+				tc := tc
+				t.Run(tc.name, func(t *testing.T) {
+					if tc.name == "mtom" && rs.binaryRequest == (xml.Name{}) {
+						t.Skip(rs.name, "doesn't speak MTOM")
+					}
+					w := httptest.NewRecorder()
+					srv.ServeHTTP(w, rs.httpRequest(t, tc.cassette))
+
+					require.Exactly(t, http.StatusOK, w.Code, w.Body.String())
+					assert.Contains(t, w.Header().Get("Content-Type"), "text/xml")
+					assertEnvelope(t, w.Body.Bytes())
+
+					envelope := &soap.Envelope{
+						Body: soap.Body{Content: &echoResponse{}},
+					}
+					require.NoError(t, xml.Unmarshal(w.Body.Bytes(), envelope))
+					assert.Nil(t, envelope.Body.Fault)
+					assert.Exactly(t, rs.response.Local, envelope.Body.SOAPBodyContentType)
+					response, ok := envelope.Body.Content.(*echoResponse)
+					require.True(t, ok, "%T", envelope.Body.Content)
+					assert.Exactly(t, tc.want, response.Result)
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package org.example.interop;
+
+import jakarta.jws.WebMethod;
+import jakarta.jws.WebService;
+import jakarta.xml.ws.Endpoint;
+import jakarta.xml.ws.WebFault;
+import jakarta.xml.ws.soap.MTOM;
+
+public class EchoServer {
+
+    public static class EchoFaultInfo {
+        public String message;
+    }
+
+    @WebFault(name = "EchoFault", targetNamespace = "http://interop.example.org/")
+    public static class EchoFault extends Exception {
+        private final EchoFaultInfo info;
+
+        public EchoFault(String message) {
+            super(message);
+            info = new EchoFaultInfo();
+            info.message = message;
+        }
+
+        public EchoFaultInfo getFaultInfo() {
+            return info;
+        }
+    }
+
+    @MTOM
+    @WebService(targetNamespace = "http://interop.example.org/", serviceName = "EchoService")
+    public static class EchoService {
+        @WebMethod
+        public String echo(String text) throws EchoFault {
+            if (text == null || text.isEmpty()) {
+                throw new EchoFault("text missing");
+            }
+            return text;
+        }
+
+        @WebMethod
+        public byte[] echoBinary(byte[] data) {
+            return data;
+        }
+    }
+
+    public static void main(String[] args) {
+        Endpoint.publish("http://0.0.0.0:8080/echo", new EchoService());
+    }
+}
@@ -0,0 +1,16 @@
+<?php
+// SoapServer in non-WSDL mode, operations are dispatched by the Body element.
+class EchoService
+{
+    public function echo($text)
+    {
+        if ($text === null || $text === '') {
+            throw new SoapFault('Server', 'text missing', null, 'text missing');
+        }
+        return $text;
+    }
+}
+
+$server = new SoapServer(null, ['uri' => 'http://interop.example.org/']);
+$server->setClass(EchoService::class);
+$server->handle();
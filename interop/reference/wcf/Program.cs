@@ -0,0 +1,51 @@
+using System;
+using CoreWCF;
+using CoreWCF.Configuration;
+using CoreWCF.Description;
+using Microsoft.AspNetCore.Builder;
+using Microsoft.Extensions.DependencyInjection;
+
+[ServiceContract]
+public interface IEchoService
+{
+    [OperationContract]
+    string Echo(string text);
+
+    [OperationContract]
+    byte[] EchoBinary(byte[] data);
+}
+
+public class EchoService : IEchoService
+{
+    public string Echo(string text)
+    {
+        if (string.IsNullOrEmpty(text))
+        {
+            throw new InvalidOperationException("text missing");
+        }
+        return text;
+    }
+
+    public byte[] EchoBinary(byte[] data) => data;
+}
+
+public static class Program
+{
+    public static void Main(string[] args)
+    {
+        var builder = WebApplication.CreateBuilder(args);
+        builder.Services.AddServiceModelServices();
+        var app = builder.Build();
+        app.UseServiceModel(services =>
+        {
+            services.AddService<EchoService>(options =>
+            {
+                options.DebugBehavior.IncludeExceptionDetailInFaults = true;
+            });
+            services.AddServiceEndpoint<EchoService, IEchoService>(new BasicHttpBinding(), "/EchoService.svc");
+            services.AddServiceEndpoint<EchoService, IEchoService>(
+                new BasicHttpBinding { MessageEncoding = WSMessageEncoding.Mtom }, "/EchoService.svc/mtom");
+        });
+        app.Run();
+    }
+}
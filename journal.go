@@ -0,0 +1,257 @@
+package soap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ReplayOfHeader is the HTTP header carrying the MessageRecord.ID of the
+// original request in requests replayed by ReplayJournal, so the partner can
+// suppress duplicates. The envelope, including a WS-Addressing MessageID, is
+// sent as archived.
+const ReplayOfHeader = "X-Replay-Of"
+
+// ErrNotReplayable is reported by ReplayJournal for requests of actions of
+// ReplayFilter.NonReplayable.
+var ErrNotReplayable = errors.New("action is not replayable")
+
+// JournalEntry is a request of a Journal.
+type JournalEntry struct {
+	// Seq is the sequence number of the request, starting at 1.
+	Seq int64 `json:"seq"`
+	MessageRecord
+}
+
+// Journal is an Archiver numbering the requests of a Client, see
+// ReplayJournal. Responses aren't journaled.
+type Journal interface {
+	Archiver
+	// Entries returns the requests with a sequence number of at least from,
+	// ordered by sequence number.
+	Entries(from int64) ([]JournalEntry, error)
+}
+
+// FileJournal is a Journal appending the requests as JSON lines to a file.
+// Sequence numbers continue where the file ends, when it's opened again.
+type FileJournal struct {
+	mu   sync.Mutex
+	file *os.File
+	seq  int64 // sequence number of the last entry
+	err  error // first write error
+}
+
+// OpenFileJournal opens the journal at path, creating it if needed.
+func OpenFileJournal(path string) (*FileJournal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	j := &FileJournal{file: file}
+	entries, size, err := j.read(0)
+	if err == nil {
+		// drop a last line cut short
+		err = file.Truncate(size)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if len(entries) > 0 {
+		j.seq = entries[len(entries)-1].Seq
+	}
+	return j, nil
+}
+
+// Archive implements Archiver, it numbers and appends requests. Errors are
+// returned by Err and Close.
+func (j *FileJournal) Archive(record MessageRecord) {
+	if record.Direction != MessageRequest {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	line, err := json.Marshal(JournalEntry{Seq: j.seq + 1, MessageRecord: record})
+	if err == nil {
+		_, err = j.file.Write(append(line, '\n'))
+	}
+	if err != nil {
+		if j.err == nil {
+			j.err = err
+		}
+		return
+	}
+	j.seq++
+}
+
+// Entries implements Journal.
+func (j *FileJournal) Entries(from int64) ([]JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entries, _, err := j.read(from)
+	return entries, err
+}
+
+// read returns the entries with a sequence number of at least from and the
+// size of the complete lines. A last line cut short, e.g. by a crash, is
+// ignored.
+func (j *FileJournal) read(from int64) ([]JournalEntry, int64, error) {
+	r := bufio.NewReader(io.NewSectionReader(j.file, 0, 1<<62))
+	var (
+		entries []JournalEntry
+		size    int64
+	)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return entries, size, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		size += int64(len(line))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, 0, err
+		}
+		if entry.Seq >= from {
+			entries = append(entries, entry)
+		}
+	}
+}
+
+// Err returns the first error appending to the journal.
+func (j *FileJournal) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+// Close syncs and closes the file, returning the first error of the journal.
+func (j *FileJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	err := j.file.Sync()
+	if closeErr := j.file.Close(); err == nil {
+		err = closeErr
+	}
+	if j.err != nil {
+		return j.err
+	}
+	return err
+}
+
+// ReplayFilter selects the requests ReplayJournal replays and paces them.
+type ReplayFilter struct {
+	// FromSeq and ToSeq bound the sequence numbers, inclusive, 0 means
+	// unbounded.
+	FromSeq, ToSeq int64
+	// From and To bound the time of the requests, To is exclusive. The zero
+	// time means unbounded.
+	From, To time.Time
+	// Actions are the actions replayed, all if empty.
+	Actions []string
+	// NonReplayable are actions which must never be sent twice, their
+	// requests are reported with ErrNotReplayable.
+	NonReplayable []string
+	// Concurrency is the number of requests replayed at the same time, 1 if
+	// below. With 1, requests are replayed and reported in order.
+	Concurrency int
+	// RateLimit is the maximum number of requests replayed per second, 0
+	// means no limit.
+	RateLimit float64
+}
+
+// selects tells whether entry is in the window of the filter.
+func (f ReplayFilter) selects(entry JournalEntry) bool {
+	if f.FromSeq > 0 && entry.Seq < f.FromSeq || f.ToSeq > 0 && entry.Seq > f.ToSeq {
+		return false
+	}
+	if !f.From.IsZero() && entry.Time.Before(f.From) || !f.To.IsZero() && !entry.Time.Before(f.To) {
+		return false
+	}
+	return len(f.Actions) == 0 || containsString(f.Actions, entry.Action)
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplayJournal sends the requests of journal selected by filter once more
+// with CallRaw of c, in the order of their sequence numbers, with the
+// ReplayOfHeader. They are posted to the URL of c, not to the
+// MessageRecord.Endpoint, which is masked. onResult is called with the
+// sequence number and the error of every selected request, one call at a
+// time. Requests replayed are journaled again if journal is the Archiver of
+// c, but not replayed by the same run. ReplayJournal stops dispatching when
+// ctx is done and returns its error.
+func ReplayJournal(ctx context.Context, c *Client, journal Journal, filter ReplayFilter, onResult func(seq int64, err error)) error {
+	entries, err := journal.Entries(filter.FromSeq)
+	if err != nil {
+		return err
+	}
+	concurrency := filter.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		slots    = make(chan struct{}, concurrency)
+		clock    = clockOrDefault(c.Clock)
+		replayed = 0
+	)
+	report := func(seq int64, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if onResult != nil {
+			onResult(seq, err)
+		}
+	}
+	defer wg.Wait()
+	for _, entry := range entries {
+		if !filter.selects(entry) {
+			continue
+		}
+		// reports wait for the slot as well to keep the order
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if containsString(filter.NonReplayable, entry.Action) {
+			report(entry.Seq, ErrNotReplayable)
+			<-slots
+			continue
+		}
+		if filter.RateLimit > 0 && replayed > 0 {
+			if err := clock.Sleep(ctx, time.Duration(float64(time.Second)/filter.RateLimit)); err != nil {
+				<-slots
+				return err
+			}
+		}
+		replayed++
+		wg.Add(1)
+		go func(entry JournalEntry) {
+			defer wg.Done()
+			_, err := c.CallRaw(ctx, entry.Action, entry.Body, nil, WithHTTPHeader(ReplayOfHeader, entry.ID))
+			report(entry.Seq, err)
+			<-slots
+		}(entry)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package soap_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orirawlings/soap"
+	"github.com/orirawlings/soap/soaptest"
+)
+
+func TestReplayJournal(t *testing.T) {
+	type received struct {
+		action, name, replayOf string
+	}
+	var got []received
+	srv := soap.NewServer()
+	for _, action := range []string{"urn:example:greeter#Greet", "urn:example:greeter#Pay"} {
+		action := action
+		srv.RegisterHandler("/greeter", action, "greetRequest",
+			func() interface{} {
+				return &greetRequest{}
+			},
+			func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+				got = append(got, received{action, request.(*greetRequest).Name, httpRequest.Header.Get(soap.ReplayOfHeader)})
+				return &greetResponse{Greeting: "Hello"}, nil
+			},
+		)
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	journal, err := soap.OpenFileJournal(path)
+	require.NoError(t, err)
+	start := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	clock := soaptest.NewFakeClock(start)
+	c := soap.NewClient(ts.URL+"/greeter", nil)
+	c.Clock = clock
+	c.IDGenerator = &soaptest.SequenceIDs{}
+	c.Archiver = journal
+	for _, call := range []struct{ action, name string }{
+		{"urn:example:greeter#Greet", "before the outage"},
+		{"urn:example:greeter#Greet", "a"},
+		{"urn:example:greeter#Pay", "b"},
+		{"urn:example:greeter#Greet", "c"},
+		{"urn:example:greeter#Greet", "d"},
+	} {
+		_, err := c.Call(context.Background(), call.action, &greetRequest{Name: call.name}, &greetResponse{})
+		require.NoError(t, err)
+		clock.Advance(time.Minute)
+	}
+	require.NoError(t, journal.Close())
+
+	// a crash in the middle of a line
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"seq":6,"Ti`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	journal, err = soap.OpenFileJournal(path)
+	require.NoError(t, err)
+	defer journal.Close()
+	entries, err := journal.Entries(0)
+	require.NoError(t, err)
+	require.Len(t, entries, 5)
+	for i, entry := range entries {
+		assert.Equal(t, int64(i+1), entry.Seq)
+		assert.Equal(t, soap.MessageRequest, entry.Direction)
+	}
+	c.Archiver = journal
+
+	got = nil
+	var results []int64
+	err = soap.ReplayJournal(context.Background(), c, journal, soap.ReplayFilter{
+		From:          start.Add(time.Minute),
+		ToSeq:         5,
+		NonReplayable: []string{"urn:example:greeter#Pay"},
+		RateLimit:     2,
+	}, func(seq int64, err error) {
+		results = append(results, seq)
+		if seq == 3 {
+			assert.ErrorIs(t, err, soap.ErrNotReplayable)
+		} else {
+			assert.NoError(t, err)
+		}
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 3, 4, 5}, results)
+	assert.Equal(t, []received{
+		{"urn:example:greeter#Greet", "a", entries[1].ID},
+		{"urn:example:greeter#Greet", "c", entries[3].ID},
+		{"urn:example:greeter#Greet", "d", entries[4].ID},
+	}, got)
+	assert.Equal(t, []time.Duration{500 * time.Millisecond, 500 * time.Millisecond}, clock.Sleeps())
+
+	entries, err = journal.Entries(6)
+	require.NoError(t, err)
+	require.Len(t, entries, 3, "replays are journaled, numbered on")
+	assert.Equal(t, int64(6), entries[0].Seq)
+}
+
+func TestReplayJournal_concurrency(t *testing.T) {
+	ts := httptest.NewServer(newGreeter())
+	defer ts.Close()
+	journal, err := soap.OpenFileJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	require.NoError(t, err)
+	defer journal.Close()
+	c := soap.NewClient(ts.URL+"/greeter", nil)
+	c.Headers = []interface{}{&apiKey{Key: "s3cr3t"}}
+	c.Archiver = journal
+	for i := 0; i < 20; i++ {
+		_, err := c.Call(context.Background(), "urn:example:greeter#Greet", &greetRequest{Name: "x"}, &greetResponse{})
+		require.NoError(t, err)
+	}
+
+	seen := map[int64]bool{}
+	err = soap.ReplayJournal(context.Background(), c, journal, soap.ReplayFilter{Actions: []string{"urn:example:greeter#Greet"}, Concurrency: 4}, func(seq int64, err error) {
+		assert.NoError(t, err)
+		seen[seq] = true
+	})
+	require.NoError(t, err)
+	assert.Len(t, seen, 20)
+}
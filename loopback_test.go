@@ -0,0 +1,79 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLoopback(t *testing.T) {
+	soapSrv := NewServer()
+	soapSrv.EchoHeaders = []string{"X-Correlation-ID"}
+	soapSrv.RegisterHandler(
+		"/pathTo",
+		"testPostAction",
+		"fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			fooRequest := request.(*FooRequest)
+			if fooRequest.Foo == "fail" {
+				return nil, errors.New("failed on purpose")
+			}
+			user, _, _ := httpRequest.BasicAuth()
+			return &FooResponse{Bar: "Hello " + user + " " + fooRequest.Foo}, nil
+		},
+	)
+
+	c := NewClient("http://in-process/pathTo", &BasicAuth{Login: "jane", Password: "secret"})
+	c.HTTPClientDoFn = NewLoopback(soapSrv)
+	c.RequestHeaderFn = func(h http.Header) {
+		h.Set("X-Correlation-ID", "abc")
+	}
+
+	t.Run("response", func(t *testing.T) {
+		response := &FooResponse{}
+		httpResponse, err := c.Call(context.Background(), "testPostAction", &FooRequest{Foo: "foo"}, response)
+		require.NoError(t, err)
+		assert.Exactly(t, "Hello jane foo", response.Bar)
+		assert.Exactly(t, http.StatusOK, httpResponse.StatusCode)
+		assert.Exactly(t, "abc", httpResponse.Header.Get("X-Correlation-ID"))
+		assert.Exactly(t, SoapContentType11, httpResponse.Header.Get("Content-Type"))
+	})
+
+	t.Run("fault", func(t *testing.T) {
+		_, err := c.Call(context.Background(), "testPostAction", &FooRequest{Foo: "fail"}, &FooResponse{})
+		var fe *FaultError
+		require.True(t, errors.As(err, &fe), "%v", err)
+		assert.Exactly(t, "failed on purpose", fe.Fault.String)
+	})
+
+	t.Run("status code", func(t *testing.T) {
+		lc := NewClient("http://in-process/pathTo", nil)
+		lc.HTTPClientDoFn = NewLoopback(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("<html>Bad Gateway</html>"))
+		}))
+		httpResponse, err := lc.Call(context.Background(), "testPostAction", &FooRequest{}, &FooResponse{})
+		var se *StatusError
+		require.True(t, errors.As(err, &se), "%v", err)
+		assert.Exactly(t, http.StatusBadGateway, se.StatusCode)
+		assert.Exactly(t, "<html>Bad Gateway</html>", string(se.Body))
+		require.NotNil(t, httpResponse)
+		assert.Exactly(t, ErrorKindTransport, KindOf(err))
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := c.Call(ctx, "testPostAction", &FooRequest{Foo: "foo"}, &FooResponse{})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Exactly(t, ErrorKindTransport, KindOf(err))
+	})
+}
@@ -0,0 +1,31 @@
+package soap
+
+import (
+	"context"
+	"net/http"
+)
+
+// CallFunc makes a SOAP call like Call, see Client.Use.
+type CallFunc func(ctx context.Context, action string, request, response interface{}) (*http.Response, error)
+
+// Use adds middleware wrapping Call, CallExtract, CallRaw and the calls built
+// on them, e.g. to audit actions, change requests or inspect responses.
+// Middleware sees request before it is marshalled and response after it is
+// decoded and may call next with a different action, request or response, or
+// not at all. CallRaw passes its envelope as request, CallExtract its extracts
+// as response. Middleware runs in the order it was added, the first
+// outermost. The innermost next makes the call with the CallOptions passed to
+// the call, e.g. by HTTPClientDoFn. Use must not be called concurrently with
+// calls.
+func (c *Client) Use(middleware func(next CallFunc) CallFunc) {
+	c.middleware = append(c.middleware, middleware)
+}
+
+// chain returns the middleware of Use wrapping call.
+func (c *Client) chain(call CallFunc) CallFunc {
+	next := call
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		next = c.middleware[i](next)
+	}
+	return next
+}
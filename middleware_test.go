@@ -0,0 +1,108 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Use(t *testing.T) {
+	var sent []byte
+	c := NewClient("http://localhorst.ch", nil)
+	c.HTTPClientDoFn = func(req *http.Request) (*http.Response, error) {
+		sent, _ = ioutil.ReadAll(req.Body)
+		assert.Equal(t, "audited", req.Header.Get("SOAPAction"))
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": {"text/xml"}},
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><FooResponse><Bar>bar</Bar></FooResponse></Body></Envelope>`))),
+		}, nil
+	}
+
+	var events []string
+	c.Use(func(next CallFunc) CallFunc {
+		return func(ctx context.Context, action string, request, response interface{}) (*http.Response, error) {
+			events = append(events, "audit "+action)
+			httpResponse, err := next(ctx, "audited", request, response)
+			events = append(events, "audited "+response.(*FooResponse).Bar)
+			return httpResponse, err
+		}
+	})
+	c.Use(func(next CallFunc) CallFunc {
+		return func(ctx context.Context, action string, request, response interface{}) (*http.Response, error) {
+			events = append(events, "mutate "+action)
+			request.(*FooRequest).Foo = "mutated"
+			return next(ctx, action, request, response)
+		}
+	})
+
+	stats := &CallStats{}
+	response := &FooResponse{}
+	_, err := c.Call(context.Background(), "foo", &FooRequest{Foo: "foo"}, response, WithCallStats(stats))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"audit foo", "mutate audited", "audited bar"}, events)
+	assert.Contains(t, string(sent), "<Foo>mutated</Foo>")
+	assert.Equal(t, "bar", response.Bar)
+	assert.Equal(t, FeatureOff, stats.Features.CompressRequest, "the options reach the call")
+}
+
+func TestClient_Use_shortCircuit(t *testing.T) {
+	c := NewClient("http://localhorst.ch", nil)
+	c.HTTPClientDoFn = func(req *http.Request) (*http.Response, error) {
+		t.Fatal("no request expected")
+		return nil, nil
+	}
+	denied := errors.New("denied")
+	c.Use(func(next CallFunc) CallFunc {
+		return func(ctx context.Context, action string, request, response interface{}) (*http.Response, error) {
+			return nil, denied
+		}
+	})
+
+	_, err := c.Call(context.Background(), "foo", &FooRequest{}, nil)
+	assert.Equal(t, denied, err)
+	_, _, err = c.CallRawBody(context.Background(), "foo", []byte("<foo/>"))
+	assert.Equal(t, denied, err, "calls built on Call are wrapped")
+}
+
+func TestClient_Use_rawAndExtract(t *testing.T) {
+	c := NewClient("http://localhorst.ch", nil)
+	c.HTTPClientDoFn = func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": {"text/xml"}},
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><FooResponse><Bar>bar</Bar></FooResponse></Body></Envelope>`))),
+		}, nil
+	}
+	var audited []string
+	c.Use(func(next CallFunc) CallFunc {
+		return func(ctx context.Context, action string, request, response interface{}) (*http.Response, error) {
+			audited = append(audited, action)
+			return next(ctx, action, request, response)
+		}
+	})
+
+	_, err := c.CallRaw(context.Background(), "raw", []byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body/></Envelope>`), nil)
+	require.NoError(t, err)
+	var bar string
+	_, err = c.CallExtract(context.Background(), "extract", &FooRequest{}, map[string]interface{}{"Body/FooResponse/Bar": &bar})
+	require.NoError(t, err)
+	assert.Equal(t, "bar", bar)
+	assert.Equal(t, []string{"raw", "extract"}, audited)
+
+	c.Use(func(next CallFunc) CallFunc {
+		return func(ctx context.Context, action string, request, response interface{}) (*http.Response, error) {
+			return next(ctx, action, &FooRequest{}, &FooResponse{})
+		}
+	})
+	_, err = c.CallRaw(context.Background(), "raw", []byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body/></Envelope>`), nil)
+	assert.Equal(t, ErrorKindProtocol, KindOf(err), "%v", err)
+	_, err = c.CallExtract(context.Background(), "extract", &FooRequest{}, map[string]interface{}{})
+	assert.Equal(t, ErrorKindProtocol, KindOf(err), "%v", err)
+}
@@ -0,0 +1,211 @@
+package soap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// sniffLen is the number of bytes of a response looked at to tell multipart
+// from plain messages, regardless of the declared Content-Type.
+const sniffLen = 512
+
+// boundaryLineRe matches the start of a multipart message, a boundary line
+// followed by a part header.
+var boundaryLineRe = regexp.MustCompile(`^--([^\s]{1,70})\r?\n[A-Za-z0-9-]+:`)
+
+// MultipartStats describes a multipart message, e.g. a response, see
+// CallStats.
+type MultipartStats struct {
+	Parts []PartStats
+	// Envelope is the index of the part selected as the SOAP envelope, -1 if
+	// none has been found.
+	Envelope int
+	// XOPIncludes counts the xop:Include elements of the envelope referring to
+	// a part of the message, DanglingXOPIncludes the ones referring to
+	// missing parts.
+	XOPIncludes         int
+	DanglingXOPIncludes int
+}
+
+// PartStats describes a part of a multipart message.
+type PartStats struct {
+	ContentType string
+	ContentID   string // without angle brackets
+	Size        int64
+}
+
+// soapPart returns the first part of the multipart message in r, which looks
+// like a SOAP envelope. The remaining parts are read for the stats.
+func soapPart(r io.Reader, boundary string) ([]byte, *MultipartStats, error) {
+	stats := &MultipartStats{Envelope: -1}
+	mr := multipart.NewReader(r, boundary)
+	var envelope []byte
+	// If this is a multipart message, search for the soapy part
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, stats, readError(err)
+		}
+		part := PartStats{
+			ContentType: p.Header.Get("Content-Type"),
+			ContentID:   strings.Trim(p.Header.Get("Content-ID"), "<>"),
+		}
+		if envelope != nil {
+			part.Size, err = io.Copy(ioutil.Discard, p)
+			stats.Parts = append(stats.Parts, part)
+			if err != nil {
+				return nil, stats, readError(err)
+			}
+			continue
+		}
+		// Parts may be compressed independently.
+		content, err := decompress(p, p.Header.Get("Content-Encoding"))
+		if err != nil {
+			return nil, stats, protocolError(err)
+		}
+		slurp, err := ioutil.ReadAll(content)
+		part.Size = int64(len(slurp))
+		stats.Parts = append(stats.Parts, part)
+		if err != nil {
+			return nil, stats, readError(err)
+		}
+		if isEnvelopePart(slurp) {
+			envelope = slurp
+			stats.Envelope = len(stats.Parts) - 1
+		}
+	}
+	if envelope == nil {
+		return nil, stats, protocolError(errors.New("multipart message does contain a soapy part"))
+	}
+	stats.countXOPIncludes(envelope)
+	return envelope, stats, nil
+}
+
+// isEnvelopePart tells whether the part content starts with a SOAP envelope,
+// after a byte order mark, whitespace and an XML declaration.
+func isEnvelopePart(content []byte) bool {
+	content = trimPreamble(content)
+	if bytes.HasPrefix(content, []byte("<?xml")) {
+		if end := bytes.Index(content, []byte("?>")); end >= 0 {
+			content = bytes.TrimLeft(content[end+2:], " \t\r\n")
+		}
+	}
+	if bytes.HasPrefix(content, soapPrefixTagLC) || bytes.HasPrefix(content, soapPrefixTagUC) {
+		return true
+	}
+	// other prefixes, e.g. env:Envelope of SOAP 1.2
+	if !bytes.HasPrefix(content, []byte("<")) {
+		return false
+	}
+	d := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return false
+		}
+		if se, ok := token.(xml.StartElement); ok {
+			return se.Name.Local == "Envelope" && (se.Name.Space == NamespaceSoap11 || se.Name.Space == NamespaceSoap12)
+		}
+	}
+}
+
+// countXOPIncludes counts the xop:Include references of envelope to the parts
+// of the message.
+func (ms *MultipartStats) countXOPIncludes(envelope []byte) {
+	ids := make(map[string]bool, len(ms.Parts))
+	for _, part := range ms.Parts {
+		ids[part.ContentID] = true
+	}
+	d := xml.NewDecoder(bytes.NewReader(envelope))
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return
+		}
+		se, ok := token.(xml.StartElement)
+		if !ok || se.Name != QNameInclude {
+			continue
+		}
+		var href string
+		for _, attr := range se.Attr {
+			if attr.Name.Local == "href" {
+				href = attr.Value
+			}
+		}
+		id, err := url.PathUnescape(strings.TrimPrefix(href, "cid:"))
+		if err == nil && strings.HasPrefix(href, "cid:") && ids[id] {
+			ms.XOPIncludes++
+		} else {
+			ms.DanglingXOPIncludes++
+		}
+	}
+}
+
+// logMultipart logs the parts of a multipart response.
+func (c *Client) logMultipart(stats *MultipartStats, logTraceID string) {
+	if c.Log == nil || stats == nil {
+		return
+	}
+	for i, part := range stats.Parts {
+		c.Log("Multipart part", "log_trace_id", logTraceID, "index", i, "content_type", part.ContentType,
+			"content_id", part.ContentID, "size", part.Size, "envelope", i == stats.Envelope)
+	}
+	c.Log("Multipart", "log_trace_id", logTraceID, "parts", len(stats.Parts), "envelope_part", stats.Envelope,
+		"xop_includes", stats.XOPIncludes, "dangling_xop_includes", stats.DanglingXOPIncludes)
+}
+
+// logMultipart logs the parts of the multipart request with the root part
+// envelope, which the handler has read. References to parts it hasn't read
+// count as dangling.
+func (s *Server) logMultipart(stats *MultipartStats, envelope []byte) {
+	if s.Log == nil || stats == nil {
+		return
+	}
+	stats.countXOPIncludes(envelope)
+	for i, part := range stats.Parts {
+		s.log("Multipart part index:", i, ", content_type:", part.ContentType, ", content_id:", part.ContentID,
+			", size:", part.Size, ", envelope:", i == stats.Envelope)
+	}
+	s.log("Multipart parts:", len(stats.Parts), ", envelope_part:", stats.Envelope,
+		", xop_includes:", stats.XOPIncludes, ", dangling_xop_includes:", stats.DanglingXOPIncludes)
+}
+
+// sniffMultipart tells whether the response body is a multipart message and
+// with which boundary. Some gateways mislabel responses, so the declared
+// multipart boundary must occur in the body and a body declared as something
+// else is treated as multipart if it starts with a boundary line. The returned
+// reader replaces body.
+func (c *Client) sniffMultipart(body io.Reader, mediaType, boundary, logTraceID string) (io.Reader, string, bool) {
+	br := bufio.NewReaderSize(body, sniffLen)
+	peek, _ := br.Peek(sniffLen)
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if boundary != "" && bytes.Contains(peek, []byte("--"+boundary)) {
+			return br, boundary, true
+		}
+		if c.Log != nil {
+			c.Log("WARNING: multipart response without its boundary, reading it as plain message", "log_trace_id", logTraceID,
+				"media_type", mediaType, "boundary", boundary)
+		}
+		return br, "", false
+	}
+	m := boundaryLineRe.FindSubmatch(peek)
+	if m == nil {
+		return br, "", false
+	}
+	if c.Log != nil {
+		c.Log("WARNING: response starts with a multipart boundary, reading it as multipart message", "log_trace_id", logTraceID,
+			"media_type", mediaType, "boundary", string(m[1]))
+	}
+	return br, string(m[1]), true
+}
@@ -0,0 +1,222 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Call_multipartStats(t *testing.T) {
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+	addPart := func(contentType, contentID, body string) {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {contentType},
+			"Content-Id":   {contentID},
+		})
+		require.NoError(t, err)
+		pw.Write([]byte(body))
+	}
+	addPart("text/plain", "<preamble>", "not SOAP")
+	envelope := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><fooResponse>
+<Bar>ok</Bar>
+<a><xop:Include xmlns:xop="http://www.w3.org/2004/08/xop/include" href="cid:att%401"/></a>
+<b><xop:Include xmlns:xop="http://www.w3.org/2004/08/xop/include" href="cid:missing"/></b>
+</fooResponse></soap:Body></soap:Envelope>`
+	addPart(`application/xop+xml; type="text/xml"`, "<root>", envelope)
+	addPart("application/octet-stream", "<att@1>", "0123456789")
+	require.NoError(t, mw.Close())
+	message := buf.Bytes()
+
+	var logged []string
+	c := NewClient("http://localhorst.ch", nil)
+	c.Log = func(msg string, keyString_ValueInterface ...interface{}) {
+		logged = append(logged, fmt.Sprint(append([]interface{}{msg}, keyString_ValueInterface...)...))
+	}
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			Header:     http.Header{"Content-Type": {`multipart/related; type="application/xop+xml"; boundary=` + mw.Boundary()}},
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(message)),
+		}, nil
+	})}).Do
+
+	want := &MultipartStats{
+		Parts: []PartStats{
+			{ContentType: "text/plain", ContentID: "preamble", Size: 8},
+			{ContentType: `application/xop+xml; type="text/xml"`, ContentID: "root", Size: int64(len(envelope))},
+			{ContentType: "application/octet-stream", ContentID: "att@1", Size: 10},
+		},
+		Envelope:            1,
+		XOPIncludes:         1,
+		DanglingXOPIncludes: 1,
+	}
+
+	t.Run("Call", func(t *testing.T) {
+		var stats CallStats
+		response := &FooResponse{}
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, response, WithCallStats(&stats))
+		require.NoError(t, err)
+		assert.Exactly(t, "ok", response.Bar)
+		assert.Equal(t, want, stats.Multipart)
+		assert.Contains(t, strings.Join(logged, "\n"), "Multipart part")
+		assert.Contains(t, strings.Join(logged, "\n"), "dangling_xop_includes")
+	})
+
+	t.Run("CallExtract", func(t *testing.T) {
+		var (
+			stats CallStats
+			bar   string
+		)
+		_, err := c.CallExtract(context.Background(), "MySOAPAction", &FooRequest{}, map[string]interface{}{
+			"Body/fooResponse/Bar": &bar,
+		}, WithCallStats(&stats))
+		require.NoError(t, err)
+		assert.Exactly(t, "ok", bar)
+		assert.Equal(t, want, stats.Multipart)
+	})
+
+	t.Run("single part", func(t *testing.T) {
+		var stats CallStats
+		c := NewClient("http://localhorst.ch", nil)
+		c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><fooResponse/></Body></Envelope>`)),
+			}, nil
+		})}).Do
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{}, WithCallStats(&stats))
+		require.NoError(t, err)
+		assert.Nil(t, stats.Multipart)
+	})
+}
+
+// The responses in testdata/gateways are shaped like the ones of gateways
+// mislabeling their Content-Type.
+func TestClient_Call_mislabeledMultipart(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		contentType string
+		want        string
+		wantParts   int
+	}{
+		{
+			name:        "multipart labeled XML",
+			file:        "multipart_labeled_xml.response",
+			contentType: "text/xml; charset=UTF-8",
+			want:        "from multipart",
+			wantParts:   1,
+		},
+		{
+			name:        "XML labeled multipart without boundary",
+			file:        "xml_labeled_multipart.response.xml",
+			contentType: `multipart/related; type="text/xml"`,
+			want:        "from plain",
+		},
+		{
+			name:        "XML labeled multipart with foreign boundary",
+			file:        "xml_labeled_multipart.response.xml",
+			contentType: `multipart/related; type="text/xml"; boundary=MIMEBoundary_1`,
+			want:        "from plain",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message, err := ioutil.ReadFile(filepath.Join("testdata", "gateways", test.file))
+			require.NoError(t, err)
+
+			var logged []string
+			c := NewClient("http://localhorst.ch", nil)
+			c.Log = func(msg string, keyString_ValueInterface ...interface{}) {
+				logged = append(logged, msg)
+			}
+			c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					Header:     http.Header{"Content-Type": {test.contentType}},
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewReader(message)),
+				}, nil
+			})}).Do
+
+			var stats CallStats
+			response := &FooResponse{}
+			_, err = c.Call(context.Background(), "MySOAPAction", &FooRequest{}, response, WithCallStats(&stats))
+			require.NoError(t, err)
+			assert.Equal(t, test.want, response.Bar)
+			if test.wantParts > 0 {
+				require.NotNil(t, stats.Multipart)
+				assert.Len(t, stats.Multipart.Parts, test.wantParts)
+			} else {
+				assert.Nil(t, stats.Multipart)
+			}
+			assert.Contains(t, strings.Join(logged, "\n"), "WARNING")
+
+			var bar string
+			_, err = c.CallExtract(context.Background(), "MySOAPAction", &FooRequest{}, map[string]interface{}{
+				"Body/fooResponse/Bar": &bar,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, test.want, bar)
+		})
+	}
+}
+
+func TestServer_multipartStats(t *testing.T) {
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+	addPart := func(contentType, contentID, body string) {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {contentType},
+			"Content-Id":   {contentID},
+		})
+		require.NoError(t, err)
+		pw.Write([]byte(body))
+	}
+	envelope := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><fooRequest>
+<Foo><xop:Include xmlns:xop="http://www.w3.org/2004/08/xop/include" href="cid:att%401"/></Foo>
+</fooRequest></soap:Body></soap:Envelope>`
+	addPart("text/xml", "<root>", envelope)
+	addPart("application/octet-stream", "<att@1>", "0123456789")
+	require.NoError(t, mw.Close())
+
+	var logged []string
+	soapSrv := NewServer()
+	soapSrv.Log = func(args ...interface{}) {
+		logged = append(logged, fmt.Sprint(args...))
+	}
+	soapSrv.RegisterHandler("/pathTo", "foo", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			a, err := RequestAttachments(httpRequest.Context()).Next()
+			require.NoError(t, err)
+			_, err = ioutil.ReadAll(a.Body)
+			require.NoError(t, err)
+			return &FooResponse{}, nil
+		},
+	)
+	r := httptest.NewRequest(http.MethodPost, "/pathTo", buf)
+	r.Header.Set("Content-Type", "multipart/related; boundary="+mw.Boundary())
+	r.Header.Set("SOAPAction", "foo")
+	w := httptest.NewRecorder()
+	soapSrv.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	out := strings.Join(logged, "\n")
+	assert.Contains(t, out, fmt.Sprint("Multipart part index:", 0, ", content_type:", "text/xml", ", content_id:", "root", ", size:", len(envelope), ", envelope:", true))
+	assert.Contains(t, out, fmt.Sprint("Multipart part index:", 1, ", content_type:", "application/octet-stream", ", content_id:", "att@1", ", size:", 10, ", envelope:", false))
+	assert.Contains(t, out, fmt.Sprint("Multipart parts:", 2, ", envelope_part:", 0, ", xop_includes:", 1, ", dangling_xop_includes:", 0))
+}
@@ -0,0 +1,196 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// xmlNode is an element parsed with RawToken, so prefixes are kept as they
+// are.
+type xmlNode struct {
+	start    xml.StartElement
+	children []interface{} // *xmlNode or copied tokens
+}
+
+func (n *xmlNode) attr(local string) (string, bool) {
+	for _, attr := range n.start.Attr {
+		if attr.Name.Space == "" && attr.Name.Local == local {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+// resolveMultiRefs inlines the SOAP-encoded multiRef elements of the Body of
+// envelope, as sent by Apache Axis 1, into the elements referring to them with
+// href="#id". Referenced multiRef elements are removed from the Body.
+func resolveMultiRefs(envelope []byte) ([]byte, error) {
+	root, prolog, err := parseXMLNodes(envelope)
+	if err != nil {
+		return nil, err
+	}
+	var body *xmlNode
+	for _, child := range root.children {
+		if n, ok := child.(*xmlNode); ok && n.start.Name.Local == "Body" {
+			body = n
+		}
+	}
+	if body == nil {
+		return envelope, nil
+	}
+
+	targets := map[string]*xmlNode{}
+	for _, child := range body.children {
+		if n, ok := child.(*xmlNode); ok {
+			if id, ok := n.attr("id"); ok {
+				targets[id] = n
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return envelope, nil
+	}
+
+	referenced := map[*xmlNode]bool{}
+	var resolve func(n *xmlNode, resolving map[string]bool) error
+	resolve = func(n *xmlNode, resolving map[string]bool) error {
+		if href, ok := n.attr("href"); ok && strings.HasPrefix(href, "#") {
+			id := href[1:]
+			target, ok := targets[id]
+			if !ok {
+				return nil // not a multiRef, leave it to the decoder
+			}
+			if resolving[id] {
+				return fmt.Errorf("multiRef %q refers to itself", id)
+			}
+			resolving[id] = true
+			defer delete(resolving, id)
+			if err := resolve(target, resolving); err != nil {
+				return err
+			}
+			referenced[target] = true
+			n.start.Attr = mergeMultiRefAttrs(n.start.Attr, target.start.Attr)
+			n.children = target.children
+			return nil
+		}
+		for _, child := range n.children {
+			if cn, ok := child.(*xmlNode); ok {
+				if err := resolve(cn, resolving); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for _, child := range body.children {
+		if n, ok := child.(*xmlNode); ok {
+			if _, isTarget := n.attr("id"); !isTarget {
+				if err := resolve(n, map[string]bool{}); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	children := body.children[:0]
+	for _, child := range body.children {
+		if n, ok := child.(*xmlNode); !ok || !referenced[n] {
+			children = append(children, child)
+		}
+	}
+	body.children = children
+
+	var b bytes.Buffer
+	b.Write(prolog)
+	writeXMLNode(&b, root)
+	return b.Bytes(), nil
+}
+
+// mergeMultiRefAttrs returns the attributes of a referring element without
+// href plus the ones of the multiRef element without id and root.
+func mergeMultiRefAttrs(own, target []xml.Attr) []xml.Attr {
+	var attrs []xml.Attr
+	for _, attr := range own {
+		if !(attr.Name.Space == "" && attr.Name.Local == "href") {
+			attrs = append(attrs, attr)
+		}
+	}
+	for _, attr := range target {
+		if (attr.Name.Space == "" && attr.Name.Local == "id") || attr.Name.Local == "root" {
+			continue // soapenc:root="0" marks the multiRef element itself
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs
+}
+
+// parseXMLNodes parses the root element of doc, prolog holds the bytes in
+// front of it.
+func parseXMLNodes(doc []byte) (root *xmlNode, prolog []byte, err error) {
+	d := xml.NewDecoder(bytes.NewReader(doc))
+	var stack []*xmlNode
+	for {
+		offset := d.InputOffset()
+		token, err := d.RawToken()
+		if err == io.EOF {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		switch tt := token.(type) {
+		case xml.StartElement:
+			n := &xmlNode{start: tt.Copy()}
+			if len(stack) == 0 {
+				root, prolog = n, doc[:offset]
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return root, prolog, nil
+			}
+		default:
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, xml.CopyToken(tt))
+			}
+		}
+	}
+}
+
+func writeXMLNode(b *bytes.Buffer, n *xmlNode) {
+	name := rawName(n.start.Name)
+	b.WriteString("<" + name)
+	for _, attr := range n.start.Attr {
+		b.WriteString(" " + rawName(attr.Name) + `="`)
+		xml.EscapeText(b, []byte(attr.Value))
+		b.WriteString(`"`)
+	}
+	if len(n.children) == 0 {
+		b.WriteString("/>")
+		return
+	}
+	b.WriteString(">")
+	for _, child := range n.children {
+		switch tt := child.(type) {
+		case *xmlNode:
+			writeXMLNode(b, tt)
+		case xml.CharData:
+			xml.EscapeText(b, tt)
+		case xml.Comment:
+			b.WriteString("<!--" + string(tt) + "-->")
+		case xml.ProcInst:
+			b.WriteString("<?" + tt.Target + " " + string(tt.Inst) + "?>")
+		case xml.Directive:
+			b.WriteString("<!" + string(tt) + ">")
+		}
+	}
+	b.WriteString("</" + name + ">")
+}
@@ -0,0 +1,50 @@
+package soap
+
+import "encoding/xml"
+
+// Namespaces of the standards commonly used alongside SOAP.
+const (
+	NamespaceSoapEncoding = "http://schemas.xmlsoap.org/soap/encoding/"
+
+	NamespaceWSSE = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"
+	NamespaceWSU  = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
+	NamespaceWSA  = "http://www.w3.org/2005/08/addressing"
+
+	NamespaceXOP     = "http://www.w3.org/2004/08/xop/include"
+	NamespaceXMLMime = "http://www.w3.org/2005/05/xmlmime"
+
+	NamespaceXSI = "http://www.w3.org/2001/XMLSchema-instance"
+	NamespaceXSD = "http://www.w3.org/2001/XMLSchema"
+
+	NamespaceSAML2 = "urn:oasis:names:tc:SAML:2.0:assertion"
+
+	// NamespaceWSRM is WS-ReliableMessaging 1.1, NamespaceWSRM200502 the
+	// earlier submission, which WCF uses by default.
+	NamespaceWSRM       = "http://docs.oasis-open.org/ws-rx/wsrm/200702"
+	NamespaceWSRM200502 = "http://schemas.xmlsoap.org/ws/2005/02/rm"
+
+	NamespaceDS       = "http://www.w3.org/2000/09/xmldsig#"
+	NamespaceExcC14N  = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	NamespaceXMLEnc   = "http://www.w3.org/2001/04/xmlenc#"
+	NamespaceXMLNS    = "http://www.w3.org/2000/xmlns/"
+	NamespaceXMLSpace = "http://www.w3.org/XML/1998/namespace"
+)
+
+// Qualified names of common elements and attributes.
+var (
+	QNameSecurity      = xml.Name{Space: NamespaceWSSE, Local: "Security"}
+	QNameUsernameToken = xml.Name{Space: NamespaceWSSE, Local: "UsernameToken"}
+	QNameTimestamp     = xml.Name{Space: NamespaceWSU, Local: "Timestamp"}
+	QNameID            = xml.Name{Space: NamespaceWSU, Local: "Id"}
+
+	QNameAction    = xml.Name{Space: NamespaceWSA, Local: "Action"}
+	QNameMessageID = xml.Name{Space: NamespaceWSA, Local: "MessageID"}
+	QNameRelatesTo = xml.Name{Space: NamespaceWSA, Local: "RelatesTo"}
+	QNameTo        = xml.Name{Space: NamespaceWSA, Local: "To"}
+	QNameReplyTo   = xml.Name{Space: NamespaceWSA, Local: "ReplyTo"}
+
+	QNameInclude = xml.Name{Space: NamespaceXOP, Local: "Include"}
+
+	QNameNil  = xml.Name{Space: NamespaceXSI, Local: "nil"}
+	QNameType = xml.Name{Space: NamespaceXSI, Local: "type"}
+)
@@ -0,0 +1,34 @@
+package soap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNamespaces pins the namespace URIs to the published specs, typos cause
+// silent interop failures.
+func TestNamespaces(t *testing.T) {
+	for have, want := range map[string]string{
+		NamespaceSoap11:       "http://schemas.xmlsoap.org/soap/envelope/",                                          // SOAP 1.1
+		NamespaceSoap12:       "http://www.w3.org/2003/05/soap-envelope",                                            // SOAP 1.2 Part 1: Messaging Framework
+		NamespaceSoapEncoding: "http://schemas.xmlsoap.org/soap/encoding/",                                          // SOAP 1.1
+		NamespaceWSSE:         "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd",  // WSS 1.0
+		NamespaceWSU:          "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd", // WSS 1.0
+		NamespaceWSA:          "http://www.w3.org/2005/08/addressing",                                               // WS-Addressing 1.0 Core
+		NamespaceXOP:          "http://www.w3.org/2004/08/xop/include",                                              // XOP
+		NamespaceXMLMime:      "http://www.w3.org/2005/05/xmlmime",                                                  // Describing Media Content of Binary Data in XML
+		NamespaceXSI:          "http://www.w3.org/2001/XMLSchema-instance",                                          // XML Schema Part 1
+		NamespaceXSD:          "http://www.w3.org/2001/XMLSchema",                                                   // XML Schema Part 1
+		NamespaceSAML2:        "urn:oasis:names:tc:SAML:2.0:assertion",                                              // SAML 2.0 Core
+		NamespaceWSRM:         "http://docs.oasis-open.org/ws-rx/wsrm/200702",                                       // WS-ReliableMessaging 1.1
+		NamespaceWSRM200502:   "http://schemas.xmlsoap.org/ws/2005/02/rm",                                           // WS-ReliableMessaging, February 2005
+		NamespaceDS:           "http://www.w3.org/2000/09/xmldsig#",                                                 // XML Signature
+		NamespaceExcC14N:      "http://www.w3.org/2001/10/xml-exc-c14n#",                                            // Exclusive XML Canonicalization
+		NamespaceXMLEnc:       "http://www.w3.org/2001/04/xmlenc#",                                                  // XML Encryption
+		NamespaceXMLNS:        "http://www.w3.org/2000/xmlns/",                                                      // Namespaces in XML
+		NamespaceXMLSpace:     "http://www.w3.org/XML/1998/namespace",                                               // Namespaces in XML
+	} {
+		assert.Exactly(t, want, have)
+	}
+}
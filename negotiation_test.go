@@ -0,0 +1,115 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClient_contentNegotiation runs the responses of testdata/negotiation
+// through every combination of SOAP version, response Content-Type and
+// packaging the Client supports.
+func TestClient_contentNegotiation(t *testing.T) {
+	contentTypes := []string{
+		"text/xml",
+		`text/xml; charset="utf-8"`,
+		"application/soap+xml",
+		"application/soap+xml; charset=utf-8",
+		"application/xml",
+		"", // missing
+	}
+	packagings := []string{"plain", "swa", "mtom"}
+	for _, soapVersion := range []string{SoapVersion11, SoapVersion12} {
+		fixture := "soap11.response.xml"
+		wantAccept := "text/xml, multipart/related"
+		if soapVersion == SoapVersion12 {
+			fixture = "soap12.response.xml"
+			wantAccept = "application/soap+xml, multipart/related"
+		}
+		envelope, err := ioutil.ReadFile(filepath.Join("testdata", "negotiation", fixture))
+		require.NoError(t, err)
+		for _, contentType := range contentTypes {
+			for _, packaging := range packagings {
+				t.Run(soapVersion+"/"+contentType+"/"+packaging, func(t *testing.T) {
+					body, responseType := envelope, contentType
+					if packaging != "plain" {
+						var buf bytes.Buffer
+						responseType, err = WriteMultipartRelated(&buf, envelope,
+							[]Attachment{{ContentID: "att", ContentType: "text/plain", Body: strings.NewReader("attached")}},
+							MultipartOptions{MTOM: packaging == "mtom", SoapVersion: soapVersion, EnvelopeContentType: contentType})
+						require.NoError(t, err)
+						body = buf.Bytes()
+					}
+					var requests []*http.Request
+					c := NewClient("http://localhorst.ch", nil)
+					if soapVersion == SoapVersion12 {
+						c.UseSoap12()
+					}
+					c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+						requests = append(requests, r)
+						header := http.Header{}
+						if responseType != "" {
+							header.Set("Content-Type", responseType)
+						}
+						return &http.Response{StatusCode: 200, Header: header, Body: ioutil.NopCloser(bytes.NewReader(body))}, nil
+					})}).Do
+
+					var stats CallStats
+					response := &FooResponse{}
+					_, err := c.Call(context.Background(), "foo", &FooRequest{}, response, WithCallStats(&stats))
+					require.NoError(t, err)
+					assert.Equal(t, "negotiated", response.Bar)
+					if packaging == "plain" {
+						assert.Nil(t, stats.Multipart)
+					} else {
+						require.NotNil(t, stats.Multipart)
+						assert.Len(t, stats.Multipart.Parts, 2)
+					}
+
+					var bar string
+					_, err = c.CallExtract(context.Background(), "foo", &FooRequest{}, map[string]interface{}{"Body/fooResponse/Bar": &bar})
+					require.NoError(t, err)
+					assert.Equal(t, "negotiated", bar)
+
+					for _, r := range requests {
+						assert.Equal(t, wantAccept, r.Header.Get("Accept"))
+					}
+				})
+			}
+		}
+
+		t.Run(soapVersion+"/json", func(t *testing.T) {
+			body, err := ioutil.ReadFile(filepath.Join("testdata", "negotiation", "json.response"))
+			require.NoError(t, err)
+			c := NewClient("http://localhorst.ch", nil)
+			if soapVersion == SoapVersion12 {
+				c.UseSoap12()
+			}
+			c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"application/json"}}, Body: ioutil.NopCloser(bytes.NewReader(body))}, nil
+			})}).Do
+			_, err = c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{})
+			assert.Equal(t, ErrorKindProtocol, KindOf(err))
+		})
+	}
+}
+
+func TestClient_Accept(t *testing.T) {
+	var accept string
+	c := NewClient("http://localhorst.ch", nil)
+	c.Accept = "application/soap+xml"
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		accept = r.Header.Get("Accept")
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	})}).Do
+	_, err := c.Call(context.Background(), "foo", &FooRequest{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "application/soap+xml", accept)
+}
@@ -0,0 +1,97 @@
+package soap
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// NonceStore remembers the nonces of WS-Security tokens to detect replayed
+// messages, see UsernameTokenVerifier. Implementations must be safe for
+// concurrent use, e.g. backed by Redis when several servers share the load.
+type NonceStore interface {
+	// Add records nonce of a token created at created. It reports whether
+	// the nonce is fresh, i.e. it hasn't been added before.
+	Add(nonce string, created time.Time) (fresh bool)
+}
+
+// NopNonceStore is a NonceStore, which considers every nonce fresh.
+type NopNonceStore struct{}
+
+// Add implements NonceStore
+func (NopNonceStore) Add(nonce string, created time.Time) bool {
+	return true
+}
+
+// MemoryNonceStore is an in-memory NonceStore. A nonce is remembered until
+// TTL after its creation time; tokens created more than TTL away from now
+// are never fresh, so the store holds at most the nonces of a 2*TTL window.
+type MemoryNonceStore struct {
+	TTL   time.Duration
+	Clock Clock // optional, falls back to the system clock
+
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	expiry nonceHeap
+}
+
+// NewMemoryNonceStore returns a MemoryNonceStore remembering nonces for ttl.
+func NewMemoryNonceStore(ttl time.Duration) *MemoryNonceStore {
+	return &MemoryNonceStore{TTL: ttl}
+}
+
+// Add implements NonceStore
+func (ms *MemoryNonceStore) Add(nonce string, created time.Time) bool {
+	now := clockOrDefault(ms.Clock).Now()
+	if created.Before(now.Add(-ms.TTL)) || created.After(now.Add(ms.TTL)) {
+		return false
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.evict(now)
+	if _, ok := ms.nonces[nonce]; ok {
+		return false
+	}
+	if ms.nonces == nil {
+		ms.nonces = make(map[string]time.Time)
+	}
+	expires := created.Add(ms.TTL)
+	ms.nonces[nonce] = expires
+	heap.Push(&ms.expiry, nonceExpiry{nonce: nonce, expires: expires})
+	return true
+}
+
+// Len returns the number of remembered nonces.
+func (ms *MemoryNonceStore) Len() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return len(ms.nonces)
+}
+
+// evict forgets the nonces expired at now.
+func (ms *MemoryNonceStore) evict(now time.Time) {
+	for len(ms.expiry) > 0 && !ms.expiry[0].expires.After(now) {
+		delete(ms.nonces, heap.Pop(&ms.expiry).(nonceExpiry).nonce)
+	}
+}
+
+type nonceExpiry struct {
+	nonce   string
+	expires time.Time
+}
+
+// nonceHeap implements heap.Interface, the nonce expiring first is on top.
+type nonceHeap []nonceExpiry
+
+func (h nonceHeap) Len() int            { return len(h) }
+func (h nonceHeap) Less(i, j int) bool  { return h[i].expires.Before(h[j].expires) }
+func (h nonceHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *nonceHeap) Push(x interface{}) { *h = append(*h, x.(nonceExpiry)) }
+
+func (h *nonceHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
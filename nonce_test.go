@@ -0,0 +1,63 @@
+package soap
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryNonceStore(t *testing.T) {
+	clock := &sleepRecorder{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ms := NewMemoryNonceStore(5 * time.Minute)
+	ms.Clock = clock
+
+	assert.True(t, ms.Add("a", clock.now))
+	assert.False(t, ms.Add("a", clock.now), "replay")
+	assert.True(t, ms.Add("b", clock.now.Add(-time.Minute)))
+	assert.False(t, ms.Add("c", clock.now.Add(-6*time.Minute)), "too old")
+	assert.False(t, ms.Add("d", clock.now.Add(6*time.Minute)), "too far in the future")
+
+	clock.now = clock.now.Add(4 * time.Minute)
+	assert.False(t, ms.Add("a", clock.now.Add(-4*time.Minute)), "still remembered")
+	assert.True(t, ms.Add("b", clock.now), "expired")
+
+	assert.True(t, NopNonceStore{}.Add("a", time.Time{}))
+	assert.True(t, NopNonceStore{}.Add("a", time.Time{}))
+}
+
+func TestMemoryNonceStore_eviction(t *testing.T) {
+	clock := &sleepRecorder{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ms := NewMemoryNonceStore(time.Minute)
+	ms.Clock = clock
+
+	for i := 0; i < 10000; i++ {
+		assert.True(t, ms.Add(fmt.Sprint("nonce-", i), clock.now))
+		clock.now = clock.now.Add(time.Second)
+	}
+	assert.LessOrEqual(t, ms.Len(), 61)
+	assert.LessOrEqual(t, len(ms.expiry), 61)
+}
+
+func TestMemoryNonceStore_race(t *testing.T) {
+	ms := NewMemoryNonceStore(time.Minute)
+	created := time.Now()
+	for i := 0; i < 100; i++ {
+		nonce := fmt.Sprint("nonce-", i)
+		var (
+			wg    sync.WaitGroup
+			fresh [2]bool
+		)
+		for j := range fresh {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				fresh[j] = ms.Add(nonce, created)
+			}(j)
+		}
+		wg.Wait()
+		assert.True(t, fresh[0] != fresh[1], "exactly one of the racing Adds must win")
+	}
+}
@@ -0,0 +1,311 @@
+package soap
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// NTLMAuth are the Windows credentials of NTLMTransport. User may also be
+// given as DOMAIN\user, if Domain is empty.
+type NTLMAuth struct {
+	Domain   string
+	User     string
+	Password string
+}
+
+// NTLMTransport returns a RoundTripper authenticating requests with NTLMv2,
+// as required by services behind IIS with Windows Integrated Authentication.
+// Use it for Client.HTTPClientDoFn:
+//
+//	c.HTTPClientDoFn = (&http.Client{Transport: NTLMTransport(nil, auth)}).Do
+//
+// Each request is sent with an NTLM negotiate message. If the server answers
+// with a challenge, the request is sent again on the same connection with the
+// authenticate message, replaying the body. Responses without a challenge are
+// returned as they are. base falls back to http.DefaultTransport.
+func NTLMTransport(base http.RoundTripper, auth *NTLMAuth) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &ntlmTransport{base: base, auth: auth, now: time.Now}
+}
+
+type ntlmTransport struct {
+	base http.RoundTripper
+	auth *NTLMAuth
+	now  func() time.Time
+}
+
+func (t *ntlmTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	getBody, err := replayableBody(req)
+	if err != nil {
+		return nil, err
+	}
+	// The handshake is bound to the connection, keep it open for the second
+	// leg.
+	negotiate := req.Clone(req.Context())
+	negotiate.Close = false
+	if negotiate.Body, err = getBody(); err != nil {
+		return nil, err
+	}
+	negotiate.Header.Set("Authorization", "NTLM "+base64.StdEncoding.EncodeToString(ntlmNegotiateMessage()))
+	resp, err := t.base.RoundTrip(negotiate)
+	if err != nil {
+		return nil, err
+	}
+	challenge, ok := ntlmChallengeOf(resp)
+	if !ok {
+		return resp, nil
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	// The client challenge is padded or cut to the 8 bytes of NTLMv2.
+	clientChallenge := make([]byte, 8)
+	copy(clientChallenge, idBytes(idGeneratorOf(req.Context()).NewID(IDNonce)))
+	msg, err := ntlmAuthenticateMessage(t.auth, challenge, clientChallenge, t.now())
+	if err != nil {
+		return nil, fmt.Errorf("NTLM authentication: %w", err)
+	}
+	authenticate := req.Clone(req.Context())
+	if authenticate.Body, err = getBody(); err != nil {
+		return nil, err
+	}
+	authenticate.Header.Set("Authorization", "NTLM "+base64.StdEncoding.EncodeToString(msg))
+	return t.base.RoundTrip(authenticate)
+}
+
+// replayableBody returns a function returning the body of req anew for each
+// leg of a handshake. Bodies without GetBody, e.g. of multipart requests, are
+// read into memory.
+func replayableBody(req *http.Request) (func() (io.ReadCloser, error), error) {
+	switch {
+	case req.Body == nil || req.Body == http.NoBody:
+		return func() (io.ReadCloser, error) { return http.NoBody, nil }, nil
+	case req.GetBody != nil:
+		return req.GetBody, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	return func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}, nil
+}
+
+// ntlmChallengeOf returns the NTLM challenge message of a 401 response.
+func ntlmChallengeOf(resp *http.Response) ([]byte, bool) {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return nil, false
+	}
+	for _, value := range resp.Header.Values("WWW-Authenticate") {
+		scheme, token := value, ""
+		if i := strings.IndexByte(value, ' '); i >= 0 {
+			scheme, token = value[:i], strings.TrimSpace(value[i+1:])
+		}
+		if !strings.EqualFold(scheme, "NTLM") && !strings.EqualFold(scheme, "Negotiate") {
+			continue
+		}
+		if challenge, err := base64.StdEncoding.DecodeString(token); err == nil && len(challenge) > 0 {
+			return challenge, true
+		}
+	}
+	return nil, false
+}
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+const (
+	ntlmNegotiateUnicode       = 0x00000001
+	ntlmRequestTarget          = 0x00000004
+	ntlmNegotiateNTLM          = 0x00000200
+	ntlmNegotiateAlwaysSign    = 0x00008000
+	ntlmNegotiateExtendedSec   = 0x00080000
+	ntlmNegotiateTargetInfo    = 0x00800000
+	ntlmNegotiate128           = 0x20000000
+	ntlmNegotiate56            = 0x80000000
+	ntlmFlags                  = ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateNTLM | ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSec | ntlmNegotiateTargetInfo | ntlmNegotiate128 | ntlmNegotiate56
+	ntlmAvTimestamp            = 7
+	ntlmFiletimeUnixEpochDelta = 116444736000000000
+)
+
+// ntlmNegotiateMessage returns the first message of the handshake, without
+// domain and workstation.
+func ntlmNegotiateMessage() []byte {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmFlags)
+	return msg
+}
+
+// ntlmChallenge is the second message of the handshake, sent by the server.
+type ntlmChallenge struct {
+	flags           uint32
+	serverChallenge []byte
+	targetInfo      []byte
+}
+
+func parseNTLMChallenge(msg []byte) (*ntlmChallenge, error) {
+	if len(msg) < 32 || !bytes.HasPrefix(msg, ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 2 {
+		return nil, errors.New("not a challenge message")
+	}
+	challenge := &ntlmChallenge{
+		flags:           binary.LittleEndian.Uint32(msg[20:]),
+		serverChallenge: msg[24:32],
+	}
+	if len(msg) >= 48 {
+		length, offset := int(binary.LittleEndian.Uint16(msg[40:])), int(binary.LittleEndian.Uint32(msg[44:]))
+		if offset+length > len(msg) {
+			return nil, errors.New("target info exceeds the challenge message")
+		}
+		challenge.targetInfo = msg[offset : offset+length]
+	}
+	return challenge, nil
+}
+
+// ntlmAuthenticateMessage returns the last message of the handshake,
+// answering the challenge message msg with the NTLMv2 response of auth and
+// clientChallenge.
+func ntlmAuthenticateMessage(auth *NTLMAuth, msg, clientChallenge []byte, now time.Time) ([]byte, error) {
+	challenge, err := parseNTLMChallenge(msg)
+	if err != nil {
+		return nil, err
+	}
+	domain, user := auth.Domain, auth.User
+	if i := strings.IndexByte(user, '\\'); domain == "" && i >= 0 {
+		domain, user = user[:i], user[i+1:]
+	}
+	timestamp := ntlmTimestamp(challenge.targetInfo)
+	if timestamp == nil {
+		timestamp = make([]byte, 8)
+		binary.LittleEndian.PutUint64(timestamp, uint64(now.UnixNano()/100+ntlmFiletimeUnixEpochDelta))
+	}
+	key := ntowfv2(domain, user, auth.Password)
+	ntResponse := ntlmV2Response(key, challenge.serverChallenge, clientChallenge, timestamp, challenge.targetInfo)
+	lmResponse := append(hmacMD5(key, challenge.serverChallenge, clientChallenge), clientChallenge...)
+
+	payloads := [][]byte{lmResponse, ntResponse, utf16LE(domain), utf16LE(user), nil, nil}
+	const headerSize = 64
+	out := make([]byte, headerSize)
+	copy(out, ntlmSignature)
+	binary.LittleEndian.PutUint32(out[8:], 3)
+	for i, payload := range payloads {
+		field := out[12+8*i:]
+		binary.LittleEndian.PutUint16(field, uint16(len(payload)))
+		binary.LittleEndian.PutUint16(field[2:], uint16(len(payload)))
+		binary.LittleEndian.PutUint32(field[4:], uint32(len(out)))
+		out = append(out, payload...)
+	}
+	binary.LittleEndian.PutUint32(out[60:], ntlmFlags&(challenge.flags|ntlmNegotiateUnicode))
+	return out, nil
+}
+
+// ntlmTimestamp returns the MsvAvTimestamp of the target info, nil if it has
+// none.
+func ntlmTimestamp(targetInfo []byte) []byte {
+	for len(targetInfo) >= 4 {
+		id, length := binary.LittleEndian.Uint16(targetInfo), int(binary.LittleEndian.Uint16(targetInfo[2:]))
+		if len(targetInfo) < 4+length || id == 0 {
+			return nil
+		}
+		if id == ntlmAvTimestamp && length == 8 {
+			return targetInfo[4:12]
+		}
+		targetInfo = targetInfo[4+length:]
+	}
+	return nil
+}
+
+// ntowfv2 is the NTLMv2 response key of MS-NLMP.
+func ntowfv2(domain, user, password string) []byte {
+	hash := md4Sum(utf16LE(password))
+	return hmacMD5(hash[:], utf16LE(strings.ToUpper(user)+domain))
+}
+
+// ntlmV2Response is the NTProofStr of MS-NLMP followed by the client blob it
+// was computed of.
+func ntlmV2Response(key, serverChallenge, clientChallenge, timestamp, targetInfo []byte) []byte {
+	var blob []byte
+	blob = append(blob, 1, 1, 0, 0, 0, 0, 0, 0)
+	blob = append(blob, timestamp...)
+	blob = append(blob, clientChallenge...)
+	blob = append(blob, 0, 0, 0, 0)
+	blob = append(blob, targetInfo...)
+	blob = append(blob, 0, 0, 0, 0)
+	return append(hmacMD5(key, serverChallenge, blob), blob...)
+}
+
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(md5.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+func utf16LE(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	out := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(out[2*i:], u)
+	}
+	return out
+}
+
+// md4Sum is MD4 (RFC 1320), which NTLM hashes passwords with. It isn't part
+// of the standard library.
+func md4Sum(data []byte) [16]byte {
+	msg := append([]byte(nil), data...)
+	msg = append(msg, 0x80)
+	for len(msg)%64 != 56 {
+		msg = append(msg, 0)
+	}
+	var length [8]byte
+	binary.LittleEndian.PutUint64(length[:], uint64(len(data))*8)
+	msg = append(msg, length[:]...)
+
+	s := [4]uint32{0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476}
+	var x [16]uint32
+	for block := msg; len(block) > 0; block = block[64:] {
+		for i := range x {
+			x[i] = binary.LittleEndian.Uint32(block[4*i:])
+		}
+		a, b, c, d := s[0], s[1], s[2], s[3]
+		for i := 0; i < 16; i++ {
+			k := i
+			a = bits.RotateLeft32(a+(b&c|^b&d)+x[k], []int{3, 7, 11, 19}[i%4])
+			a, b, c, d = d, a, b, c
+		}
+		for i := 0; i < 16; i++ {
+			k := i/4 + i%4*4
+			a = bits.RotateLeft32(a+(b&c|b&d|c&d)+x[k]+0x5a827999, []int{3, 5, 9, 13}[i%4])
+			a, b, c, d = d, a, b, c
+		}
+		for i := 0; i < 16; i++ {
+			k := []int{0, 8, 4, 12, 2, 10, 6, 14, 1, 9, 5, 13, 3, 11, 7, 15}[i]
+			a = bits.RotateLeft32(a+(b^c^d)+x[k]+0x6ed9eba1, []int{3, 9, 11, 15}[i%4])
+			a, b, c, d = d, a, b, c
+		}
+		s[0], s[1], s[2], s[3] = s[0]+a, s[1]+b, s[2]+c, s[3]+d
+	}
+	var sum [16]byte
+	for i, v := range s {
+		binary.LittleEndian.PutUint32(sum[4*i:], v)
+	}
+	return sum
+}
@@ -0,0 +1,130 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMD4Sum(t *testing.T) {
+	// Test suite of RFC 1320.
+	for input, want := range map[string]string{
+		"":               "31d6cfe0d16ae931b73c59d7e0c089c0",
+		"abc":            "a448017aaf21d8525fc10ae87aa6729d",
+		"message digest": "d9130a8164549fe818874806e1c7014b",
+		"12345678901234567890123456789012345678901234567890123456789012345678901234567890": "e33b4ddc9c38f2199c3e7b164fcc0536",
+	} {
+		sum := md4Sum([]byte(input))
+		assert.Equal(t, want, hex.EncodeToString(sum[:]), input)
+	}
+}
+
+// ntlmTestTargetInfo is the target info of the examples of MS-NLMP 4.2.4.
+var ntlmTestTargetInfo, _ = hex.DecodeString("02000c0044006f006d00610069006e0001000c0053006500720076006500720000000000")
+
+func TestNTLMv2Response(t *testing.T) {
+	// Example of MS-NLMP 4.2.4.
+	key := ntowfv2("Domain", "User", "Password")
+	assert.Equal(t, "0c868a403bfd7a93a3001ef22ef02e3f", hex.EncodeToString(key))
+	serverChallenge, _ := hex.DecodeString("0123456789abcdef")
+	clientChallenge := bytes.Repeat([]byte{0xaa}, 8)
+	response := ntlmV2Response(key, serverChallenge, clientChallenge, make([]byte, 8), ntlmTestTargetInfo)
+	assert.Equal(t, "68cd0ab851e51c96aabc927bebef6a1c", hex.EncodeToString(response[:16]))
+}
+
+// ntlmTestChallenge returns a challenge message with serverChallenge and
+// ntlmTestTargetInfo.
+func ntlmTestChallenge(serverChallenge []byte) []byte {
+	msg := make([]byte, 48)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 2)
+	binary.LittleEndian.PutUint32(msg[20:], ntlmFlags)
+	copy(msg[24:], serverChallenge)
+	binary.LittleEndian.PutUint16(msg[40:], uint16(len(ntlmTestTargetInfo)))
+	binary.LittleEndian.PutUint16(msg[42:], uint16(len(ntlmTestTargetInfo)))
+	binary.LittleEndian.PutUint32(msg[44:], 48)
+	return append(msg, ntlmTestTargetInfo...)
+}
+
+// ntlmField returns the payload of the security buffer of msg at offset.
+func ntlmField(msg []byte, offset int) []byte {
+	length, start := binary.LittleEndian.Uint16(msg[offset:]), binary.LittleEndian.Uint32(msg[offset+4:])
+	return msg[start : start+uint32(length)]
+}
+
+func TestNTLMTransport(t *testing.T) {
+	serverChallenge := []byte("8bytes!!")
+	for name, opts := range map[string][]CallOption{
+		"plain":       nil,
+		"attachments": {WithAttachments(NewAttachmentReader(&Attachment{ContentID: "a", ContentType: "text/plain", Body: strings.NewReader("attached")}))},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var legs []string
+			var bodies [][]byte
+			fakeIIS := RoundTrip(func(r *http.Request) (*http.Response, error) {
+				body, _ := ioutil.ReadAll(r.Body)
+				bodies = append(bodies, body)
+				msg, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(r.Header.Get("Authorization"), "NTLM "))
+				require.NoError(t, err)
+				require.True(t, bytes.HasPrefix(msg, ntlmSignature))
+				switch binary.LittleEndian.Uint32(msg[8:]) {
+				case 1:
+					legs = append(legs, "negotiate")
+					assert.False(t, r.Close, "the connection is kept for the handshake")
+					return &http.Response{
+						StatusCode: http.StatusUnauthorized,
+						Header:     http.Header{"Www-Authenticate": {"NTLM " + base64.StdEncoding.EncodeToString(ntlmTestChallenge(serverChallenge))}},
+						Body:       http.NoBody,
+					}, nil
+				case 3:
+					legs = append(legs, "authenticate")
+					assert.Equal(t, utf16LE("CORP"), ntlmField(msg, 28))
+					assert.Equal(t, utf16LE("jdoe"), ntlmField(msg, 36))
+					ntResponse := ntlmField(msg, 20)
+					want := hmacMD5(ntowfv2("CORP", "jdoe", "s3cr3t"), serverChallenge, ntResponse[16:])
+					if !bytes.Equal(want, ntResponse[:16]) {
+						return &http.Response{StatusCode: http.StatusUnauthorized, Body: http.NoBody}, nil
+					}
+					return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><FooResponse><Bar>authenticated</Bar></FooResponse></Body></Envelope>`))}, nil
+				}
+				t.Fatalf("unexpected message type %d", msg[8])
+				return nil, nil
+			})
+
+			c := NewClient("http://localhorst.ch", nil)
+			c.HTTPClientDoFn = (&http.Client{Transport: NTLMTransport(fakeIIS, &NTLMAuth{User: `CORP\jdoe`, Password: "s3cr3t"})}).Do
+			response := &FooResponse{}
+			_, err := c.Call(context.Background(), "foo", &FooRequest{Foo: "replayed"}, response, opts...)
+			require.NoError(t, err)
+			assert.Equal(t, "authenticated", response.Bar)
+			assert.Equal(t, []string{"negotiate", "authenticate"}, legs)
+			require.Len(t, bodies, 2)
+			assert.Contains(t, string(bodies[1]), "replayed")
+			assert.Equal(t, bodies[0], bodies[1], "the body is replayed")
+		})
+	}
+}
+
+func TestNTLMTransport_noChallenge(t *testing.T) {
+	legs := 0
+	c := NewClient("http://localhorst.ch", nil)
+	c.HTTPClientDoFn = (&http.Client{Transport: NTLMTransport(RoundTrip(func(r *http.Request) (*http.Response, error) {
+		legs++
+		return &http.Response{StatusCode: http.StatusUnauthorized, Header: http.Header{"Www-Authenticate": {"Basic realm=x"}}, Body: http.NoBody}, nil
+	}), &NTLMAuth{User: "jdoe"})}).Do
+
+	_, err := c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{})
+	var ae *AuthError
+	require.ErrorAs(t, err, &ae)
+	assert.Equal(t, "Basic realm=x", ae.Challenge)
+	assert.Equal(t, 1, legs)
+}
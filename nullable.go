@@ -0,0 +1,29 @@
+package soap
+
+import "encoding/xml"
+
+// Nullable is an optional value without a pointer. The element is only
+// written if Valid is set and Valid is set if the element has been decoded.
+type Nullable[T any] struct {
+	Value T
+	Valid bool
+}
+
+// NewNullable returns a valid Nullable holding v.
+func NewNullable[T any](v T) Nullable[T] {
+	return Nullable[T]{Value: v, Valid: true}
+}
+
+// MarshalXML implements xml.Marshaler
+func (n Nullable[T]) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if !n.Valid {
+		return nil
+	}
+	return e.EncodeElement(n.Value, start)
+}
+
+// UnmarshalXML implements xml.Unmarshaler
+func (n *Nullable[T]) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	n.Valid = true
+	return d.DecodeElement(&n.Value, &start)
+}
@@ -0,0 +1,313 @@
+// Package opensearch provides a soap.Archiver indexing the messages of a
+// soap.Client into OpenSearch or Elasticsearch using the bulk API.
+//
+//	archiver := opensearch.New("https://search.example.com:9200", opensearch.WithIndex("soap-2006.01.02"))
+//	defer archiver.Close()
+//	client.Archiver = archiver
+package opensearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/orirawlings/soap"
+)
+
+// Defaults of an Archiver
+const (
+	DefaultIndex         = "soap-2006.01.02"
+	DefaultFlushInterval = 5 * time.Second
+	DefaultFlushSize     = 500
+	DefaultBufferSize    = 10000
+	DefaultMaxAttempts   = 5
+	DefaultBackoff       = 500 * time.Millisecond
+)
+
+// Option configures an Archiver.
+type Option func(*Archiver)
+
+// WithIndex sets the index name template, a layout of time.Format applied to
+// the time of each record, e.g. "soap-2006.01.02" for daily indices. Parts
+// that aren't meant to be replaced must not contain layout elements.
+func WithIndex(template string) Option {
+	return func(a *Archiver) {
+		a.index = template
+	}
+}
+
+// WithFlush sets the interval and the number of buffered records after which
+// the buffer is sent.
+func WithFlush(interval time.Duration, size int) Option {
+	return func(a *Archiver) {
+		a.flushInterval = interval
+		a.flushSize = size
+	}
+}
+
+// WithBufferSize bounds the number of buffered records. If the buffer is full
+// the oldest record is dropped, see Dropped.
+func WithBufferSize(size int) Option {
+	return func(a *Archiver) {
+		a.bufferSize = size
+	}
+}
+
+// WithRetry sets how often a bulk request is attempted and the backoff before
+// the first retry, which doubles for each further one.
+func WithRetry(maxAttempts int, backoff time.Duration) Option {
+	return func(a *Archiver) {
+		a.maxAttempts = maxAttempts
+		a.backoff = backoff
+	}
+}
+
+// WithHTTPClientDoFn replaces http.DefaultClient.Do, e.g. to authenticate.
+func WithHTTPClientDoFn(do func(req *http.Request) (*http.Response, error)) Option {
+	return func(a *Archiver) {
+		a.do = do
+	}
+}
+
+// WithClock replaces soap.SystemClock used for backoffs.
+func WithClock(clock soap.Clock) Option {
+	return func(a *Archiver) {
+		a.clock = clock
+	}
+}
+
+// Archiver is a soap.Archiver sending the records in NDJSON bulk requests. Its
+// methods are safe for concurrent use.
+type Archiver struct {
+	url           string
+	index         string
+	flushInterval time.Duration
+	flushSize     int
+	bufferSize    int
+	maxAttempts   int
+	backoff       time.Duration
+	do            func(req *http.Request) (*http.Response, error)
+	clock         soap.Clock
+
+	mu      sync.Mutex
+	buffer  []soap.MessageRecord
+	closed  bool
+	dropped uint64
+
+	flush chan struct{}
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// New returns a running Archiver posting to the bulk API of the cluster at
+// url. Close it to send the remaining records.
+func New(url string, opts ...Option) *Archiver {
+	a := &Archiver{
+		url:           strings.TrimSuffix(url, "/") + "/_bulk",
+		index:         DefaultIndex,
+		flushInterval: DefaultFlushInterval,
+		flushSize:     DefaultFlushSize,
+		bufferSize:    DefaultBufferSize,
+		maxAttempts:   DefaultMaxAttempts,
+		backoff:       DefaultBackoff,
+		do:            http.DefaultClient.Do,
+		clock:         soap.SystemClock{},
+		flush:         make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	a.wg.Add(1)
+	go a.run()
+	return a
+}
+
+// Archive implements soap.Archiver, it only buffers record.
+func (a *Archiver) Archive(record soap.MessageRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		a.dropped++
+		return
+	}
+	if len(a.buffer) >= a.bufferSize {
+		a.buffer = a.buffer[1:]
+		a.dropped++
+	}
+	a.buffer = append(a.buffer, record)
+	if len(a.buffer) >= a.flushSize {
+		select {
+		case a.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Dropped returns the number of records which have not been indexed, because
+// the buffer was full, indexing failed permanently or the Archiver had been
+// closed.
+func (a *Archiver) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Close sends the buffered records and stops the Archiver.
+func (a *Archiver) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	a.mu.Unlock()
+	close(a.done)
+	a.wg.Wait()
+	return nil
+}
+
+func (a *Archiver) run() {
+	defer a.wg.Done()
+	ticker := time.NewTicker(a.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-a.flush:
+		case <-a.done:
+			a.send()
+			return
+		}
+		a.send()
+	}
+}
+
+// send indexes the buffered records, retrying the ones failing temporarily.
+func (a *Archiver) send() {
+	a.mu.Lock()
+	records := a.buffer
+	a.buffer = nil
+	a.mu.Unlock()
+
+	for start := 0; start < len(records); start += a.flushSize {
+		end := start + a.flushSize
+		if end > len(records) {
+			end = len(records)
+		}
+		a.sendBatch(records[start:end])
+	}
+}
+
+func (a *Archiver) sendBatch(records []soap.MessageRecord) {
+	backoff := a.backoff
+	for attempt := 1; ; attempt++ {
+		retry, failed := a.bulk(records)
+		a.addDropped(failed)
+		if len(retry) == 0 {
+			return
+		}
+		if attempt >= a.maxAttempts {
+			a.addDropped(len(retry))
+			return
+		}
+		a.clock.Sleep(context.Background(), backoff)
+		backoff *= 2
+		records = retry
+	}
+}
+
+func (a *Archiver) addDropped(n int) {
+	atomic.AddUint64(&a.dropped, uint64(n))
+}
+
+// document is the indexed form of a soap.MessageRecord.
+type document struct {
+	Timestamp   time.Time `json:"@timestamp"`
+	Direction   string    `json:"direction"`
+	ID          string    `json:"id"`
+	Endpoint    string    `json:"endpoint"`
+	Action      string    `json:"action"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Body        string    `json:"body"`
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+	} `json:"items"`
+}
+
+// temporary tells whether a request or item failing with status may succeed
+// later.
+func temporary(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// bulk sends records in a single bulk request and returns the ones to retry
+// and the number of records failed permanently.
+func (a *Archiver) bulk(records []soap.MessageRecord) (retry []soap.MessageRecord, failed int) {
+	body := &bytes.Buffer{}
+	enc := json.NewEncoder(body)
+	for _, r := range records {
+		action := map[string]interface{}{"index": map[string]string{"_index": r.Time.UTC().Format(a.index)}}
+		if err := enc.Encode(action); err != nil {
+			return nil, len(records)
+		}
+		if err := enc.Encode(document{
+			Timestamp:   r.Time,
+			Direction:   string(r.Direction),
+			ID:          r.ID,
+			Endpoint:    r.Endpoint,
+			Action:      r.Action,
+			StatusCode:  r.StatusCode,
+			ContentType: r.ContentType,
+			Body:        string(r.Body),
+		}); err != nil {
+			return nil, len(records)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, a.url, body)
+	if err != nil {
+		return nil, len(records)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := a.do(req)
+	if err != nil {
+		return records, 0
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	switch {
+	case err != nil || temporary(resp.StatusCode):
+		return records, 0
+	case resp.StatusCode >= 300:
+		return nil, len(records)
+	}
+
+	var br bulkResponse
+	if err := json.Unmarshal(data, &br); err != nil || !br.Errors {
+		return nil, 0
+	}
+	if len(br.Items) != len(records) {
+		return nil, len(records)
+	}
+	for i, item := range br.Items {
+		for _, result := range item {
+			switch {
+			case temporary(result.Status):
+				retry = append(retry, records[i])
+			case result.Status >= 300:
+				failed++
+			}
+		}
+	}
+	return retry, failed
+}
@@ -0,0 +1,218 @@
+package opensearch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/orirawlings/soap"
+	"github.com/orirawlings/soap/soaptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bulkEndpoint is a fake bulk API. respond decides the status of each item of
+// a request, 0 fails the whole request with 503.
+type bulkEndpoint struct {
+	mu       sync.Mutex
+	requests [][]map[string]interface{} // lines of each request
+	respond  func(request int, doc map[string]interface{}) int
+}
+
+func (be *bulkEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := map[string]interface{}{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lines = append(lines, line)
+	}
+
+	be.mu.Lock()
+	n := len(be.requests)
+	be.requests = append(be.requests, lines)
+	be.mu.Unlock()
+
+	var (
+		items  []interface{}
+		errors bool
+	)
+	for i := 1; i < len(lines); i += 2 {
+		status := 201
+		if be.respond != nil {
+			status = be.respond(n, lines[i])
+		}
+		if status == 0 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		errors = errors || status >= 300
+		items = append(items, map[string]interface{}{"index": map[string]interface{}{"status": status}})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": errors, "items": items})
+}
+
+func (be *bulkEndpoint) docs() (indices []string, ids []string) {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	for _, lines := range be.requests {
+		for i := 0; i+1 < len(lines); i += 2 {
+			indices = append(indices, lines[i]["index"].(map[string]interface{})["_index"].(string))
+			ids = append(ids, lines[i+1]["id"].(string))
+		}
+	}
+	return
+}
+
+func (be *bulkEndpoint) requestCount() int {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	return len(be.requests)
+}
+
+func record(id string, t time.Time) soap.MessageRecord {
+	return soap.MessageRecord{
+		Time:      t,
+		Direction: soap.MessageRequest,
+		ID:        id,
+		Endpoint:  "http://localhorst.ch/soap",
+		Action:    "MySOAPAction",
+		Body:      []byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body/></Envelope>`),
+	}
+}
+
+var day1 = time.Date(2026, 10, 14, 23, 59, 0, 0, time.UTC)
+
+func TestArchiver(t *testing.T) {
+	t.Run("flush by size", func(t *testing.T) {
+		be := &bulkEndpoint{}
+		srv := httptest.NewServer(be)
+		defer srv.Close()
+		a := New(srv.URL, WithFlush(time.Hour, 3), WithIndex("soap-traffic-2006.01.02"))
+		a.Archive(record("a", day1))
+		a.Archive(record("b", day1))
+		a.Archive(record("c", day1.Add(2*time.Minute)))
+		require.Eventually(t, func() bool { return be.requestCount() == 1 }, time.Second, time.Millisecond)
+		require.NoError(t, a.Close())
+
+		indices, ids := be.docs()
+		assert.Equal(t, []string{"a", "b", "c"}, ids)
+		assert.Equal(t, []string{"soap-traffic-2026.10.14", "soap-traffic-2026.10.14", "soap-traffic-2026.10.15"}, indices)
+		doc := be.requests[0][1]
+		assert.Equal(t, "request", doc["direction"])
+		assert.Equal(t, "MySOAPAction", doc["action"])
+		assert.Equal(t, "2026-10-14T23:59:00Z", doc["@timestamp"])
+		assert.Contains(t, doc["body"], "<Envelope")
+		assert.Zero(t, a.Dropped())
+	})
+
+	t.Run("flush by interval", func(t *testing.T) {
+		be := &bulkEndpoint{}
+		srv := httptest.NewServer(be)
+		defer srv.Close()
+		a := New(srv.URL, WithFlush(5*time.Millisecond, 100))
+		defer a.Close()
+		a.Archive(record("a", day1))
+		require.Eventually(t, func() bool { return be.requestCount() == 1 }, time.Second, time.Millisecond)
+		indices, _ := be.docs()
+		assert.Equal(t, []string{"soap-2026.10.14"}, indices)
+	})
+
+	t.Run("retry with backoff", func(t *testing.T) {
+		be := &bulkEndpoint{respond: func(request int, doc map[string]interface{}) int {
+			switch {
+			case request == 0:
+				return 0 // whole request fails
+			case request == 1 && doc["id"] == "b":
+				return 429
+			case doc["id"] == "c":
+				return 400 // mapping error, not retried
+			}
+			return 201
+		}}
+		srv := httptest.NewServer(be)
+		defer srv.Close()
+		clock := soaptest.NewFakeClock(day1)
+		a := New(srv.URL, WithFlush(time.Hour, 100), WithRetry(3, time.Second), WithClock(clock))
+		a.Archive(record("a", day1))
+		a.Archive(record("b", day1))
+		a.Archive(record("c", day1))
+		require.NoError(t, a.Close())
+
+		require.Equal(t, 3, be.requestCount())
+		_, ids := be.docs()
+		assert.Equal(t, []string{"a", "b", "c", "a", "b", "c", "b"}, ids)
+		assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, clock.Sleeps())
+		assert.Equal(t, uint64(1), a.Dropped())
+	})
+
+	t.Run("give up", func(t *testing.T) {
+		be := &bulkEndpoint{respond: func(int, map[string]interface{}) int { return 0 }}
+		srv := httptest.NewServer(be)
+		defer srv.Close()
+		a := New(srv.URL, WithFlush(time.Hour, 100), WithRetry(2, time.Second), WithClock(soaptest.NewFakeClock(day1)))
+		a.Archive(record("a", day1))
+		a.Archive(record("b", day1))
+		require.NoError(t, a.Close())
+		assert.Equal(t, 2, be.requestCount())
+		assert.Equal(t, uint64(2), a.Dropped())
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		be := &bulkEndpoint{}
+		srv := httptest.NewServer(be)
+		defer srv.Close()
+		a := New(srv.URL, WithFlush(time.Hour, 100), WithBufferSize(2))
+		for i := 0; i < 5; i++ {
+			a.Archive(record(fmt.Sprint(i), day1))
+		}
+		assert.Equal(t, uint64(3), a.Dropped())
+		require.NoError(t, a.Close())
+		_, ids := be.docs()
+		assert.Equal(t, []string{"3", "4"}, ids)
+
+		a.Archive(record("late", day1))
+		assert.Equal(t, uint64(4), a.Dropped())
+	})
+
+	t.Run("Client", func(t *testing.T) {
+		be := &bulkEndpoint{}
+		srv := httptest.NewServer(be)
+		defer srv.Close()
+		soapSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/xml")
+			fmt.Fprint(w, `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body/></Envelope>`)
+		}))
+		defer soapSrv.Close()
+
+		a := New(srv.URL, WithFlush(time.Hour, 100))
+		c := soap.NewClient(soapSrv.URL, nil)
+		c.Archiver = a
+		_, err := c.Call(context.Background(), "MySOAPAction", nil, nil)
+		require.NoError(t, err)
+		require.NoError(t, a.Close())
+
+		require.Equal(t, 1, be.requestCount())
+		lines := be.requests[0]
+		require.Len(t, lines, 4)
+		assert.Equal(t, "request", lines[1]["direction"])
+		assert.Equal(t, "response", lines[3]["direction"])
+		assert.Equal(t, lines[1]["id"], lines[3]["id"])
+		assert.True(t, strings.HasPrefix(lines[3]["body"].(string), "<Envelope"))
+	})
+}
@@ -0,0 +1,214 @@
+package soap
+
+import (
+	"crypto/tls"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// CallOption configures a single call of a Client.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	url         string
+	queryParams url.Values
+	httpHeader  http.Header
+	stats       *CallStats
+	maxPages    int
+
+	timeout        *time.Duration
+	retryPolicy    *RetryPolicy
+	retryPolicySet bool
+
+	features Features   // resolved, see Client.FeatureResolver
+	trace    *CallTrace // set while the Instrumentation traces the call
+
+	envelopeAttrs []xml.Attr
+	bodyAttrs     []xml.Attr
+	headers       []interface{}
+	wsAddressing  *WSAddressing
+	// responseHeader receives the Header of the response, see
+	// WithResponseHeader
+	responseHeader interface{}
+	// unwrapResponse is the local name of the response wrapper element, see
+	// WithUnwrapResponse
+	unwrapResponse string
+
+	attachments *AttachmentReader
+}
+
+// CallStats describes how a call went, see WithCallStats.
+type CallStats struct {
+	// TLS is the state of the connection the response has been received on,
+	// nil for plain HTTP. It is set even if handling the response fails.
+	TLS *tls.ConnectionState
+	// Multipart describes the parts of a multipart response, nil for single
+	// part responses.
+	Multipart *MultipartStats
+	// PolicyKey is the key of Client.Policies applied to the call, "" if none.
+	PolicyKey string
+	// Policy is the effective policy of the call, including call options.
+	Policy CallPolicy
+	// ResponseHeaders are the header blocks of the SOAP Header of the
+	// response, as received. CallExtract doesn't set them.
+	ResponseHeaders []HeaderBlock
+	// MessageID is the WS-Addressing MessageID of the request, see
+	// WSAddressing.
+	MessageID string
+	// IntegrityHash is the hash of the request envelope sent in
+	// Client.IntegrityHeader by the last attempt.
+	IntegrityHash string
+	// Features are the Features in effect for the call, see
+	// Client.FeatureResolver.
+	Features Features
+	// Streamed tells whether the request envelope was streamed, see
+	// Client.StreamThreshold. SizeEstimate is the estimated size of the Body
+	// content it was decided on, 0 if StreamThreshold is not set. Measured
+	// sizes stop at StreamThreshold.
+	Streamed     bool
+	SizeEstimate int64
+}
+
+func newCallOptions(opts []CallOption) *callOptions {
+	o := &callOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.stats == nil {
+		o.stats = &CallStats{}
+	}
+	return o
+}
+
+// WithURL posts a single call to endpoint instead of the URL passed to
+// NewClient, e.g. for tenant specific URLs sharing credentials and headers.
+// Everything else of the Client applies, including QueryParams and its HTTP
+// client. Calls with an endpoint other than an absolute http or https URL
+// fail before the request is marshalled.
+func WithURL(endpoint string) CallOption {
+	return func(o *callOptions) {
+		o.url = endpoint
+	}
+}
+
+// WithQueryParam adds the URL query parameter key with value to a single call.
+// The parameter replaces all values of key given by the endpoint URL or
+// Client.QueryParams. Use it multiple times with the same key for multiple
+// values.
+func WithQueryParam(key, value string) CallOption {
+	return func(o *callOptions) {
+		if o.queryParams == nil {
+			o.queryParams = url.Values{}
+		}
+		o.queryParams.Add(key, value)
+	}
+}
+
+// WithHTTPHeader adds the HTTP header key with value to the request of a single
+// call, e.g. a correlation ID. The header replaces all values of key set by
+// the Client, including those of RequestHeaderFn. Use it multiple times with
+// the same key for multiple values.
+func WithHTTPHeader(key, value string) CallOption {
+	return func(o *callOptions) {
+		if o.httpHeader == nil {
+			o.httpHeader = http.Header{}
+		}
+		o.httpHeader.Add(key, value)
+	}
+}
+
+// WithCallStats makes the call fill stats.
+func WithCallStats(stats *CallStats) CallOption {
+	return func(o *callOptions) {
+		o.stats = stats
+	}
+}
+
+// WithMaxPages limits Paginate to n pages, see DefaultMaxPages. It doesn't
+// affect other calls.
+func WithMaxPages(n int) CallOption {
+	return func(o *callOptions) {
+		o.maxPages = n
+	}
+}
+
+// WithHeaders adds header blocks to the SOAP Header of a single call, after
+// Client.Headers.
+func WithHeaders(headers ...interface{}) CallOption {
+	return func(o *callOptions) {
+		o.headers = append(o.headers, headers...)
+	}
+}
+
+// WithResponseHeader decodes the SOAP Header of the response into dst, a
+// pointer to a struct whose fields are the header blocks, e.g. a session token
+// or a pagination cursor. A response without Header leaves dst untouched.
+// Header blocks as received are in CallStats.ResponseHeaders. CallExtract
+// ignores it, extract "Header/..." paths instead.
+func WithResponseHeader(dst interface{}) CallOption {
+	return func(o *callOptions) {
+		o.responseHeader = dst
+	}
+}
+
+// WithUnwrapResponse tolerates deployments of a service differing in whether
+// the result is wrapped: if the Body element has the local name
+// wrapperLocalName, e.g. "GetQuoteResponse", its single child element, e.g.
+// GetQuoteResult, is decoded into the response, otherwise the Body element
+// itself. A wrapper with more than one child element fails the call, a
+// wrapper without leaves the response untouched. CallExtract ignores it.
+func WithUnwrapResponse(wrapperLocalName string) CallOption {
+	return func(o *callOptions) {
+		o.unwrapResponse = wrapperLocalName
+	}
+}
+
+// WithWSAddressing adds the WS-Addressing header blocks of wsa to a single
+// call, instead of those of Client.WSAddressing.
+func WithWSAddressing(wsa *WSAddressing) CallOption {
+	return func(o *callOptions) {
+		o.wsAddressing = wsa
+	}
+}
+
+// WithAttachments sends the request as multipart/related message with the
+// attachments after the envelope. They are streamed, so the call isn't
+// retried once they have been sent.
+func WithAttachments(attachments *AttachmentReader) CallOption {
+	return func(o *callOptions) {
+		o.attachments = attachments
+	}
+}
+
+// WithEnvelopeAttrs replaces Client.EnvelopeAttrs for a single call.
+func WithEnvelopeAttrs(attrs ...xml.Attr) CallOption {
+	return func(o *callOptions) {
+		o.envelopeAttrs = append([]xml.Attr{}, attrs...)
+	}
+}
+
+// WithBodyAttrs replaces Client.BodyAttrs for a single call.
+func WithBodyAttrs(attrs ...xml.Attr) CallOption {
+	return func(o *callOptions) {
+		o.bodyAttrs = append([]xml.Attr{}, attrs...)
+	}
+}
+
+// WithTimeout bounds a single call including its retries, replacing
+// CallPolicy.Timeout. 0 means no timeout.
+func WithTimeout(d time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = &d
+	}
+}
+
+// WithRetryPolicy replaces Client.RetryPolicy and CallPolicy.Retry for a single
+// call, nil disables retries.
+func WithRetryPolicy(rp *RetryPolicy) CallOption {
+	return func(o *callOptions) {
+		o.retryPolicy = rp
+		o.retryPolicySet = true
+	}
+}
@@ -0,0 +1,50 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// DefaultMaxPages is the number of pages Paginate fetches at most, unless
+// WithMaxPages is given.
+const DefaultMaxPages = 1000
+
+// ErrTooManyPages is returned by Paginate, if next still returns a request
+// after the maximum number of pages.
+var ErrTooManyPages = errors.New("too many pages")
+
+// Paginate calls action with first and then with the requests returned by
+// next for the previous response, until next returns false. Each response is
+// passed to each before next is called. Errors of Call, e.g. SOAP Faults, and
+// of each end the loop immediately and are returned, as is the context error
+// if ctx is done between two pages. opts are passed on to every call, use
+// WithMaxPages to change the limit of DefaultMaxPages guarding against
+// endless loops.
+func Paginate[Req, Resp any](ctx context.Context, c *Client, action string, first *Req, next func(prevResp *Resp) (*Req, bool), each func(*Resp) error, opts ...CallOption) error {
+	maxPages := newCallOptions(opts).maxPages
+	if maxPages <= 0 {
+		maxPages = DefaultMaxPages
+	}
+
+	request := first
+	for page := 1; ; page++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		response := new(Resp)
+		if _, err := c.Call(ctx, action, request, response, opts...); err != nil {
+			return fmt.Errorf("page %d: %w", page, err)
+		}
+		if err := each(response); err != nil {
+			return err
+		}
+		var ok bool
+		if request, ok = next(response); !ok {
+			return nil
+		}
+		if page >= maxPages {
+			return fmt.Errorf("%w: more than %d", ErrTooManyPages, maxPages)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pageRequest struct {
+	XMLName xml.Name `xml:"pageRequest"`
+	Cursor  string   `xml:"cursor"`
+}
+
+type pageResponse struct {
+	XMLName xml.Name `xml:"pageResponse"`
+	Items   []string `xml:"item"`
+	Next    string   `xml:"next"`
+}
+
+func TestPaginate(t *testing.T) {
+	const pages = 3
+	var calls int
+	soapSrv := NewServer()
+	soapSrv.RegisterHandler("/list", "list", "pageRequest",
+		func() interface{} {
+			return &pageRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			calls++
+			cursor := request.(*pageRequest).Cursor
+			if cursor == "fail" {
+				return nil, errors.New("invalid cursor")
+			}
+			page, _ := strconv.Atoi(cursor)
+			response := &pageResponse{Items: []string{"item " + strconv.Itoa(page)}}
+			if page < pages-1 {
+				response.Next = strconv.Itoa(page + 1)
+			}
+			return response, nil
+		},
+	)
+	c := NewClient("http://in-process/list", nil)
+	c.HTTPClientDoFn = NewLoopback(soapSrv)
+
+	next := func(prev *pageResponse) (*pageRequest, bool) {
+		return &pageRequest{Cursor: prev.Next}, prev.Next != ""
+	}
+
+	t.Run("all pages", func(t *testing.T) {
+		calls = 0
+		var items []string
+		err := Paginate(context.Background(), c, "list", &pageRequest{Cursor: "0"}, next, func(resp *pageResponse) error {
+			items = append(items, resp.Items...)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Exactly(t, []string{"item 0", "item 1", "item 2"}, items)
+		assert.Exactly(t, pages, calls)
+	})
+
+	t.Run("fault", func(t *testing.T) {
+		calls = 0
+		err := Paginate(context.Background(), c, "list", &pageRequest{Cursor: "0"},
+			func(prev *pageResponse) (*pageRequest, bool) {
+				return &pageRequest{Cursor: "fail"}, true
+			},
+			func(resp *pageResponse) error { return nil },
+		)
+		var fe *FaultError
+		require.ErrorAs(t, err, &fe)
+		assert.Exactly(t, "invalid cursor", fe.Fault.String)
+		assert.Exactly(t, 2, calls)
+	})
+
+	t.Run("each fails", func(t *testing.T) {
+		calls = 0
+		stop := errors.New("stop")
+		err := Paginate(context.Background(), c, "list", &pageRequest{Cursor: "0"}, next, func(resp *pageResponse) error {
+			return stop
+		})
+		assert.ErrorIs(t, err, stop)
+		assert.Exactly(t, 1, calls)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		calls = 0
+		ctx, cancel := context.WithCancel(context.Background())
+		err := Paginate(ctx, c, "list", &pageRequest{Cursor: "0"}, next, func(resp *pageResponse) error {
+			cancel()
+			return nil
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Exactly(t, 1, calls)
+	})
+
+	t.Run("max pages", func(t *testing.T) {
+		calls = 0
+		err := Paginate(context.Background(), c, "list", &pageRequest{Cursor: "0"},
+			func(prev *pageResponse) (*pageRequest, bool) {
+				return &pageRequest{Cursor: "0"}, true
+			},
+			func(resp *pageResponse) error { return nil },
+			WithMaxPages(5),
+		)
+		assert.ErrorIs(t, err, ErrTooManyPages)
+		assert.Exactly(t, 5, calls)
+	})
+}
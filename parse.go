@@ -0,0 +1,102 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseOption configures ParseEnvelope.
+type ParseOption func(*parseOptions)
+
+type parseOptions struct {
+	bodyFactory        func() interface{}
+	faultDetailFactory func() interface{}
+}
+
+// WithBodyFactory makes ParseEnvelope decode the Body content into the value
+// returned by f, which must be a pointer.
+func WithBodyFactory(f func() interface{}) ParseOption {
+	return func(o *parseOptions) {
+		o.bodyFactory = f
+	}
+}
+
+// WithFaultDetailFactory makes ParseEnvelope decode the content of the detail
+// element of a Fault into the value returned by f, which must be a pointer,
+// see Fault.DetailContent.
+func WithFaultDetailFactory(f func() interface{}) ParseOption {
+	return func(o *parseOptions) {
+		o.faultDetailFactory = f
+	}
+}
+
+// ParseEnvelope decodes a SOAP 1.1 or 1.2 envelope, e.g. taken from a queue.
+// Without WithBodyFactory the Body content is skipped, SOAP Faults are decoded
+// anyway.
+func ParseEnvelope(r io.Reader, opts ...ParseOption) (*Envelope, error) {
+	o := &parseOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	env := &EnvelopeV2{}
+	if o.bodyFactory != nil {
+		env.Body.Content = o.bodyFactory()
+	}
+	if err := xml.NewDecoder(r).Decode(env); err != nil {
+		return nil, err
+	}
+	if fault := env.Body.Fault; fault != nil && o.faultDetailFactory != nil && len(fault.DetailRaw) > 0 {
+		detail := o.faultDetailFactory()
+		if err := xml.NewDecoder(bytes.NewReader(fault.DetailRaw)).Decode(detail); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("could not decode fault detail: %w", err)
+		}
+		fault.Detail = detail
+	}
+	return EnvelopeFromV2(env), nil
+}
+
+// MarshalEnvelope encodes envelope for soapVersion, SoapVersion11 or
+// SoapVersion12. Faults are written in the layout of the version.
+func MarshalEnvelope(envelope *Envelope, soapVersion string) ([]byte, error) {
+	return xml.Marshal(EnvelopeToV2(envelope, soapVersion))
+}
+
+// UnmarshalXML decodes SOAP 1.1 and, with namespaces replaced by SOAP 1.1
+// ones, SOAP 1.2 Faults.
+func (f *Fault) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	fv := &FaultV2{}
+	soap12, err := fv.decode(d, start)
+	if err != nil {
+		return err
+	}
+	if soap12 && start.Name.Space == NamespaceSoap11 {
+		// Undo the namespace replacement in role URIs, e.g. .../role/next.
+		fv.Role = unreplaceNamespace(fv.Role)
+		fv.Node = unreplaceNamespace(fv.Node)
+	}
+	*f = *FaultFromV2(fv, "")
+	f.XMLName = start.Name
+	f.soap12 = soap12
+	return nil
+}
+
+// unreplaceNamespace restores the SOAP 1.2 namespace in uri, which was
+// replaced by the SOAP 1.1 one for decoding.
+func unreplaceNamespace(uri string) string {
+	if strings.HasPrefix(uri, NamespaceSoap11) {
+		return NamespaceSoap12 + strings.TrimPrefix(uri, NamespaceSoap11)
+	}
+	return uri
+}
+
+// MarshalXML writes DetailContent, if set, instead of Detail.
+func (f Fault) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	version := SoapVersion11
+	if f.soap12 {
+		version = SoapVersion12
+	}
+	return FaultToV2(&f).encode(e, version)
+}
@@ -0,0 +1,97 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type accountDetail struct {
+	XMLName xml.Name `xml:"urn:bank AccountFault"`
+	Account string   `xml:"urn:bank Account"`
+	Reason  string   `xml:"urn:bank Reason"`
+}
+
+func TestParseEnvelope(t *testing.T) {
+	tests := []struct {
+		name        string
+		soapVersion string
+		envelope    string
+	}{
+		{
+			name:        "1.1",
+			soapVersion: SoapVersion11,
+			envelope: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>
+<faultcode>soap:Client</faultcode><faultstring>account locked</faultstring><faultactor>urn:bank:ledger</faultactor>
+<detail><b:AccountFault xmlns:b="urn:bank"><b:Account>CH93-0076</b:Account><b:Reason>fraud</b:Reason></b:AccountFault></detail>
+</soap:Fault></soap:Body></soap:Envelope>`,
+		},
+		{
+			name:        "1.2",
+			soapVersion: SoapVersion12,
+			envelope: `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body><env:Fault>
+<env:Code><env:Value>soap:Client</env:Value></env:Code><env:Reason><env:Text xml:lang="en">account locked</env:Text></env:Reason>
+<env:Role>urn:bank:ledger</env:Role>
+<env:Detail><b:AccountFault xmlns:b="urn:bank"><b:Account>CH93-0076</b:Account><b:Reason>fraud</b:Reason></b:AccountFault></env:Detail>
+</env:Fault></env:Body></env:Envelope>`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parse := func(data string) *Envelope {
+				envelope, err := ParseEnvelope(strings.NewReader(data),
+					WithBodyFactory(func() interface{} { return &FooResponse{} }),
+					WithFaultDetailFactory(func() interface{} { return &accountDetail{} }),
+				)
+				require.NoError(t, err)
+				return envelope
+			}
+			envelope := parse(test.envelope)
+			fault := envelope.Body.Fault
+			require.NotNil(t, fault)
+			assert.Nil(t, envelope.Body.Content)
+			assert.Equal(t, "soap:Client", fault.Code)
+			assert.Equal(t, "account locked", fault.String)
+			assert.Equal(t, "urn:bank:ledger", fault.Actor)
+			require.IsType(t, &accountDetail{}, fault.DetailContent)
+			assert.Equal(t, "CH93-0076", fault.DetailContent.(*accountDetail).Account)
+			assert.Equal(t, "fraud", fault.DetailContent.(*accountDetail).Reason)
+
+			data, err := MarshalEnvelope(envelope, test.soapVersion)
+			require.NoError(t, err)
+			if test.soapVersion == SoapVersion12 {
+				assert.Contains(t, string(data), NamespaceSoap12)
+				assert.NotContains(t, string(data), NamespaceSoap11)
+				assert.Contains(t, string(data), "Reason>")
+			} else {
+				assert.Contains(t, string(data), "<faultstring>")
+			}
+			again := parse(string(data))
+			assert.Equal(t, fault.Code, again.Body.Fault.Code)
+			assert.Equal(t, fault.String, again.Body.Fault.String)
+			assert.Equal(t, fault.Actor, again.Body.Fault.Actor)
+			assert.Equal(t, fault.DetailContent, again.Body.Fault.DetailContent)
+		})
+	}
+
+	t.Run("body", func(t *testing.T) {
+		envelope, err := ParseEnvelope(strings.NewReader(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+<Body><fooResponse><Bar>ok</Bar></fooResponse></Body></Envelope>`),
+			WithBodyFactory(func() interface{} { return &FooResponse{} }))
+		require.NoError(t, err)
+		assert.Nil(t, envelope.Body.Fault)
+		assert.Equal(t, &FooResponse{Bar: "ok"}, envelope.Body.Content)
+	})
+
+	t.Run("without factories", func(t *testing.T) {
+		envelope, err := ParseEnvelope(bytes.NewReader([]byte(tests[0].envelope)))
+		require.NoError(t, err)
+		assert.Nil(t, envelope.Body.Content)
+		assert.Nil(t, envelope.Body.Fault.DetailContent)
+		assert.Equal(t, "account locked", envelope.Body.Fault.String)
+	})
+}
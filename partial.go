@@ -0,0 +1,92 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// PartialResultMode selects how the Client handles response Bodies holding
+// both a result and a Fault, which some aggregating services send although
+// SOAP doesn't allow it, see Client.PartialResultMode.
+type PartialResultMode int
+
+const (
+	// PartialResultBoth decodes the result into the response and returns a
+	// *PartialResultError (default).
+	PartialResultBoth PartialResultMode = iota
+	// PartialResultPreferFault returns the *FaultError, as for a Body holding
+	// just the Fault. The response is decoded nevertheless.
+	PartialResultPreferFault
+	// PartialResultPreferResult decodes the result and drops the Faults.
+	PartialResultPreferResult
+)
+
+// PartialResultError is returned for a response Body holding both a result,
+// which has been decoded into the response passed to Call, and Faults. It
+// unwraps to the *FaultError of the first Fault.
+type PartialResultError struct {
+	// Response is the response passed to Call.
+	Response interface{}
+	// Faults are all Faults of the Body in document order.
+	Faults []*Fault
+	Err    *FaultError
+}
+
+func (pe *PartialResultError) Error() string {
+	return fmt.Sprintf("partial result with %d faults: %s", len(pe.Faults), pe.Err)
+}
+
+func (pe *PartialResultError) Unwrap() error {
+	return pe.Err
+}
+
+var errFaultWithResult = errors.New("response mixes a SOAP Fault with other Body content")
+
+// checkBodyFaults returns errFaultWithResult if the Body of envelope holds a
+// Fault together with other elements, including more Faults.
+func checkBodyFaults(envelope []byte) error {
+	if !bytes.Contains(envelope, []byte("Fault")) {
+		return nil
+	}
+	d := xml.NewDecoder(bytes.NewReader(envelope))
+	var (
+		depth    int
+		inBody   bool
+		children int
+		faults   int
+	)
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch tt := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				inBody = tt.Name.Local == "Body"
+			}
+			if depth != 3 || !inBody {
+				continue
+			}
+			children++
+			if tt.Name.Local == "Fault" && (tt.Name.Space == NamespaceSoap11 || tt.Name.Space == NamespaceSoap12) {
+				faults++
+			}
+			if faults > 0 && children > 1 {
+				return errFaultWithResult
+			}
+		case xml.EndElement:
+			depth--
+			if depth == 1 && tt.Name.Local == "Body" {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Call_partialResult(t *testing.T) {
+	aggregator, err := ioutil.ReadFile("testdata/faults/aggregator.partial.response.xml")
+	require.NoError(t, err)
+	faultFirst := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>
+<soap:Fault><faultcode>soap:Server</faultcode><faultstring>inventory timed out</faultstring></soap:Fault>
+<FooResponse><Bar>partial</Bar></FooResponse></soap:Body></soap:Envelope>`
+
+	for name, tc := range map[string]struct {
+		body       string
+		mode       PartialResultMode
+		wantBar    string
+		wantFaults []string
+		wantErr    string // "" if no error is expected
+	}{
+		"aggregator": {
+			body:       string(aggregator),
+			wantBar:    "3 of 4 sub-operations succeeded",
+			wantFaults: []string{"sub-operation inventory timed out", "sub-operation pricing rejected the currency"},
+			wantErr:    "partial",
+		},
+		"fault first": {
+			body:       faultFirst,
+			wantBar:    "partial",
+			wantFaults: []string{"inventory timed out"},
+			wantErr:    "partial",
+		},
+		"prefer fault": {
+			body:    string(aggregator),
+			mode:    PartialResultPreferFault,
+			wantBar: "3 of 4 sub-operations succeeded",
+			wantErr: "fault",
+		},
+		"prefer result": {
+			body:    string(aggregator),
+			mode:    PartialResultPreferResult,
+			wantBar: "3 of 4 sub-operations succeeded",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewClient("http://localhorst.ch", nil)
+			c.PartialResultMode = tc.mode
+			c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(tc.body))}, nil
+			})}).Do
+
+			response := &FooResponse{}
+			httpResponse, err := c.Call(context.Background(), "aggregate", &FooRequest{}, response)
+			assert.NotNil(t, httpResponse)
+			assert.Equal(t, tc.wantBar, response.Bar)
+
+			var pe *PartialResultError
+			var fe *FaultError
+			switch tc.wantErr {
+			case "":
+				assert.NoError(t, err)
+			case "fault":
+				require.True(t, errors.As(err, &fe), "%v", err)
+				assert.False(t, errors.As(err, &pe))
+				assert.Equal(t, "sub-operation inventory timed out", fe.Fault.String)
+			case "partial":
+				require.True(t, errors.As(err, &pe), "%v", err)
+				assert.Equal(t, ErrorKindApplication, KindOf(err))
+				assert.Same(t, response, pe.Response)
+				var faults []string
+				for _, f := range pe.Faults {
+					faults = append(faults, f.String)
+				}
+				assert.Equal(t, tc.wantFaults, faults)
+				require.True(t, errors.As(err, &fe), "a partial result unwraps to the fault")
+				assert.Equal(t, tc.wantFaults[0], fe.Fault.String)
+				assert.True(t, strings.HasPrefix(string(fe.Raw), "<soap"), "%s", fe.Raw)
+				assert.Contains(t, string(fe.Raw), tc.wantFaults[0])
+			}
+		})
+	}
+}
+
+func TestClient_Call_multipleFaults(t *testing.T) {
+	c := NewClient("http://localhorst.ch", nil)
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 500, Body: ioutil.NopCloser(strings.NewReader(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>
+<soap:Fault><faultcode>soap:Server</faultcode><faultstring>first</faultstring></soap:Fault>
+<soap:Fault><faultcode>soap:Server</faultcode><faultstring>second</faultstring></soap:Fault>
+</soap:Body></soap:Envelope>`))}, nil
+	})}).Do
+
+	_, err := c.Call(context.Background(), "aggregate", &FooRequest{}, &FooResponse{})
+	var fe *FaultError
+	require.True(t, errors.As(err, &fe), "%v", err)
+	assert.Equal(t, "first", fe.Fault.String)
+	var pe *PartialResultError
+	assert.False(t, errors.As(err, &pe), "there is no result")
+}
+
+// aggregateResponse is a Body of a result and a Fault.
+type aggregateResponse struct{}
+
+func (aggregateResponse) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	if err := e.Encode(&FooResponse{Bar: "partial"}); err != nil {
+		return err
+	}
+	return e.Encode(NewFault("soap:Server", "inventory timed out"))
+}
+
+func TestServer_UnsafePartialResults(t *testing.T) {
+	soapSrv := NewServer()
+	soapSrv.RegisterHandler("/pathTo", "aggregate", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			return aggregateResponse{}, nil
+		},
+	)
+	srv := httptest.NewServer(soapSrv)
+	defer srv.Close()
+	c := NewClient(srv.URL+"/pathTo", nil)
+
+	response := &FooResponse{}
+	_, err := c.Call(context.Background(), "aggregate", &FooRequest{}, response)
+	var fe *FaultError
+	require.True(t, errors.As(err, &fe), "%v", err)
+	assert.Equal(t, errFaultWithResult.Error(), fe.Fault.String)
+	var pe *PartialResultError
+	assert.False(t, errors.As(err, &pe), "the body has been refused")
+
+	soapSrv.UnsafePartialResults = true
+	_, err = c.Call(context.Background(), "aggregate", &FooRequest{}, response)
+	require.True(t, errors.As(err, &pe), "%v", err)
+	assert.Equal(t, "partial", response.Bar)
+	assert.Equal(t, "inventory timed out", pe.Err.Fault.String)
+}
+
+func TestCheckBodyFaults(t *testing.T) {
+	const fault = `<soap:Fault><faultcode>soap:Server</faultcode><faultstring>boom</faultstring></soap:Fault>`
+	for name, tc := range map[string]struct {
+		body    string
+		wantErr error
+	}{
+		"fault":                  {body: `<soap:Body>` + fault + `</soap:Body>`},
+		"header block and fault": {body: `<soap:Header><Session xmlns="urn:example">s</Session></soap:Header><soap:Body>` + fault + `</soap:Body>`},
+		"result":                 {body: `<soap:Header><Session xmlns="urn:example">s</Session></soap:Header><soap:Body><FooResponse/></soap:Body>`},
+		"result and fault":       {body: `<soap:Body><FooResponse/>` + fault + `</soap:Body>`, wantErr: errFaultWithResult},
+		"two faults":             {body: `<soap:Header/><soap:Body>` + fault + fault + `</soap:Body>`, wantErr: errFaultWithResult},
+	} {
+		t.Run(name, func(t *testing.T) {
+			envelope := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">` + tc.body + `</soap:Envelope>`
+			assert.Equal(t, tc.wantErr, checkBodyFaults([]byte(envelope)))
+		})
+	}
+}
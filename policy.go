@@ -0,0 +1,115 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"sync"
+	"time"
+)
+
+// DefaultPolicy is the key of Client.Policies for actions without a policy of
+// their own.
+const DefaultPolicy = "*"
+
+// CallPolicy configures the calls of an action, see Client.Policies. Call
+// options, e.g. WithTimeout, take precedence.
+type CallPolicy struct {
+	// Timeout bounds a call including its retries, 0 means no timeout.
+	Timeout time.Duration
+	// Retry replaces Client.RetryPolicy, nil keeps it.
+	Retry *RetryPolicy
+	// RateLimit is the maximum number of calls of the action per second, 0
+	// means no limit. Calls wait for their turn.
+	RateLimit float64
+	// Idempotent allows retries, calls of other actions are attempted once.
+	Idempotent bool
+	// ResponseHeaders are the requirements for header blocks of successful
+	// responses by name, see HeaderRequirement. They aren't checked by
+	// CallExtract.
+	ResponseHeaders map[xml.Name]HeaderRequirement
+}
+
+// rateLimiters spaces the calls of actions with a CallPolicy.RateLimit.
+type rateLimiters struct {
+	mu   sync.Mutex
+	next map[string]time.Time // earliest start of the next call by action
+}
+
+// wait waits for the turn of a call of action limited to rate calls per
+// second.
+func (rl *rateLimiters) wait(ctx context.Context, clock Clock, action string, rate float64) error {
+	interval := time.Duration(float64(time.Second) / rate)
+	rl.mu.Lock()
+	now := clock.Now()
+	start := rl.next[action]
+	if start.Before(now) {
+		start = now
+	}
+	if rl.next == nil {
+		rl.next = map[string]time.Time{}
+	}
+	rl.next[action] = start.Add(interval)
+	rl.mu.Unlock()
+	if d := start.Sub(now); d > 0 {
+		return clock.Sleep(ctx, d)
+	}
+	return nil
+}
+
+// policy returns the key and the CallPolicy of Client.Policies for action.
+func (c *Client) policy(action string) (string, CallPolicy, bool) {
+	if policy, ok := c.Policies[action]; ok {
+		return action, policy, true
+	}
+	policy, ok := c.Policies[DefaultPolicy]
+	return DefaultPolicy, policy, ok
+}
+
+// applyPolicy resolves the effective policy of a call of action into o, waits
+// for the rate limit and returns the context bounded by its timeout.
+func (c *Client) applyPolicy(ctx context.Context, action string, o *callOptions) (context.Context, context.CancelFunc, error) {
+	key, ok := c.resolvePolicy(action, o)
+	effective := o.stats.Policy
+	if c.Log != nil && ok {
+		c.Log("Policy", "action", action, "policy", key, "timeout", effective.Timeout,
+			"retry", effective.Retry != nil, "rate_limit", effective.RateLimit)
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if effective.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, effective.Timeout)
+	}
+	if effective.RateLimit > 0 && c.limiters != nil {
+		if err := c.limiters.wait(ctx, clockOrDefault(c.Clock), action, effective.RateLimit); err != nil {
+			cancel()
+			return nil, nil, transportError(err)
+		}
+	}
+	return ctx, cancel, nil
+}
+
+// resolvePolicy resolves the effective policy of a call of action into o and
+// returns the key of Client.Policies it is based on, if any.
+func (c *Client) resolvePolicy(action string, o *callOptions) (string, bool) {
+	key, policy, ok := c.policy(action)
+	effective := CallPolicy{Retry: c.RetryPolicy}
+	if ok {
+		o.stats.PolicyKey = key
+		effective = policy
+		if policy.Retry == nil {
+			effective.Retry = c.RetryPolicy
+		}
+		if !policy.Idempotent {
+			effective.Retry = nil
+		}
+	}
+	if o.timeout != nil {
+		effective.Timeout = *o.timeout
+	}
+	if o.retryPolicySet {
+		effective.Retry = o.retryPolicy
+	}
+	o.retryPolicy = effective.Retry
+	o.stats.Policy = effective
+	return key, ok
+}
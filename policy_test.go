@@ -0,0 +1,112 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Policies(t *testing.T) {
+	getStatus := CallPolicy{Timeout: 2 * time.Second, Retry: &RetryPolicy{MaxAttempts: 3}, Idempotent: true}
+	newClient := func(attempts *int) *Client {
+		c := NewClient("http://localhorst.ch", nil)
+		c.Clock = &sleepRecorder{}
+		c.RetryPolicy = &RetryPolicy{MaxAttempts: 2}
+		c.Policies = map[string]CallPolicy{
+			"SubmitOrder": {Timeout: 10 * time.Second},
+			"GetStatus":   getStatus,
+			DefaultPolicy: {Idempotent: true},
+		}
+		c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+			*attempts++
+			return nil, syscall.ECONNREFUSED
+		})}).Do
+		return c
+	}
+
+	tests := []struct {
+		action       string
+		opts         []CallOption
+		wantAttempts int
+		wantKey      string
+		wantPolicy   CallPolicy
+	}{
+		{action: "SubmitOrder", wantAttempts: 1, wantKey: "SubmitOrder", wantPolicy: CallPolicy{Timeout: 10 * time.Second}},
+		{action: "GetStatus", wantAttempts: 3, wantKey: "GetStatus", wantPolicy: getStatus},
+		{action: "Other", wantAttempts: 2, wantKey: DefaultPolicy, wantPolicy: CallPolicy{Retry: &RetryPolicy{MaxAttempts: 2}, Idempotent: true}},
+		{
+			action:       "GetStatus",
+			opts:         []CallOption{WithRetryPolicy(nil), WithTimeout(time.Second)},
+			wantAttempts: 1,
+			wantKey:      "GetStatus",
+			wantPolicy:   CallPolicy{Timeout: time.Second, Idempotent: true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.action, func(t *testing.T) {
+			var (
+				attempts int
+				stats    CallStats
+			)
+			c := newClient(&attempts)
+			_, err := c.Call(context.Background(), test.action, &FooRequest{}, &FooResponse{}, append(test.opts, WithCallStats(&stats))...)
+			assert.Error(t, err)
+			assert.Equal(t, test.wantAttempts, attempts)
+			assert.Equal(t, test.wantKey, stats.PolicyKey)
+			assert.Equal(t, test.wantPolicy, stats.Policy)
+		})
+	}
+
+	t.Run("without policies", func(t *testing.T) {
+		var (
+			attempts int
+			stats    CallStats
+		)
+		c := newClient(&attempts)
+		c.Policies = nil
+		c.Call(context.Background(), "SubmitOrder", &FooRequest{}, &FooResponse{}, WithCallStats(&stats))
+		assert.Equal(t, 2, attempts)
+		assert.Empty(t, stats.PolicyKey)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		c := NewClient("http://localhorst.ch", nil)
+		c.Policies = map[string]CallPolicy{DefaultPolicy: {Timeout: 10 * time.Millisecond}}
+		c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+			<-r.Context().Done()
+			return nil, r.Context().Err()
+		})}).Do
+		_, err := c.Call(context.Background(), "Slow", &FooRequest{}, &FooResponse{})
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), "got %v", err)
+
+		start := time.Now()
+		_, err = c.Call(context.Background(), "Slow", &FooRequest{}, &FooResponse{}, WithTimeout(50*time.Millisecond))
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		clock := &sleepRecorder{now: time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)}
+		c := NewClient("http://localhorst.ch", nil)
+		c.Clock = clock
+		c.Policies = map[string]CallPolicy{"GetStatus": {RateLimit: 2}}
+		c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(faultResponse("soap:Server", "busy"))}).Do
+		for i := 0; i < 3; i++ {
+			c.Call(context.Background(), "GetStatus", &FooRequest{}, &FooResponse{})
+		}
+		c.Call(context.Background(), "Other", &FooRequest{}, &FooResponse{})
+		assert.Equal(t, []time.Duration{500 * time.Millisecond, 500 * time.Millisecond}, clock.sleeps)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := c.Call(ctx, "GetStatus", &FooRequest{}, &FooResponse{})
+		require.Error(t, err)
+		assert.Equal(t, ErrorKindTransport, KindOf(err))
+	})
+}
@@ -0,0 +1,98 @@
+package soap
+
+import (
+	"net/http"
+	"strings"
+)
+
+// PreDispatchErrorMode selects how the Server responds to requests it rejects
+// before a handler runs, see Server.PreDispatchErrorMode.
+type PreDispatchErrorMode int
+
+const (
+	// PreDispatchErrorFault responds with a SOAP Fault envelope (default).
+	PreDispatchErrorFault PreDispatchErrorMode = iota
+	// PreDispatchErrorPlain responds with a plain text HTTP error using the
+	// StatusCode of the PreDispatchError.
+	PreDispatchErrorPlain
+	// PreDispatchErrorCustom leaves the response to
+	// Server.PreDispatchErrorFn, it falls back to PreDispatchErrorFault if
+	// that is nil.
+	PreDispatchErrorCustom
+)
+
+// PreDispatchReason tells why a request has been rejected before dispatch.
+type PreDispatchReason string
+
+// Reasons for rejecting requests before dispatch.
+const (
+	PreDispatchMethodNotAllowed     PreDispatchReason = "method_not_allowed"
+	PreDispatchUnsupportedMediaType PreDispatchReason = "unsupported_media_type"
+	PreDispatchVersionMismatch      PreDispatchReason = "version_mismatch" // a SOAP 1.2 request to a SOAP 1.1 server
+	PreDispatchBodyTooLarge         PreDispatchReason = "body_too_large"
+	PreDispatchReadFailed           PreDispatchReason = "read_failed"
+	PreDispatchUnknownPath          PreDispatchReason = "unknown_path"
+	PreDispatchUnknownAction        PreDispatchReason = "unknown_action"
+	PreDispatchMalformedEnvelope    PreDispatchReason = "malformed_envelope"
+	PreDispatchNoHandler            PreDispatchReason = "no_handler"
+	PreDispatchInvalidValue         PreDispatchReason = "invalid_value" // see Server.ValidateEnums
+)
+
+// preDispatchStatusCodes are the status codes of the PreDispatchReasons.
+var preDispatchStatusCodes = map[PreDispatchReason]int{
+	PreDispatchMethodNotAllowed:     http.StatusMethodNotAllowed,
+	PreDispatchUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	PreDispatchVersionMismatch:      http.StatusBadRequest,
+	PreDispatchBodyTooLarge:         http.StatusRequestEntityTooLarge,
+	PreDispatchReadFailed:           http.StatusBadRequest,
+	PreDispatchUnknownPath:          http.StatusNotFound,
+	PreDispatchUnknownAction:        http.StatusBadRequest,
+	PreDispatchMalformedEnvelope:    http.StatusBadRequest,
+	PreDispatchNoHandler:            http.StatusBadRequest,
+	PreDispatchInvalidValue:         http.StatusBadRequest,
+}
+
+// PreDispatchError describes a request rejected before dispatch.
+type PreDispatchError struct {
+	Reason     PreDispatchReason
+	StatusCode int // the status code for plain HTTP errors
+	Err        error
+}
+
+func (pe PreDispatchError) Error() string {
+	return pe.Err.Error()
+}
+
+func (pe PreDispatchError) Unwrap() error {
+	return pe.Err
+}
+
+// reject responds to a request rejected before dispatch according to the
+// PreDispatchErrorMode and returns the error describing it.
+func (s *Server) reject(w http.ResponseWriter, r *http.Request, reason PreDispatchReason, err error) error {
+	if reason == PreDispatchReadFailed || reason == PreDispatchMalformedEnvelope {
+		// http.MaxBytesReader doesn't export its error before Go 1.19
+		if strings.HasSuffix(err.Error(), "http: request body too large") {
+			reason = PreDispatchBodyTooLarge
+		}
+	}
+	if reason == PreDispatchMethodNotAllowed {
+		w.Header().Set("Allow", http.MethodPost)
+	}
+	pe := PreDispatchError{
+		Reason:     reason,
+		StatusCode: preDispatchStatusCodes[reason],
+		Err:        err,
+	}
+	switch {
+	case s.PreDispatchErrorMode == PreDispatchErrorPlain:
+		s.log("rejecting request:", err)
+		http.Error(w, err.Error(), pe.StatusCode)
+	case s.PreDispatchErrorMode == PreDispatchErrorCustom && s.PreDispatchErrorFn != nil:
+		s.log("rejecting request:", err)
+		s.PreDispatchErrorFn(w, r, pe)
+	default:
+		s.handleError(r.Context(), err, w)
+	}
+	return pe
+}
@@ -0,0 +1,155 @@
+package soap
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_PreDispatchErrorMode(t *testing.T) {
+	soapSrv := NewServer()
+	soapSrv.MaxRequestBytes = 512
+	soapSrv.RegisterHandler("/pathTo", "testPostAction", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			return &FooResponse{Bar: "ok"}, nil
+		},
+	)
+	soapSrv.RegisterHandler("/pathTo", "upload", "blob",
+		func() interface{} {
+			return &blobRequest{started: make(chan struct{})}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			return &FooResponse{Bar: "ok"}, nil
+		},
+		StreamBody(),
+	)
+
+	const envelope = `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body>%s</Body></Envelope>`
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		action     string
+		body       string
+		wantReason PreDispatchReason
+	}{
+		{
+			name:       "GET",
+			method:     "GET",
+			path:       "/pathTo",
+			wantReason: PreDispatchMethodNotAllowed,
+		},
+		{
+			name:       "too large",
+			path:       "/pathTo",
+			action:     "testPostAction",
+			body:       strings.Replace(envelope, "%s", "<fooRequest><Foo>"+strings.Repeat("foo", 512)+"</Foo></fooRequest>", 1),
+			wantReason: PreDispatchBodyTooLarge,
+		},
+		{
+			name:       "too large streaming",
+			path:       "/pathTo",
+			action:     "upload",
+			body:       strings.Replace(envelope, "%s", "<blob>"+strings.Repeat("QUJD", 512)+"</blob>", 1),
+			wantReason: PreDispatchBodyTooLarge,
+		},
+		{
+			name:       "unknown path",
+			path:       "/unknown",
+			action:     "testPostAction",
+			body:       strings.Replace(envelope, "%s", "<fooRequest/>", 1),
+			wantReason: PreDispatchUnknownPath,
+		},
+		{
+			name:       "unknown action",
+			path:       "/pathTo",
+			action:     "unknown",
+			body:       strings.Replace(envelope, "%s", "<fooRequest/>", 1),
+			wantReason: PreDispatchUnknownAction,
+		},
+		{
+			name:       "malformed envelope",
+			path:       "/pathTo",
+			action:     "testPostAction",
+			body:       `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body>`,
+			wantReason: PreDispatchMalformedEnvelope,
+		},
+		{
+			name:       "malformed streaming envelope",
+			path:       "/pathTo",
+			action:     "upload",
+			body:       `<html><body/></html>`,
+			wantReason: PreDispatchMalformedEnvelope,
+		},
+		{
+			name:       "no handler",
+			path:       "/pathTo",
+			action:     "testPostAction",
+			body:       strings.Replace(envelope, "%s", "<barRequest/>", 1),
+			wantReason: PreDispatchNoHandler,
+		},
+	}
+
+	serve := func(method, path, action, body string) *httptest.ResponseRecorder {
+		if method == "" {
+			method = "POST"
+		}
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("SOAPAction", action)
+		w := httptest.NewRecorder()
+		soapSrv.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Run("fault", func(t *testing.T) {
+				soapSrv.PreDispatchErrorMode = PreDispatchErrorFault
+				w := serve(test.method, test.path, test.action, test.body)
+				assert.Exactly(t, http.StatusOK, w.Code)
+				responseEnvelope := &Envelope{Body: Body{Content: &dummyContent{}}}
+				require.NoError(t, xml.Unmarshal(w.Body.Bytes(), responseEnvelope))
+				assert.NotNil(t, responseEnvelope.Body.Fault)
+			})
+
+			t.Run("plain", func(t *testing.T) {
+				soapSrv.PreDispatchErrorMode = PreDispatchErrorPlain
+				w := serve(test.method, test.path, test.action, test.body)
+				assert.Exactly(t, preDispatchStatusCodes[test.wantReason], w.Code)
+				assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+				assert.NotContains(t, w.Body.String(), "Envelope")
+			})
+
+			t.Run("custom", func(t *testing.T) {
+				soapSrv.PreDispatchErrorMode = PreDispatchErrorCustom
+				var got PreDispatchError
+				soapSrv.PreDispatchErrorFn = func(w http.ResponseWriter, r *http.Request, reason PreDispatchError) {
+					got = reason
+					w.WriteHeader(http.StatusTeapot)
+				}
+				defer func() { soapSrv.PreDispatchErrorFn = nil }()
+				w := serve(test.method, test.path, test.action, test.body)
+				assert.Exactly(t, http.StatusTeapot, w.Code)
+				assert.Exactly(t, test.wantReason, got.Reason)
+				assert.Exactly(t, preDispatchStatusCodes[test.wantReason], got.StatusCode)
+				assert.Error(t, got.Err)
+			})
+		})
+	}
+
+	t.Run("dispatched", func(t *testing.T) {
+		soapSrv.PreDispatchErrorMode = PreDispatchErrorPlain
+		defer func() { soapSrv.PreDispatchErrorMode = PreDispatchErrorFault }()
+		w := serve("", "/pathTo", "testPostAction", strings.Replace(envelope, "%s", "<fooRequest/>", 1))
+		assert.Exactly(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "<Bar>ok</Bar>")
+	})
+}
@@ -0,0 +1,207 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"regexp"
+	"sync"
+)
+
+var (
+	prefixesMu sync.RWMutex
+	// conventionalPrefixes are the prefixes by namespace, see
+	// ConventionalPrefixes.
+	conventionalPrefixes = map[string]string{
+		NamespaceWSSE:         "wsse",
+		NamespaceWSU:          "wsu",
+		NamespaceWSA:          "wsa",
+		NamespaceXSI:          "xsi",
+		NamespaceXSD:          "xsd",
+		NamespaceXOP:          "xop",
+		NamespaceXMLMime:      "xmime",
+		NamespaceDS:           "ds",
+		NamespaceSoapEncoding: "soapenc",
+		NamespaceXLink:        "xlink",
+	}
+)
+
+// ConventionalPrefixes returns the prefixes Marshal declares for namespaced
+// attributes, e.g. wsu:Id or xsi:type, instead of those encoding/xml makes up
+// from the namespace URI, by namespace. The map is a copy, see RegisterPrefix.
+func ConventionalPrefixes() map[string]string {
+	prefixesMu.RLock()
+	defer prefixesMu.RUnlock()
+	prefixes := make(map[string]string, len(conventionalPrefixes))
+	for ns, prefix := range conventionalPrefixes {
+		prefixes[ns] = prefix
+	}
+	return prefixes
+}
+
+// RegisterPrefix makes prefix the conventional prefix of namespace, e.g. of
+// the attributes of your own namespaces, see ConventionalPrefixes. It may be
+// called concurrently with marshalling.
+func RegisterPrefix(namespace, prefix string) {
+	prefixesMu.Lock()
+	defer prefixesMu.Unlock()
+	conventionalPrefixes[namespace] = prefix
+}
+
+// NamespaceXLink is the namespace of XLink attributes, e.g. xlink:href.
+const NamespaceXLink = "http://www.w3.org/1999/xlink"
+
+var prefixDeclRe = regexp.MustCompile(`xmlns:([^=\s]+)\s*=\s*"([^"]*)"`)
+
+// TidyPrefixes rewrites the prefixes of the namespaces of ConventionalPrefixes
+// in the XML document data to the conventional ones and drops declarations
+// repeating one of an ancestor, e.g. for the output of xml.Marshal, which
+// declares a prefix made up from the namespace URI on every element with a
+// namespaced attribute. Prefixes clashing with other declarations are kept.
+// Marshal and MarshalIndent apply it. Decoding doesn't depend on prefixes,
+// fields tagged with the namespace, e.g.
+//
+//	ID string `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd Id,attr"`
+//
+// are decoded whatever the prefix of the peer.
+func TidyPrefixes(data []byte) ([]byte, error) {
+	if !needsTidying(data) {
+		return data, nil
+	}
+	var out bytes.Buffer
+	if err := tidyPrefixes(&out, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// tidyPrefixes copies the XML document r to w like TidyPrefixes, holding back
+// no more than the token being read, so streamed documents can be tidied.
+func tidyPrefixes(w io.Writer, r io.Reader) error {
+	type scope struct {
+		ns      map[string]string // prefix to namespace in scope
+		renames map[string]string // prefix to conventional prefix
+	}
+	prefixes := ConventionalPrefixes()
+	scopes := []scope{{ns: map[string]string{"xml": NamespaceXMLSpace}, renames: map[string]string{}}}
+	var (
+		// pending holds what the decoder has read from r, but not yet
+		// written to w. It starts at the token being read.
+		pending bytes.Buffer
+		tag     bytes.Buffer
+	)
+	d := xml.NewDecoder(io.TeeReader(r, &pending))
+	for {
+		offset := d.InputOffset()
+		token, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		raw := pending.Next(int(d.InputOffset() - offset))
+		tag.Reset()
+		switch tt := token.(type) {
+		case xml.EndElement:
+			s := scopes[len(scopes)-1]
+			scopes = scopes[:len(scopes)-1]
+			if conv, ok := s.renames[tt.Name.Space]; ok && bytes.HasPrefix(raw, []byte("</")) {
+				tag.WriteString("</" + conv + ":" + tt.Name.Local + ">")
+			}
+		case xml.StartElement:
+			parent := scopes[len(scopes)-1]
+			s := scope{ns: make(map[string]string, len(parent.ns)), renames: make(map[string]string, len(parent.renames))}
+			for p, ns := range parent.ns {
+				s.ns[p] = ns
+			}
+			for p, conv := range parent.renames {
+				s.renames[p] = conv
+			}
+			changed := false
+			var attrs []xml.Attr
+			for _, a := range tt.Attr {
+				if a.Name.Space != "xmlns" {
+					attrs = append(attrs, a)
+					continue
+				}
+				conv := prefixes[a.Value]
+				if conv == "" || conv == a.Name.Local || declares(tt.Attr, conv) ||
+					parent.ns[conv] != "" && parent.ns[conv] != a.Value {
+					// Nothing to do or the conventional prefix is taken.
+					s.ns[a.Name.Local] = a.Value
+					delete(s.renames, a.Name.Local)
+					attrs = append(attrs, a)
+					continue
+				}
+				changed = true
+				s.renames[a.Name.Local] = conv
+				if parent.ns[conv] == a.Value {
+					continue // already declared by an ancestor
+				}
+				s.ns[conv] = a.Value
+				attrs = append(attrs, xml.Attr{Name: xml.Name{Space: "xmlns", Local: conv}, Value: a.Value})
+			}
+			for i, a := range attrs {
+				if conv, ok := s.renames[a.Name.Space]; ok && a.Name.Space != "xmlns" {
+					attrs[i].Name.Space = conv
+					changed = true
+				}
+			}
+			if conv, ok := s.renames[tt.Name.Space]; ok {
+				tt.Name.Space = conv
+				changed = true
+			}
+			scopes = append(scopes, s)
+			if changed {
+				writeStartTag(&tag, tt.Name, attrs, bytes.HasSuffix(raw, []byte("/>")))
+			}
+		}
+		if tag.Len() > 0 {
+			raw = tag.Bytes()
+		}
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(pending.Bytes())
+	return err
+}
+
+// needsTidying tells whether data declares one of ConventionalPrefixes with
+// another prefix.
+func needsTidying(data []byte) bool {
+	prefixes := ConventionalPrefixes()
+	for _, m := range prefixDeclRe.FindAllSubmatch(data, -1) {
+		if conv := prefixes[string(m[2])]; conv != "" && conv != string(m[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// declares tells whether attrs declare prefix.
+func declares(attrs []xml.Attr, prefix string) bool {
+	for _, a := range attrs {
+		if a.Name.Space == "xmlns" && a.Name.Local == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// writeStartTag writes the start tag of name with attrs, whose names are
+// prefixed, not namespaced, as RawToken returns them.
+func writeStartTag(out *bytes.Buffer, name xml.Name, attrs []xml.Attr, empty bool) {
+	out.WriteString("<" + rawName(name))
+	for _, a := range attrs {
+		out.WriteString(" " + rawName(a.Name) + `="`)
+		xml.EscapeText(out, []byte(a.Value))
+		out.WriteString(`"`)
+	}
+	if empty {
+		out.WriteString("/>")
+	} else {
+		out.WriteString(">")
+	}
+}
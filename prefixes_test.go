@@ -0,0 +1,82 @@
+package soap
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type signedPart struct {
+	XMLName xml.Name `xml:"urn:example:parts Part"`
+	ID      string   `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd Id,attr,omitempty"`
+	Type    string   `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr,omitempty"`
+	Href    string   `xml:"http://www.w3.org/1999/xlink href,attr,omitempty"`
+	Child   *signedPart
+}
+
+func TestMarshal_namespacedAttrs(t *testing.T) {
+	part := signedPart{ID: "Part-1", Type: "p:Signed", Href: "#doc", Child: &signedPart{ID: "Part-2"}}
+	data, err := Marshal(part)
+	require.NoError(t, err)
+	assert.Equal(t, `<Part xmlns="urn:example:parts" xmlns:wsu="`+NamespaceWSU+`" wsu:Id="Part-1"`+
+		` xmlns:xsi="`+NamespaceXSI+`" xsi:type="p:Signed" xmlns:xlink="`+NamespaceXLink+`" xlink:href="#doc">`+
+		`<Part xmlns="urn:example:parts" wsu:Id="Part-2"></Part></Part>`, string(data))
+
+	var decoded signedPart
+	require.NoError(t, xml.Unmarshal(data, &decoded))
+	assert.Equal(t, []string{"Part-1", "p:Signed", "#doc", "Part-2"}, []string{decoded.ID, decoded.Type, decoded.Href, decoded.Child.ID})
+
+	peer := `<p:Part xmlns:p="urn:example:parts" xmlns:u="` + NamespaceWSU + `" xmlns:i="` + NamespaceXSI + `" u:Id="Part-1" i:type="p:Signed"/>`
+	decoded = signedPart{}
+	require.NoError(t, xml.Unmarshal([]byte(peer), &decoded))
+	assert.Equal(t, "Part-1", decoded.ID, "prefixes of the peer don't matter")
+	assert.Equal(t, "p:Signed", decoded.Type)
+}
+
+func TestTidyPrefixes(t *testing.T) {
+	for name, tc := range map[string]struct {
+		in, want string
+	}{
+		"nothing to do": {
+			in:   `<a xmlns:wsu="` + NamespaceWSU + `" wsu:Id="1"><b>&amp;</b></a>`,
+			want: `<a xmlns:wsu="` + NamespaceWSU + `" wsu:Id="1"><b>&amp;</b></a>`,
+		},
+		"empty elements": {
+			in:   `<a xmlns:x="` + NamespaceXSI + `" x:nil="true"/><b xmlns:y="` + NamespaceXSI + `" y:nil="true" />`,
+			want: `<a xmlns:xsi="` + NamespaceXSI + `" xsi:nil="true"/><b xmlns:xsi="` + NamespaceXSI + `" xsi:nil="true"/>`,
+		},
+		"taken by an ancestor": {
+			in:   `<a xmlns:xsi="urn:other"><b xmlns:x="` + NamespaceXSI + `" x:nil="true"/></a>`,
+			want: `<a xmlns:xsi="urn:other"><b xmlns:x="` + NamespaceXSI + `" x:nil="true"/></a>`,
+		},
+		"taken by the element": {
+			in:   `<a xmlns:xsi="urn:other" xmlns:x="` + NamespaceXSI + `" x:nil="true"/>`,
+			want: `<a xmlns:xsi="urn:other" xmlns:x="` + NamespaceXSI + `" x:nil="true"/>`,
+		},
+		"element prefix": {
+			in:   `<x:Security xmlns:x="` + NamespaceWSSE + `"><x:Token/></x:Security>`,
+			want: `<wsse:Security xmlns:wsse="` + NamespaceWSSE + `"><wsse:Token/></wsse:Security>`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := TidyPrefixes([]byte(tc.in))
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+}
+
+func TestRegisterPrefix(t *testing.T) {
+	const ns = "urn:example:register-prefix"
+	prefixes := ConventionalPrefixes()
+	prefixes[ns] = "changed"
+	assert.NotContains(t, ConventionalPrefixes(), ns, "a copy")
+
+	RegisterPrefix(ns, "ex")
+	assert.Equal(t, "ex", ConventionalPrefixes()[ns])
+	data, err := TidyPrefixes([]byte(`<a xmlns:x="` + ns + `" x:id="1"/>`))
+	require.NoError(t, err)
+	assert.Equal(t, `<a xmlns:ex="`+ns+`" ex:id="1"/>`, string(data))
+}
@@ -0,0 +1,155 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// RedactedElements lists the local names of elements whose text content is
+// masked by PrettyXML and in the bodies of FailedRequests.
+var RedactedElements = []string{"Password", "Nonce", "BinarySecurityToken"}
+
+// excerptBytes is the byte budget for XML excerpts in errors and logs.
+const excerptBytes = 1024
+
+// hexDumpBytes is the number of leading bytes dumped by hexExcerpt.
+const hexDumpBytes = 64
+
+// hexExcerpt returns a hex dump of the first bytes of b, which shows what
+// keeps a body from being decoded, e.g. a byte order mark or binary content.
+func hexExcerpt(b []byte) string {
+	if len(b) > hexDumpBytes {
+		b = b[:hexDumpBytes]
+	}
+	return hex.Dump(b)
+}
+
+const redactedValue = "********"
+
+// PrettyXML re-indents the XML document b for logs and error messages. The
+// result is truncated at an element boundary to at most maxBytes (plus a
+// "… truncated (N more bytes)" marker), maxBytes <= 0 means no limit. Text
+// content of elements listed in RedactedElements is masked. If b isn't well
+// formed XML, it is returned as is, subject to the same byte budget.
+func PrettyXML(b []byte, maxBytes int) string {
+	redacted := make(map[string]bool, len(RedactedElements))
+	for _, name := range RedactedElements {
+		redacted[name] = true
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(b))
+
+	var (
+		out        bytes.Buffer
+		level      int
+		lastWasEnd bool
+		masked     int // > 0 while inside a redacted element
+		safeOut    int // output length at the last element boundary
+		safeIn     int64
+	)
+	lf := func() {
+		if out.Len() > 0 {
+			out.WriteString("\n")
+		}
+		out.WriteString(strings.Repeat("\t", level))
+	}
+
+	for {
+		token, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return truncate(b, maxBytes)
+		}
+
+		switch tt := token.(type) {
+		case xml.StartElement:
+			lf()
+			out.WriteString("<" + rawName(tt.Name))
+			for _, attr := range tt.Attr {
+				out.WriteString(" " + rawName(attr.Name) + `="`)
+				xml.EscapeText(&out, []byte(attr.Value))
+				out.WriteString(`"`)
+			}
+			out.WriteString(">")
+			level++
+			if masked > 0 || redacted[tt.Name.Local] {
+				masked++
+			}
+			lastWasEnd = false
+		case xml.EndElement:
+			level--
+			if lastWasEnd {
+				lf()
+			}
+			out.WriteString("</" + rawName(tt.Name) + ">")
+			if masked > 0 {
+				masked--
+			}
+			lastWasEnd = true
+		case xml.CharData:
+			text := bytes.TrimSpace(tt)
+			if len(text) == 0 {
+				continue
+			}
+			if lastWasEnd {
+				lf()
+			}
+			if masked > 0 {
+				out.WriteString(redactedValue)
+			} else {
+				xml.EscapeText(&out, text)
+			}
+		case xml.Comment:
+			lf()
+			out.WriteString("<!--" + string(tt) + "-->")
+			lastWasEnd = true
+		case xml.ProcInst:
+			lf()
+			out.WriteString("<?" + tt.Target + " " + string(tt.Inst) + "?>")
+			lastWasEnd = true
+		case xml.Directive:
+			lf()
+			out.WriteString("<!" + string(tt) + ">")
+			lastWasEnd = true
+		}
+
+		if maxBytes > 0 && out.Len() > maxBytes {
+			out.Truncate(safeOut)
+			return out.String() + truncatedMarker(len(b)-int(safeIn))
+		}
+		if _, isCharData := token.(xml.CharData); !isCharData {
+			safeOut, safeIn = out.Len(), d.InputOffset()
+		}
+	}
+	return out.String()
+}
+
+// truncate cuts b to at most maxBytes without splitting a UTF-8 sequence.
+func truncate(b []byte, maxBytes int) string {
+	if maxBytes <= 0 || len(b) <= maxBytes {
+		return string(b)
+	}
+	n := maxBytes
+	for n > 0 && !utf8.RuneStart(b[n]) {
+		n--
+	}
+	return string(b[:n]) + truncatedMarker(len(b)-n)
+}
+
+func truncatedMarker(n int) string {
+	return fmt.Sprintf("\n… truncated (%d more bytes)", n)
+}
+
+func rawName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
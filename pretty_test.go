@@ -0,0 +1,47 @@
+package soap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrettyXML(t *testing.T) {
+	envelope := []byte(`<?xml version="1.0" encoding="utf-8"?><soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Header><wsse:Security xmlns:wsse="urn:wsse"><wsse:UsernameToken><wsse:Username>kirk</wsse:Username><wsse:Password Type="PasswordText">ncc-1701</wsse:Password></wsse:UsernameToken></wsse:Security></soap:Header><soap:Body><fooRequest><Foo>a &amp; b</Foo><Empty></Empty></fooRequest></soap:Body></soap:Envelope>`)
+
+	t.Run("indent and redact", func(t *testing.T) {
+		assert.Exactly(t, `<?xml version="1.0" encoding="utf-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+	<soap:Header>
+		<wsse:Security xmlns:wsse="urn:wsse">
+			<wsse:UsernameToken>
+				<wsse:Username>kirk</wsse:Username>
+				<wsse:Password Type="PasswordText">********</wsse:Password>
+			</wsse:UsernameToken>
+		</wsse:Security>
+	</soap:Header>
+	<soap:Body>
+		<fooRequest>
+			<Foo>a &amp; b</Foo>
+			<Empty></Empty>
+		</fooRequest>
+	</soap:Body>
+</soap:Envelope>`, PrettyXML(envelope, 0))
+	})
+
+	t.Run("truncate at element boundary", func(t *testing.T) {
+		have := PrettyXML(envelope, 130)
+		assert.True(t, strings.HasPrefix(have, `<?xml version="1.0" encoding="utf-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+	<soap:Header>
+… truncated (`), have)
+		assert.True(t, strings.HasSuffix(have, " more bytes)"), have)
+	})
+
+	t.Run("not xml", func(t *testing.T) {
+		assert.Exactly(t, "Service Unavailable & retry later", PrettyXML([]byte("Service Unavailable & retry later"), 0))
+		assert.Exactly(t, "Service Unavailable \n… truncated (13 more bytes)", PrettyXML([]byte("Service Unavailable & retry later"), 20))
+		assert.Exactly(t, "ä\n… truncated (6 more bytes)", PrettyXML([]byte("ää & x"), 3))
+	})
+}
@@ -0,0 +1,59 @@
+package soap
+
+// Profile bundles the Client settings for the quirks of a vendor stack. Apply
+// profiles with Client.ApplyProfile, settings made afterwards override them.
+// Profiles set the SOAP version, the quoting of the SOAPAction, the
+// resolution of multiRef elements and the Content-Type. A byte order mark is
+// tolerated regardless, namespace qualification and the lexical form of bools
+// follow the types of requests and responses. The zero Profile changes
+// nothing.
+type Profile struct {
+	Name  string
+	apply func(c *Client)
+}
+
+var (
+	// ProfileDotNet talks to ASMX and WCF basicHttpBinding services: SOAP 1.1
+	// with a quoted SOAPAction, which they dispatch on.
+	ProfileDotNet = Profile{
+		Name: "dotnet",
+		apply: func(c *Client) {
+			c.UseSoap11()
+			c.QuoteSOAPAction = true
+		},
+	}
+
+	// ProfileAxis1 talks to rpc/encoded services of Apache Axis 1: SOAP 1.1
+	// with a quoted SOAPAction, responses reference values by multiRef
+	// elements, see Client.ResolveMultiRefs.
+	ProfileAxis1 = Profile{
+		Name: "axis1",
+		apply: func(c *Client) {
+			c.UseSoap11()
+			c.QuoteSOAPAction = true
+			c.ResolveMultiRefs = true
+		},
+	}
+
+	// ProfileSAPPI talks to SAP PI/PO SOAP adapters: SOAP 1.1 with a quoted
+	// SOAPAction and the Content-Type spelled the way the adapter sends it
+	// itself, which some adapter versions require.
+	ProfileSAPPI = Profile{
+		Name: "sappi",
+		apply: func(c *Client) {
+			c.UseSoap11()
+			c.QuoteSOAPAction = true
+			c.ContentTypeOverride = "text/xml;charset=UTF-8"
+		},
+	}
+)
+
+// ApplyProfile applies the profiles in the given order, later ones override
+// settings of earlier ones.
+func (c *Client) ApplyProfile(profiles ...Profile) {
+	for _, p := range profiles {
+		if p.apply != nil {
+			p.apply(c)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The envelopes in testdata/profiles are shaped like the responses of the
+// respective stacks, including their prefixes, declarations and encodings.
+
+type dotNetQuoteResponse struct {
+	XMLName  xml.Name `xml:"http://tempuri.org/ GetQuoteResponse"`
+	Symbol   string   `xml:"http://tempuri.org/ GetQuoteResult>Symbol"`
+	Price    float64  `xml:"http://tempuri.org/ GetQuoteResult>Price"`
+	Tradable bool     `xml:"http://tempuri.org/ GetQuoteResult>Tradable"`
+}
+
+type axisQuoteResponse struct {
+	XMLName  xml.Name `xml:"urn:QuoteService getQuoteResponse"`
+	Symbol   string   `xml:"getQuoteReturn>symbol"`
+	Price    float64  `xml:"getQuoteReturn>price"`
+	Tradable bool     `xml:"getQuoteReturn>tradable"`
+}
+
+type sapQuoteResponse struct {
+	XMLName  xml.Name `xml:"urn:sap-com:document:sap:rfc:functions GetQuoteResponse"`
+	Symbol   string   `xml:"QUOTE>SYMBOL"`
+	Price    float64  `xml:"QUOTE>PRICE"`
+	Tradable string   `xml:"QUOTE>TRADABLE"`
+}
+
+func TestClient_ApplyProfile(t *testing.T) {
+	tests := []struct {
+		profile         Profile
+		wantAction      string
+		wantContentType string
+		response        interface{}
+		want            interface{}
+	}{
+		{
+			profile:         ProfileDotNet,
+			wantAction:      `"http://tempuri.org/GetQuote"`,
+			wantContentType: `text/xml; charset="utf-8"`,
+			response:        &dotNetQuoteResponse{},
+			want:            &dotNetQuoteResponse{XMLName: xml.Name{Space: "http://tempuri.org/", Local: "GetQuoteResponse"}, Symbol: "ACME", Price: 12.5, Tradable: true},
+		},
+		{
+			profile:         ProfileAxis1,
+			wantAction:      `"http://tempuri.org/GetQuote"`,
+			wantContentType: `text/xml; charset="utf-8"`,
+			response:        &axisQuoteResponse{},
+			want:            &axisQuoteResponse{XMLName: xml.Name{Space: "urn:QuoteService", Local: "getQuoteResponse"}, Symbol: "ACME", Price: 12.5, Tradable: true},
+		},
+		{
+			profile:         ProfileSAPPI,
+			wantAction:      `"http://tempuri.org/GetQuote"`,
+			wantContentType: `text/xml;charset=UTF-8`,
+			response:        &sapQuoteResponse{},
+			want:            &sapQuoteResponse{XMLName: xml.Name{Space: "urn:sap-com:document:sap:rfc:functions", Local: "GetQuoteResponse"}, Symbol: "ACME", Price: 12.5, Tradable: "X"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.profile.Name, func(t *testing.T) {
+			envelope, err := ioutil.ReadFile(filepath.Join("testdata", "profiles", test.profile.Name+".response.xml"))
+			require.NoError(t, err)
+
+			var header http.Header
+			c := NewClient("http://localhorst.ch", nil)
+			c.UseSoap12()
+			c.ApplyProfile(test.profile)
+			c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+				header = r.Header
+				return &http.Response{
+					StatusCode: 200,
+					Header:     http.Header{"Content-Type": {"text/xml; charset=utf-8"}},
+					Body:       ioutil.NopCloser(bytes.NewReader(envelope)),
+				}, nil
+			})}).Do
+
+			_, err = c.Call(context.Background(), "http://tempuri.org/GetQuote", &FooRequest{}, test.response)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, test.response)
+			assert.Exactly(t, test.wantAction, header.Get("SOAPAction"))
+			assert.Exactly(t, test.wantContentType, header.Get("Content-Type"))
+		})
+	}
+
+	t.Run("overrides", func(t *testing.T) {
+		c := NewClient("http://localhorst.ch", nil)
+		c.ApplyProfile(ProfileSAPPI, ProfileAxis1)
+		c.QuoteSOAPAction = false
+		assert.True(t, c.ResolveMultiRefs)
+		assert.Exactly(t, "text/xml;charset=UTF-8", c.contentType())
+		assert.False(t, c.QuoteSOAPAction)
+	})
+
+	t.Run("zero", func(t *testing.T) {
+		c := NewClient("http://localhorst.ch", nil)
+		c.UseSoap12()
+		c.ApplyProfile(Profile{})
+		assert.Exactly(t, SoapVersion12, c.SoapVersion)
+		assert.False(t, c.QuoteSOAPAction)
+	})
+}
+
+func TestResolveMultiRefs(t *testing.T) {
+	t.Run("cycle", func(t *testing.T) {
+		_, err := resolveMultiRefs([]byte(`<Envelope><Body><a href="#id0"/><multiRef id="id0"><b href="#id0"/></multiRef></Body></Envelope>`))
+		assert.EqualError(t, err, `multiRef "id0" refers to itself`)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		envelope := `<Envelope><Body><a href="#id0"/><multiRef id="id1">1</multiRef></Body></Envelope>`
+		got, err := resolveMultiRefs([]byte(envelope))
+		require.NoError(t, err)
+		assert.Exactly(t, `<Envelope><Body><a href="#id0"/><multiRef id="id1">1</multiRef></Body></Envelope>`, string(got))
+	})
+
+	t.Run("shared", func(t *testing.T) {
+		got, err := resolveMultiRefs([]byte(`<?xml version="1.0"?><s:Envelope xmlns:s="urn:s"><s:Body><r><a href="#id0"/><b href="#id0"/></r><multiRef id="id0">x &amp; y</multiRef><!-- end --></s:Body></s:Envelope>`))
+		require.NoError(t, err)
+		assert.Exactly(t, `<?xml version="1.0"?><s:Envelope xmlns:s="urn:s"><s:Body><r><a>x &amp; y</a><b>x &amp; y</b></r><!-- end --></s:Body></s:Envelope>`, string(got))
+	})
+}
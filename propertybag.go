@@ -0,0 +1,211 @@
+package soap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Property is an entry of a PropertyBag.
+type Property struct {
+	Key   string
+	Value string
+}
+
+// PropertyBag is an ordered map of strings for open-ended properties, which
+// schemas model as repeated key/value elements:
+//
+//	Props PropertyBag `xml:"Property"`
+//
+// is marshalled as
+//
+//	<Property><Key>color</Key><Value>red</Value></Property>
+//	<Property><Key>size</Key><Value>XL</Value></Property>
+//
+// in insertion order. Options in the soap tag of the field rename the key and
+// value elements and sort the entries by key when marshalling with Marshal,
+// the default Marshaller of Client and Server:
+//
+//	Props PropertyBag `xml:"Settings>Setting" soap:"key=Name,value=Val,sorted"`
+//
+// When unmarshalling, the first child element of an entry is taken as key and
+// the second as value, whatever their names. Duplicate keys are kept: Get
+// returns the last value of a key, Values all of them.
+type PropertyBag struct {
+	entries []Property
+}
+
+// NewPropertyBag returns a bag with the entries of m sorted by key.
+func NewPropertyBag(m map[string]string) PropertyBag {
+	var b PropertyBag
+	for _, key := range sortedKeys(m) {
+		b.Add(key, m[key])
+	}
+	return b
+}
+
+// Add appends an entry, keeping those with the same key.
+func (b *PropertyBag) Add(key, value string) {
+	b.entries = append(b.entries, Property{Key: key, Value: value})
+}
+
+// Set replaces the entries with key by a single one at the position of the
+// first, or appends one if there is none.
+func (b *PropertyBag) Set(key, value string) {
+	for i, p := range b.entries {
+		if p.Key == key {
+			b.entries[i].Value = value
+			b.deleteFrom(i+1, key)
+			return
+		}
+	}
+	b.Add(key, value)
+}
+
+// Delete removes the entries with key.
+func (b *PropertyBag) Delete(key string) {
+	b.deleteFrom(0, key)
+}
+
+func (b *PropertyBag) deleteFrom(i int, key string) {
+	kept := b.entries[:i]
+	for _, p := range b.entries[i:] {
+		if p.Key != key {
+			kept = append(kept, p)
+		}
+	}
+	b.entries = kept
+}
+
+// Get returns the last value of key.
+func (b PropertyBag) Get(key string) (string, bool) {
+	for i := len(b.entries) - 1; i >= 0; i-- {
+		if b.entries[i].Key == key {
+			return b.entries[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// Values returns all values of key in order.
+func (b PropertyBag) Values(key string) []string {
+	var values []string
+	for _, p := range b.entries {
+		if p.Key == key {
+			values = append(values, p.Value)
+		}
+	}
+	return values
+}
+
+// Keys returns the distinct keys in the order of their first entry.
+func (b PropertyBag) Keys() []string {
+	seen := make(map[string]bool, len(b.entries))
+	var keys []string
+	for _, p := range b.entries {
+		if !seen[p.Key] {
+			seen[p.Key] = true
+			keys = append(keys, p.Key)
+		}
+	}
+	return keys
+}
+
+// Entries returns a copy of the entries in order.
+func (b PropertyBag) Entries() []Property {
+	return append([]Property(nil), b.entries...)
+}
+
+// Len returns the number of entries, including duplicate keys.
+func (b PropertyBag) Len() int {
+	return len(b.entries)
+}
+
+// Map returns the entries as map, the last value of a key wins.
+func (b PropertyBag) Map() map[string]string {
+	m := make(map[string]string, len(b.entries))
+	for _, p := range b.entries {
+		m[p.Key] = p.Value
+	}
+	return m
+}
+
+// MarshalXML implements xml.Marshaler, writing an element named like start
+// for each entry.
+func (b PropertyBag) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return propertyBagXML{bag: b}.MarshalXML(e, start)
+}
+
+// UnmarshalXML implements xml.Unmarshaler, appending the entry of start.
+func (b *PropertyBag) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var children struct {
+		Elements []struct {
+			Text string `xml:",chardata"`
+		} `xml:",any"`
+	}
+	if err := d.DecodeElement(&children, &start); err != nil {
+		return err
+	}
+	if len(children.Elements) != 2 {
+		return fmt.Errorf("property %s has %d child elements, want key and value", start.Name.Local, len(children.Elements))
+	}
+	b.Add(children.Elements[0].Text, children.Elements[1].Text)
+	return nil
+}
+
+var propertyBagType = reflect.TypeOf(PropertyBag{})
+
+// propertyBagXML marshals a PropertyBag with the options of a soap tag.
+type propertyBagXML struct {
+	bag        PropertyBag
+	key, value string
+	sorted     bool
+}
+
+// newPropertyBagXML applies the soap tag options of a PropertyBag field.
+func newPropertyBagXML(bag PropertyBag, soapTag string) propertyBagXML {
+	p := propertyBagXML{bag: bag}
+	for _, opt := range strings.Split(soapTag, ",") {
+		switch name, value, _ := strings.Cut(opt, "="); name {
+		case "key":
+			p.key = value
+		case "value":
+			p.value = value
+		case "sorted":
+			p.sorted = true
+		}
+	}
+	return p
+}
+
+func (p propertyBagXML) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	key, value := xml.Name{Local: "Key"}, xml.Name{Local: "Value"}
+	if p.key != "" {
+		key.Local = p.key
+	}
+	if p.value != "" {
+		value.Local = p.value
+	}
+	entries := p.bag.entries
+	if p.sorted {
+		entries = p.bag.Entries()
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	}
+	for _, entry := range entries {
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		if err := e.EncodeElement(entry.Key, xml.StartElement{Name: key}); err != nil {
+			return err
+		}
+		if err := e.EncodeElement(entry.Value, xml.StartElement{Name: value}); err != nil {
+			return err
+		}
+		if err := e.EncodeToken(start.End()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
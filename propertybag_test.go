@@ -0,0 +1,75 @@
+package soap
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type propertiesRequest struct {
+	XMLName  xml.Name    `xml:"urn:example:props SetProperties"`
+	Props    PropertyBag `xml:"Property"`
+	Settings PropertyBag `xml:"Settings>Setting" soap:"key=Name,value=Val,sorted"`
+}
+
+func TestPropertyBag_marshal(t *testing.T) {
+	var request propertiesRequest
+	request.Props.Add("size", "XL")
+	request.Props.Add("color", "red")
+	request.Settings = NewPropertyBag(map[string]string{"b": "2", "a": "1"})
+	request.Settings.Add("0", "first")
+
+	data, err := Marshal(&request)
+	require.NoError(t, err)
+	assert.Equal(t, `<SetProperties xmlns="urn:example:props">`+
+		`<Property><Key>size</Key><Value>XL</Value></Property>`+
+		`<Property><Key>color</Key><Value>red</Value></Property>`+
+		`<Settings>`+
+		`<Setting><Name>0</Name><Val>first</Val></Setting>`+
+		`<Setting><Name>a</Name><Val>1</Val></Setting>`+
+		`<Setting><Name>b</Name><Val>2</Val></Setting>`+
+		`</Settings></SetProperties>`, string(data))
+
+	data, err = xml.Marshal(&request)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `<Settings><Setting><Key>a</Key><Value>1</Value></Setting>`, "encoding/xml doesn't know soap tags")
+}
+
+func TestPropertyBag_unmarshal(t *testing.T) {
+	var request propertiesRequest
+	err := xml.Unmarshal([]byte(`<SetProperties xmlns="urn:example:props">
+	<Property><Key>color</Key><Value>red</Value></Property>
+	<Property><Key>size</Key><Value>XL</Value></Property>
+	<Property><Key>color</Key><Value>blue</Value></Property>
+	<Settings><Setting><Name>a</Name><Val>1</Val></Setting></Settings>
+</SetProperties>`), &request)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, request.Props.Len())
+	color, ok := request.Props.Get("color")
+	assert.True(t, ok)
+	assert.Equal(t, "blue", color, "the last value wins")
+	assert.Equal(t, []string{"red", "blue"}, request.Props.Values("color"))
+	assert.Equal(t, []string{"color", "size"}, request.Props.Keys())
+	assert.Equal(t, map[string]string{"color": "blue", "size": "XL"}, request.Props.Map())
+	assert.Equal(t, map[string]string{"a": "1"}, request.Settings.Map(), "key and value are taken by position")
+
+	err = xml.Unmarshal([]byte(`<SetProperties xmlns="urn:example:props"><Property><Key>color</Key></Property></SetProperties>`), &request)
+	assert.EqualError(t, err, "property Property has 1 child elements, want key and value")
+}
+
+func TestPropertyBag_edit(t *testing.T) {
+	var bag PropertyBag
+	bag.Add("a", "1")
+	bag.Add("b", "2")
+	bag.Add("a", "3")
+	bag.Set("a", "4")
+	assert.Equal(t, []Property{{Key: "a", Value: "4"}, {Key: "b", Value: "2"}}, bag.Entries())
+	bag.Set("c", "5")
+	bag.Delete("b")
+	assert.Equal(t, []Property{{Key: "a", Value: "4"}, {Key: "c", Value: "5"}}, bag.Entries())
+	_, ok := bag.Get("b")
+	assert.False(t, ok)
+}
@@ -0,0 +1,109 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// reauthState deduplicates runs of Client.Reauthenticate. It is kept behind a
+// pointer, so the Client can still be copied.
+type reauthState struct {
+	mu         sync.Mutex
+	generation uint64 // successful runs so far
+	running    *reauthRun
+}
+
+type reauthRun struct {
+	done chan struct{}
+	err  error
+}
+
+type reauthenticatingKey struct{}
+
+// withReauthentication runs call and, if it fails with a SOAP Fault matching
+// ReauthenticateFaults, runs Reauthenticate and then call once more.
+func (c *Client) withReauthentication(ctx context.Context, call func() (*http.Response, error)) (*http.Response, error) {
+	if c.Reauthenticate == nil || ctx.Value(reauthenticatingKey{}) != nil {
+		return call()
+	}
+	generation := c.reauthGeneration()
+	resp, err := call()
+	var fe *FaultError
+	if !errors.As(err, &fe) || !c.reauthenticates(fe.Fault) {
+		return resp, err
+	}
+	if c.Log != nil {
+		c.Log("Reauthenticating", "error", err)
+	}
+	reauthErr := c.reauthenticate(ctx, generation, func(ctx context.Context) error {
+		return c.Reauthenticate(ctx, c, fe)
+	})
+	if reauthErr != nil {
+		return resp, fmt.Errorf("could not reauthenticate after %v: %w", err, reauthErr)
+	}
+	c.refreshCredentials()
+	return call()
+}
+
+// reauthenticates reports whether f matches ReauthenticateFaults.
+func (c *Client) reauthenticates(f *Fault) bool {
+	for _, fm := range c.ReauthenticateFaults {
+		if fm.Match(f) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) reauthGeneration() uint64 {
+	if c.reauth == nil {
+		return 0
+	}
+	c.reauth.mu.Lock()
+	defer c.reauth.mu.Unlock()
+	return c.reauth.generation
+}
+
+// reauthenticate runs reauth, i.e. Reauthenticate or OnAuthError, for a call
+// started at generation. Calls failing while it runs wait for its result,
+// calls started before a successful run don't run it again.
+func (c *Client) reauthenticate(ctx context.Context, generation uint64, reauth func(ctx context.Context) error) error {
+	// Calls made while reauthenticating, e.g. to log in, don't reauthenticate.
+	ctx = context.WithValue(ctx, reauthenticatingKey{}, true)
+	rs := c.reauth
+	if rs == nil {
+		return reauth(ctx)
+	}
+
+	rs.mu.Lock()
+	if rs.generation != generation {
+		rs.mu.Unlock()
+		return nil
+	}
+	if run := rs.running; run != nil {
+		rs.mu.Unlock()
+		select {
+		case <-run.done:
+			return run.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	run := &reauthRun{done: make(chan struct{})}
+	rs.running = run
+	rs.mu.Unlock()
+
+	run.err = reauth(ctx)
+
+	rs.mu.Lock()
+	rs.running = nil
+	if run.err == nil {
+		rs.generation++
+	}
+	rs.mu.Unlock()
+	close(run.done)
+	return run.err
+}
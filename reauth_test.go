@@ -0,0 +1,279 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sessionHeader carries the session token current when it is marshaled.
+type sessionHeader struct {
+	mu    sync.Mutex
+	token string
+}
+
+func (sh *sessionHeader) set(token string) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.token = token
+}
+
+func (sh *sessionHeader) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return e.EncodeElement(sh.token, xml.StartElement{Name: xml.Name{Space: "urn:example:session", Local: "SessionToken"}})
+}
+
+// sessionServer is a fake service with a login operation, which expires the
+// sessions issued before.
+type sessionServer struct {
+	mu       sync.Mutex
+	current  string
+	logins   int
+	failNext bool // the next login fails with an expired session itself
+}
+
+func (ss *sessionServer) expire() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.current = "expired-by-server"
+}
+
+func (ss *sessionServer) handler() http.Handler {
+	soapSrv := NewServer()
+	soapSrv.RegisterHandler("/pathTo", "login", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			ss.mu.Lock()
+			defer ss.mu.Unlock()
+			ss.logins++
+			if ss.failNext {
+				return nil, NewFault("soap:Client.SessionExpired", "session expired")
+			}
+			ss.current = fmt.Sprintf("session-%d", ss.logins)
+			return &FooResponse{Bar: ss.current}, nil
+		},
+	)
+	soapSrv.RegisterHandler("/pathTo", "foo", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			var token string
+			for _, h := range RequestHeaders(httpRequest.Context()) {
+				var v string
+				if h.Name.Local == "SessionToken" && xml.Unmarshal(h.Raw, &v) == nil {
+					token = v
+				}
+			}
+			ss.mu.Lock()
+			defer ss.mu.Unlock()
+			if token == "" || token != ss.current {
+				return nil, NewFault("soap:Client.SessionExpired", "session expired")
+			}
+			return &FooResponse{Bar: "ok"}, nil
+		},
+	)
+	return soapSrv
+}
+
+func newSessionClient(url string, session *sessionHeader, reauthentications *callCounter) *Client {
+	c := NewClient(url, nil)
+	c.Headers = []interface{}{session}
+	c.ReauthenticateFaults = []FaultMatcher{{Code: "Client.SessionExpired"}}
+	c.Reauthenticate = func(ctx context.Context, c *Client, fault *FaultError) error {
+		reauthentications.inc()
+		response := &FooResponse{}
+		if _, err := c.Call(ctx, "login", &FooRequest{}, response); err != nil {
+			return err
+		}
+		session.set(response.Bar)
+		return nil
+	}
+	return c
+}
+
+type callCounter struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (ic *callCounter) inc() {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	ic.n++
+}
+
+func (ic *callCounter) get() int {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	return ic.n
+}
+
+func TestClient_Reauthenticate(t *testing.T) {
+	t.Run("session expired", func(t *testing.T) {
+		ss := &sessionServer{}
+		srv := httptest.NewServer(ss.handler())
+		defer srv.Close()
+		session := &sessionHeader{}
+		reauthentications := &callCounter{}
+		c := newSessionClient(srv.URL+"/pathTo", session, reauthentications)
+
+		for _, want := range []int{1, 1, 2} {
+			if want == 2 {
+				ss.expire()
+			}
+			response := &FooResponse{}
+			_, err := c.Call(context.Background(), "foo", &FooRequest{}, response)
+			require.NoError(t, err)
+			assert.Equal(t, "ok", response.Bar)
+			assert.Equal(t, want, ss.logins)
+		}
+		assert.Equal(t, 2, reauthentications.get())
+	})
+
+	t.Run("concurrent calls share one login", func(t *testing.T) {
+		ss := &sessionServer{}
+		srv := httptest.NewServer(ss.handler())
+		defer srv.Close()
+		session := &sessionHeader{}
+		reauthentications := &callCounter{}
+		c := newSessionClient(srv.URL+"/pathTo", session, reauthentications)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for i := 0; i < cap(errs); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{})
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, 1, ss.logins)
+		assert.Equal(t, 1, reauthentications.get())
+	})
+
+	t.Run("login doesn't reauthenticate", func(t *testing.T) {
+		ss := &sessionServer{failNext: true}
+		srv := httptest.NewServer(ss.handler())
+		defer srv.Close()
+		reauthentications := &callCounter{}
+		c := newSessionClient(srv.URL+"/pathTo", &sessionHeader{}, reauthentications)
+
+		_, err := c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{})
+		var fe *FaultError
+		require.True(t, errors.As(err, &fe), "%v", err)
+		assert.Contains(t, err.Error(), "could not reauthenticate")
+		assert.Equal(t, 1, ss.logins)
+		assert.Equal(t, 1, reauthentications.get())
+	})
+
+	t.Run("other faults", func(t *testing.T) {
+		ss := &sessionServer{}
+		srv := httptest.NewServer(ss.handler())
+		defer srv.Close()
+		reauthentications := &callCounter{}
+		c := newSessionClient(srv.URL+"/pathTo", &sessionHeader{}, reauthentications)
+		c.ReauthenticateFaults = []FaultMatcher{{Code: "Client.TokenRevoked"}}
+
+		_, err := c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{})
+		require.Error(t, err)
+		assert.Equal(t, 0, reauthentications.get())
+	})
+}
+
+func TestClient_OnAuthError(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		current = "token-1"
+		issued  = 1
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		valid := r.Header.Get("X-Session") == current
+		mu.Unlock()
+		if !valid {
+			w.Header().Set("WWW-Authenticate", `Session realm="soap"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><FooResponse><Bar>ok</Bar></FooResponse></Body></Envelope>`))
+	}))
+	defer srv.Close()
+
+	var session sessionHeader
+	session.set("stale")
+	refreshes := &callCounter{}
+	c := NewClient(srv.URL, nil)
+	c.RequestHeaderFn = func(header http.Header) {
+		session.mu.Lock()
+		defer session.mu.Unlock()
+		header.Set("X-Session", session.token)
+	}
+	c.OnAuthError = func(ctx context.Context, resp *http.Response) error {
+		refreshes.inc()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		mu.Lock()
+		defer mu.Unlock()
+		session.set(current)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, refreshes.get(), "concurrent calls share one refresh")
+
+	t.Run("still rejected", func(t *testing.T) {
+		mu.Lock()
+		issued++
+		current = fmt.Sprintf("token-%d", issued)
+		mu.Unlock()
+		c.OnAuthError = func(ctx context.Context, resp *http.Response) error {
+			refreshes.inc()
+			return nil
+		}
+		_, err := c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{})
+		var ae *AuthError
+		require.ErrorAs(t, err, &ae)
+		assert.Equal(t, 2, refreshes.get(), "retried exactly once")
+	})
+
+	t.Run("refresh fails", func(t *testing.T) {
+		failed := errors.New("identity provider down")
+		c.OnAuthError = func(ctx context.Context, resp *http.Response) error {
+			return failed
+		}
+		_, err := c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{})
+		assert.ErrorIs(t, err, failed)
+		assert.Contains(t, err.Error(), "could not reauthenticate after authentication failed: 401")
+	})
+}
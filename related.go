@@ -0,0 +1,304 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+)
+
+// rootContentID is the Content-ID of the envelope part of multipart/related
+// messages written by this package.
+const rootContentID = "rootpart@soap"
+
+const mediaTypeXOP = "application/xop+xml"
+
+// MultipartOptions configures WriteMultipartRelated.
+type MultipartOptions struct {
+	// MTOM writes an MTOM/XOP message, the envelope part is
+	// application/xop+xml. Otherwise the message follows SOAP with
+	// Attachments, the envelope part has the SOAP media type.
+	MTOM bool
+	// SoapVersion selects the media type of the envelope, SoapVersion11 if
+	// empty.
+	SoapVersion string
+	// EnvelopeContentType replaces the media type of the envelope derived
+	// from SoapVersion, e.g. to add an action parameter.
+	EnvelopeContentType string
+	// Boundary replaces the random boundary.
+	Boundary string
+	// TransferEncoding is used for attachments without a TransferEncoding,
+	// their Body is encoded with it if it is "base64" or "quoted-printable".
+	TransferEncoding string
+}
+
+// envelopeContentType returns the Content-Type of the envelope, before MTOM
+// packaging.
+func (opts MultipartOptions) envelopeContentType() string {
+	if opts.EnvelopeContentType != "" {
+		return opts.EnvelopeContentType
+	}
+	mediaType := mediaTypeSoap11
+	if opts.SoapVersion == SoapVersion12 {
+		mediaType = mediaTypeSoap12
+	}
+	return mime.FormatMediaType(mediaType, map[string]string{"charset": "utf-8"})
+}
+
+// rootContentType returns the Content-Type of the envelope part.
+func (opts MultipartOptions) rootContentType() string {
+	if !opts.MTOM {
+		return opts.envelopeContentType()
+	}
+	mediaType, _, _ := mime.ParseMediaType(opts.envelopeContentType())
+	return mime.FormatMediaType(mediaTypeXOP, map[string]string{"charset": "utf-8", "type": mediaType})
+}
+
+// contentType returns the Content-Type of the message.
+func (opts MultipartOptions) contentType() string {
+	rootType, _, _ := mime.ParseMediaType(opts.rootContentType())
+	params := map[string]string{
+		"type":     rootType,
+		"start":    "<" + rootContentID + ">",
+		"boundary": opts.Boundary,
+	}
+	if opts.MTOM {
+		params["start-info"], _, _ = mime.ParseMediaType(opts.envelopeContentType())
+	}
+	return mime.FormatMediaType("multipart/related", params)
+}
+
+// WriteMultipartRelated writes a multipart/related message of envelope and
+// atts to w, e.g. for a transport other than HTTP, and returns its
+// Content-Type. The Client sends attachments the same way, see
+// WithAttachments.
+func WriteMultipartRelated(w io.Writer, envelope []byte, atts []Attachment, opts MultipartOptions) (contentType string, err error) {
+	if opts.Boundary == "" {
+		opts.Boundary = RandomIDs{}.NewID(IDBoundary)
+	}
+	attachments := make([]*Attachment, len(atts))
+	for i := range atts {
+		attachments[i] = &atts[i]
+	}
+	if err := writeMultipartRelated(w, envelope, NewAttachmentReader(attachments...), opts); err != nil {
+		return "", err
+	}
+	return opts.contentType(), nil
+}
+
+// writeMultipartRelated writes the message of envelope and attachments with
+// the boundary of opts to w.
+func writeMultipartRelated(w io.Writer, envelope []byte, attachments *AttachmentReader, opts MultipartOptions) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(opts.Boundary); err != nil {
+		return err
+	}
+	pw, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {opts.rootContentType()},
+		"Content-Id":   {"<" + rootContentID + ">"},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := pw.Write(envelope); err != nil {
+		return err
+	}
+	for {
+		a, err := attachments.Next()
+		if err == io.EOF {
+			return mw.Close()
+		}
+		if err != nil {
+			return err
+		}
+		transferEncoding, encode := a.TransferEncoding, false
+		if transferEncoding == "" && opts.TransferEncoding != "" {
+			transferEncoding, encode = opts.TransferEncoding, true
+		}
+		h := textproto.MIMEHeader{}
+		if a.ContentType != "" {
+			h.Set("Content-Type", a.ContentType)
+		}
+		if a.ContentID != "" {
+			h.Set("Content-Id", "<"+a.ContentID+">")
+		}
+		if transferEncoding != "" {
+			h.Set("Content-Transfer-Encoding", transferEncoding)
+		}
+		pw, err := mw.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		if err := copyEncoded(pw, a.Body, transferEncoding, encode); err != nil {
+			return err
+		}
+	}
+}
+
+// copyEncoded copies r to w, encoded with transferEncoding if encode is set.
+func copyEncoded(w io.Writer, r io.Reader, transferEncoding string, encode bool) error {
+	var ew io.WriteCloser
+	switch {
+	case encode && strings.EqualFold(transferEncoding, "base64"):
+		ew = base64.NewEncoder(base64.StdEncoding, &lineWriter{w: w})
+	case encode && strings.EqualFold(transferEncoding, "quoted-printable"):
+		ew = quotedprintable.NewWriter(w)
+	default:
+		_, err := io.Copy(w, r)
+		return err
+	}
+	if _, err := io.Copy(ew, r); err != nil {
+		return err
+	}
+	return ew.Close()
+}
+
+// lineWriter breaks base64 into lines of 76 characters, as MIME requires.
+type lineWriter struct {
+	w   io.Writer
+	col int
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if lw.col == 76 {
+			if _, err := lw.w.Write([]byte("\r\n")); err != nil {
+				return n, err
+			}
+			lw.col = 0
+		}
+		chunk := p
+		if len(chunk) > 76-lw.col {
+			chunk = chunk[:76-lw.col]
+		}
+		m, err := lw.w.Write(chunk)
+		n += m
+		lw.col += m
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// Decoded returns the Body decoded from its TransferEncoding. Bodies of other
+// encodings than base64 and quoted-printable are returned as they are.
+func (a *Attachment) Decoded() io.Reader {
+	switch {
+	case strings.EqualFold(a.TransferEncoding, "base64"):
+		return base64.NewDecoder(base64.StdEncoding, a.Body)
+	case strings.EqualFold(a.TransferEncoding, "quoted-printable"):
+		return quotedprintable.NewReader(a.Body)
+	}
+	return a.Body
+}
+
+// ReadMultipartRelated reads the multipart/related message in r with the
+// Content-Type contentType, e.g. received by a transport other than HTTP. The
+// envelope must be the first part. The Bodies of atts are read into memory,
+// they are kept in their TransferEncoding, see Attachment.Decoded. The Server
+// reads requests the same way, see RequestAttachments.
+func ReadMultipartRelated(contentType string, r io.Reader) (envelope []byte, atts []Attachment, err error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mediaType != "multipart/related" {
+		return nil, nil, fmt.Errorf("not a multipart/related message: %q", mediaType)
+	}
+	envelope, attachments, _, err := readMultipartRelated(r, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	for {
+		a, err := attachments.Next()
+		if err == io.EOF {
+			return envelope, atts, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		body, err := ioutil.ReadAll(a.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+		a.Body = bytes.NewReader(body)
+		atts = append(atts, *a)
+	}
+}
+
+// readMultipartRelated reads the envelope part of the multipart/related
+// message in r with the Content-Type params and returns it with the remaining
+// parts. The envelope must be the first part. The stats grow as the remaining
+// parts are read.
+func readMultipartRelated(r io.Reader, params map[string]string) ([]byte, *AttachmentReader, *MultipartStats, error) {
+	root, attachments, stats, err := openMultipartRelated(r, params)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	envelope, err := ioutil.ReadAll(root)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not read root part: %w", err)
+	}
+	return envelope, attachments, stats, nil
+}
+
+// openMultipartRelated is readMultipartRelated leaving the envelope part to
+// be read from root, before the remaining parts.
+func openMultipartRelated(r io.Reader, params map[string]string) (root io.Reader, attachments *AttachmentReader, stats *MultipartStats, err error) {
+	mr := multipart.NewReader(r, params["boundary"])
+	p, err := mr.NextRawPart()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not read root part: %w", err)
+	}
+	if start := strings.Trim(params["start"], "<>"); start != "" && contentID(p.Header) != start {
+		return nil, nil, nil, fmt.Errorf("root part %q is not the first part", start)
+	}
+	stats = &MultipartStats{Parts: []PartStats{{
+		ContentType: p.Header.Get("Content-Type"),
+		ContentID:   contentID(p.Header),
+	}}}
+	return &countingPart{Reader: p, stats: stats}, &AttachmentReader{next: func() (*Attachment, error) {
+		// Raw parts keep their transfer encoding, to forward them as they are.
+		p, err := mr.NextRawPart()
+		if err != nil {
+			return nil, err
+		}
+		stats.Parts = append(stats.Parts, PartStats{
+			ContentType: p.Header.Get("Content-Type"),
+			ContentID:   contentID(p.Header),
+		})
+		return &Attachment{
+			ContentID:        contentID(p.Header),
+			ContentType:      p.Header.Get("Content-Type"),
+			TransferEncoding: p.Header.Get("Content-Transfer-Encoding"),
+			Body:             &countingPart{Reader: p, stats: stats, i: len(stats.Parts) - 1},
+		}, nil
+	}}, stats, nil
+}
+
+// countingPart counts the bytes read from a part into the Size of its
+// PartStats.
+type countingPart struct {
+	io.Reader
+	stats *MultipartStats
+	i     int
+}
+
+func (cp *countingPart) Read(p []byte) (int, error) {
+	n, err := cp.Reader.Read(p)
+	cp.stats.Parts[cp.i].Size += int64(n)
+	return n, err
+}
+
+func contentID(h textproto.MIMEHeader) string {
+	return strings.Trim(h.Get("Content-ID"), "<>")
+}
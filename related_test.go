@@ -0,0 +1,101 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultipartRelated(t *testing.T) {
+	envelope := []byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><fooRequest/></soap:Body></soap:Envelope>`)
+	blob := bytes.Repeat([]byte{0, 1, 2, 0xff}, 100)
+
+	for name, tc := range map[string]struct {
+		opts            MultipartOptions
+		wantContentType string
+		wantRootType    string
+	}{
+		"SwA": {
+			opts:            MultipartOptions{Boundary: "b1", TransferEncoding: "base64"},
+			wantContentType: `multipart/related; boundary=b1; start="<rootpart@soap>"; type="text/xml"`,
+			wantRootType:    "text/xml; charset=utf-8",
+		},
+		"MTOM 1.2": {
+			opts:            MultipartOptions{MTOM: true, SoapVersion: SoapVersion12, Boundary: "b2", TransferEncoding: "base64"},
+			wantContentType: `multipart/related; boundary=b2; start="<rootpart@soap>"; start-info="application/soap+xml"; type="application/xop+xml"`,
+			wantRootType:    `application/xop+xml; charset=utf-8; type="application/soap+xml"`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			contentType, err := WriteMultipartRelated(&buf, envelope, []Attachment{
+				{ContentID: "blob@example.com", ContentType: "application/octet-stream", Body: bytes.NewReader(blob)},
+				{ContentID: "note@example.com", ContentType: "text/plain", TransferEncoding: "8bit", Body: strings.NewReader("as is")},
+			}, tc.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantContentType, contentType)
+			assert.Contains(t, buf.String(), "Content-Type: "+tc.wantRootType+"\r\n")
+			for _, line := range strings.Split(buf.String(), "\r\n") {
+				assert.LessOrEqual(t, len(line), 998, "MIME line length")
+			}
+
+			gotEnvelope, atts, err := ReadMultipartRelated(contentType, &buf)
+			require.NoError(t, err)
+			assert.Equal(t, envelope, gotEnvelope)
+			require.Len(t, atts, 2)
+			assert.Equal(t, "blob@example.com", atts[0].ContentID)
+			assert.Equal(t, "base64", atts[0].TransferEncoding)
+			decoded, err := ioutil.ReadAll(atts[0].Decoded())
+			require.NoError(t, err)
+			assert.Equal(t, blob, decoded)
+			assert.Equal(t, "8bit", atts[1].TransferEncoding)
+			body, err := ioutil.ReadAll(atts[1].Decoded())
+			require.NoError(t, err)
+			assert.Equal(t, "as is", string(body))
+		})
+	}
+
+	t.Run("client requests", func(t *testing.T) {
+		var (
+			contentType string
+			request     []byte
+		)
+		c := NewClient("http://localhorst.ch", nil)
+		c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+			contentType = r.Header.Get("Content-Type")
+			request, _ = ioutil.ReadAll(r.Body)
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		})}).Do
+		_, err := c.Call(context.Background(), "foo", &FooRequest{}, nil, WithAttachments(NewAttachmentReader(
+			&Attachment{ContentID: "a@example.com", ContentType: "text/plain", Body: strings.NewReader("a")},
+		)))
+		require.NoError(t, err)
+
+		gotEnvelope, atts, err := ReadMultipartRelated(contentType, bytes.NewReader(request))
+		require.NoError(t, err)
+		assert.Contains(t, string(gotEnvelope), "<fooRequest>")
+		require.Len(t, atts, 1)
+		assert.Equal(t, "a@example.com", atts[0].ContentID)
+	})
+
+	t.Run("root part first", func(t *testing.T) {
+		body := "--b\r\nContent-Id: <att>\r\n\r\nx\r\n--b\r\nContent-Id: <root>\r\n\r\n<soap:Envelope/>\r\n--b--\r\n"
+		_, _, err := ReadMultipartRelated(`multipart/related; boundary=b; start="<root>"`, strings.NewReader(body))
+		assert.EqualError(t, err, `root part "root" is not the first part`)
+
+		gotEnvelope, atts, err := ReadMultipartRelated(`multipart/related; boundary=b`, strings.NewReader(body))
+		require.NoError(t, err)
+		assert.Equal(t, "x", string(gotEnvelope))
+		require.Len(t, atts, 1)
+		assert.Equal(t, "root", atts[0].ContentID)
+
+		_, _, err = ReadMultipartRelated("text/xml", strings.NewReader(body))
+		assert.EqualError(t, err, `not a multipart/related message: "text/xml"`)
+	})
+}
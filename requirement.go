@@ -0,0 +1,76 @@
+package soap
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// HeaderRequirement is how strictly a header block is required in responses,
+// see CallPolicy.ResponseHeaders.
+type HeaderRequirement int
+
+const (
+	// HeaderOptional header blocks may be missing silently.
+	HeaderOptional HeaderRequirement = iota
+	// HeaderExpected header blocks are logged as missing with the action and
+	// counted in the missing_headers metric of EnableExpvar, the call
+	// succeeds.
+	HeaderExpected
+	// HeaderRequired header blocks fail the call with a *MissingHeaderError
+	// if they are missing.
+	HeaderRequired
+)
+
+// MissingHeaderError is returned for a response missing a header block
+// required by CallPolicy.ResponseHeaders. The response has been decoded
+// nevertheless.
+type MissingHeaderError struct {
+	Action string
+	Header xml.Name
+}
+
+func (me *MissingHeaderError) Error() string {
+	return fmt.Sprintf("response of action %q is missing the required header block {%s}%s", me.Action, me.Header.Space, me.Header.Local)
+}
+
+// checkResponseHeaders checks the header blocks of a successful response to
+// a call of action against the requirements of its policy.
+func (c *Client) checkResponseHeaders(action string, o *callOptions) error {
+	requirements := o.stats.Policy.ResponseHeaders
+	if len(requirements) == 0 {
+		return nil
+	}
+	received := make(map[xml.Name]bool, len(o.stats.ResponseHeaders))
+	for _, block := range o.stats.ResponseHeaders {
+		received[block.Name] = true
+	}
+	for _, name := range sortedHeaderNames(requirements) {
+		if received[name] {
+			continue
+		}
+		switch requirements[name] {
+		case HeaderRequired:
+			return protocolError(&MissingHeaderError{Action: action, Header: name})
+		case HeaderExpected:
+			if c.Log != nil {
+				c.Log("WARNING: expected response header block missing", "action", action, "header", "{"+name.Space+"}"+name.Local)
+			}
+			c.metrics.missingHeader(action)
+		}
+	}
+	return nil
+}
+
+// sortedHeaderNames returns the names of requirements sorted by namespace and
+// local name, so they are checked in a stable order.
+func sortedHeaderNames(requirements map[xml.Name]HeaderRequirement) []xml.Name {
+	keys := make(map[string]xml.Name, len(requirements))
+	for name := range requirements {
+		keys[name.Space+" "+name.Local] = name
+	}
+	names := make([]xml.Name, 0, len(keys))
+	for _, key := range sortedKeys(keys) {
+		names = append(names, keys[key])
+	}
+	return names
+}
@@ -0,0 +1,59 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"expvar"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Call_responseHeaderRequirements(t *testing.T) {
+	session := xml.Name{Space: "urn:example:session", Local: "Session"}
+	trace := xml.Name{Space: "urn:example:trace", Local: "TraceID"}
+	hint := xml.Name{Space: "urn:example:trace", Local: "Hint"}
+
+	var logged []string
+	c := NewClient("http://localhorst.ch", nil)
+	c.EnableExpvar("soap_test_requirements")
+	c.Log = func(msg string, kv ...interface{}) {
+		if strings.HasPrefix(msg, "WARNING: expected") {
+			logged = append(logged, msg+" "+kv[1].(string)+" "+kv[3].(string))
+		}
+	}
+	c.Policies = map[string]CallPolicy{
+		"strict":  {ResponseHeaders: map[xml.Name]HeaderRequirement{session: HeaderRequired, trace: HeaderExpected}},
+		"lenient": {ResponseHeaders: map[xml.Name]HeaderRequirement{trace: HeaderExpected, hint: HeaderOptional}},
+	}
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+	<Header><Session xmlns="urn:example:session">s-1</Session></Header>
+	<Body><FooResponse><Bar>ok</Bar></FooResponse></Body>
+</Envelope>`))}, nil
+	})}).Do
+
+	response := &FooResponse{}
+	_, err := c.Call(context.Background(), "lenient", &FooRequest{}, response)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", response.Bar)
+	assert.Equal(t, []string{"WARNING: expected response header block missing lenient {urn:example:trace}TraceID"}, logged)
+	assert.Equal(t, "1", expvar.Get("soap_test_requirements.missing_headers").(*expvar.Map).Get("lenient").String())
+
+	_, err = c.Call(context.Background(), "strict", &FooRequest{}, response)
+	require.NoError(t, err, "the required header block is there")
+
+	c.Policies["strict"].ResponseHeaders[xml.Name{Space: "urn:example:session", Local: "Expiry"}] = HeaderRequired
+	httpResponse, err := c.Call(context.Background(), "strict", &FooRequest{}, response)
+	var me *MissingHeaderError
+	require.True(t, errors.As(err, &me), "%v", err)
+	assert.Equal(t, ErrorKindProtocol, KindOf(err))
+	assert.Equal(t, "strict", me.Action)
+	assert.Equal(t, `response of action "strict" is missing the required header block {urn:example:session}Expiry`, me.Error())
+	assert.NotNil(t, httpResponse)
+}
@@ -0,0 +1,290 @@
+package soap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FaultError is returned by Client calls for a SOAP Fault response. Use
+// errors.As to retrieve it.
+type FaultError struct {
+	Fault *Fault
+	// Raw is the Fault element as received.
+	Raw []byte
+	// Recovered is set if the Fault element isn't well-formed XML, its fields
+	// have been extracted on a best-effort basis.
+	Recovered bool
+
+	formatted string // the Fault element formatted for Error()
+}
+
+func (fe *FaultError) Error() string {
+	if fe.Recovered {
+		return fmt.Sprintf("SOAP FAULT (recovered from malformed XML): %q", fe.Fault.String)
+	}
+	return fmt.Sprintf("SOAP FAULT: %q", fe.formatted)
+}
+
+func (fe *FaultError) Unwrap() error {
+	return fe.Fault
+}
+
+// FaultMatcher matches SOAP Faults, see Client.RetryableFaults. Empty fields
+// match every fault.
+type FaultMatcher struct {
+	// Code is compared to the faultcode. Without a prefix it matches the local
+	// part of the faultcode regardless of the prefix.
+	Code string
+	// String is matched against the faultstring.
+	String *regexp.Regexp
+}
+
+// Match reports whether fm matches f.
+func (fm FaultMatcher) Match(f *Fault) bool {
+	if fm.Code != "" && fm.Code != f.Code {
+		if strings.Contains(fm.Code, ":") || fm.Code != f.Code[strings.LastIndex(f.Code, ":")+1:] {
+			return false
+		}
+	}
+	return fm.String == nil || fm.String.MatchString(f.String)
+}
+
+// RetryPolicy configures retries of Client calls, the request envelope is
+// replayed for every attempt. Retries are off unless a policy is set, see
+// Client.RetryPolicy, CallPolicy and WithRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one,
+	// values below 2 disable retries.
+	MaxAttempts int
+	// Backoff is the pause between the first two attempts.
+	Backoff time.Duration
+	// Multiplier grows the pause after every further attempt, exponentially
+	// for values above 1. The pause stays Backoff otherwise.
+	Multiplier float64
+	// MaxBackoff caps the pause, 0 means no cap.
+	MaxBackoff time.Duration
+	// Jitter randomizes the pause by up to this fraction of it in either
+	// direction, e.g. 0.2 for ±20%.
+	Jitter float64
+	// RetryableStatusCodes are the HTTP statuses retried, e.g. 429, 502 and
+	// 503. If set, responses failing with a *StatusError are retried only if
+	// their status is listed.
+	RetryableStatusCodes []int
+	// RetryableKinds are the kinds of errors retried, if set, instead of
+	// ErrorKindTransport. An *AuthError is never retried, nor is a SOAP Fault
+	// of ErrorKindApplication not matching Client.RetryableFaults.
+	RetryableKinds []ErrorKind
+	// MaxRetryAfter caps the pause requested by the Retry-After header of a
+	// response, DefaultMaxRetryAfter if 0. Longer requests are cut down to it.
+	MaxRetryAfter time.Duration
+	// IgnoreRetryAfter always pauses for the computed backoff.
+	IgnoreRetryAfter bool
+	// Retryable decides whether a failed attempt is retried. resp is the HTTP
+	// response of the attempt, if any, err can be inspected with KindOf and
+	// errors.As, e.g. for a *StatusError. It replaces RetryableStatusCodes,
+	// RetryableKinds and DefaultRetryable. SOAP Faults are retried only if
+	// they match Client.RetryableFaults, whatever the policy says.
+	Retryable func(resp *http.Response, err error) bool
+}
+
+// DefaultMaxRetryAfter is the cap of the Retry-After pause of a RetryPolicy
+// without MaxRetryAfter.
+const DefaultMaxRetryAfter = 2 * time.Minute
+
+// DefaultRetryable retries transport errors and responses with the status 429
+// Too Many Requests, unless the context of the call is done. SOAP Faults are
+// only retried if they match Client.RetryableFaults, an *AuthError is never
+// retried.
+func DefaultRetryable(resp *http.Response, err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var se *StatusError
+	if errors.As(err, &se) && se.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return KindOf(err) == ErrorKindTransport
+}
+
+// retryable reports whether the attempt failing with err is retried under rp.
+// Attempts which failed after part of the response body has been read are
+// never retried.
+func (c *Client) retryable(rp *RetryPolicy, resp *http.Response, err error) bool {
+	if errors.Is(err, errBodyConsumed) {
+		return false
+	}
+	var fe *FaultError
+	if errors.As(err, &fe) {
+		for _, fm := range c.RetryableFaults {
+			if fm.Match(fe.Fault) {
+				return true
+			}
+		}
+		return false
+	}
+	if rp.Retryable != nil {
+		return rp.Retryable(resp, err)
+	}
+	return rp.retryable(resp, err)
+}
+
+// retryable applies RetryableStatusCodes and RetryableKinds, falling back to
+// DefaultRetryable.
+func (rp *RetryPolicy) retryable(resp *http.Response, err error) bool {
+	var (
+		ae *AuthError
+		se *StatusError
+	)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.As(err, &ae) {
+		return false
+	}
+	if len(rp.RetryableStatusCodes) > 0 && errors.As(err, &se) {
+		for _, code := range rp.RetryableStatusCodes {
+			if code == se.StatusCode {
+				return true
+			}
+		}
+		return false
+	}
+	if len(rp.RetryableKinds) > 0 {
+		kind := KindOf(err)
+		for _, k := range rp.RetryableKinds {
+			if k == kind {
+				return true
+			}
+		}
+		return false
+	}
+	return DefaultRetryable(resp, err)
+}
+
+// backoff returns the pause after attempt n.
+func (rp *RetryPolicy) backoff(n int) time.Duration {
+	d := float64(rp.Backoff)
+	for i := 1; i < n && rp.Multiplier > 1; i++ {
+		d *= rp.Multiplier
+		if rp.MaxBackoff > 0 && d >= float64(rp.MaxBackoff) {
+			break
+		}
+	}
+	if rp.MaxBackoff > 0 && d > float64(rp.MaxBackoff) {
+		d = float64(rp.MaxBackoff)
+	}
+	if rp.Jitter > 0 {
+		d *= 1 - rp.Jitter + 2*rp.Jitter*randomFraction()
+	}
+	return time.Duration(d)
+}
+
+// pause returns the pause after attempt n, which failed with resp: the time
+// requested by its Retry-After header, if valid, or the backoff.
+func (rp *RetryPolicy) pause(n int, resp *http.Response, now time.Time) time.Duration {
+	if rp.IgnoreRetryAfter || resp == nil {
+		return rp.backoff(n)
+	}
+	d, ok := retryAfter(resp.Header.Get("Retry-After"), now)
+	if !ok {
+		return rp.backoff(n)
+	}
+	limit := rp.MaxRetryAfter
+	if limit <= 0 {
+		limit = DefaultMaxRetryAfter
+	}
+	if d > limit {
+		d = limit
+	}
+	return d
+}
+
+// retryAfter parses the value of a Retry-After header, delay-seconds or an
+// HTTP-date.
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		if seconds > int64(math.MaxInt64/time.Second) {
+			seconds = int64(math.MaxInt64 / time.Second)
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if d := date.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// randomFraction returns a random number in [0, 1).
+func randomFraction() float64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0.5
+	}
+	return float64(binary.BigEndian.Uint64(b[:])>>11) / (1 << 53)
+}
+
+// retry runs attempt until it succeeds, fails with an error which isn't
+// retryable or the attempts of rp are exhausted. The result of the last attempt
+// is returned.
+func (c *Client) retry(ctx context.Context, rp *RetryPolicy, attempt func() (*http.Response, error)) (*http.Response, error) {
+	reauthenticated := false
+	for n := 1; ; n++ {
+		generation := c.reauthGeneration()
+		resp, err := attempt()
+		var ae *AuthError
+		if errors.As(err, &ae) && !reauthenticated && c.OnAuthError != nil && ctx.Value(reauthenticatingKey{}) == nil {
+			if c.Log != nil {
+				c.Log("Reauthenticating", "error", err)
+			}
+			reauthErr := c.reauthenticate(ctx, generation, func(ctx context.Context) error {
+				return c.OnAuthError(ctx, ae.response)
+			})
+			if reauthErr != nil {
+				return resp, fmt.Errorf("could not reauthenticate after %v: %w", err, reauthErr)
+			}
+			c.refreshCredentials()
+			reauthenticated = true
+			n--
+			continue
+		}
+		if errors.As(err, &ae) && !reauthenticated && c.refreshCredentials() {
+			if c.Log != nil {
+				c.Log("Retrying with refreshed credentials", "error", err)
+			}
+			reauthenticated = true
+			n--
+			continue
+		}
+		if err == nil || rp == nil || n >= rp.MaxAttempts || !c.retryable(rp, resp, err) {
+			return resp, err
+		}
+		now := clockOrDefault(c.Clock).Now()
+		pause := rp.pause(n, resp, now)
+		if deadline, ok := ctx.Deadline(); ok && deadline.Sub(now) < pause {
+			return resp, err // the next attempt would miss the deadline
+		}
+		if c.Log != nil {
+			c.Log("Retrying", "attempt", n, "backoff", pause, "error", err)
+		}
+		if sleepErr := clockOrDefault(c.Clock).Sleep(ctx, pause); sleepErr != nil {
+			return resp, err
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sleepRecorder is a Clock whose time only moves when Sleep is called.
+type sleepRecorder struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (sr *sleepRecorder) Now() time.Time { return sr.now }
+
+func (sr *sleepRecorder) Sleep(ctx context.Context, d time.Duration) error {
+	sr.sleeps = append(sr.sleeps, d)
+	sr.now = sr.now.Add(d)
+	return ctx.Err()
+}
+
+func (sr *sleepRecorder) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+func faultResponse(code, str string) func(r *http.Request) (*http.Response, error) {
+	return func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 500,
+			Body: ioutil.NopCloser(strings.NewReader(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><Fault>
+<faultcode>` + code + `</faultcode><faultstring>` + str + `</faultstring></Fault></Body></Envelope>`)),
+		}, nil
+	}
+}
+
+func TestFaultMatcher(t *testing.T) {
+	f := &Fault{Code: "soap:Server.Busy", String: "Server too busy, try again"}
+	assert.True(t, FaultMatcher{}.Match(f))
+	assert.True(t, FaultMatcher{Code: "soap:Server.Busy"}.Match(f))
+	assert.True(t, FaultMatcher{Code: "Server.Busy"}.Match(f))
+	assert.False(t, FaultMatcher{Code: "s:Server.Busy"}.Match(f))
+	assert.False(t, FaultMatcher{Code: "Server"}.Match(f))
+	assert.True(t, FaultMatcher{Code: "Server.Busy", String: regexp.MustCompile(`try again`)}.Match(f))
+	assert.False(t, FaultMatcher{String: regexp.MustCompile(`^Invalid`)}.Match(f))
+}
+
+func TestClientRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		responses    []func(r *http.Request) (*http.Response, error)
+		faults       []FaultMatcher
+		kinds        []ErrorKind
+		retryable    func(resp *http.Response, err error) bool
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name: "transport error",
+			responses: []func(r *http.Request) (*http.Response, error){
+				func(r *http.Request) (*http.Response, error) { return nil, syscall.ECONNRESET },
+				faultResponse("soap:Server", "unrelated"),
+			},
+			wantAttempts: 2,
+			wantErr:      true,
+		},
+		{
+			name: "fault not retried by default",
+			responses: []func(r *http.Request) (*http.Response, error){
+				faultResponse("soap:Server.Busy", "busy"),
+			},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name: "retryable fault",
+			responses: []func(r *http.Request) (*http.Response, error){
+				faultResponse("soap:Server.Busy", "busy"),
+				faultResponse("soap:Server.Busy", "busy"),
+				faultResponse("soap:Server.Busy", "busy"),
+			},
+			faults:       []FaultMatcher{{Code: "Server.Busy"}},
+			wantAttempts: 3,
+			wantErr:      true,
+		},
+		{
+			name: "fault not matching RetryableFaults",
+			responses: []func(r *http.Request) (*http.Response, error){
+				faultResponse("soap:Client", "invalid request"),
+			},
+			faults:       []FaultMatcher{{Code: "Server.Busy"}},
+			kinds:        []ErrorKind{ErrorKindApplication},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name: "fault and a custom predicate",
+			responses: []func(r *http.Request) (*http.Response, error){
+				faultResponse("soap:Client", "invalid request"),
+			},
+			retryable:    func(resp *http.Response, err error) bool { return true },
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name: "custom predicate",
+			responses: []func(r *http.Request) (*http.Response, error){
+				func(r *http.Request) (*http.Response, error) { return nil, syscall.ECONNRESET },
+			},
+			retryable:    func(resp *http.Response, err error) bool { return false },
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				attempts int
+				bodies   []string
+			)
+			clock := &sleepRecorder{}
+			c := NewClient("http://localhorst.ch", nil)
+			c.Clock = clock
+			c.RetryPolicy = &RetryPolicy{MaxAttempts: 3, Backoff: time.Second, RetryableKinds: test.kinds, Retryable: test.retryable}
+			c.RetryableFaults = test.faults
+			c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+				body, _ := ioutil.ReadAll(r.Body)
+				bodies = append(bodies, string(body))
+				rt := test.responses[attempts]
+				attempts++
+				return rt(r)
+			})}).Do
+			_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{Foo: "bar"}, &FooResponse{})
+			assert.Equal(t, test.wantErr, err != nil)
+			assert.Equal(t, test.wantAttempts, attempts)
+			assert.Len(t, clock.sleeps, test.wantAttempts-1)
+			for _, body := range bodies {
+				assert.Equal(t, bodies[0], body, "request replayed")
+			}
+		})
+	}
+
+	t.Run("last fault returned", func(t *testing.T) {
+		c := NewClient("http://localhorst.ch", nil)
+		c.Clock = &sleepRecorder{}
+		c.RetryPolicy = &RetryPolicy{MaxAttempts: 2}
+		c.RetryableFaults = []FaultMatcher{{String: regexp.MustCompile(`busy`)}}
+		c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(faultResponse("soap:Server", "busy"))}).Do
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+		var fe *FaultError
+		require.True(t, errors.As(err, &fe))
+		assert.Equal(t, "busy", fe.Fault.String)
+		assert.Exactly(t, ErrorKindApplication, KindOf(err))
+		assert.Contains(t, err.Error(), "SOAP FAULT: ")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var attempts int
+		c := NewClient("http://localhorst.ch", nil)
+		c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+			attempts++
+			return nil, syscall.ECONNRESET
+		})}).Do
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+		require.Error(t, err)
+		assert.Equal(t, 1, attempts)
+	})
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	rp := &RetryPolicy{Backoff: 100 * time.Millisecond}
+	assert.Equal(t, 100*time.Millisecond, rp.backoff(3), "constant without Multiplier")
+
+	rp = &RetryPolicy{Backoff: 100 * time.Millisecond, Multiplier: 2, MaxBackoff: time.Second}
+	var pauses []time.Duration
+	for n := 1; n <= 6; n++ {
+		pauses = append(pauses, rp.backoff(n))
+	}
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}, pauses)
+
+	rp = &RetryPolicy{Backoff: time.Second, Jitter: 0.25}
+	for i := 0; i < 100; i++ {
+		pause := rp.backoff(1)
+		assert.True(t, pause >= 750*time.Millisecond && pause <= 1250*time.Millisecond, pause)
+	}
+}
+
+// brokenBody returns some bytes and then fails like a reset connection.
+type brokenBody struct {
+	sent bool
+}
+
+func (b *brokenBody) Read(p []byte) (int, error) {
+	if b.sent {
+		return 0, syscall.ECONNRESET
+	}
+	b.sent = true
+	return copy(p, `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body>`), nil
+}
+
+func (b *brokenBody) Close() error { return nil }
+
+func TestClientRetry_policy(t *testing.T) {
+	status := func(code int) func(r *http.Request) (*http.Response, error) {
+		return func(r *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: code, Body: ioutil.NopCloser(strings.NewReader("gateway says no"))}, nil
+		}
+	}
+	reset := func(r *http.Request) (*http.Response, error) { return nil, syscall.ECONNRESET }
+	tests := []struct {
+		name         string
+		policy       *RetryPolicy
+		timeout      time.Duration
+		response     func(r *http.Request) (*http.Response, error)
+		wantAttempts int
+		wantSleeps   []time.Duration
+	}{
+		{name: "off by default", response: reset, wantAttempts: 1},
+		{
+			name:         "exponential backoff",
+			policy:       &RetryPolicy{MaxAttempts: 4, Backoff: time.Second, Multiplier: 2},
+			response:     status(http.StatusBadGateway),
+			wantAttempts: 4,
+			wantSleeps:   []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+		},
+		{
+			name:         "retryable status code",
+			policy:       &RetryPolicy{MaxAttempts: 2, RetryableStatusCodes: []int{http.StatusTooManyRequests}},
+			response:     status(http.StatusTooManyRequests),
+			wantAttempts: 2,
+			wantSleeps:   []time.Duration{0},
+		},
+		{
+			name:         "status code not listed",
+			policy:       &RetryPolicy{MaxAttempts: 2, RetryableStatusCodes: []int{http.StatusTooManyRequests}},
+			response:     status(http.StatusServiceUnavailable),
+			wantAttempts: 1,
+		},
+		{
+			name:         "retryable kind",
+			policy:       &RetryPolicy{MaxAttempts: 2, RetryableKinds: []ErrorKind{ErrorKindProtocol}},
+			response:     status(http.StatusNotFound),
+			wantAttempts: 2,
+			wantSleeps:   []time.Duration{0},
+		},
+		{
+			name:         "kind not listed",
+			policy:       &RetryPolicy{MaxAttempts: 2, RetryableKinds: []ErrorKind{ErrorKindProtocol}},
+			response:     reset,
+			wantAttempts: 1,
+		},
+		{
+			name:   "body partly read",
+			policy: &RetryPolicy{MaxAttempts: 2},
+			response: func(r *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: 200, Body: &brokenBody{}}, nil
+			},
+			wantAttempts: 1,
+		},
+		{
+			name:         "deadline",
+			policy:       &RetryPolicy{MaxAttempts: 3, Backoff: time.Minute},
+			timeout:      time.Second,
+			response:     reset,
+			wantAttempts: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := 0
+			clock := &sleepRecorder{now: time.Now()}
+			c := NewClient("http://localhorst.ch", nil)
+			c.Clock = clock
+			c.RetryPolicy = test.policy
+			c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+				attempts++
+				return test.response(r)
+			})}).Do
+			var opts []CallOption
+			if test.timeout > 0 {
+				opts = append(opts, WithTimeout(test.timeout))
+			}
+			_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{}, opts...)
+			assert.Error(t, err)
+			assert.Equal(t, test.wantAttempts, attempts)
+			assert.Equal(t, test.wantSleeps, clock.sleeps)
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	for value, want := range map[string]time.Duration{
+		"3":                             3 * time.Second,
+		" 120 ":                         2 * time.Minute,
+		"Thu, 15 Oct 2026 12:00:30 GMT": 30 * time.Second,
+		"Thu, 15 Oct 2026 11:59:00 GMT": 0,
+	} {
+		d, ok := retryAfter(value, now)
+		assert.True(t, ok, value)
+		assert.Equal(t, want, d, value)
+	}
+	for _, value := range []string{"", "-1", "soon", "1.5", "Thursday"} {
+		_, ok := retryAfter(value, now)
+		assert.False(t, ok, value)
+	}
+}
+
+func TestClientRetry_retryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		policy     RetryPolicy
+		wantSleeps []time.Duration
+	}{
+		{name: "seconds", retryAfter: "3", wantSleeps: []time.Duration{3 * time.Second}},
+		{name: "date", retryAfter: "Thu, 15 Oct 2026 12:00:10 GMT", wantSleeps: []time.Duration{10 * time.Second}},
+		{name: "malformed", retryAfter: "later", wantSleeps: []time.Duration{time.Second}},
+		{name: "capped", retryAfter: "3600", policy: RetryPolicy{MaxRetryAfter: 30 * time.Second}, wantSleeps: []time.Duration{30 * time.Second}},
+		{name: "default cap", retryAfter: "3600", wantSleeps: []time.Duration{DefaultMaxRetryAfter}},
+		{name: "ignored", retryAfter: "3", policy: RetryPolicy{IgnoreRetryAfter: true}, wantSleeps: []time.Duration{time.Second}},
+	}
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		for _, test := range tests {
+			t.Run(http.StatusText(status)+"/"+test.name, func(t *testing.T) {
+				attempts := 0
+				clock := &sleepRecorder{now: time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)}
+				c := NewClient("http://localhorst.ch", nil)
+				c.Clock = clock
+				policy := test.policy
+				policy.MaxAttempts, policy.Backoff = 2, time.Second
+				c.RetryPolicy = &policy
+				c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+					attempts++
+					if attempts == 1 {
+						return &http.Response{StatusCode: status, Header: http.Header{"Retry-After": {test.retryAfter}}, Body: http.NoBody}, nil
+					}
+					return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+				})}).Do
+				_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+				require.NoError(t, err)
+				assert.Equal(t, 2, attempts)
+				assert.Equal(t, test.wantSleeps, clock.sleeps)
+			})
+		}
+	}
+
+	t.Run("deadline", func(t *testing.T) {
+		attempts := 0
+		c := NewClient("http://localhorst.ch", nil)
+		c.Clock = &sleepRecorder{now: time.Now()}
+		c.RetryPolicy = &RetryPolicy{MaxAttempts: 2}
+		c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+			attempts++
+			return &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"60"}}, Body: http.NoBody}, nil
+		})}).Do
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{}, WithTimeout(time.Second))
+		var se *StatusError
+		require.ErrorAs(t, err, &se)
+		assert.Equal(t, http.StatusTooManyRequests, se.StatusCode)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("deadline of the Clock", func(t *testing.T) {
+		attempts := 0
+		c := NewClient("http://localhorst.ch", nil)
+		c.Clock = &sleepRecorder{now: time.Now().Add(time.Hour)}
+		c.RetryPolicy = &RetryPolicy{MaxAttempts: 2}
+		c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+			attempts++
+			return &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"1"}}, Body: http.NoBody}, nil
+		})}).Do
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{}, WithTimeout(time.Minute))
+		require.Error(t, err)
+		assert.Equal(t, 1, attempts, "the Clock is past the deadline")
+	})
+}
@@ -1,12 +1,17 @@
 package soap
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // OperationHandlerFunc runs the actual business logic - request is whatever you constructed in RequestFactoryFunc
@@ -20,12 +25,21 @@ type dummyContent struct{}
 type operationHandler struct {
 	requestFactory RequestFactoryFunc
 	handler        OperationHandlerFunc
+	streaming      bool // see StreamBody
+	actionOptional bool // see ActionOptional
 }
 
 type responseWriter struct {
 	log           func(...interface{})
 	w             http.ResponseWriter
 	outputStarted bool
+
+	bufferLimit int  // buffer responses up to this size to set Content-Length
+	head        bool // don't write the body of responses to HEAD requests
+	buf         bytes.Buffer
+	size        int // bytes written so far
+	status      int // status code held back while buffering
+	streaming   bool
 }
 
 func (w *responseWriter) Header() http.Header {
@@ -35,28 +49,171 @@ func (w *responseWriter) Header() http.Header {
 func (w *responseWriter) Write(b []byte) (int, error) {
 	w.outputStarted = true
 	if w.log != nil {
-		w.log("writing response: ", string(b))
+		w.log("writing response: ", PrettyXML(b, excerptBytes))
+	}
+	w.size += len(b)
+	if w.head {
+		return len(b), nil
+	}
+	if w.buffering() {
+		if w.size <= w.bufferLimit {
+			return w.buf.Write(b)
+		}
+		w.streaming = true
+		if w.status != 0 {
+			w.w.WriteHeader(w.status)
+		}
+		if _, err := w.w.Write(w.buf.Bytes()); err != nil {
+			return 0, err
+		}
 	}
 	return w.w.Write(b)
 }
 
 func (w *responseWriter) WriteHeader(code int) {
+	if w.buffering() || w.head {
+		if w.status == 0 {
+			w.status = code
+		}
+		return
+	}
 	w.w.WriteHeader(code)
 }
 
+func (w *responseWriter) buffering() bool {
+	return w.bufferLimit > 0 && !w.streaming
+}
+
+// finish sends a buffered response with its Content-Length. Responses to HEAD
+// requests get the Content-Length the body would have had, unless it exceeds
+// the buffer.
+func (w *responseWriter) finish() {
+	if !w.buffering() && !w.head {
+		return
+	}
+	if w.status == 0 && !w.outputStarted {
+		return
+	}
+	fits := w.bufferLimit <= 0 || w.size <= w.bufferLimit
+	if w.Header().Get("Content-Length") == "" && fits && bodyAllowed(w.status) {
+		w.Header().Set("Content-Length", strconv.Itoa(w.size))
+	}
+	if w.status != 0 {
+		w.w.WriteHeader(w.status)
+	}
+	if !w.head {
+		w.w.Write(w.buf.Bytes())
+	}
+}
+
+// bodyAllowed reports whether a response with status may have a body.
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified || status == 0
+}
+
 // Server a SOAP server, which can be run standalone or used as a http.HandlerFunc
 type Server struct {
 	Log         func(...interface{}) // do nothing on nil or add your fmt.Print* or log.*
 	handlers    map[string]map[string]map[string]*operationHandler
+	aliases     map[string]map[string]map[string]*operationAlias
 	Marshaller  XMLMarshaller
 	ContentType string
 	SoapVersion string
+	EchoHeaders []string // optional, HTTP request headers copied onto every response, e.g. X-Correlation-ID
+	Clock       Clock    // optional, falls back to the system clock
+	// MaxRequestBytes limits the size of request bodies, 0 means no limit.
+	MaxRequestBytes int64
+	// PreDispatchErrorMode selects the response to requests rejected before
+	// a handler runs, e.g. for an unknown action or a malformed envelope.
+	PreDispatchErrorMode PreDispatchErrorMode
+	// PreDispatchErrorFn writes the response for PreDispatchErrorCustom.
+	PreDispatchErrorFn func(w http.ResponseWriter, r *http.Request, reason PreDispatchError)
+	// EnvelopeAttrs and BodyAttrs are added to the Envelope and Body elements
+	// of responses and faults, e.g. EncodingStyle.
+	EnvelopeAttrs []xml.Attr
+	BodyAttrs     []xml.Attr
+	// DeterministicOutput writes the attributes of responses and faults in a
+	// stable order, see Client.DeterministicOutput.
+	DeterministicOutput bool
+	// ResponseBufferBytes makes responses handlers write themselves, up to
+	// this size, buffered to send their Content-Length, larger ones are sent
+	// chunked. 0 disables buffering. Envelopes always have a Content-Length.
+	ResponseBufferBytes int
+	// HeadMode selects the response to HEAD requests, e.g. of health checks.
+	HeadMode HeadMode
+	// ValidateEnums rejects requests with values outside of their enumeration,
+	// see Enum. Leave it off for peers sending values outside of the schema.
+	ValidateEnums bool
+	// ActorURI identifies the server in the Faults it sends, as faultactor or,
+	// in SOAP 1.2, Role, unless the Fault of a handler sets its own.
+	ActorURI string
+	// HandlerTimeout bounds the context of handlers, 0 means no limit.
+	HandlerTimeout time.Duration
+	// DeadlineFromHeader returns how long the caller of a request waits for
+	// the response, e.g. from a vendor TTL header, and whether it tells. The
+	// context of the handler gets the deadline, counted from the receipt of
+	// the request and bounded by HandlerTimeout. If it has passed before the
+	// handler runs, ErrCallerDeadlinePassed is sent instead.
+	DeadlineFromHeader func(headers []HeaderBlock) (time.Duration, bool)
+	// DeadLetter receives the requests which fail decoding, have no handler,
+	// fail validation or the handler of which panics, e.g. to replay them
+	// later, see DeadLetterSpool. Request bodies are only kept if it is set.
+	DeadLetter func(ctx context.Context, r FailedRequest)
+	// DeadLetterMaxBytes caps the body of FailedRequests,
+	// DefaultDeadLetterMaxBytes if 0.
+	DeadLetterMaxBytes int64
+	// DeadLetterRedactHeaders are the request headers whose values are
+	// replaced in FailedRequests, Authorization, Proxy-Authorization and
+	// Cookie if nil. Set it to an empty slice to keep all headers.
+	DeadLetterRedactHeaders []string
+	// UnsafePartialResults lets handlers respond with a Body holding a Fault
+	// together with other elements, which SOAP doesn't allow, e.g. to emulate
+	// an aggregating service. Such responses are refused otherwise, see
+	// PartialResultError.
+	UnsafePartialResults bool
+	// FeatureResolver, if set, switches Features per request, e.g. by tenant.
+	// Flags left at FeatureDefault keep the fields of the Server.
+	FeatureResolver func(r *http.Request) Features
+
+	metrics    *expvarMetrics // set by EnableExpvar
+	duplicates [][3]string    // path, action and element registered more than once
+	validated  uint32         // set by Validate
+}
+
+type echoedHeadersKey struct{}
+
+// EchoedHeaders returns the request headers the server echoes into the
+// response, see Server.EchoHeaders. Use it with the context of the
+// *http.Request passed to an OperationHandlerFunc.
+func EchoedHeaders(ctx context.Context) http.Header {
+	hdr, _ := ctx.Value(echoedHeadersKey{}).(http.Header)
+	return hdr
+}
+
+// echoHeaders copies the headers listed in EchoHeaders from r onto w and
+// returns r with the echoed headers in its context.
+func (s *Server) echoHeaders(w http.ResponseWriter, r *http.Request) *http.Request {
+	if len(s.EchoHeaders) == 0 {
+		return r
+	}
+	echoed := http.Header{}
+	for _, name := range s.EchoHeaders {
+		values := r.Header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		key := http.CanonicalHeaderKey(name)
+		echoed[key] = append([]string(nil), values...)
+		w.Header()[key] = append([]string(nil), values...)
+	}
+	return r.WithContext(context.WithValue(r.Context(), echoedHeadersKey{}, echoed))
 }
 
 // NewServer construct a new SOAP server
 func NewServer() *Server {
 	return &Server{
 		handlers:    make(map[string]map[string]map[string]*operationHandler),
+		aliases:     make(map[string]map[string]map[string]*operationAlias),
 		Marshaller:  defaultMarshaller{},
 		ContentType: SoapContentType11,
 		SoapVersion: SoapVersion11,
@@ -79,9 +236,13 @@ func (s *Server) UseSoap12() {
 	s.ContentType = SoapContentType12
 }
 
-// RegisterHandler register to handle an operation. This function must not be
-// called after the server has been started.
-func (s *Server) RegisterHandler(path string, action string, messageType string, requestFactory RequestFactoryFunc, operationHandlerFunc OperationHandlerFunc) {
+// RegisterHandler register to handle an operation. Requests are matched by
+// their action, see ActionOptional for requests without one, and their Body
+// element. Quotes around action are dropped like those of the SOAPAction
+// header. This function must not be called after the server has been
+// started.
+func (s *Server) RegisterHandler(path string, action string, messageType string, requestFactory RequestFactoryFunc, operationHandlerFunc OperationHandlerFunc, opts ...HandlerOption) {
+	action = trimAction(action)
 	if _, ok := s.handlers[path]; !ok {
 		s.handlers[path] = make(map[string]map[string]*operationHandler)
 	}
@@ -89,23 +250,24 @@ func (s *Server) RegisterHandler(path string, action string, messageType string,
 	if _, ok := s.handlers[path][action]; !ok {
 		s.handlers[path][action] = make(map[string]*operationHandler)
 	}
-	s.handlers[path][action][messageType] = &operationHandler{
+	if _, ok := s.handlers[path][action][messageType]; ok {
+		s.duplicates = append(s.duplicates, [3]string{path, action, messageType})
+	}
+	h := &operationHandler{
 		handler:        operationHandlerFunc,
 		requestFactory: requestFactory,
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	s.handlers[path][action][messageType] = h
 }
 
-func (s *Server) handleError(err error, w http.ResponseWriter) {
+func (s *Server) handleError(ctx context.Context, err error, w http.ResponseWriter) {
 	// has to write a soap fault
 	s.log("handling error:", err)
-	responseEnvelope := &Envelope{
-		Body: Body{
-			Content: &Fault{
-				String: err.Error(),
-			},
-		},
-	}
-	xmlBytes, xmlErr := s.Marshaller.Marshal(responseEnvelope)
+	fault := s.faultFor(err)
+	xmlBytes, xmlErr := s.envelopeWriter(ctx).write(fault)
 	if xmlErr != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(w, "could not marshal soap fault for: %s xmlError: %s\n", err, xmlErr)
@@ -115,6 +277,33 @@ func (s *Server) handleError(err error, w http.ResponseWriter) {
 	w.Write(xmlBytes)
 }
 
+// faultFor returns the Fault sent for err.
+func (s *Server) faultFor(err error) *Fault {
+	fault := &Fault{String: err.Error()}
+	var handlerFault *Fault
+	if errors.As(err, &handlerFault) {
+		copied := *handlerFault
+		fault = &copied
+	}
+	if fault.Actor == "" {
+		fault.Actor = s.ActorURI
+	}
+	fault.soap12 = s.SoapVersion == SoapVersion12
+	return fault
+}
+
+// envelopeWriter returns the writer of response envelopes of the request
+// with ctx.
+func (s *Server) envelopeWriter(ctx context.Context) envelopeWriter {
+	return envelopeWriter{
+		Version:       s.SoapVersion,
+		Marshaller:    s.Marshaller,
+		EnvelopeAttrs: s.EnvelopeAttrs,
+		BodyAttrs:     s.BodyAttrs,
+		Deterministic: s.features(ctx).DeterministicOutput.on(),
+	}
+}
+
 // WriteHeader first set the content-type header and then writes the header code.
 func (s *Server) WriteHeader(w http.ResponseWriter, code int) {
 	setContentType(w, s.ContentType)
@@ -131,101 +320,368 @@ func addSOAPHeader(w http.ResponseWriter, contentLength int, contentType string)
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	soapAction := r.Header.Get("SOAPAction")
-	s.log("ServeHTTP method:", r.Method, ", path:", r.URL.Path, ", SOAPAction", "\""+soapAction+"\"")
-	// we have a valid request time to call the handler
-	w = &responseWriter{
+	soapAction := requestAction(r)
+	r = s.withRequestReceived(s.echoHeaders(w, s.withFeatures(withRawAction(r))))
+	if echoed := EchoedHeaders(r.Context()); len(echoed) > 0 {
+		s.log("ServeHTTP method:", r.Method, ", path:", r.URL.Path, ", SOAPAction", "\""+soapAction+"\"", ", echoed headers:", echoed)
+	} else {
+		s.log("ServeHTTP method:", r.Method, ", path:", r.URL.Path, ", SOAPAction", "\""+soapAction+"\"")
+	}
+	rw := &responseWriter{
 		log:           s.Log,
 		w:             w,
 		outputStarted: false,
+		bufferLimit:   s.ResponseBufferBytes,
+		head:          r.Method == http.MethodHead,
+	}
+	defer rw.finish()
+	if r.Method == http.MethodHead {
+		s.serveHead(rw, r)
+		return
+	}
+	s.validateOnce()
+	// The outcome is preset for panicking handlers.
+	err, kind, fault := errHandlerPanicked, ErrorKindApplication, false
+	defer func(end func(error, ErrorKind, bool)) {
+		end(err, kind, fault)
+	}(s.metrics.begin(s.metricsAction(r, soapAction)))
+	body := s.captureBody(r)
+	if body != nil {
+		defer s.deadLetterPanic(r, body)
+	}
+	m, reason, err := s.decodeRequest(rw, r)
+	if err != nil {
+		s.deadLetterRejected(r, body, s.reject(rw, r, reason, err))
+		kind, fault = ErrorKindProtocol, s.rejectsWithFault()
+		return
 	}
-	switch r.Method {
-	case "POST":
-		soapRequestBytes, err := ioutil.ReadAll(r.Body)
-		// Our structs for Envelope, Header, Body and Fault are tagged with namespace for SOAP 1.1
-		// Therefore we must adjust namespaces for incoming SOAP 1.2 messages
-		if s.SoapVersion == SoapVersion12 {
-			soapRequestBytes = replaceSoap12to11(soapRequestBytes)
+	r = withRequestAttachments(withRequestHeaders(r, m.headers), m.attachments)
+	_, err = s.dispatch(rw, r, m.handler, m.request, m.alias)
+	fault = err != nil
+	s.logMultipart(m.multipart, m.envelope)
+}
+
+// requestAction returns the SOAPAction header of r or, for SOAP 1.2, the
+// action parameter of its Content-Type.
+func requestAction(r *http.Request) string {
+	// .NET sends an empty quoted SOAPAction for the default action.
+	if action := trimAction(r.Header.Get("SOAPAction")); action != "" {
+		return action
+	}
+	_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return trimAction(params["action"])
+}
+
+var errNotPOST = errors.New("this is a soap service - you have to POST soap requests")
+
+// contentTypeVersion returns the SOAP version the Content-Type mediaType and
+// params of a request declare, "" if they don't tell.
+func contentTypeVersion(mediaType string, params map[string]string) string {
+	if mediaType == "multipart/related" {
+		// the root part of MTOM messages is XOP, see rootContentType
+		mediaType = params["type"]
+		if mediaType == mediaTypeXOP {
+			mediaType = params["start-info"]
 		}
+	}
+	switch mediaType {
+	case "text/xml":
+		return SoapVersion11
+	case "application/soap+xml":
+		return SoapVersion12
+	}
+	return ""
+}
 
+// namespaceVersion returns the SOAP version of the envelope namespace ns, ""
+// for other namespaces.
+func namespaceVersion(ns string) string {
+	switch ns {
+	case NamespaceSoap11:
+		return SoapVersion11
+	case NamespaceSoap12:
+		return SoapVersion12
+	}
+	return ""
+}
+
+// rootNamespace returns the namespace of the root element of envelope, ""
+// if it has none or can't be read.
+func rootNamespace(envelope []byte) string {
+	d := xml.NewDecoder(bytes.NewReader(envelope))
+	for {
+		token, err := d.Token()
 		if err != nil {
-			s.handleError(fmt.Errorf("could not read POST:: %s", err), w)
-			return
-		}
-		pathHandlers, ok := s.handlers[r.URL.Path]
-		if !ok {
-			s.handleError(fmt.Errorf("unknown path %q", r.URL.Path), w)
-			return
+			return ""
 		}
-		actionHandlers, ok := pathHandlers[soapAction]
-		if !ok {
-			s.handleError(fmt.Errorf("unknown action %q", soapAction), w)
-			return
+		if se, ok := token.(xml.StartElement); ok {
+			return se.Name.Space
 		}
+	}
+}
 
-		// we need to find out, what is in the body
-		probeEnvelope := &Envelope{
-			Body: Body{
-				Content: &dummyContent{},
-			},
-		}
+// checkContentType rejects requests with a media type other than those of
+// SOAP 1.1, SOAP 1.2 and multipart/related, and SOAP 1.2 requests if the server
+// speaks SOAP 1.1. Requests without Content-Type are taken.
+func (s *Server) checkContentType(mediaType string, params map[string]string) (PreDispatchReason, error) {
+	switch mediaType {
+	case "", "text/xml", "application/soap+xml", "multipart/related":
+	default:
+		return PreDispatchUnsupportedMediaType, fmt.Errorf("unsupported Content-Type %q", mediaType)
+	}
+	return s.checkVersion(contentTypeVersion(mediaType, params))
+}
+
+// checkVersion rejects requests of the SOAP version if the server doesn't
+// speak it, with a VersionMismatch Fault. A SOAP 1.2 server takes SOAP 1.1
+// requests as well.
+func (s *Server) checkVersion(version string) (PreDispatchReason, error) {
+	if version == SoapVersion12 && s.SoapVersion != SoapVersion12 {
+		return PreDispatchVersionMismatch, NewFault("soap:VersionMismatch", "SOAP 1.2 request, the server speaks SOAP 1.1")
+	}
+	return "", nil
+}
 
-		if err := s.Marshaller.Unmarshal(soapRequestBytes, probeEnvelope); err != nil {
-			s.handleError(fmt.Errorf("could not probe soap body content:: %s", err), w)
-			return
+// decodedRequest is a request ready for dispatch.
+type decodedRequest struct {
+	action  string
+	element string // local name of the Body element
+	handler *operationHandler
+	request interface{}
+	alias   *operationAlias // the alias the request used, if any
+	headers []HeaderBlock
+	version string // SOAP version of the envelope
+	// attachments of multipart/related requests, see RequestAttachments
+	attachments *AttachmentReader
+	// multipart describes the parts of multipart/related requests read so
+	// far, envelope is their root part.
+	multipart *MultipartStats
+	envelope  []byte
+}
+
+// decodeRequest reads and decodes the request r, w is needed to limit the
+// size of the request. If the request is rejected, the reason is returned with
+// the error.
+func (s *Server) decodeRequest(w http.ResponseWriter, r *http.Request) (*decodedRequest, PreDispatchReason, error) {
+	if r.Method != http.MethodPost {
+		return nil, PreDispatchMethodNotAllowed, errNotPOST
+	}
+	if s.MaxRequestBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.MaxRequestBytes)
+	}
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if reason, err := s.checkContentType(mediaType, params); err != nil {
+		return nil, reason, err
+	}
+	if s.streams(r.URL.Path, requestAction(r)) {
+		if mediaType != "multipart/related" {
+			return s.decodeStream(r, r.Body)
+		}
+		root, attachments, stats, err := openMultipartRelated(r.Body, params)
+		if err != nil {
+			return nil, PreDispatchReadFailed, err
+		}
+		m, reason, err := s.decodeStream(r, root)
+		if err != nil {
+			return nil, reason, err
 		}
-		t := probeEnvelope.Body.SOAPBodyContentType
-		s.log("found content type", t)
-		actionHandler, ok := actionHandlers[t]
-		if !ok {
-			s.handleError(fmt.Errorf("no action handler for content type: %q", t), w)
-			return
+		m.attachments, m.multipart = attachments, stats
+		return m, reason, nil
+	}
+	if mediaType == "multipart/related" {
+		soapRequestBytes, attachments, stats, err := readMultipartRelated(r.Body, params)
+		if err != nil {
+			return nil, PreDispatchReadFailed, err
 		}
-		request := actionHandler.requestFactory()
-		envelope := &Envelope{
-			Header: Header{},
-			Body: Body{
-				Content: request,
-			},
+		m, reason, err := s.decodeMessage(r, soapRequestBytes)
+		if err != nil {
+			return nil, reason, err
 		}
+		m.attachments, m.multipart, m.envelope = attachments, stats, soapRequestBytes
+		return m, reason, nil
+	}
+	soapRequestBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, PreDispatchReadFailed, fmt.Errorf("could not read POST:: %s", err)
+	}
+	return s.decodeMessage(r, soapRequestBytes)
+}
 
-		if err := xml.Unmarshal(soapRequestBytes, &envelope); err != nil {
-			s.handleError(fmt.Errorf("could not unmarshal request:: %s", err), w)
-			return
+// HandleMessage runs the decode, dispatch and encode pipeline of ServeHTTP for
+// the request envelope soapRequestBytes, which has already been read from r.
+// The response envelope or SOAP fault is written to w. It returns the response
+// of the OperationHandlerFunc or the error the SOAP fault was written for.
+func (s *Server) HandleMessage(w http.ResponseWriter, r *http.Request, soapRequestBytes []byte) (interface{}, error) {
+	rw, ok := w.(*responseWriter)
+	if !ok {
+		rw = &responseWriter{
+			log:           s.Log,
+			w:             w,
+			outputStarted: false,
 		}
-		s.log("request", s.jsonDump(envelope))
+	}
+	s.validateOnce()
+	body := s.capturedBytes(soapRequestBytes)
+	if body != nil {
+		defer s.deadLetterPanic(r, body)
+	}
+	m, reason, err := s.decodeMessage(r, soapRequestBytes)
+	if err != nil {
+		pe := s.reject(rw, r, reason, err)
+		s.deadLetterRejected(r, body, pe)
+		return nil, pe
+	}
+	return s.dispatch(rw, withRequestHeaders(r, m.headers), m.handler, m.request, m.alias)
+}
 
-		response, err := actionHandler.handler(request, w, r)
-		if err != nil {
-			s.log("action handler threw up")
-			s.handleError(err, w)
-			return
-		}
-		s.log("result", s.jsonDump(response))
-		if !w.(*responseWriter).outputStarted {
-			responseEnvelope := &Envelope{
-				Body: Body{
-					Content: response,
-				},
-			}
-			xmlBytes, err := s.Marshaller.Marshal(responseEnvelope)
-			// Adjust namespaces for SOAP 1.2
-			if s.SoapVersion == SoapVersion12 {
-				xmlBytes = replaceSoap11to12(xmlBytes)
-			}
-			if err != nil {
-				s.handleError(fmt.Errorf("could not marshal response:: %s", err), w)
-			}
-			addSOAPHeader(w, len(xmlBytes), s.ContentType)
-			w.Write(xmlBytes)
-		} else {
-			s.log("action handler sent its own output")
+// decodeMessage finds the handler for the request envelope soapRequestBytes
+// and decodes the request.
+func (s *Server) decodeMessage(r *http.Request, soapRequestBytes []byte) (*decodedRequest, PreDispatchReason, error) {
+	soapAction := requestAction(r)
+	version := namespaceVersion(rootNamespace(soapRequestBytes))
+	if reason, err := s.checkVersion(version); err != nil {
+		return nil, reason, err
+	}
+	// Header blocks are handed out as received, see RequestHeaders.
+	headers, _ := headerBlocks(soapRequestBytes)
+
+	// Our structs for Envelope, Header, Body and Fault are tagged with namespace for SOAP 1.1
+	// Therefore we must adjust namespaces for incoming SOAP 1.2 messages
+	if s.SoapVersion == SoapVersion12 {
+		soapRequestBytes = replaceSoap12to11(soapRequestBytes)
+	}
+
+	if _, reason, err := s.checkAction(r.URL.Path, soapAction); err != nil {
+		return nil, reason, err
+	}
+
+	// we need to find out, what is in the body
+	probeEnvelope := &Envelope{
+		Body: Body{
+			Content: &dummyContent{},
+		},
+	}
+
+	if err := s.Marshaller.Unmarshal(soapRequestBytes, probeEnvelope); err != nil {
+		s.log("could not probe request:", PrettyXML(soapRequestBytes, excerptBytes))
+		return nil, PreDispatchMalformedEnvelope, fmt.Errorf("could not probe soap body content:: %s", err)
+	}
+	t := probeEnvelope.Body.SOAPBodyContentType
+	s.log("found content type", t)
+	actionHandler, alias, reason, err := s.handlerFor(r.URL.Path, soapAction, t)
+	if err != nil {
+		return nil, reason, err
+	}
+	if alias != nil {
+		s.log("deprecated_alias", "action:", soapAction, ", content type:", t, ", routed to action:", alias.action)
+		if alias.requestTag != "" {
+			soapRequestBytes = renameBodyElement(soapRequestBytes, alias.requestTag)
+		}
+	}
+	request := actionHandler.requestFactory()
+	envelope := &Envelope{
+		Header: Header{},
+		Body: Body{
+			Content: request,
+		},
+	}
+
+	if err := xml.Unmarshal(soapRequestBytes, &envelope); err != nil {
+		return nil, PreDispatchMalformedEnvelope, fmt.Errorf("could not unmarshal request:: %s", err)
+	}
+	s.log("request", s.jsonDump(envelope))
+	if s.features(r.Context()).ValidateEnums.on() {
+		if err := ValidateEnums(request); err != nil {
+			return nil, PreDispatchInvalidValue, err
 		}
+	}
 
-	default:
-		// this will be a soap fault !?
-		s.handleError(errors.New("this is a soap service - you have to POST soap requests"), w)
+	return &decodedRequest{action: soapAction, element: t, handler: actionHandler, request: request, alias: alias, headers: headers, version: version}, "", nil
+}
+
+// checkAction rejects requests to unknown paths or with unknown actions.
+// knownAction tells whether action has handlers or aliases of its own at path.
+func (s *Server) checkAction(path, action string) (knownAction bool, reason PreDispatchReason, err error) {
+	pathHandlers, ok := s.handlers[path]
+	if !ok {
+		return false, PreDispatchUnknownPath, fmt.Errorf("unknown path %q", path)
+	}
+	_, knownAction = pathHandlers[action]
+	knownAction = knownAction || s.aliases[path][action] != nil
+	if !knownAction && !s.hasOptionalActions(path) {
+		return false, PreDispatchUnknownAction, fmt.Errorf("unknown action %q", action)
+	}
+	return knownAction, "", nil
+}
+
+// handlerFor returns the handler at path for requests with action and the
+// Body element, found directly, by an alias, which is returned as well, or as
+// ActionOptional handler.
+func (s *Server) handlerFor(path, action, element string) (*operationHandler, *operationAlias, PreDispatchReason, error) {
+	knownAction, reason, err := s.checkAction(path, action)
+	if err != nil {
+		return nil, nil, reason, err
+	}
+	if actionHandler, ok := s.handlers[path][action][element]; ok {
+		return actionHandler, nil, "", nil
+	}
+	if alias := s.aliases[path][action][element]; alias != nil {
+		if actionHandler, ok := s.aliasedHandler(path, element, alias); ok {
+			return actionHandler, alias, "", nil
+		}
 	}
+	optional, err := s.optionalActionHandler(path, action, element)
+	switch {
+	case err != nil:
+		return nil, nil, PreDispatchNoHandler, err
+	case optional != nil:
+		return optional, nil, "", nil
+	case !knownAction:
+		return nil, nil, PreDispatchUnknownAction, fmt.Errorf("unknown action %q", action)
+	}
+	return nil, nil, PreDispatchNoHandler, fmt.Errorf("no action handler for content type: %q", element)
+}
+
+// dispatch runs the handler for the decoded request and writes the response
+// envelope or SOAP fault. alias is the alias the request used, if any.
+func (s *Server) dispatch(rw *responseWriter, r *http.Request, actionHandler *operationHandler, request interface{}, alias *operationAlias) (interface{}, error) {
+	var w http.ResponseWriter = rw
+	fail := func(err error) (interface{}, error) {
+		s.handleError(r.Context(), err, w)
+		return nil, err
+	}
+
+	ctx, cancel, err := s.handlerContext(r)
+	if err != nil {
+		return fail(err)
+	}
+	defer cancel()
+	response, err := actionHandler.handler(request, w, r.WithContext(ctx))
+	if err != nil {
+		s.log("action handler threw up")
+		return fail(err)
+	}
+	s.log("result", s.jsonDump(response))
+	if rw.outputStarted {
+		s.log("action handler sent its own output")
+		return response, nil
+	}
+
+	xmlBytes, err := s.envelopeWriter(r.Context()).write(response)
+	if err != nil {
+		return fail(fmt.Errorf("could not marshal response:: %s", err))
+	}
+	if !s.features(r.Context()).UnsafePartialResults.on() {
+		if err := checkBodyFaults(xmlBytes); err != nil {
+			return fail(err)
+		}
+	}
+	if alias != nil && alias.responseTag != "" {
+		xmlBytes = renameBodyElement(xmlBytes, alias.responseTag)
+	}
+	addSOAPHeader(w, len(xmlBytes), s.ContentType)
+	w.Write(xmlBytes)
+	return response, nil
 }
 
 func (s *Server) jsonDump(v interface{}) string {
@@ -2,12 +2,20 @@ package soap
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -33,9 +41,8 @@ func TestServer_ServeHTTP(t *testing.T) {
 	srv := httptest.NewServer(soapSrv)
 	defer srv.Close()
 
-	// the NewClient is incompatible to the server. why? because of the SOAP
-	// namespace and its check. due to backwards compatibility reasons the
-	// structs in this package can't be changed.
+	// raw requests as sent by other SOAP toolkits, see TestServer_Client for
+	// requests sent by the Client of this package.
 
 	postFn := func(t *testing.T, postBody []byte) *http.Response {
 		body := ioutil.NopCloser(bytes.NewReader(postBody))
@@ -88,6 +95,351 @@ func TestServer_ServeHTTP(t *testing.T) {
 	})
 }
 
+func TestServer_Client(t *testing.T) {
+	for _, soapVersion := range []string{SoapVersion11, SoapVersion12} {
+		t.Run(soapVersion, func(t *testing.T) {
+			soapSrv := NewServer()
+			if soapVersion == SoapVersion12 {
+				soapSrv.UseSoap12()
+			}
+			soapSrv.RegisterHandler(
+				"/pathTo",
+				"testPostAction",
+				"fooRequest",
+				func() interface{} {
+					return &FooRequest{}
+				},
+				func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+					fooRequest := request.(*FooRequest)
+					if fooRequest.Foo == "fail" {
+						return nil, errors.New("failed on purpose")
+					}
+					return &FooResponse{
+						Bar: "Hello \"" + fooRequest.Foo + "\"",
+					}, nil
+				},
+			)
+			srv := httptest.NewServer(soapSrv)
+			defer srv.Close()
+			client := NewClient(srv.URL+"/pathTo", nil)
+			if soapVersion == SoapVersion12 {
+				client.UseSoap12()
+			}
+
+			t.Run("response", func(t *testing.T) {
+				response := &FooResponse{}
+				_, err := client.Call(context.Background(), "testPostAction", &FooRequest{Foo: "i am foo"}, response)
+				require.NoError(t, err)
+				assert.Exactly(t, "Hello \"i am foo\"", response.Bar)
+			})
+
+			t.Run("fault", func(t *testing.T) {
+				_, err := client.Call(context.Background(), "testPostAction", &FooRequest{Foo: "fail"}, &FooResponse{})
+				var fe *FaultError
+				require.True(t, errors.As(err, &fe), "%v", err)
+				assert.Exactly(t, "failed on purpose", fe.Fault.String)
+			})
+
+			t.Run("unknown content", func(t *testing.T) {
+				_, err := client.Call(context.Background(), "testPostAction", &struct {
+					XMLName xml.Name `xml:"barRequest"`
+				}{}, &FooResponse{})
+				var fe *FaultError
+				require.True(t, errors.As(err, &fe), "%v", err)
+				assert.Exactly(t, "no action handler for content type: \"barRequest\"", fe.Fault.String)
+			})
+		})
+	}
+}
+
+func TestServer_EchoHeaders(t *testing.T) {
+	soapSrv := NewServer()
+	soapSrv.EchoHeaders = []string{"x-correlation-id", "X-Tenant"}
+	var handlerHeaders http.Header
+	soapSrv.RegisterHandler(
+		"/pathTo",
+		"testPostAction",
+		"fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			handlerHeaders = EchoedHeaders(httpRequest.Context())
+			return &FooResponse{Bar: "ok"}, nil
+		},
+	)
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/pathTo", strings.NewReader(body))
+		r.Header.Set("SOAPAction", "testPostAction")
+		r.Header.Add("X-Correlation-Id", "abc")
+		r.Header.Add("X-Correlation-Id", "def")
+		r.Header.Add("X-Other", "not echoed")
+		w := httptest.NewRecorder()
+		soapSrv.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("response", func(t *testing.T) {
+		w := serve(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><fooRequest><Foo>foo</Foo></fooRequest></Body></Envelope>`)
+		assert.Exactly(t, []string{"abc", "def"}, w.Header().Values("X-Correlation-ID"))
+		assert.Empty(t, w.Header().Values("X-Tenant"))
+		assert.Empty(t, w.Header().Values("X-Other"))
+		assert.Exactly(t, http.Header{"X-Correlation-Id": {"abc", "def"}}, handlerHeaders)
+	})
+
+	t.Run("fault", func(t *testing.T) {
+		w := serve(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><barRequest/></Body></Envelope>`)
+		assert.Contains(t, w.Body.String(), "Fault")
+		assert.Exactly(t, []string{"abc", "def"}, w.Header().Values("X-Correlation-ID"))
+	})
+}
+
+// blobRequest counts the bytes of its base64 blob while the request is
+// streamed in.
+type blobRequest struct {
+	started chan struct{}
+	size    int
+}
+
+func (br *blobRequest) DecodeSOAPBody(d *xml.Decoder, start xml.StartElement) error {
+	select {
+	case <-br.started:
+	default:
+		close(br.started)
+	}
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch tt := token.(type) {
+		case xml.CharData:
+			br.size += len(bytes.TrimSpace(tt))
+		case xml.EndElement:
+			if tt.Name == start.Name {
+				return nil
+			}
+		}
+	}
+}
+
+func TestServer_ServeHTTP_streaming(t *testing.T) {
+	started := make(chan struct{})
+	soapSrv := NewServer()
+	soapSrv.RegisterHandler("/upload", "upload", "blob",
+		func() interface{} {
+			return &blobRequest{started: started}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			return &FooResponse{Bar: fmt.Sprint(request.(*blobRequest).size)}, nil
+		},
+		StreamBody(),
+	)
+	soapSrv.RegisterHandler("/upload", "upload", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			return &FooResponse{Bar: request.(*FooRequest).Foo}, nil
+		},
+	)
+
+	t.Run("decodes while reading", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.Write([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Header><Ignored/></Header><Body><blob>`))
+			select {
+			case <-started:
+			case <-time.After(5 * time.Second):
+				pw.CloseWithError(errors.New("request has been buffered"))
+				return
+			}
+			for i := 0; i < 1000; i++ {
+				pw.Write(bytes.Repeat([]byte("QUJD"), 256))
+			}
+			pw.Write([]byte(`</blob></Body></Envelope>`))
+			pw.Close()
+		}()
+
+		r := httptest.NewRequest("POST", "/upload", pr)
+		r.Header.Set("SOAPAction", "upload")
+		w := httptest.NewRecorder()
+		soapSrv.ServeHTTP(w, r)
+
+		responseEnvelope := &Envelope{Body: Body{Content: &FooResponse{}}}
+		require.NoError(t, xml.Unmarshal(w.Body.Bytes(), responseEnvelope))
+		require.Nil(t, responseEnvelope.Body.Fault)
+		assert.Exactly(t, "1024000", responseEnvelope.Body.Content.(*FooResponse).Bar)
+	})
+
+	t.Run("regular request of streaming action", func(t *testing.T) {
+		r := httptest.NewRequest("POST", "/upload", strings.NewReader(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><fooRequest><Foo>small</Foo></fooRequest></Body></Envelope>`))
+		r.Header.Set("SOAPAction", "upload")
+		w := httptest.NewRecorder()
+		soapSrv.ServeHTTP(w, r)
+
+		responseEnvelope := &Envelope{Body: Body{Content: &FooResponse{}}}
+		require.NoError(t, xml.Unmarshal(w.Body.Bytes(), responseEnvelope))
+		assert.Exactly(t, "small", responseEnvelope.Body.Content.(*FooResponse).Bar)
+	})
+
+	t.Run("MaxRequestBytes", func(t *testing.T) {
+		soapSrv.MaxRequestBytes = 1024
+		defer func() { soapSrv.MaxRequestBytes = 0 }()
+
+		for _, action := range []string{"upload", "buffered"} {
+			body := `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><blob>` + strings.Repeat("QUJD", 1024) + `</blob></Body></Envelope>`
+			r := httptest.NewRequest("POST", "/upload", strings.NewReader(body))
+			r.Header.Set("SOAPAction", action)
+			w := httptest.NewRecorder()
+			soapSrv.ServeHTTP(w, r)
+
+			responseEnvelope := &Envelope{Body: Body{Content: &dummyContent{}}}
+			require.NoError(t, xml.Unmarshal(w.Body.Bytes(), responseEnvelope))
+			require.NotNil(t, responseEnvelope.Body.Fault, action)
+			assert.Contains(t, responseEnvelope.Body.Fault.String, "too large", action)
+		}
+	})
+}
+
+func TestServer_ServeHTTP_streamingRoutes(t *testing.T) {
+	soapSrv := NewServer()
+	soapSrv.UseSoap12()
+	soapSrv.RegisterHandler("/upload", "upload", "blob",
+		func() interface{} {
+			return &blobRequest{started: make(chan struct{})}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			var names []string
+			for _, h := range RequestHeaders(httpRequest.Context()) {
+				names = append(names, h.Name.Local)
+			}
+			parts := 0
+			if attachments := RequestAttachments(httpRequest.Context()); attachments != nil {
+				for {
+					if _, err := attachments.Next(); err != nil {
+						break
+					}
+					parts++
+				}
+			}
+			return &FooResponse{Bar: fmt.Sprint(request.(*blobRequest).size, names, parts)}, nil
+		},
+		StreamBody(),
+		ActionOptional(),
+	)
+	soapSrv.RegisterHandler("/upload", "upload", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			return &FooResponse{Bar: request.(*FooRequest).Foo}, nil
+		},
+	)
+	soapSrv.Alias("/upload", "oldUpload", "oldBlob", "upload", AliasRequestTag("blob"))
+	soapSrv.Alias("/upload", "oldUpload", "oldFooRequest", "upload", AliasRequestTag("fooRequest"))
+
+	const (
+		soap11 = `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">%s</Envelope>`
+		soap12 = `<Envelope xmlns="http://www.w3.org/2003/05/soap-envelope">%s</Envelope>`
+	)
+	var multipartBody bytes.Buffer
+	mw := multipart.NewWriter(&multipartBody)
+	root, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/xop+xml"}})
+	fmt.Fprintf(root, soap11, `<Body><blob>QUJD</blob></Body>`)
+	attachment, _ := mw.CreatePart(textproto.MIMEHeader{"Content-ID": {"<blob>"}})
+	attachment.Write([]byte("blob"))
+	mw.Close()
+
+	tests := []struct {
+		name        string
+		action      string
+		contentType string
+		body        string
+		want        string
+		wantFault   string
+	}{
+		{
+			name:   "header blocks",
+			action: "upload",
+			body:   fmt.Sprintf(soap12, `<Header><Trace xmlns="urn:trace"/><Tenant xmlns="urn:tenant"/></Header><Body><blob>QUJD</blob></Body>`),
+			want:   "4 [Trace Tenant] 0",
+		},
+		{
+			name:   "alias",
+			action: "oldUpload",
+			body:   fmt.Sprintf(soap11, `<Body><oldBlob>QUJD</oldBlob></Body>`),
+			want:   "4 [] 0",
+		},
+		{
+			name:   "alias of a regular request",
+			action: "oldUpload",
+			body:   fmt.Sprintf(soap11, `<Body><oldFooRequest><Foo>renamed</Foo></oldFooRequest></Body>`),
+			want:   "renamed",
+		},
+		{
+			name: "optional action",
+			body: fmt.Sprintf(soap11, `<Body><blob>QUJD</blob></Body>`),
+			want: "4 [] 0",
+		},
+		{
+			name:        "multipart",
+			action:      "upload",
+			contentType: "multipart/related; boundary=" + mw.Boundary(),
+			body:        multipartBody.String(),
+			want:        "4 [] 1",
+		},
+		{
+			name:      "foreign envelope namespace",
+			action:    "upload",
+			body:      `<Envelope xmlns="urn:not-soap"><Body><blob>QUJD</blob></Body></Envelope>`,
+			wantFault: `unexpected element "Envelope", expected soap envelope`,
+		},
+		{
+			name:      "foreign body namespace",
+			action:    "upload",
+			body:      fmt.Sprintf(soap11, `<Body xmlns="urn:not-soap"><blob>QUJD</blob></Body>`),
+			wantFault: `unexpected element "Body", expected soap envelope`,
+		},
+		{
+			name:      "trailing garbage",
+			action:    "upload",
+			body:      fmt.Sprintf(soap11, `<Body><blob>QUJD</blob></Body>`) + `<Envelope/>`,
+			wantFault: "trailing data after soap envelope",
+		},
+		{
+			name:      "unknown action",
+			action:    "download",
+			body:      fmt.Sprintf(soap11, `<Body><blob>QUJD</blob></Body>`),
+			wantFault: `unknown action "download"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/upload", strings.NewReader(tt.body))
+			if tt.action != "" {
+				r.Header.Set("SOAPAction", tt.action)
+			}
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			soapSrv.ServeHTTP(w, r)
+
+			responseEnvelope := &Envelope{Body: Body{Content: &FooResponse{}}}
+			require.NoError(t, xml.Unmarshal(replaceSoap12to11(w.Body.Bytes()), responseEnvelope), w.Body.String())
+			if tt.wantFault != "" {
+				require.NotNil(t, responseEnvelope.Body.Fault)
+				assert.Contains(t, responseEnvelope.Body.Fault.String, tt.wantFault)
+				return
+			}
+			require.Nil(t, responseEnvelope.Body.Fault, w.Body.String())
+			assert.Equal(t, tt.want, responseEnvelope.Body.Content.(*FooResponse).Bar)
+		})
+	}
+}
+
 func ExampleServer() {
 	type FooRequest struct {
 		XMLName xml.Name `xml:"FooRequest"`
@@ -121,3 +473,36 @@ func ExampleServer() {
 	)
 	_ = http.ListenAndServe(":8080", soapServer)
 }
+
+func TestServer_soap12Action(t *testing.T) {
+	var request *http.Request
+	var body []byte
+	soapSrv := NewServer()
+	soapSrv.UseSoap12()
+	soapSrv.RegisterHandler("/pathTo", "urn:foo#Do", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(req interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			return &FooResponse{Bar: req.(*FooRequest).Foo}, nil
+		},
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		body, _ = ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		soapSrv.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL+"/pathTo", nil)
+	c.UseSoap12()
+	response := &FooResponse{}
+	_, err := c.Call(context.Background(), "urn:foo#Do", &FooRequest{Foo: "twelve"}, response)
+	require.NoError(t, err)
+	assert.Equal(t, "twelve", response.Bar)
+	assert.Empty(t, request.Header.Values("SOAPAction"))
+	assert.Equal(t, `application/soap+xml; charset="utf-8"; action="urn:foo#Do"`, request.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), NamespaceSoap12)
+	assert.NotContains(t, string(body), NamespaceSoap11)
+}
@@ -1,7 +1,12 @@
 package soap
 
 import (
+	"bytes"
 	"encoding/xml"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
 )
 
 // SOAP 1.1 and SOAP 1.2 must expect different ContentTypes and Namespaces.
@@ -13,6 +18,9 @@ const (
 	SoapContentType11 = "text/xml; charset=\"utf-8\""
 	SoapContentType12 = "application/soap+xml; charset=\"utf-8\""
 
+	mediaTypeSoap11 = "text/xml"
+	mediaTypeSoap12 = "application/soap+xml"
+
 	NamespaceSoap11 = "http://schemas.xmlsoap.org/soap/envelope/"
 	NamespaceSoap12 = "http://www.w3.org/2003/05/soap-envelope"
 )
@@ -24,13 +32,19 @@ var (
 )
 
 // Envelope type `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+//
+// It is what an XMLMarshaller of Client and Server is given. EnvelopeV2 is
+// the richer model, see EnvelopeToV2.
 type Envelope struct {
-	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	XMLName xml.Name   `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Attrs   []xml.Attr `xml:",any,attr"` // optional, e.g. encodingStyle, see EncodingStyle
 	Header  Header
 	Body    Body
 }
 
 // Header type
+//
+// See HeaderV2 for the richer model.
 type Header struct {
 	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Header"`
 
@@ -38,22 +52,166 @@ type Header struct {
 }
 
 // Body type
+//
+// See BodyV2 for the richer model.
 type Body struct {
 	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
 
+	Attrs               []xml.Attr  `xml:",any,attr"` // optional, only marshalled
 	Fault               *Fault      `xml:",omitempty"`
 	Content             interface{} `xml:",omitempty"`
 	SOAPBodyContentType string      `xml:"-"`
+
+	// faults are all Faults of a Body also holding a result, see
+	// PartialResultError.
+	faults []*Fault
 }
 
 // Fault type
+//
+// It is the Fault of a FaultError. FaultV2 is the richer model, see
+// FaultToV2.
 type Fault struct {
 	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Fault"`
 
 	Code   string `xml:"faultcode,omitempty"`
 	String string `xml:"faultstring,omitempty"`
-	Actor  string `xml:"faultactor,omitempty"`
+	Actor  string `xml:"faultactor,omitempty"` // faultactor or, in SOAP 1.2, Role
 	Detail string `xml:"detail,omitempty"`
+
+	// Node is the SOAP node which failed, SOAP 1.2 only.
+	Node string `xml:"-"`
+
+	// DetailContent is the decoded detail, see WithFaultDetailFactory. If set,
+	// it is marshalled instead of Detail.
+	DetailContent interface{} `xml:"-"`
+
+	soap12    bool   // decoded from or marshalled to the SOAP 1.2 layout
+	detailXML []byte // content of the detail element as received
+}
+
+// rawEnvelope is an Envelope whose Body content is already serialized XML.
+type rawEnvelope struct {
+	XMLName xml.Name   `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Header  Header
+	Body    rawBody
+}
+
+// rawBody type, Content is written verbatim
+type rawBody struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content []byte     `xml:",innerxml"`
+}
+
+// EncodingStyle returns the SOAP encodingStyle attribute, e.g. for the
+// Envelope of rpc/encoded services:
+//
+//	c.EnvelopeAttrs = []xml.Attr{soap.EncodingStyle(soap.NamespaceSoapEncoding)}
+func EncodingStyle(uri string) xml.Attr {
+	return xml.Attr{Name: xml.Name{Space: NamespaceSoap11, Local: "encodingStyle"}, Value: uri}
+}
+
+// bodyContent returns the raw bytes of the first child element of the
+// envelope's Body or nil, if the Body is empty. Namespace declarations of the
+// Envelope and Body elements are copied onto the start tag of the element, if
+// it doesn't declare the same prefix itself.
+func bodyContent(envelope []byte) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(envelope))
+
+	var (
+		inScope []xml.Attr
+		depth   int
+		inBody  bool
+		start   int64
+		own     []xml.Attr
+	)
+	for {
+		offset := d.InputOffset()
+		token, err := d.RawToken()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch tt := token.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case depth == 1 || (depth == 2 && tt.Name.Local == "Body"):
+				inBody = depth == 2
+				inScope = append(inScope, namespaceDecls(tt.Attr)...)
+			case depth == 3 && inBody:
+				start = offset
+				own = namespaceDecls(tt.Attr)
+			}
+		case xml.EndElement:
+			depth--
+			switch {
+			case depth == 2 && inBody:
+				return withNamespaceDecls(envelope[start:d.InputOffset()], inScope, own), nil
+			case depth == 1 && inBody:
+				return nil, nil
+			case depth == 0:
+				return nil, errors.New("no SOAP body found")
+			}
+		}
+	}
+}
+
+func namespaceDecls(attrs []xml.Attr) []xml.Attr {
+	var decls []xml.Attr
+	for _, attr := range attrs {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			decls = append(decls, attr)
+		}
+	}
+	return decls
+}
+
+// withNamespaceDecls inserts the declarations of inScope not shadowed by own
+// right after the element name of the start tag in element.
+func withNamespaceDecls(element []byte, inScope, own []xml.Attr) []byte {
+	declared := make(map[xml.Name]bool, len(own))
+	for _, attr := range own {
+		declared[attr.Name] = true
+	}
+
+	// Later declarations (Body) shadow earlier ones (Envelope).
+	effective := make([]bool, len(inScope))
+	for i := len(inScope) - 1; i >= 0; i-- {
+		if !declared[inScope[i].Name] {
+			declared[inScope[i].Name] = true
+			effective[i] = true
+		}
+	}
+
+	var decls bytes.Buffer
+	for i, attr := range inScope {
+		if !effective[i] {
+			continue
+		}
+		decls.WriteString(" ")
+		if attr.Name.Space != "" {
+			decls.WriteString(attr.Name.Space + ":")
+		}
+		decls.WriteString(attr.Name.Local + `="`)
+		xml.EscapeText(&decls, []byte(attr.Value))
+		decls.WriteString(`"`)
+	}
+	if decls.Len() == 0 {
+		return element
+	}
+
+	nameEnd := bytes.IndexAny(element, " \t\r\n/>")
+	out := make([]byte, 0, len(element)+decls.Len())
+	out = append(out, element[:nameEnd]...)
+	out = append(out, decls.Bytes()...)
+	return append(out, element[nameEnd:]...)
 }
 
 // UnmarshalXML implement xml.Unmarshaler
@@ -63,9 +221,11 @@ func (b *Body) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	}
 
 	var (
-		token    xml.Token
-		err      error
-		consumed bool
+		token     xml.Token
+		err       error
+		consumed  bool
+		faults    []*Fault
+		collector = newContentCollector(b.Content)
 	)
 
 Loop:
@@ -80,14 +240,20 @@ Loop:
 
 		switch se := token.(type) {
 		case xml.StartElement:
-			if consumed {
+			if se.Name.Space == NamespaceSoap11 && se.Name.Local == "Fault" {
+				// Faults may come with a result, see PartialResultError.
+				fault := &Fault{}
+				if err = d.DecodeElement(fault, &se); err != nil {
+					return err
+				}
+				faults = append(faults, fault)
+			} else if consumed && collector == nil {
 				return xml.UnmarshalError("Found multiple elements inside SOAP body; not wrapped-document/literal WS-I compliant")
-			} else if se.Name.Space == "http://schemas.xmlsoap.org/soap/envelope/" && se.Name.Local == "Fault" {
-				b.Fault = &Fault{}
-				b.Content = nil
-
-				err = d.DecodeElement(b.Fault, &se)
-				if err != nil {
+			} else if collector != nil {
+				if !consumed {
+					b.SOAPBodyContentType = se.Name.Local
+				}
+				if err = collector.collect(d, se); err != nil {
 					return err
 				}
 
@@ -105,9 +271,117 @@ Loop:
 		}
 	}
 
+	if len(faults) > 0 {
+		b.Fault = faults[0]
+		if consumed {
+			b.faults = faults
+		} else {
+			b.Content = nil
+		}
+	}
+	return nil
+}
+
+// ElementFactory returns the value a Body element with the given name is
+// decoded into. Returning nil skips the element.
+type ElementFactory func(name xml.Name) interface{}
+
+// contentCollector decodes Body content consisting of several elements.
+type contentCollector interface {
+	collect(d *xml.Decoder, start xml.StartElement) error
+}
+
+// newContentCollector returns a contentCollector for content, if content
+// isn't a single element.
+func newContentCollector(content interface{}) contentCollector {
+	if mc, ok := content.(*multiContent); ok {
+		return mc
+	}
+	v := reflect.ValueOf(content)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return nil
+	}
+	slice := v.Elem()
+	if slice.Type().Elem().Kind() == reflect.Uint8 {
+		return nil // []byte is decoded from character data
+	}
+	return &sliceContent{
+		slice: slice,
+		name:  elementName(slice.Type().Elem()),
+	}
+}
+
+// multiContent decodes every Body element into a value from factory.
+type multiContent struct {
+	factory ElementFactory
+	values  []interface{}
+}
+
+func (mc *multiContent) collect(d *xml.Decoder, start xml.StartElement) error {
+	v := mc.factory(start.Name)
+	if v == nil {
+		return d.Skip()
+	}
+	if err := d.DecodeElement(v, &start); err != nil {
+		return err
+	}
+	mc.values = append(mc.values, v)
+	return nil
+}
+
+// sliceContent appends every Body element matching name to slice. An empty
+// name matches all elements.
+type sliceContent struct {
+	slice reflect.Value
+	name  xml.Name
+}
+
+func (sc *sliceContent) collect(d *xml.Decoder, start xml.StartElement) error {
+	if sc.name.Local != "" && (sc.name.Local != start.Name.Local || sc.name.Space != "" && sc.name.Space != start.Name.Space) {
+		return d.Skip()
+	}
+	elemType := sc.slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+	elem := reflect.New(elemType)
+	if err := d.DecodeElement(elem.Interface(), &start); err != nil {
+		return err
+	}
+	if !isPtr {
+		elem = elem.Elem()
+	}
+	sc.slice.Set(reflect.Append(sc.slice, elem))
 	return nil
 }
 
+// elementName returns the name given by the XMLName field tag of the struct
+// type t, if any.
+func elementName(t reflect.Type) xml.Name {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return xml.Name{}
+	}
+	f, ok := t.FieldByName("XMLName")
+	if !ok || f.Type != reflect.TypeOf(xml.Name{}) {
+		return xml.Name{}
+	}
+	tag := strings.Split(f.Tag.Get("xml"), ",")[0]
+	if i := strings.LastIndex(tag, " "); i >= 0 {
+		return xml.Name{Space: tag[:i], Local: tag[i+1:]}
+	}
+	return xml.Name{Local: tag}
+}
+
 func (f *Fault) Error() string {
 	return f.String
 }
+
+// DetailXML returns the content of the detail element as received, nil if
+// the Fault hasn't been decoded or has no detail.
+func (f *Fault) DetailXML() []byte {
+	return f.detailXML
+}
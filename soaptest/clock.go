@@ -0,0 +1,108 @@
+package soaptest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/orirawlings/soap"
+)
+
+// FakeClock is a soap.Clock for deterministic tests. Time only moves when
+// Advance or Sleep is called: Sleep doesn't block, but advances the clock by
+// the given duration and records it. The functions of AfterFunc timers, which
+// are due then, are called by Advance and Sleep before they return.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+	timers map[*fakeTimer]struct{}
+}
+
+// NewFakeClock returns a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now implements soap.Clock
+func (fc *FakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+// Sleep implements soap.Clock
+func (fc *FakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fc.mu.Lock()
+	fc.sleeps = append(fc.sleeps, d)
+	fc.mu.Unlock()
+	fc.Advance(d)
+	return nil
+}
+
+// AfterFunc implements soap.Clock
+func (fc *FakeClock) AfterFunc(d time.Duration, f func()) soap.Timer {
+	t := &fakeTimer{fc: fc, f: f}
+	t.Reset(d)
+	return t
+}
+
+// Advance moves the clock forward by d and fires the timers due.
+func (fc *FakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	fc.now = fc.now.Add(d)
+	var due []*fakeTimer
+	for t := range fc.timers {
+		if !t.at.After(fc.now) {
+			due = append(due, t)
+			delete(fc.timers, t)
+		}
+	}
+	fc.mu.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].at.Before(due[j].at)
+	})
+	for _, t := range due {
+		t.f()
+	}
+}
+
+// Sleeps returns the durations passed to Sleep so far.
+func (fc *FakeClock) Sleeps() []time.Duration {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return append([]time.Duration(nil), fc.sleeps...)
+}
+
+// fakeTimer is a timer of a FakeClock, it is pending while it is in the
+// timers of the clock.
+type fakeTimer struct {
+	fc *FakeClock
+	f  func()
+	at time.Time
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.fc.mu.Lock()
+	defer t.fc.mu.Unlock()
+	_, pending := t.fc.timers[t]
+	delete(t.fc.timers, t)
+	return pending
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.fc.mu.Lock()
+	defer t.fc.mu.Unlock()
+	if t.fc.timers == nil {
+		t.fc.timers = make(map[*fakeTimer]struct{})
+	}
+	_, pending := t.fc.timers[t]
+	t.at = t.fc.now.Add(d)
+	t.fc.timers[t] = struct{}{}
+	return pending
+}
@@ -0,0 +1,48 @@
+package soaptest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/orirawlings/soap"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ soap.Clock = (*FakeClock)(nil)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	fc := NewFakeClock(start)
+	assert.Exactly(t, start, fc.Now())
+
+	fc.Advance(time.Minute)
+	assert.NoError(t, fc.Sleep(context.Background(), time.Second))
+	assert.NoError(t, fc.Sleep(context.Background(), 2*time.Second))
+	assert.Exactly(t, start.Add(time.Minute+3*time.Second), fc.Now())
+	assert.Exactly(t, []time.Duration{time.Second, 2 * time.Second}, fc.Sleeps())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, fc.Sleep(ctx, time.Hour), context.Canceled)
+	assert.Exactly(t, start.Add(time.Minute+3*time.Second), fc.Now())
+}
+
+func TestFakeClock_AfterFunc(t *testing.T) {
+	fc := NewFakeClock(time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC))
+	var fired []string
+	first := fc.AfterFunc(time.Second, func() { fired = append(fired, "first") })
+	fc.AfterFunc(2*time.Second, func() { fired = append(fired, "second") })
+	stopped := fc.AfterFunc(time.Second, func() { fired = append(fired, "stopped") })
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+
+	fc.Advance(999 * time.Millisecond)
+	assert.Empty(t, fired)
+	assert.True(t, first.Reset(2*time.Second), "pending")
+	assert.NoError(t, fc.Sleep(context.Background(), 1001*time.Millisecond))
+	assert.Exactly(t, []string{"second"}, fired)
+	fc.Advance(time.Second)
+	assert.Exactly(t, []string{"second", "first"}, fired)
+	assert.False(t, first.Stop(), "fired")
+}
@@ -0,0 +1,26 @@
+package soaptest
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/orirawlings/soap"
+)
+
+// SequenceIDs is a soap.IDGenerator for deterministic tests, it mints
+// "<kind>-<n>" with a sequence number n per kind, starting at 1.
+type SequenceIDs struct {
+	mu   sync.Mutex
+	next map[soap.IDKind]int
+}
+
+// NewID implements soap.IDGenerator
+func (s *SequenceIDs) NewID(kind soap.IDKind) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next == nil {
+		s.next = map[soap.IDKind]int{}
+	}
+	s.next[kind]++
+	return fmt.Sprintf("%s-%d", kind, s.next[kind])
+}
@@ -0,0 +1,17 @@
+package soaptest
+
+import (
+	"testing"
+
+	"github.com/orirawlings/soap"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ soap.IDGenerator = (*SequenceIDs)(nil)
+
+func TestSequenceIDs(t *testing.T) {
+	ids := &SequenceIDs{}
+	assert.Equal(t, "message-1", ids.NewID(soap.IDMessage))
+	assert.Equal(t, "message-2", ids.NewID(soap.IDMessage))
+	assert.Equal(t, "nonce-1", ids.NewID(soap.IDNonce))
+}
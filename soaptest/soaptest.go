@@ -0,0 +1,55 @@
+// Package soaptest provides utilities for testing code using the soap
+// package.
+package soaptest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/orirawlings/soap"
+)
+
+// Invoke runs the operation registered at path and action of srv for req in
+// process, through the same decode, dispatch and encode pipeline as
+// srv.ServeHTTP, but without HTTP. It returns the response the handler
+// produced or the SOAP fault the server has emitted. err is reserved for
+// failures of the harness itself, e.g. if req can't be marshaled.
+func Invoke(srv *soap.Server, path, action string, req interface{}) (resp interface{}, fault *soap.Fault, err error) {
+	soapRequestBytes, err := srv.Marshaller.Marshal(soap.Envelope{
+		Body: soap.Body{Content: req},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not marshal request: %w", err)
+	}
+	if srv.SoapVersion == soap.SoapVersion12 {
+		soapRequestBytes = bytes.ReplaceAll(soapRequestBytes, []byte(soap.NamespaceSoap11), []byte(soap.NamespaceSoap12))
+	}
+
+	r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(soapRequestBytes))
+	r.Header.Set("Content-Type", srv.ContentType)
+	r.Header.Set("SOAPAction", action)
+	w := httptest.NewRecorder()
+
+	resp, handleErr := srv.HandleMessage(w, r, soapRequestBytes)
+	if handleErr == nil {
+		return resp, nil, nil
+	}
+
+	responseBytes := w.Body.Bytes()
+	if srv.SoapVersion == soap.SoapVersion12 {
+		responseBytes = bytes.ReplaceAll(responseBytes, []byte(soap.NamespaceSoap12), []byte(soap.NamespaceSoap11))
+	}
+	responseEnvelope := &soap.Envelope{
+		Body: soap.Body{Content: &struct{}{}},
+	}
+	if err := xml.Unmarshal(responseBytes, responseEnvelope); err != nil {
+		return nil, nil, fmt.Errorf("could not unmarshal fault for %q: %w", handleErr, err)
+	}
+	if responseEnvelope.Body.Fault != nil {
+		return nil, responseEnvelope.Body.Fault, nil
+	}
+	return nil, nil, fmt.Errorf("no fault emitted for %q", handleErr)
+}
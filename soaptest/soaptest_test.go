@@ -0,0 +1,66 @@
+package soaptest
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/orirawlings/soap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fooRequest struct {
+	XMLName xml.Name `xml:"fooRequest"`
+	Foo     string
+}
+
+type fooResponse struct {
+	Bar string
+}
+
+func TestInvoke(t *testing.T) {
+	for _, version := range []string{soap.SoapVersion11, soap.SoapVersion12} {
+		t.Run(version, func(t *testing.T) {
+			srv := soap.NewServer()
+			if version == soap.SoapVersion12 {
+				srv.UseSoap12()
+			}
+			srv.RegisterHandler("/pathTo", "operationFoo", "fooRequest",
+				func() interface{} {
+					return &fooRequest{}
+				},
+				func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+					foo := request.(*fooRequest).Foo
+					if foo == "" {
+						return nil, errors.New("foo is required")
+					}
+					return &fooResponse{Bar: "Hello " + foo}, nil
+				},
+			)
+
+			t.Run("response", func(t *testing.T) {
+				resp, fault, err := Invoke(srv, "/pathTo", "operationFoo", &fooRequest{Foo: "foo"})
+				require.NoError(t, err)
+				assert.Nil(t, fault)
+				assert.Exactly(t, &fooResponse{Bar: "Hello foo"}, resp)
+			})
+
+			t.Run("handler fault", func(t *testing.T) {
+				resp, fault, err := Invoke(srv, "/pathTo", "operationFoo", &fooRequest{})
+				require.NoError(t, err)
+				assert.Nil(t, resp)
+				require.NotNil(t, fault)
+				assert.Exactly(t, "foo is required", fault.String)
+			})
+
+			t.Run("unknown action", func(t *testing.T) {
+				_, fault, err := Invoke(srv, "/pathTo", "operationBar", &fooRequest{Foo: "foo"})
+				require.NoError(t, err)
+				require.NotNil(t, fault)
+				assert.Exactly(t, `unknown action "operationBar"`, fault.String)
+			})
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package soap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// SizeHinter is implemented by requests which know the approximate size of
+// their encoded Body content, see Client.StreamThreshold. The size of other
+// requests is measured by encoding them like Marshal without keeping the
+// output, until StreamThreshold is reached.
+type SizeHinter interface {
+	SOAPSizeHint() int64
+}
+
+// errSizeLimit stops measuring requests, see requestSize.
+var errSizeLimit = errors.New("size limit reached")
+
+// streams decides whether the request of a Call of soapAction is streamed,
+// see StreamThreshold.
+func (c *Client) streams(soapAction string, request interface{}, o *callOptions) bool {
+	if c.StreamThreshold <= 0 {
+		return false
+	}
+	size, err := requestSize(request, c.StreamThreshold)
+	if err != nil {
+		// marshalling reports it
+		return false
+	}
+	o.stats.SizeEstimate = size
+	if size < c.StreamThreshold {
+		return false
+	}
+	if reason := c.unstreamable(request, o); reason != "" {
+		if c.Log != nil {
+			c.Log("Buffering large request", "action", soapAction, "size_estimate", size, "reason", reason)
+		}
+		return false
+	}
+	if c.Log != nil {
+		c.Log("Streaming request", "action", soapAction, "size_estimate", size, "note", "retries are disabled")
+	}
+	o.stats.Streamed = true
+	return true
+}
+
+// unstreamable returns why the request can't be streamed, "" if it can.
+func (c *Client) unstreamable(request interface{}, o *callOptions) string {
+	switch {
+	case request == nil:
+		return "no request"
+	case isRawRequest(request):
+		return "raw body"
+	case c.BodyEncoder != nil:
+		return "BodyEncoder is set"
+	case c.Marshaller != defaultMarshaller{}:
+		return "custom Marshaller"
+	case c.Signer != nil:
+		return "Signer is set"
+	case c.IntegrityHeader != "":
+		return "IntegrityHeader is set"
+	case c.Archiver != nil:
+		return "Archiver is set"
+	case o.attachments != nil:
+		return "WithAttachments is set"
+	case o.features.CompressRequest.on():
+		return "CompressRequest is set"
+	case o.features.DeterministicOutput.on():
+		return "DeterministicOutput is set"
+	}
+	return ""
+}
+
+func isRawRequest(request interface{}) bool {
+	_, ok := request.(rawRequest)
+	return ok
+}
+
+// requestSize returns the SizeHinter estimate of request or measures it like
+// Marshal encodes it, but stops at limit.
+func requestSize(request interface{}, limit int64) (int64, error) {
+	if sh, ok := request.(SizeHinter); ok {
+		return sh.SOAPSizeHint(), nil
+	}
+	if raw, ok := request.(rawRequest); ok {
+		return int64(len(raw)), nil
+	}
+	cw := countingWriter{limit: limit}
+	if err := encodeIndent(&cw, request, "", ""); err != nil {
+		if errors.Is(err, errSizeLimit) {
+			return limit, nil
+		}
+		return 0, err
+	}
+	return cw.n, nil
+}
+
+// countingWriter counts and discards what's written, failing with
+// errSizeLimit once limit is reached.
+type countingWriter struct {
+	n     int64
+	limit int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.n += int64(len(p))
+	if cw.n >= cw.limit {
+		return 0, errSizeLimit
+	}
+	return len(p), nil
+}
+
+// roundTripStream makes a single attempt of a SOAP call like roundTrip, but
+// encodes request while it is sent.
+func (c *Client) roundTripStream(ctx context.Context, endpoint, soapAction string, request, response interface{}, o *callOptions) (*http.Response, error) {
+	if o.features.ValidateEnums.on() {
+		if err := ValidateEnums(request); err != nil {
+			return nil, protocolError(err)
+		}
+	}
+	ew := c.requestEnvelopeWriter(soapAction, o)
+	req, err := c.prepareRequest(ctx, endpoint, soapAction, nil, o)
+	if err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	// unblocks the encoder, if the request isn't sent completely
+	defer pr.Close()
+	req.Body = pr
+	req.GetBody = nil
+	req.ContentLength = -1
+	go func() {
+		pw.CloseWithError(writeStreamedEnvelope(pw, ew, request))
+	}()
+	return c.send(req, soapAction, nil, response, o)
+}
+
+// writeStreamedEnvelope writes the envelope of request to w while it is
+// encoded. It is the envelope ew.write returns with the default Marshaller,
+// whatever the size of request.
+func writeStreamedEnvelope(w io.Writer, ew envelopeWriter, request interface{}) error {
+	var rw *replacingWriter
+	if ew.Version == SoapVersion12 {
+		rw = &replacingWriter{w: w, old: bNamespaceSoap11, new: bNamespaceSoap12}
+		w = rw
+	}
+	bw := bufio.NewWriter(w)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(encodeIndent(pw, ew.envelope(request), "", defaultIndent))
+	}()
+	err := tidyPrefixes(bw, pr)
+	// unblocks the encoder, if tidying failed
+	pr.CloseWithError(err)
+	if err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if rw != nil {
+		return rw.Flush()
+	}
+	return nil
+}
+
+// replacingWriter writes to w what's written to it with old replaced by new,
+// like bytes.ReplaceAll. The end of the input, which may be the start of old,
+// is held back until Flush.
+type replacingWriter struct {
+	w        io.Writer
+	old, new []byte
+	held     []byte
+}
+
+func (rw *replacingWriter) Write(p []byte) (int, error) {
+	data := append(rw.held, p...)
+	var out []byte
+	for {
+		i := bytes.Index(data, rw.old)
+		if i < 0 {
+			break
+		}
+		out = append(append(out, data[:i]...), rw.new...)
+		data = data[i+len(rw.old):]
+	}
+	keep := len(rw.old) - 1
+	if keep > len(data) {
+		keep = len(data)
+	}
+	out = append(out, data[:len(data)-keep]...)
+	rw.held = append(rw.held[:0], data[len(data)-keep:]...)
+	if _, err := rw.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes what's held back.
+func (rw *replacingWriter) Flush() error {
+	_, err := rw.w.Write(rw.held)
+	rw.held = nil
+	return err
+}
@@ -0,0 +1,180 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hintedRequest claims a size without encoding to it.
+type hintedRequest struct {
+	XMLName xml.Name `xml:"fooRequest"`
+	Foo     string
+	hint    int64
+}
+
+func (r *hintedRequest) SOAPSizeHint() int64 { return r.hint }
+
+func TestClient_StreamThreshold(t *testing.T) {
+	soapSrv := NewServer()
+	var contentLengths []int64
+	soapSrv.RegisterHandler("/pathTo", "foo", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			contentLengths = append(contentLengths, httpRequest.ContentLength)
+			return &FooResponse{Bar: strings.ToUpper(request.(*FooRequest).Foo)}, nil
+		},
+	)
+	srv := httptest.NewServer(soapSrv)
+	defer srv.Close()
+	c := NewClient(srv.URL+"/pathTo", nil)
+	var logged []string
+	c.Log = func(msg string, keyString_ValueInterface ...interface{}) {
+		logged = append(logged, msg)
+	}
+
+	stats := &CallStats{}
+	response := &FooResponse{}
+	_, err := c.Call(context.Background(), "foo", &FooRequest{Foo: "small"}, response, WithCallStats(stats))
+	require.NoError(t, err)
+	assert.Equal(t, "SMALL", response.Bar)
+	assert.False(t, stats.Streamed)
+	assert.Zero(t, stats.SizeEstimate, "no estimate without a threshold")
+
+	c.StreamThreshold = 1000
+	stats = &CallStats{}
+	_, err = c.Call(context.Background(), "foo", &FooRequest{Foo: "small"}, response, WithCallStats(stats))
+	require.NoError(t, err)
+	assert.False(t, stats.Streamed)
+	assert.Equal(t, int64(len("<fooRequest><Foo>small</Foo></fooRequest>")), stats.SizeEstimate, "measured")
+	assert.Greater(t, contentLengths[1], int64(0))
+
+	stats = &CallStats{}
+	large := strings.Repeat("x", 2000)
+	_, err = c.Call(context.Background(), "foo", &FooRequest{Foo: large}, response, WithCallStats(stats))
+	require.NoError(t, err)
+	assert.Equal(t, strings.ToUpper(large), response.Bar)
+	assert.True(t, stats.Streamed)
+	assert.Equal(t, int64(-1), contentLengths[2], "no Content-Length")
+	assert.Contains(t, logged, "Streaming request")
+
+	stats = &CallStats{}
+	_, err = c.Call(context.Background(), "foo", &hintedRequest{Foo: "hinted", hint: 1 << 20}, response, WithCallStats(stats))
+	require.NoError(t, err)
+	assert.Equal(t, "HINTED", response.Bar)
+	assert.True(t, stats.Streamed)
+	assert.Equal(t, int64(1<<20), stats.SizeEstimate)
+
+	c.Marshaller = &countingMarshaller{XMLMarshaller: defaultMarshaller{}}
+	stats = &CallStats{}
+	_, err = c.Call(context.Background(), "foo", &FooRequest{Foo: large}, response, WithCallStats(stats))
+	require.NoError(t, err)
+	assert.False(t, stats.Streamed, "custom Marshallers need the whole envelope")
+	assert.Contains(t, logged, "Buffering large request")
+}
+
+func TestClient_StreamThreshold_SOAP12(t *testing.T) {
+	var body string
+	c := NewClient("http://localhorst.ch", nil)
+	c.UseSoap12()
+	c.StreamThreshold = 1
+	c.HTTPClientDoFn = func(req *http.Request) (*http.Response, error) {
+		b, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		body = string(b)
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	}
+
+	_, err := c.Call(context.Background(), "foo", &FooRequest{Foo: "foo"}, nil)
+	require.NoError(t, err)
+	assert.Contains(t, body, `<Envelope xmlns="http://www.w3.org/2003/05/soap-envelope">`)
+	assert.Contains(t, body, "<Foo>foo</Foo>")
+	assert.True(t, strings.HasSuffix(strings.TrimSpace(body), "</Envelope>"), body)
+}
+
+// streamedRequest needs the zero-aware walk and tidied prefixes.
+type streamedRequest struct {
+	XMLName xml.Name `xml:"streamedRequest"`
+	ID      string   `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd Id,attr"`
+	Opt     string   `soap:"omitzero"`
+	Data    string
+}
+
+func TestClient_StreamThreshold_sameEnvelope(t *testing.T) {
+	for _, soapVersion := range []string{SoapVersion11, SoapVersion12} {
+		t.Run(soapVersion, func(t *testing.T) {
+			var bodies []string
+			c := NewClient("http://localhorst.ch", nil)
+			if soapVersion == SoapVersion12 {
+				c.UseSoap12()
+			}
+			c.Headers = []interface{}{&authToken{Token: "t0k3n"}}
+			c.HTTPClientDoFn = func(req *http.Request) (*http.Response, error) {
+				b, err := ioutil.ReadAll(req.Body)
+				require.NoError(t, err)
+				bodies = append(bodies, string(b))
+				return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+			}
+			request := &streamedRequest{ID: "body-1", Data: strings.Repeat("x", 100)}
+
+			stats := &CallStats{}
+			_, err := c.Call(context.Background(), "foo", request, nil, WithCallStats(stats))
+			require.NoError(t, err)
+			assert.False(t, stats.Streamed)
+
+			c.StreamThreshold = 10
+			stats = &CallStats{}
+			_, err = c.Call(context.Background(), "foo", request, nil, WithCallStats(stats))
+			require.NoError(t, err)
+			assert.True(t, stats.Streamed)
+			assert.Equal(t, int64(10), stats.SizeEstimate, "measured up to the threshold")
+
+			require.Len(t, bodies, 2)
+			assert.Equal(t, bodies[0], bodies[1], "streaming doesn't change the envelope")
+			assert.NotContains(t, bodies[1], "<Opt>")
+			assert.Contains(t, bodies[1], `<streamedRequest xmlns:wsu="`+NamespaceWSU+`" wsu:Id="body-1">`)
+		})
+	}
+}
+
+func TestReplacingWriter(t *testing.T) {
+	var out strings.Builder
+	rw := &replacingWriter{w: &out, old: []byte("abc"), new: []byte("X")}
+	for _, p := range []string{"1a", "bc2ab", "", "cab", "c", "ab"} {
+		_, err := rw.Write([]byte(p))
+		require.NoError(t, err)
+	}
+	require.NoError(t, rw.Flush())
+	assert.Equal(t, "1X2XXab", out.String())
+}
+
+func TestClient_StreamThreshold_noRetries(t *testing.T) {
+	attempts := 0
+	c := NewClient("http://localhorst.ch", nil)
+	c.RetryPolicy = &RetryPolicy{MaxAttempts: 3}
+	c.Clock = &sleepRecorder{}
+	c.HTTPClientDoFn = func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return nil, syscall.ECONNRESET
+	}
+
+	_, err := c.Call(context.Background(), "foo", &FooRequest{Foo: "foo"}, nil)
+	assert.Error(t, err)
+	assert.Equal(t, 3, attempts, "buffered requests are retried")
+
+	attempts = 0
+	c.StreamThreshold = 1
+	_, err = c.Call(context.Background(), "foo", &FooRequest{Foo: "foo"}, nil)
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts, "streamed requests aren't")
+}
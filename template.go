@@ -0,0 +1,162 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	placeholderRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_.-]*)\}`)
+	cdataRe       = regexp.MustCompile(`(?s)<!\[CDATA\[.*?\]\]>`)
+)
+
+// TemplateOption configures TemplateRequest.
+type TemplateOption func(*templateOptions)
+
+type templateOptions struct {
+	strict bool
+}
+
+// TemplateStrict makes TemplateRequest reject values whose key has no
+// placeholder in the template, e.g. because of a typo.
+func TemplateStrict() TemplateOption {
+	return func(o *templateOptions) {
+		o.strict = true
+	}
+}
+
+// TemplateRequest fills the ${PLACEHOLDER} tokens of the envelope template
+// templateXML with values, e.g. to send envelopes kept in files with CallRaw.
+// Values are XML-escaped, inside CDATA sections they are inserted verbatim.
+// It fails if a placeholder has no value or the result isn't well-formed XML.
+func TemplateRequest(templateXML []byte, values map[string]string, opts ...TemplateOption) ([]byte, error) {
+	o := &templateOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var (
+		used    = map[string]bool{}
+		missing = map[string]bool{}
+	)
+	substitute := func(segment []byte, cdata bool) []byte {
+		return placeholderRe.ReplaceAllFunc(segment, func(token []byte) []byte {
+			key := string(token[2 : len(token)-1])
+			value, ok := values[key]
+			if !ok {
+				missing[key] = true
+				return token
+			}
+			used[key] = true
+			if cdata {
+				// "]]>" would end the section, split it across two.
+				return []byte(strings.ReplaceAll(value, "]]>", "]]]]><![CDATA[>"))
+			}
+			var buf bytes.Buffer
+			xml.EscapeText(&buf, []byte(value))
+			return buf.Bytes()
+		})
+	}
+
+	out := make([]byte, 0, len(templateXML))
+	last := 0
+	for _, loc := range cdataRe.FindAllIndex(templateXML, -1) {
+		out = append(out, substitute(templateXML[last:loc[0]], false)...)
+		out = append(out, substitute(templateXML[loc[0]:loc[1]], true)...)
+		last = loc[1]
+	}
+	out = append(out, substitute(templateXML[last:], false)...)
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("template placeholders without value: %s", strings.Join(sortedKeys(missing), ", "))
+	}
+	if o.strict {
+		unknown := map[string]bool{}
+		for key := range values {
+			if !used[key] {
+				unknown[key] = true
+			}
+		}
+		if len(unknown) > 0 {
+			return nil, fmt.Errorf("template values without placeholder: %s", strings.Join(sortedKeys(unknown), ", "))
+		}
+	}
+	if err := wellFormed(out); err != nil {
+		return nil, fmt.Errorf("templated request is not well-formed: %w", err)
+	}
+	return out, nil
+}
+
+func sortedKeys[V any](set map[string]V) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// wellFormed checks that data is a single well-formed XML document.
+func wellFormed(data []byte) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	roots := 0
+	depth := 0
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch token.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				roots++
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if roots != 1 {
+		return fmt.Errorf("expected one root element, found %d", roots)
+	}
+	return nil
+}
+
+// CallRaw makes a SOAP call posting envelope as is, e.g. made with
+// TemplateRequest, and decodes the response like Call. The envelope must match
+// the SoapVersion of the Client, namespaces aren't adjusted. Middleware of Use
+// is passed envelope as request.
+func (c *Client) CallRaw(ctx context.Context, soapAction string, envelope []byte, response interface{}, opts ...CallOption) (*http.Response, error) {
+	return c.chain(func(ctx context.Context, action string, request, response interface{}) (*http.Response, error) {
+		envelope, ok := request.([]byte)
+		if !ok {
+			return nil, protocolError(fmt.Errorf("CallRaw needs an envelope as request, got %T", request))
+		}
+		return c.callRaw(ctx, action, envelope, response, opts...)
+	})(ctx, soapAction, envelope, response)
+}
+
+// callRaw makes the SOAP call of CallRaw, after the middleware of Use.
+func (c *Client) callRaw(ctx context.Context, soapAction string, envelope []byte, response interface{}, opts ...CallOption) (httpResponse *http.Response, err error) {
+	cs, err := c.begin(ctx, soapAction, opts)
+	defer func() { cs.end(err) }()
+	if err != nil {
+		return nil, err
+	}
+	ctx, soapAction, o, endpoint := cs.ctx, cs.action, cs.o, cs.endpoint
+	return c.withReauthentication(ctx, func() (*http.Response, error) {
+		return c.retry(ctx, o.retryPolicy, func() (*http.Response, error) {
+			return c.roundTrip(ctx, endpoint, soapAction, envelope, response, o)
+		})
+	})
+}
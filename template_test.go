@@ -0,0 +1,122 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fooTemplate = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>
+<fooRequest note="${NOTE}"><Foo>${FOO}</Foo><Raw><![CDATA[${RAW}]]></Raw></fooRequest>
+</soap:Body></soap:Envelope>`
+
+func TestTemplateRequest(t *testing.T) {
+	out, err := TemplateRequest([]byte(fooTemplate), map[string]string{
+		"FOO":  "a < b & c",
+		"NOTE": `say "hi"`,
+		"RAW":  "<x/> ]]> tail",
+	})
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `<Foo>a &lt; b &amp; c</Foo>`)
+	assert.Contains(t, string(out), `note="say &#34;hi&#34;"`)
+	assert.Contains(t, string(out), `<![CDATA[<x/> ]]]]><![CDATA[> tail]]>`)
+
+	envelope, err := ParseEnvelope(bytes.NewReader(out), WithBodyFactory(func() interface{} { return &FooRequest{} }))
+	require.NoError(t, err)
+	assert.Equal(t, "a < b & c", envelope.Body.Content.(*FooRequest).Foo)
+}
+
+func TestTemplateRequest_errors(t *testing.T) {
+	_, err := TemplateRequest([]byte(fooTemplate), map[string]string{"FOO": "x"})
+	assert.EqualError(t, err, "template placeholders without value: NOTE, RAW")
+
+	values := map[string]string{"FOO": "x", "NOTE": "n", "RAW": "r", "FOOO": "typo"}
+	_, err = TemplateRequest([]byte(fooTemplate), values)
+	assert.NoError(t, err, "unknown keys are fine unless strict")
+	_, err = TemplateRequest([]byte(fooTemplate), values, TemplateStrict())
+	assert.EqualError(t, err, "template values without placeholder: FOOO")
+
+	_, err = TemplateRequest([]byte(`<a>${A}</b>`), map[string]string{"A": "x"})
+	assert.Error(t, err)
+	_, err = TemplateRequest([]byte(`<a/><b/>`), nil)
+	assert.EqualError(t, err, "templated request is not well-formed: expected one root element, found 2")
+}
+
+func TestClient_CallRaw(t *testing.T) {
+	envelope, err := TemplateRequest([]byte(fooTemplate), map[string]string{"FOO": "hello", "NOTE": "", "RAW": ""})
+	require.NoError(t, err)
+
+	var archived []MessageRecord
+	c := NewClient("http://localhorst.ch", &BasicAuth{Login: "user", Password: "pass"})
+	c.Archiver = archiverFunc(func(record MessageRecord) {
+		archived = append(archived, record)
+	})
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, string(envelope), string(body))
+		assert.Equal(t, "foo", r.Header.Get("SOAPAction"))
+		_, _, ok := r.BasicAuth()
+		assert.True(t, ok)
+		return &http.Response{
+			StatusCode: 200,
+			Body: ioutil.NopCloser(bytes.NewReader([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+<soap:Body><fooResponse><Bar>hi</Bar></fooResponse></soap:Body></soap:Envelope>`))),
+		}, nil
+	})}).Do
+
+	response := &FooResponse{}
+	_, err = c.CallRaw(context.Background(), "foo", envelope, response)
+	require.NoError(t, err)
+	assert.Equal(t, "hi", response.Bar)
+	require.Len(t, archived, 2)
+	assert.Equal(t, envelope, archived[0].Body)
+}
+
+func TestClient_CallRawBody(t *testing.T) {
+	const fragment = `<fooRequest xmlns="urn:example:foo"><Foo a="1">hello &amp; bye</Foo></fooRequest>`
+	const fault = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+<soap:Body><soap:Fault><faultcode>soap:Client</faultcode><faultstring>no</faultstring></soap:Fault></soap:Body></soap:Envelope>`
+	const result = `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+<env:Body><fooResponse><Bar>hi</Bar></fooResponse></env:Body></env:Envelope>`
+
+	respond := result
+	c := NewClient("http://localhorst.ch", &BasicAuth{Login: "user", Password: "pass"})
+	c.UseSoap12()
+	c.Headers = []interface{}{&authToken{Token: "t0k3n"}}
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), fragment)
+		headers, err := headerBlocks(body)
+		require.NoError(t, err)
+		assert.Len(t, headers, 1)
+		_, _, ok := r.BasicAuth()
+		assert.True(t, ok)
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(respond))}, nil
+	})}).Do
+
+	_, envelope, err := c.CallRawBody(context.Background(), "foo", []byte(fragment))
+	require.NoError(t, err)
+	assert.Equal(t, result, string(envelope), "returned as received")
+
+	respond = fault
+	c.UseSoap11()
+	httpResponse, envelope, err := c.CallRawBody(context.Background(), "foo", []byte(fragment))
+	var fe *FaultError
+	require.True(t, errors.As(err, &fe), "%v", err)
+	assert.Equal(t, "no", fe.Fault.String)
+	assert.NotNil(t, httpResponse)
+	assert.Equal(t, fault, string(envelope))
+
+	_, _, err = c.CallRawBody(context.Background(), "foo", []byte(`<a><b></a>`))
+	require.Error(t, err)
+	assert.Equal(t, ErrorKindProtocol, KindOf(err))
+}
@@ -0,0 +1,115 @@
+package soap
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+)
+
+// PeerCertificateError is returned when the certificate of the peer doesn't
+// match any pinned fingerprint, see Client.RequirePeerCertSHA256.
+type PeerCertificateError struct {
+	// Fingerprint is the SHA-256 fingerprint of the leaf certificate the peer
+	// presented, empty if the connection wasn't TLS.
+	Fingerprint string
+}
+
+func (pe *PeerCertificateError) Error() string {
+	if pe.Fingerprint == "" {
+		return "peer certificate pinning requires a TLS connection"
+	}
+	return fmt.Sprintf("peer certificate with SHA-256 fingerprint %s is not pinned", pe.Fingerprint)
+}
+
+// CertificateSHA256 returns the hex encoded SHA-256 fingerprint of the DER
+// encoded certificate der.
+func CertificateSHA256(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeFingerprint accepts upper case and colon separated fingerprints.
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+}
+
+func checkPinnedCertificate(fingerprints []string, leaf []byte) error {
+	if leaf == nil {
+		return &PeerCertificateError{}
+	}
+	have := CertificateSHA256(leaf)
+	for _, fingerprint := range fingerprints {
+		if normalizeFingerprint(fingerprint) == have {
+			return nil
+		}
+	}
+	return &PeerCertificateError{Fingerprint: have}
+}
+
+// VerifyPeerCertSHA256 returns a tls.Config.VerifyPeerCertificate function
+// aborting the TLS handshake, before any request is sent, if the leaf
+// certificate doesn't match one of the SHA-256 fingerprints.
+func VerifyPeerCertSHA256(fingerprints []string) func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("no peer certificate presented")
+		}
+		return checkPinnedCertificate(fingerprints, rawCerts[0])
+	}
+}
+
+// PinnedTransport returns a clone of base whose TLS handshakes fail if the
+// leaf certificate of the peer doesn't match one of the SHA-256 fingerprints.
+// Use it where Client.RequirePeerCertSHA256 can't close connections before
+// the request is sent, e.g. for HTTPClientDoFn implementations wrapping the
+// transport.
+func PinnedTransport(base *http.Transport, fingerprints []string) *http.Transport {
+	t := base.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	t.TLSClientConfig.VerifyPeerCertificate = VerifyPeerCertSHA256(fingerprints)
+	return t
+}
+
+// checkPeerCertificate enforces RequirePeerCertSHA256 on the connection state
+// of a response.
+func (c *Client) checkPeerCertificate(state *tls.ConnectionState) error {
+	if len(c.RequirePeerCertSHA256) == 0 {
+		return nil
+	}
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return &PeerCertificateError{}
+	}
+	return checkPinnedCertificate(c.RequirePeerCertSHA256, state.PeerCertificates[0].Raw)
+}
+
+// pinConnections enforces RequirePeerCertSHA256 on the connections req is
+// sent on: connections to peers which aren't pinned are closed as soon as the
+// transport got them, before req is written. The returned error is set then.
+func (c *Client) pinConnections(req *http.Request) (*http.Request, *error) {
+	pinErr := new(error)
+	if len(c.RequirePeerCertSHA256) == 0 {
+		return req, pinErr
+	}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			var state *tls.ConnectionState
+			if conn, ok := info.Conn.(interface{ ConnectionState() tls.ConnectionState }); ok {
+				cs := conn.ConnectionState()
+				state = &cs
+			}
+			if err := c.checkPeerCertificate(state); err != nil {
+				*pinErr = err
+				info.Conn.Close()
+			}
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), pinErr
+}
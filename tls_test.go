@@ -0,0 +1,97 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_RequirePeerCertSHA256(t *testing.T) {
+	var handled int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&handled, 1)
+		w.Header().Set("Content-Type", SoapContentType11)
+		w.Write([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><FooResponse><Bar>pinned</Bar></FooResponse></Body></Envelope>`))
+	}))
+	defer srv.Close()
+	fingerprint := CertificateSHA256(srv.Certificate().Raw)
+
+	t.Run("pinned", func(t *testing.T) {
+		c := NewClient(srv.URL, nil)
+		c.HTTPClientDoFn = srv.Client().Do
+		c.RequirePeerCertSHA256 = []string{"00:11", strings.ToUpper(fingerprint)}
+
+		var stats CallStats
+		var resp FooResponse
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &resp, WithCallStats(&stats))
+		require.NoError(t, err)
+		assert.Exactly(t, "pinned", resp.Bar)
+		require.NotNil(t, stats.TLS)
+		assert.Exactly(t, srv.Certificate().Raw, stats.TLS.PeerCertificates[0].Raw)
+	})
+
+	t.Run("not pinned", func(t *testing.T) {
+		before := atomic.LoadInt32(&handled)
+		c := NewClient(srv.URL, &BasicAuth{Login: "user", Password: "secret"})
+		c.HTTPClientDoFn = srv.Client().Do
+		c.RequirePeerCertSHA256 = []string{"00:11"}
+
+		var stats CallStats
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{}, WithCallStats(&stats))
+		var pe *PeerCertificateError
+		require.True(t, errors.As(err, &pe), "%v", err)
+		assert.Exactly(t, fingerprint, pe.Fingerprint)
+		assert.Equal(t, ErrorKindProtocol, KindOf(err))
+		assert.Exactly(t, before, atomic.LoadInt32(&handled), "the request, credentials included, isn't sent")
+		assert.Nil(t, stats.TLS)
+	})
+
+	t.Run("not pinned, checked on the response", func(t *testing.T) {
+		c := NewClient(srv.URL, nil)
+		c.HTTPClientDoFn = func(req *http.Request) (*http.Response, error) {
+			// hides the connection from the trace
+			return srv.Client().Do(req.WithContext(context.Background()))
+		}
+		c.RequirePeerCertSHA256 = []string{"00:11"}
+
+		var stats CallStats
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{}, WithCallStats(&stats))
+		var pe *PeerCertificateError
+		require.True(t, errors.As(err, &pe), "%v", err)
+		assert.Exactly(t, fingerprint, pe.Fingerprint)
+		assert.NotNil(t, stats.TLS)
+	})
+
+	t.Run("plain HTTP", func(t *testing.T) {
+		plain := httptest.NewServer(http.NotFoundHandler())
+		defer plain.Close()
+		c := NewClient(plain.URL, nil)
+		c.RequirePeerCertSHA256 = []string{fingerprint}
+
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+		var pe *PeerCertificateError
+		require.True(t, errors.As(err, &pe))
+		assert.Empty(t, pe.Fingerprint)
+	})
+
+	t.Run("pinned transport aborts before sending", func(t *testing.T) {
+		before := atomic.LoadInt32(&handled)
+		c := NewClient(srv.URL, nil)
+		c.HTTPClientDoFn = (&http.Client{
+			Transport: PinnedTransport(srv.Client().Transport.(*http.Transport), []string{"00:11"}),
+		}).Do
+
+		_, err := c.Call(context.Background(), "MySOAPAction", &FooRequest{}, &FooResponse{})
+		var pe *PeerCertificateError
+		require.True(t, errors.As(err, &pe))
+		assert.Exactly(t, fingerprint, pe.Fingerprint)
+		assert.Exactly(t, before, atomic.LoadInt32(&handled))
+	})
+}
@@ -0,0 +1,72 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// unwrapResponse replaces the first Body element of envelope by its single
+// child element, if the local name of the Body element is wrapper. Namespace
+// declarations of the wrapper are copied onto the child. A wrapper without
+// child element is dropped, leaving the Body empty. Other envelopes are
+// returned unchanged.
+func unwrapResponse(envelope []byte, wrapper string) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(envelope))
+	var (
+		depth        int
+		inBody       bool
+		wrapperStart int64
+		wrapperDecls []xml.Attr
+		children     int
+		childStart   int64
+		childEnd     int64
+		childDecls   []xml.Attr
+	)
+	for {
+		offset := d.InputOffset()
+		token, err := d.RawToken()
+		if err == io.EOF {
+			return envelope, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tt := token.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case depth == 2:
+				inBody = tt.Name.Local == "Body"
+			case depth == 3 && inBody:
+				if tt.Name.Local != wrapper {
+					return envelope, nil
+				}
+				wrapperStart = offset
+				wrapperDecls = namespaceDecls(tt.Attr)
+			case depth == 4 && wrapperStart > 0:
+				children++
+				if children > 1 {
+					return nil, fmt.Errorf("response wrapper %s has more than one child element, can't tell which is the result", wrapper)
+				}
+				childStart = offset
+				childDecls = namespaceDecls(tt.Attr)
+			}
+		case xml.EndElement:
+			depth--
+			switch {
+			case depth == 3 && wrapperStart > 0:
+				childEnd = d.InputOffset()
+			case depth == 2 && wrapperStart > 0:
+				out := append([]byte(nil), envelope[:wrapperStart]...)
+				if children == 1 {
+					out = append(out, withNamespaceDecls(envelope[childStart:childEnd], wrapperDecls, childDecls)...)
+				}
+				return append(out, envelope[d.InputOffset():]...), nil
+			case depth == 1 && inBody:
+				return envelope, nil
+			}
+		}
+	}
+}
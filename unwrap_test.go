@@ -0,0 +1,66 @@
+package soap
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type quoteResult struct {
+	XMLName struct{} `xml:"urn:example:quotes GetQuoteResult"`
+	Symbol  string   `xml:"urn:example:quotes Symbol"`
+	Price   float64  `xml:"urn:example:quotes Price"`
+}
+
+func TestClient_Call_WithUnwrapResponse(t *testing.T) {
+	for name, tc := range map[string]struct {
+		file    string
+		body    string
+		want    quoteResult
+		wantErr string
+	}{
+		"wrapped":  {file: "testdata/unwrap/wrapped.response.xml", want: quoteResult{Symbol: "ACME", Price: 42.17}},
+		"bare":     {file: "testdata/unwrap/bare.response.xml", want: quoteResult{Symbol: "ACME", Price: 42.17}},
+		"no child": {body: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><GetQuoteResponse xmlns="urn:example:quotes"/></Body></Envelope>`},
+		"ambiguous": {
+			body: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><GetQuoteResponse xmlns="urn:example:quotes">
+<GetQuoteResult><Symbol>ACME</Symbol></GetQuoteResult><GetQuoteResult><Symbol>INIT</Symbol></GetQuoteResult>
+</GetQuoteResponse></Body></Envelope>`,
+			wantErr: "response wrapper GetQuoteResponse has more than one child element",
+		},
+		"header named like the wrapper": {
+			body: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Header><GetQuoteResponse xmlns="urn:example:quotes"><a/><b/></GetQuoteResponse></Header>
+<Body><GetQuoteResult xmlns="urn:example:quotes"><Symbol>ACME</Symbol></GetQuoteResult></Body></Envelope>`,
+			want: quoteResult{Symbol: "ACME"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			body := []byte(tc.body)
+			if tc.file != "" {
+				var err error
+				body, err = ioutil.ReadFile(tc.file)
+				require.NoError(t, err)
+			}
+			c := NewClient("http://localhorst.ch", nil)
+			c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(string(body)))}, nil
+			})}).Do
+
+			response := &quoteResult{}
+			_, err := c.Call(context.Background(), "GetQuote", &FooRequest{}, response, WithUnwrapResponse("GetQuoteResponse"))
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				assert.Equal(t, ErrorKindProtocol, KindOf(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, *response)
+		})
+	}
+}
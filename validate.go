@@ -0,0 +1,113 @@
+package soap
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+// RegistrationError describes a handler or alias registered in a way the
+// Server can't serve, see Server.Validate.
+type RegistrationError struct {
+	Path    string
+	Action  string
+	Element string // the request element
+	Err     error
+}
+
+func (re *RegistrationError) Error() string {
+	return fmt.Sprintf("path %q, action %q, element %q: %s", re.Path, re.Action, re.Element, re.Err)
+}
+
+func (re *RegistrationError) Unwrap() error {
+	return re.Err
+}
+
+var errDuplicateRegistration = errors.New("registered more than once, the last registration wins")
+
+// Validate checks the registered handlers and aliases and returns all
+// problems found, nil if there are none: request factories returning nil, a
+// non-pointer or a type for another element, duplicate registrations and
+// aliases without a handler to route to. Call it after registering, e.g. in
+// main or a test. If it hasn't been called, the first request runs it and
+// logs the problems.
+func (s *Server) Validate() []error {
+	atomic.StoreUint32(&s.validated, 1)
+	var errs []error
+	for _, path := range sortedKeys(s.handlers) {
+		for _, action := range sortedKeys(s.handlers[path]) {
+			for _, element := range sortedKeys(s.handlers[path][action]) {
+				if err := checkFactory(element, s.handlers[path][action][element]); err != nil {
+					errs = append(errs, &RegistrationError{Path: path, Action: action, Element: element, Err: err})
+				}
+			}
+		}
+	}
+	for _, r := range s.duplicates {
+		errs = append(errs, &RegistrationError{Path: r[0], Action: r[1], Element: r[2], Err: errDuplicateRegistration})
+	}
+	for _, path := range sortedKeys(s.aliases) {
+		for _, action := range sortedKeys(s.aliases[path]) {
+			for _, element := range sortedKeys(s.aliases[path][action]) {
+				alias := s.aliases[path][action][element]
+				if _, ok := s.aliasedHandler(path, element, alias); !ok {
+					tag := element
+					if alias.requestTag != "" {
+						tag = alias.requestTag
+					}
+					errs = append(errs, &RegistrationError{Path: path, Action: action, Element: element,
+						Err: fmt.Errorf("alias of action %q, element %q, which has no handler", alias.action, tag)})
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// validateOnce runs Validate for the first request, if it has never been
+// called, and logs the problems.
+func (s *Server) validateOnce() {
+	if !atomic.CompareAndSwapUint32(&s.validated, 0, 1) {
+		return
+	}
+	for _, err := range s.Validate() {
+		s.log("invalid registration:", err)
+	}
+}
+
+// checkFactory checks that the factory of h returns a pointer, which requests
+// with the element can be decoded into, and that a BodyStreamDecoder is
+// streamed.
+func checkFactory(element string, h *operationHandler) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("request factory panicked: %v", v)
+		}
+	}()
+	request := h.requestFactory()
+	if request == nil {
+		return errors.New("request factory returns nil")
+	}
+	t := reflect.TypeOf(request)
+	if t.Kind() != reflect.Ptr {
+		return fmt.Errorf("request factory returns non-pointer %s", t)
+	}
+	if _, ok := request.(BodyStreamDecoder); ok {
+		if !h.streaming {
+			return fmt.Errorf("request factory returns BodyStreamDecoder %s, register the handler with StreamBody", t)
+		}
+		return nil
+	}
+	if t.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	if f, ok := t.Elem().FieldByName("XMLName"); ok {
+		tag := strings.Split(f.Tag.Get("xml"), ",")[0]
+		if local := tag[strings.LastIndex(tag, " ")+1:]; local != "" && local != element {
+			return fmt.Errorf("request factory returns %s for element %q", t, local)
+		}
+	}
+	return nil
+}
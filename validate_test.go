@@ -0,0 +1,88 @@
+package soap
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Validate(t *testing.T) {
+	handler := func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+		return &FooResponse{Bar: "ok"}, nil
+	}
+	soapSrv := NewServer()
+	soapSrv.RegisterHandler("/pathTo", "foo", "fooRequest", func() interface{} { return &FooRequest{} }, handler)
+	soapSrv.RegisterHandler("/pathTo", "foo", "fooRequest", func() interface{} { return &FooRequest{} }, handler)
+	soapSrv.RegisterHandler("/pathTo", "value", "fooRequest", func() interface{} { return FooRequest{} }, handler)
+	soapSrv.RegisterHandler("/pathTo", "nil", "fooRequest", func() interface{} { return nil }, handler)
+	soapSrv.RegisterHandler("/pathTo", "order", "fooRequest", func() interface{} { return &orderRequest{} }, handler)
+	soapSrv.RegisterHandler("/pathTo", "upload", "blob", func() interface{} { return &blobRequest{} }, handler, StreamBody())
+	soapSrv.RegisterHandler("/pathTo", "unstreamed", "blob", func() interface{} { return &blobRequest{} }, handler)
+	soapSrv.Alias("/pathTo", "oldFoo", "fooRequest", "foo")
+	soapSrv.Alias("/pathTo", "oldBar", "barRequest", "bar")
+	soapSrv.Alias("/pathTo", "loop", "fooRequest", "oldFoo")
+
+	var got []string
+	for _, err := range soapSrv.Validate() {
+		got = append(got, err.Error())
+	}
+	assert.Equal(t, []string{
+		`path "/pathTo", action "nil", element "fooRequest": request factory returns nil`,
+		`path "/pathTo", action "order", element "fooRequest": request factory returns *soap.orderRequest for element "orderRequest"`,
+		`path "/pathTo", action "unstreamed", element "blob": request factory returns BodyStreamDecoder *soap.blobRequest, register the handler with StreamBody`,
+		`path "/pathTo", action "value", element "fooRequest": request factory returns non-pointer soap.FooRequest`,
+		`path "/pathTo", action "foo", element "fooRequest": registered more than once, the last registration wins`,
+		`path "/pathTo", action "loop", element "fooRequest": alias of action "oldFoo", element "fooRequest", which has no handler`,
+		`path "/pathTo", action "oldBar", element "barRequest": alias of action "bar", element "barRequest", which has no handler`,
+	}, got)
+
+	soapSrv = NewServer()
+	soapSrv.RegisterHandler("/pathTo", "foo", "fooRequest", func() interface{} { return &FooRequest{} }, handler)
+	soapSrv.Alias("/pathTo", "oldFoo", "oldFooRequest", "foo", AliasRequestTag("fooRequest"))
+	assert.Empty(t, soapSrv.Validate())
+}
+
+func TestServer_Validate_firstRequest(t *testing.T) {
+	var logged []string
+	soapSrv := NewServer()
+	soapSrv.Log = func(args ...interface{}) {
+		if args[0] == "invalid registration:" {
+			logged = append(logged, fmt.Sprint(args[1]))
+		}
+	}
+	soapSrv.RegisterHandler("/pathTo", "foo", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			return &FooResponse{Bar: "ok"}, nil
+		},
+	)
+	soapSrv.Alias("/pathTo", "oldBar", "barRequest", "bar")
+	srv := httptest.NewServer(soapSrv)
+	defer srv.Close()
+	c := NewClient(srv.URL+"/pathTo", nil)
+
+	for i := 0; i < 2; i++ {
+		_, err := c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{`path "/pathTo", action "oldBar", element "barRequest": alias of action "bar", element "barRequest", which has no handler`}, logged)
+
+	logged = nil
+	soapSrv = NewServer()
+	soapSrv.Log = func(args ...interface{}) {
+		if args[0] == "invalid registration:" {
+			logged = append(logged, fmt.Sprint(args[1]))
+		}
+	}
+	soapSrv.Alias("/pathTo", "oldBar", "barRequest", "bar")
+	soapSrv.Validate()
+	soapSrv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/pathTo", nil))
+	assert.Empty(t, logged, "validated servers aren't validated again")
+}
@@ -0,0 +1,95 @@
+package soap
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// WSAAnonymous is the anonymous address of WS-Addressing, replies are sent
+// on the connection of the request.
+const WSAAnonymous = NamespaceWSA + "/anonymous"
+
+// WSAddressing adds the WS-Addressing header blocks wsa:To, wsa:Action,
+// wsa:MessageID and wsa:ReplyTo to requests, see Client.WSAddressing and
+// WithWSAddressing. The MessageID of a call is reported in
+// CallStats.MessageID, use RelatesToOf to match responses.
+type WSAddressing struct {
+	// To is the destination, the URL passed to NewClient if empty.
+	To string
+	// Action replaces the SOAPAction of the call.
+	Action string
+	// ReplyTo is the address replies are sent to, WSAAnonymous if empty.
+	ReplyTo string
+	// IDGenerator mints the MessageID as IDMessage, it falls back to the
+	// IDGenerator of the Client.
+	IDGenerator IDGenerator
+}
+
+type wsaValue struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+type wsaReplyTo struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/08/addressing ReplyTo"`
+	Address string   `xml:"http://www.w3.org/2005/08/addressing Address"`
+}
+
+// headers returns the header blocks of a request to url with soapAction and
+// its MessageID.
+func (wsa *WSAddressing) headers(url, soapAction string, ids IDGenerator) (headers []interface{}, messageID string) {
+	to, action, replyTo := wsa.To, wsa.Action, wsa.ReplyTo
+	if to == "" {
+		to = url
+	}
+	if action == "" {
+		// a quoted SOAPAction, see Client.QuoteSOAPAction, is the same action
+		action = strings.Trim(soapAction, `"`)
+	}
+	if replyTo == "" {
+		replyTo = WSAAnonymous
+	}
+	if wsa.IDGenerator != nil {
+		ids = wsa.IDGenerator
+	}
+	messageID = ids.NewID(IDMessage)
+	return []interface{}{
+		wsaValue{XMLName: QNameTo, Value: to},
+		wsaValue{XMLName: QNameAction, Value: action},
+		wsaValue{XMLName: QNameMessageID, Value: messageID},
+		wsaReplyTo{Address: replyTo},
+	}, messageID
+}
+
+// RelatesTo is a wsa:RelatesTo header block, see RelatesToOf.
+type RelatesTo struct {
+	// MessageID is the message the message relates to.
+	MessageID string
+	// RelationshipType is a URI, "" stands for a reply.
+	RelationshipType string
+}
+
+type relatesToXML struct {
+	RelationshipType string `xml:"RelationshipType,attr"`
+	Value            string `xml:",chardata"`
+}
+
+// RelatesToOf returns the wsa:RelatesTo header blocks among headers, e.g. the
+// CallStats.ResponseHeaders.
+func RelatesToOf(headers []HeaderBlock) ([]RelatesTo, error) {
+	var relations []RelatesTo
+	for _, h := range headers {
+		if h.Name != QNameRelatesTo {
+			continue
+		}
+		var in relatesToXML
+		if err := xml.Unmarshal(h.Raw, &in); err != nil {
+			return nil, err
+		}
+		relations = append(relations, RelatesTo{
+			MessageID:        strings.TrimSpace(in.Value),
+			RelationshipType: in.RelationshipType,
+		})
+	}
+	return relations, nil
+}
@@ -0,0 +1,81 @@
+package soap
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_WSAddressing(t *testing.T) {
+	const response = `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/" xmlns:wsa="http://www.w3.org/2005/08/addressing">
+	<Header>
+		<wsa:Action>urn:fooResponse</wsa:Action>
+		<wsa:RelatesTo>message-1</wsa:RelatesTo>
+		<wsa:RelatesTo RelationshipType="urn:example:previous"> message-0 </wsa:RelatesTo>
+	</Header>
+	<Body><FooResponse><Bar>bar</Bar></FooResponse></Body>
+</Envelope>`
+	var headers []HeaderBlock
+	c := NewClient("http://localhorst.ch/foo?key=secret", nil)
+	c.Headers = []interface{}{&authToken{Token: "t0k3n"}}
+	c.WSAddressing = &WSAddressing{IDGenerator: sequenceIDs{}}
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		request, _ := ioutil.ReadAll(r.Body)
+		headers, _ = headerBlocks(request)
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(response))}, nil
+	})}).Do
+
+	stats := &CallStats{}
+	_, err := c.Call(context.Background(), "urn:foo", &FooRequest{}, &FooResponse{}, WithCallStats(stats))
+	require.NoError(t, err)
+	require.Len(t, headers, 5)
+	assert.Equal(t, `<To xmlns="http://www.w3.org/2005/08/addressing">http://localhorst.ch/foo?key=secret</To>`, string(headers[0].Raw))
+	assert.Equal(t, `<Action xmlns="http://www.w3.org/2005/08/addressing">urn:foo</Action>`, string(headers[1].Raw))
+	assert.Equal(t, `<MessageID xmlns="http://www.w3.org/2005/08/addressing">message-1</MessageID>`, string(headers[2].Raw))
+	assert.Equal(t, QNameReplyTo, headers[3].Name)
+	assert.Contains(t, string(headers[3].Raw), `<Address xmlns="http://www.w3.org/2005/08/addressing">http://www.w3.org/2005/08/addressing/anonymous</Address>`)
+	assert.Equal(t, QNameAction, headers[1].Name)
+	assert.Equal(t, `<AuthToken xmlns="urn:example:auth">t0k3n</AuthToken>`, string(headers[4].Raw), "Headers follow")
+	assert.Equal(t, "message-1", stats.MessageID)
+
+	relations, err := RelatesToOf(stats.ResponseHeaders)
+	require.NoError(t, err)
+	assert.Equal(t, []RelatesTo{
+		{MessageID: "message-1"},
+		{MessageID: "message-0", RelationshipType: "urn:example:previous"},
+	}, relations)
+
+	_, err = c.Call(context.Background(), "urn:foo", &FooRequest{}, &FooResponse{},
+		WithWSAddressing(&WSAddressing{To: "urn:to", Action: "urn:override", ReplyTo: "http://example.com/replies", IDGenerator: sequenceIDs{}}))
+	require.NoError(t, err)
+	require.Len(t, headers, 5)
+	assert.Equal(t, `<To xmlns="http://www.w3.org/2005/08/addressing">urn:to</To>`, string(headers[0].Raw))
+	assert.Equal(t, `<Action xmlns="http://www.w3.org/2005/08/addressing">urn:override</Action>`, string(headers[1].Raw))
+	assert.Equal(t, QNameReplyTo, headers[3].Name)
+	assert.Contains(t, string(headers[3].Raw), `<Address xmlns="http://www.w3.org/2005/08/addressing">http://example.com/replies</Address>`)
+}
+
+func TestClient_WSAddressing_quotedAction(t *testing.T) {
+	var headers []HeaderBlock
+	c := NewClient("http://localhorst.ch", nil)
+	c.QuoteSOAPAction = true
+	c.WSAddressing = &WSAddressing{}
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		assert.Equal(t, `"urn:foo"`, r.Header.Get("SOAPAction"))
+		request, _ := ioutil.ReadAll(r.Body)
+		headers, _ = headerBlocks(request)
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	})}).Do
+
+	stats := &CallStats{}
+	_, err := c.Call(context.Background(), "urn:foo", &FooRequest{}, nil, WithCallStats(stats))
+	require.NoError(t, err)
+	require.Len(t, headers, 4)
+	assert.Equal(t, `<Action xmlns="http://www.w3.org/2005/08/addressing">urn:foo</Action>`, string(headers[1].Raw))
+	assert.Regexp(t, `^urn:uuid:`, stats.MessageID)
+}
@@ -0,0 +1,189 @@
+package soap
+
+import (
+	"encoding/xml"
+	"strconv"
+	"sync"
+)
+
+// Sequence is the wsrm:Sequence header of WS-ReliableMessaging, which numbers
+// the messages of a sequence. The protocol itself, i.e. creating sequences and
+// resending unacknowledged messages, is up to the caller. Add the header to
+// Client.Headers or use WithHeaders, see SequenceNumbers.
+type Sequence struct {
+	// Namespace is the WS-ReliableMessaging version, NamespaceWSRM if empty.
+	Namespace     string
+	Identifier    string
+	MessageNumber uint64
+	// LastMessage marks the last message of the sequence. It exists in
+	// NamespaceWSRM200502 only, later versions close sequences explicitly.
+	LastMessage bool
+}
+
+// MarshalXML writes the Sequence header in its namespace.
+func (s Sequence) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	ns := s.Namespace
+	if ns == "" {
+		ns = NamespaceWSRM
+	}
+	out := struct {
+		XMLName  xml.Name
+		Children []wsrmElement
+	}{
+		XMLName: xml.Name{Space: ns, Local: "Sequence"},
+		Children: []wsrmElement{
+			{XMLName: xml.Name{Space: ns, Local: "Identifier"}, Value: s.Identifier},
+			{XMLName: xml.Name{Space: ns, Local: "MessageNumber"}, Value: strconv.FormatUint(s.MessageNumber, 10)},
+		},
+	}
+	if s.LastMessage {
+		out.Children = append(out.Children, wsrmElement{XMLName: xml.Name{Space: ns, Local: "LastMessage"}})
+	}
+	return e.Encode(out)
+}
+
+type wsrmElement struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+// SequenceAcknowledgement is the wsrm:SequenceAcknowledgement header, by which
+// the receiver of a sequence acknowledges messages.
+type SequenceAcknowledgement struct {
+	// Namespace is the WS-ReliableMessaging version of the header.
+	Namespace  string
+	Identifier string
+	Ranges     []AcknowledgementRange
+	// Nacks are the message numbers the receiver reports missing.
+	Nacks []uint64
+	// None and Final are NamespaceWSRM only.
+	None  bool
+	Final bool
+}
+
+// AcknowledgementRange is a range of acknowledged message numbers, both ends
+// included.
+type AcknowledgementRange struct {
+	Lower uint64 `xml:"Lower,attr"`
+	Upper uint64 `xml:"Upper,attr"`
+}
+
+// Acknowledged reports whether the message number n has been acknowledged.
+func (sa SequenceAcknowledgement) Acknowledged(n uint64) bool {
+	for _, r := range sa.Ranges {
+		if r.Lower <= n && n <= r.Upper {
+			return true
+		}
+	}
+	return false
+}
+
+// sequenceAcknowledgementXML is namespace agnostic, the namespace of the
+// header block is checked by SequenceAcknowledgementsOf.
+type sequenceAcknowledgementXML struct {
+	Identifier string                 `xml:"Identifier"`
+	Ranges     []AcknowledgementRange `xml:"AcknowledgementRange"`
+	Nacks      []uint64               `xml:"Nack"`
+	None       *struct{}              `xml:"None"`
+	Final      *struct{}              `xml:"Final"`
+}
+
+// SequenceAcknowledgementsOf returns the SequenceAcknowledgement headers among
+// headers, e.g. CallStats.ResponseHeaders, of either WS-ReliableMessaging
+// version.
+func SequenceAcknowledgementsOf(headers []HeaderBlock) ([]SequenceAcknowledgement, error) {
+	var acks []SequenceAcknowledgement
+	for _, h := range headers {
+		if h.Name.Local != "SequenceAcknowledgement" || h.Name.Space != NamespaceWSRM && h.Name.Space != NamespaceWSRM200502 {
+			continue
+		}
+		var in sequenceAcknowledgementXML
+		if err := xml.Unmarshal(h.Raw, &in); err != nil {
+			return nil, err
+		}
+		acks = append(acks, SequenceAcknowledgement{
+			Namespace:  h.Name.Space,
+			Identifier: in.Identifier,
+			Ranges:     in.Ranges,
+			Nacks:      in.Nacks,
+			None:       in.None != nil,
+			Final:      in.Final != nil,
+		})
+	}
+	return acks, nil
+}
+
+// SequenceNumberStore persists the last message number used per sequence,
+// e.g. to continue sequences after a restart. Implementations must be safe for
+// concurrent use.
+type SequenceNumberStore interface {
+	// Load returns the last message number of the sequence identifier, 0 if
+	// none has been used yet.
+	Load(identifier string) (uint64, error)
+	Save(identifier string, number uint64) error
+}
+
+// MemorySequenceNumberStore is an in-memory SequenceNumberStore.
+type MemorySequenceNumberStore struct {
+	mu      sync.Mutex
+	numbers map[string]uint64
+}
+
+// Load implements SequenceNumberStore
+func (ms *MemorySequenceNumberStore) Load(identifier string) (uint64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.numbers[identifier], nil
+}
+
+// Save implements SequenceNumberStore
+func (ms *MemorySequenceNumberStore) Save(identifier string, number uint64) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.numbers == nil {
+		ms.numbers = make(map[string]uint64)
+	}
+	ms.numbers[identifier] = number
+	return nil
+}
+
+// SequenceNumbers hands out the message numbers of sequences, starting at 1.
+type SequenceNumbers struct {
+	Store SequenceNumberStore
+
+	mu sync.Mutex
+}
+
+// NewSequenceNumbers returns SequenceNumbers persisted in store, in memory if
+// store is nil.
+func NewSequenceNumbers(store SequenceNumberStore) *SequenceNumbers {
+	if store == nil {
+		store = &MemorySequenceNumberStore{}
+	}
+	return &SequenceNumbers{Store: store}
+}
+
+// Next returns the next message number of the sequence identifier.
+func (sn *SequenceNumbers) Next(identifier string) (uint64, error) {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	n, err := sn.Store.Load(identifier)
+	if err != nil {
+		return 0, err
+	}
+	n++
+	if err := sn.Store.Save(identifier, n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Sequence returns the Sequence header of the next message of the sequence
+// identifier in namespace, see Sequence.Namespace.
+func (sn *SequenceNumbers) Sequence(namespace, identifier string) (*Sequence, error) {
+	n, err := sn.Next(identifier)
+	if err != nil {
+		return nil, err
+	}
+	return &Sequence{Namespace: namespace, Identifier: identifier, MessageNumber: n}, nil
+}
@@ -0,0 +1,118 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequenceAcknowledgementsOf(t *testing.T) {
+	for name, tc := range map[string]struct {
+		file   string
+		soap12 bool
+		want   []SequenceAcknowledgement
+	}{
+		"WCF 2005/02": {
+			file:   "testdata/wsrm/wcf200502.response.xml",
+			soap12: true,
+			want: []SequenceAcknowledgement{{
+				Namespace:  NamespaceWSRM200502,
+				Identifier: "urn:uuid:6c9d4a70-8a5e-4e1b-b1b3-0d3b6f1c2a11",
+				Ranges:     []AcknowledgementRange{{Lower: 1, Upper: 3}, {Lower: 5, Upper: 5}},
+			}},
+		},
+		"WS-RM 1.1": {
+			file: "testdata/wsrm/wsrm11.response.xml",
+			want: []SequenceAcknowledgement{
+				{
+					Namespace:  NamespaceWSRM,
+					Identifier: "http://example.com/sequences/a2f1",
+					Ranges:     []AcknowledgementRange{{Lower: 1, Upper: 2}},
+					Final:      true,
+				},
+				{
+					Namespace:  NamespaceWSRM,
+					Identifier: "http://example.com/sequences/b7c3",
+					Nacks:      []uint64{4, 6},
+				},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			envelope, err := ioutil.ReadFile(tc.file)
+			require.NoError(t, err)
+			c := NewClient("http://localhorst.ch", nil)
+			if tc.soap12 {
+				c.UseSoap12()
+			}
+			c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(string(envelope)))}, nil
+			})}).Do
+
+			stats := &CallStats{}
+			response := &FooResponse{}
+			_, err = c.Call(context.Background(), "foo", &FooRequest{}, response, WithCallStats(stats))
+			require.NoError(t, err)
+			assert.Equal(t, "accepted", response.Bar)
+
+			acks, err := SequenceAcknowledgementsOf(stats.ResponseHeaders)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, acks)
+		})
+	}
+
+	ack := SequenceAcknowledgement{Ranges: []AcknowledgementRange{{Lower: 1, Upper: 3}, {Lower: 5, Upper: 5}}}
+	assert.True(t, ack.Acknowledged(3))
+	assert.False(t, ack.Acknowledged(4))
+	assert.True(t, ack.Acknowledged(5))
+}
+
+func TestSequence(t *testing.T) {
+	numbers := NewSequenceNumbers(nil)
+	var received []HeaderBlock
+	soapSrv := NewServer()
+	soapSrv.RegisterHandler("/pathTo", "foo", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			received = RequestHeaders(httpRequest.Context())
+			return &FooResponse{}, nil
+		},
+	)
+	srv := httptest.NewServer(soapSrv)
+	defer srv.Close()
+	c := NewClient(srv.URL+"/pathTo", nil)
+
+	for _, want := range []uint64{1, 2} {
+		sequence, err := numbers.Sequence(NamespaceWSRM200502, "urn:uuid:seq-1")
+		require.NoError(t, err)
+		_, err = c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{}, WithHeaders(sequence))
+		require.NoError(t, err)
+
+		require.Len(t, received, 1)
+		assert.Equal(t, xml.Name{Space: NamespaceWSRM200502, Local: "Sequence"}, received[0].Name)
+		var in struct {
+			Identifier    string `xml:"http://schemas.xmlsoap.org/ws/2005/02/rm Identifier"`
+			MessageNumber uint64 `xml:"http://schemas.xmlsoap.org/ws/2005/02/rm MessageNumber"`
+		}
+		require.NoError(t, xml.Unmarshal(received[0].Raw, &in))
+		assert.Equal(t, "urn:uuid:seq-1", in.Identifier)
+		assert.Equal(t, want, in.MessageNumber)
+	}
+
+	n, err := numbers.Next("urn:uuid:seq-2")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), n, "sequences are numbered independently")
+
+	data, err := xml.Marshal(Sequence{Identifier: "s", MessageNumber: 7, LastMessage: true})
+	require.NoError(t, err)
+	assert.Equal(t, `<Sequence xmlns="`+NamespaceWSRM+`"><Identifier xmlns="`+NamespaceWSRM+`">s</Identifier><MessageNumber xmlns="`+NamespaceWSRM+`">7</MessageNumber><LastMessage xmlns="`+NamespaceWSRM+`"></LastMessage></Sequence>`, string(data))
+}
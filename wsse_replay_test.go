@@ -0,0 +1,63 @@
+package soap_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orirawlings/soap"
+	"github.com/orirawlings/soap/soaptest"
+)
+
+func TestUsernameTokenVerifier_replayAfterTTL(t *testing.T) {
+	const ttl = 5 * time.Minute
+	clock := soaptest.NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	nonces := soap.NewMemoryNonceStore(ttl)
+	nonces.Clock = clock
+	verifier := &soap.UsernameTokenVerifier{
+		Password: func(username string) (string, bool) {
+			return "s3cr3t", username == "ada"
+		},
+		Nonces: nonces,
+	}
+	soapSrv := soap.NewServer()
+	soapSrv.RegisterHandler("/greeter", "greet", "greetRequest",
+		func() interface{} {
+			return &greetRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			username, err := verifier.Verify(soap.RequestHeaders(httpRequest.Context()))
+			if err != nil {
+				return nil, err
+			}
+			return &greetResponse{Greeting: username}, nil
+		},
+	)
+	c := soap.NewClient("http://localhorst.ch/greeter", nil)
+	c.HTTPClientDoFn = soap.NewLoopback(soapSrv)
+	call := func(token *soap.WSSEUsernameToken) error {
+		_, err := c.Call(context.Background(), "greet", &greetRequest{}, &greetResponse{}, soap.WithHeaders(token))
+		return err
+	}
+	failedAuthentication := func(t *testing.T, err error, reason string) {
+		var fe *soap.FaultError
+		require.ErrorAs(t, err, &fe)
+		assert.Equal(t, "wsse:FailedAuthentication", fe.Fault.Code)
+		assert.Equal(t, reason, fe.Fault.String)
+	}
+
+	withoutCreated := &soap.WSSEUsernameToken{Username: "ada", Password: "s3cr3t", Nonce: []byte("once")}
+	failedAuthentication(t, call(withoutCreated), "Nonce without Created")
+	clock.Advance(2 * ttl)
+	failedAuthentication(t, call(withoutCreated), "Nonce without Created")
+
+	withCreated := &soap.WSSEUsernameToken{Username: "ada", Password: "s3cr3t", Nonce: []byte("twice"), Created: clock.Now()}
+	require.NoError(t, call(withCreated))
+	failedAuthentication(t, call(withCreated), "replayed or expired UsernameToken")
+	clock.Advance(2 * ttl)
+	failedAuthentication(t, call(withCreated), "replayed or expired UsernameToken")
+}
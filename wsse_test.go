@@ -0,0 +1,261 @@
+package soap
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// samlAssertion is shaped like a signed bearer assertion, its whitespace,
+// prefixes and attribute order must survive unchanged.
+const samlAssertion = `<saml2:Assertion xmlns:saml2="urn:oasis:names:tc:SAML:2.0:assertion" ID="_a1b2"  IssueInstant="2026-10-15T08:00:00Z" Version="2.0">
+	<saml2:Issuer>https://idp.example.com</saml2:Issuer>
+	<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo/><ds:SignatureValue>c2lnbmF0dXJl
+</ds:SignatureValue></ds:Signature>
+	<saml2:Subject><saml2:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified">ada&amp;co</saml2:NameID></saml2:Subject>
+</saml2:Assertion>`
+
+func TestSecurity_SAMLAssertion(t *testing.T) {
+	created := time.Date(2026, 10, 15, 8, 0, 0, 0, time.UTC)
+	security := &Security{
+		Timestamp: &Timestamp{Created: created, Expires: created.Add(5 * time.Minute)},
+		Assertion: &SAMLAssertion{Raw: []byte(samlAssertion)},
+	}
+
+	for _, soapVersion := range []string{SoapVersion11, SoapVersion12} {
+		t.Run(soapVersion, func(t *testing.T) {
+			var received *SAMLAssertion
+			soapSrv := NewServer()
+			if soapVersion == SoapVersion12 {
+				soapSrv.UseSoap12()
+			}
+			soapSrv.RegisterHandler("/pathTo", "foo", "fooRequest",
+				func() interface{} {
+					return &FooRequest{}
+				},
+				func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+					received = SAMLAssertionOf(RequestHeaders(httpRequest.Context()))
+					return &FooResponse{Bar: "ok"}, nil
+				},
+			)
+			srv := httptest.NewServer(soapSrv)
+			defer srv.Close()
+
+			c := NewClient(srv.URL+"/pathTo", nil)
+			if soapVersion == SoapVersion12 {
+				c.UseSoap12()
+			}
+			c.Headers = []interface{}{security}
+			_, err := c.Call(context.Background(), "foo", &FooRequest{Foo: "foo"}, &FooResponse{})
+			require.NoError(t, err)
+			require.NotNil(t, received)
+			assert.Equal(t, samlAssertion, string(received.Raw))
+		})
+	}
+
+	t.Run("layout", func(t *testing.T) {
+		data, err := xml.Marshal(security)
+		require.NoError(t, err)
+		out := string(data)
+		assert.True(t, strings.HasPrefix(out, `<Security xmlns="`+NamespaceWSSE+`">`), out)
+		assert.Contains(t, out, `<Created xmlns="`+NamespaceWSU+`">2026-10-15T08:00:00.000Z</Created><Expires xmlns="`+NamespaceWSU+`">2026-10-15T08:05:00.000Z</Expires>`)
+		assert.Less(t, strings.Index(out, "Timestamp"), strings.Index(out, samlAssertion))
+	})
+}
+
+func TestRequestHeaders(t *testing.T) {
+	envelope := []byte(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" xmlns:a="urn:a"><s:Header>
+<a:One>1</a:One><Two xmlns="urn:b"><x/></Two><Three/>
+</s:Header><s:Body><fooRequest/></s:Body></s:Envelope>`)
+	blocks, err := headerBlocks(envelope)
+	require.NoError(t, err)
+	assert.Equal(t, []HeaderBlock{
+		{Name: xml.Name{Space: "urn:a", Local: "One"}, Raw: []byte(`<a:One>1</a:One>`)},
+		{Name: xml.Name{Space: "urn:b", Local: "Two"}, Raw: []byte(`<Two xmlns="urn:b"><x/></Two>`)},
+		{Name: xml.Name{Local: "Three"}, Raw: []byte(`<Three/>`)},
+	}, blocks)
+
+	blocks, err = headerBlocks([]byte(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body/></s:Envelope>`))
+	require.NoError(t, err)
+	assert.Empty(t, blocks)
+}
+
+func TestWSSEUsernameToken(t *testing.T) {
+	token := &WSSEUsernameToken{
+		Username: "ada",
+		Password: "s3cr<t",
+		Nonce:    []byte("0123456789abcdef"),
+		Created:  time.Date(2026, 10, 15, 8, 0, 0, 0, time.UTC),
+	}
+
+	var request []byte
+	var authorization string
+	c := NewClient("http://localhorst.ch", &BasicAuth{Login: "gateway", Password: "pw"})
+	c.Headers = []interface{}{token}
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		request, _ = ioutil.ReadAll(r.Body)
+		authorization = r.Header.Get("Authorization")
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	})}).Do
+	_, err := c.Call(context.Background(), "foo", &FooRequest{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Basic Z2F0ZXdheTpwdw==", authorization, "basic auth is sent along")
+
+	blocks, err := headerBlocks(request)
+	require.NoError(t, err)
+	require.Len(t, blocks, 1)
+	assert.Equal(t, QNameSecurity, blocks[0].Name)
+	assertGolden(t, "wsse_username_token.xml", blocks[0].Raw)
+
+	data, err := xml.Marshal(&Security{Timestamp: &Timestamp{Created: token.Created, Expires: token.Created.Add(time.Minute)}, UsernameToken: &WSSEUsernameToken{Username: "ada", Password: "pw"}})
+	require.NoError(t, err)
+	out := string(data)
+	assert.Less(t, strings.Index(out, "Timestamp"), strings.Index(out, "UsernameToken"), out)
+	assert.NotContains(t, out, "Nonce", "optional elements are omitted")
+	assert.Equal(t, 1, strings.Count(out, "</Created>"), "only the Timestamp has a Created")
+}
+
+func TestWSSETimestamp(t *testing.T) {
+	clock := &sleepRecorder{now: time.Date(2026, 10, 15, 10, 0, 0, 123456789, time.FixedZone("CEST", 2*60*60))}
+	ts := &WSSETimestamp{TTL: 90 * time.Second, Clock: clock, IDGenerator: sequenceIDs{}}
+
+	assert.Equal(t, &Timestamp{
+		ID:      "TS-element-1",
+		Created: time.Date(2026, 10, 15, 8, 0, 0, 123000000, time.UTC),
+		Expires: time.Date(2026, 10, 15, 8, 1, 30, 123000000, time.UTC),
+	}, ts.Timestamp())
+
+	var request []byte
+	c := NewClient("http://localhorst.ch", nil)
+	c.Headers = []interface{}{ts}
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		request, _ = ioutil.ReadAll(r.Body)
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	})}).Do
+	_, err := c.Call(context.Background(), "foo", &FooRequest{}, nil)
+	require.NoError(t, err)
+	blocks, err := headerBlocks(request)
+	require.NoError(t, err)
+	require.Len(t, blocks, 1)
+	out := string(blocks[0].Raw)
+	assert.Contains(t, out, `<Timestamp xmlns="`+NamespaceWSU+`" xmlns:wsu="`+NamespaceWSU+`" wsu:Id="TS-element-2">`)
+	assert.Contains(t, out, `>2026-10-15T08:00:00.123Z</Created>`)
+	assert.Contains(t, out, `>2026-10-15T08:01:30.123Z</Expires>`)
+
+	clock.now = clock.now.Add(time.Minute)
+	ts.Security = &Security{UsernameToken: &WSSEUsernameToken{Username: "ada", Password: "pw"}}
+	_, err = c.Call(context.Background(), "foo", &FooRequest{}, nil)
+	require.NoError(t, err)
+	blocks, err = headerBlocks(request)
+	require.NoError(t, err)
+	require.Len(t, blocks, 1, "a single Security header")
+	out = string(blocks[0].Raw)
+	assert.Contains(t, out, `>2026-10-15T08:01:00.123Z</Created>`, "created per request")
+	assert.Less(t, strings.Index(out, "<Timestamp"), strings.Index(out, "<UsernameToken"), out)
+}
+
+func TestWSSEUsernameToken_digest(t *testing.T) {
+	// Nonce and Created of the example of the UsernameToken Profile, the digest
+	// is computed independently with Python's hashlib.
+	nonce, err := hex.DecodeString("d36e316282959a9ed4c89851497a717f")
+	require.NoError(t, err)
+	assert.Equal(t, "xzwbFlkhLtAK/hc7kIcULNndAxI=", PasswordDigest(nonce, "2003-12-15T14:43:07Z", "taadtaadpstcsm"))
+
+	token := &WSSEUsernameToken{
+		Username:    "ada",
+		Password:    "taadtaadpstcsm",
+		Digest:      true,
+		Clock:       &sleepRecorder{now: time.Date(2003, 12, 15, 14, 43, 7, 0, time.UTC)},
+		IDGenerator: nonceIDs{base64.StdEncoding.EncodeToString(nonce)},
+	}
+	data, err := xml.Marshal(token)
+	require.NoError(t, err)
+	out := string(data)
+	assert.Contains(t, out, `Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">xzwbFlkhLtAK/hc7kIcULNndAxI=</Password>`)
+	assert.Contains(t, out, `EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary">024xYoKVmp7UyJhRSXpxfw==</Nonce>`)
+	assert.Contains(t, out, `>2003-12-15T14:43:07Z</Created>`)
+	assert.NotContains(t, out, "taadtaadpstcsm")
+
+	token.IDGenerator = nil
+	first, err := xml.Marshal(token)
+	require.NoError(t, err)
+	second, err := xml.Marshal(token)
+	require.NoError(t, err)
+	assert.NotEqual(t, string(first), string(second), "a fresh nonce per envelope")
+}
+
+// nonceIDs mints the same nonce every time.
+type nonceIDs struct{ nonce string }
+
+func (n nonceIDs) NewID(kind IDKind) string {
+	return n.nonce
+}
+
+func TestUsernameTokenVerifier(t *testing.T) {
+	verifier := &UsernameTokenVerifier{
+		Password: func(username string) (string, bool) {
+			return "s3cr3t", username == "ada"
+		},
+		Nonces: NewMemoryNonceStore(5 * time.Minute),
+	}
+	soapSrv := NewServer()
+	soapSrv.RegisterHandler("/pathTo", "foo", "fooRequest",
+		func() interface{} {
+			return &FooRequest{}
+		},
+		func(request interface{}, w http.ResponseWriter, httpRequest *http.Request) (interface{}, error) {
+			username, err := verifier.Verify(RequestHeaders(httpRequest.Context()))
+			if err != nil {
+				return nil, err
+			}
+			return &FooResponse{Bar: username}, nil
+		},
+	)
+	c := NewClient("http://localhorst.ch/pathTo", nil)
+	c.HTTPClientDoFn = NewLoopback(soapSrv)
+	call := func(token *WSSEUsernameToken) (*FooResponse, error) {
+		response := &FooResponse{}
+		_, err := c.Call(context.Background(), "foo", &FooRequest{}, response, WithHeaders(token))
+		return response, err
+	}
+	failedAuthentication := func(t *testing.T, err error, reason string) {
+		var fe *FaultError
+		require.ErrorAs(t, err, &fe)
+		assert.Equal(t, "wsse:FailedAuthentication", fe.Fault.Code)
+		assert.Equal(t, reason, fe.Fault.String)
+	}
+
+	response, err := call(&WSSEUsernameToken{Username: "ada", Password: "s3cr3t"})
+	require.NoError(t, err)
+	assert.Equal(t, "ada", response.Bar)
+
+	replayed := &WSSEUsernameToken{
+		Username:    "ada",
+		Password:    "s3cr3t",
+		Digest:      true,
+		Created:     time.Now(),
+		IDGenerator: nonceIDs{base64.StdEncoding.EncodeToString([]byte("once"))},
+	}
+	response, err = call(replayed)
+	require.NoError(t, err)
+	assert.Equal(t, "ada", response.Bar)
+	_, err = call(replayed)
+	failedAuthentication(t, err, "replayed or expired UsernameToken")
+
+	_, err = call(&WSSEUsernameToken{Username: "ada", Password: "wrong", Digest: true})
+	failedAuthentication(t, err, "unknown user or wrong password")
+	_, err = call(&WSSEUsernameToken{Username: "bob", Password: "s3cr3t"})
+	failedAuthentication(t, err, "unknown user or wrong password")
+	_, err = c.Call(context.Background(), "foo", &FooRequest{}, &FooResponse{})
+	failedAuthentication(t, err, "UsernameToken missing")
+}
@@ -0,0 +1,245 @@
+package soap
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Algorithms of XML signatures
+const (
+	signatureRSASHA256 = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	digestSHA256       = NamespaceXMLEnc + "sha256"
+	x509v3TokenType    = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-x509-token-profile-1.0#X509v3"
+)
+
+// EnvelopeSigner signs request envelopes, see Client.Signer.
+type EnvelopeSigner interface {
+	// SignEnvelope returns the signed envelope, it must not modify envelope.
+	SignEnvelope(envelope []byte) ([]byte, error)
+}
+
+// X509Signer is the EnvelopeSigner of the X.509 Token Profile. It signs the
+// SOAP Body, referenced by a wsu:Id, with an RSA key: the Security header gets
+// the certificate as BinarySecurityToken and a ds:Signature using Exclusive XML
+// Canonicalization, SHA-256 digests and RSA-SHA256. Tokens of a Security
+// header already in the envelope, e.g. a Timestamp, are kept.
+//
+// Verifiers need to know that wsu:Id is an ID attribute, e.g.
+// xmlsec1 --verify --id-attr:Id <SOAP envelope namespace>:Body.
+type X509Signer struct {
+	// Certificate is the signing certificate, its PrivateKey must be an RSA
+	// key. The leaf certificate is sent.
+	Certificate tls.Certificate
+	// IDGenerator mints the wsu:Id of the Body and the token, "Body-" and
+	// "X509-" followed by an IDElement. It falls back to the IDGenerator of
+	// the Client, or RandomIDs.
+	IDGenerator IDGenerator
+}
+
+// SignEnvelope implements EnvelopeSigner
+func (xs *X509Signer) SignEnvelope(envelope []byte) ([]byte, error) {
+	if len(xs.Certificate.Certificate) == 0 {
+		return nil, errors.New("signing certificate missing")
+	}
+	key, ok := xs.Certificate.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("signing key missing")
+	}
+	if _, ok := key.Public().(*rsa.PublicKey); !ok {
+		return nil, fmt.Errorf("unsupported signing key %T, need an RSA key", key.Public())
+	}
+	ids := xs.IDGenerator
+	if ids == nil {
+		ids = RandomIDs{}
+	}
+
+	doc, err := scanEnvelope(envelope)
+	if err != nil {
+		return nil, err
+	}
+	bodyID := doc.bodyID
+	signed := envelope
+	if bodyID == "" {
+		bodyID = "Body-" + ids.NewID(IDElement)
+		signed = splice(envelope, doc.bodyAttrsAt, 0,
+			fmt.Sprintf(` xmlns:wsu="%s" wsu:Id="%s"`, NamespaceWSU, c14nAttrReplacer.Replace(bodyID)))
+	}
+	body, err := excC14N(signed, func(se xml.StartElement) bool {
+		return se.Name.Space == doc.namespace && se.Name.Local == "Body" && attrValue(se, QNameID) == bodyID
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not canonicalize body: %w", err)
+	}
+	digest := sha256.Sum256(body)
+
+	signedInfo, err := excC14N([]byte(fmt.Sprintf(
+		`<ds:SignedInfo xmlns:ds="%s">`+
+			`<ds:CanonicalizationMethod Algorithm="%s"></ds:CanonicalizationMethod>`+
+			`<ds:SignatureMethod Algorithm="%s"></ds:SignatureMethod>`+
+			`<ds:Reference URI="#%s">`+
+			`<ds:Transforms><ds:Transform Algorithm="%s"></ds:Transform></ds:Transforms>`+
+			`<ds:DigestMethod Algorithm="%s"></ds:DigestMethod>`+
+			`<ds:DigestValue>%s</ds:DigestValue>`+
+			`</ds:Reference>`+
+			`</ds:SignedInfo>`,
+		NamespaceDS, NamespaceExcC14N, signatureRSASHA256, c14nAttrReplacer.Replace(bodyID),
+		NamespaceExcC14N, digestSHA256, base64.StdEncoding.EncodeToString(digest[:]),
+	)), func(xml.StartElement) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	hashed := sha256.Sum256(signedInfo)
+	signature, err := key.Sign(rand.Reader, hashed[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("could not sign envelope: %w", err)
+	}
+
+	tokenID := "X509-" + ids.NewID(IDElement)
+	tokens := fmt.Sprintf(
+		`<wsse:BinarySecurityToken xmlns:wsse="%s" xmlns:wsu="%s" EncodingType="%s" ValueType="%s" wsu:Id="%s">%s</wsse:BinarySecurityToken>`+
+			`<ds:Signature xmlns:ds="%s">%s<ds:SignatureValue>%s</ds:SignatureValue>`+
+			`<ds:KeyInfo><wsse:SecurityTokenReference xmlns:wsse="%s"><wsse:Reference URI="#%s" ValueType="%s"></wsse:Reference></wsse:SecurityTokenReference></ds:KeyInfo>`+
+			`</ds:Signature>`,
+		NamespaceWSSE, NamespaceWSU, base64BinaryEncoding, x509v3TokenType, c14nAttrReplacer.Replace(tokenID),
+		base64.StdEncoding.EncodeToString(xs.Certificate.Certificate[0]),
+		NamespaceDS, signedInfo, base64.StdEncoding.EncodeToString(signature),
+		NamespaceWSSE, c14nAttrReplacer.Replace(tokenID), x509v3TokenType,
+	)
+	// The Header precedes the Body, splicing it leaves the Body untouched.
+	switch {
+	case doc.securityAt >= 0:
+		return splice(signed, doc.securityAt, doc.securityCut, tokens), nil
+	case doc.headerAt >= 0:
+		return splice(signed, doc.headerAt, doc.headerCut,
+			`<wsse:Security xmlns:wsse="`+NamespaceWSSE+`">`+tokens+`</wsse:Security>`), nil
+	}
+	header := "Header"
+	if doc.prefix != "" {
+		header = doc.prefix + ":Header"
+	}
+	return splice(signed, doc.bodyAt, 0,
+		fmt.Sprintf(`<%s xmlns%s="%s"><wsse:Security xmlns:wsse="%s">%s</wsse:Security></%s>`,
+			header, prefixSuffix(doc.prefix), doc.namespace, NamespaceWSSE, tokens, header)), nil
+}
+
+// scannedEnvelope holds the offsets of an envelope where SignEnvelope inserts.
+// The offsets of Header and Security are where content is appended, -1 if they
+// are missing. A cut is the length of "/>" of an empty element tag, which is
+// replaced by the content and an end tag.
+type scannedEnvelope struct {
+	namespace, prefix string // of the Envelope element
+	headerAt          int
+	headerCut         int
+	securityAt        int
+	securityCut       int
+	bodyAt            int // the start of the Body element
+	bodyAttrsAt       int // the end of the attributes of the Body element
+	bodyID            string
+}
+
+func scanEnvelope(envelope []byte) (*scannedEnvelope, error) {
+	doc := &scannedEnvelope{headerAt: -1, securityAt: -1}
+	d := xml.NewDecoder(bytes.NewReader(envelope))
+	var (
+		scopes []map[string]string
+		path   []xml.Name // resolved names of the open elements
+	)
+	for {
+		offset := int(d.InputOffset())
+		token, err := d.RawToken()
+		if err == io.EOF {
+			return nil, errors.New("envelope without Body")
+		}
+		if err != nil {
+			return nil, err
+		}
+		end := int(d.InputOffset())
+		switch tt := token.(type) {
+		case xml.StartElement:
+			ns := map[string]string{}
+			if len(scopes) > 0 {
+				for prefix, uri := range scopes[len(scopes)-1] {
+					ns[prefix] = uri
+				}
+			}
+			for _, a := range tt.Attr {
+				switch {
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					ns[""] = a.Value
+				case a.Name.Space == "xmlns":
+					ns[a.Name.Local] = a.Value
+				}
+			}
+			scopes = append(scopes, ns)
+			se := resolveStart(tt, ns)
+			path = append(path, se.Name)
+			// Empty element tags have no end tag to insert before.
+			tagEnd, cut := end-1, 0
+			if bytes.HasSuffix(envelope[:end], []byte("/>")) {
+				tagEnd, cut = end-2, 2
+			}
+			switch {
+			case len(path) == 1:
+				doc.namespace, doc.prefix = se.Name.Space, tt.Name.Space
+			case len(path) == 2 && doc.isHeader(se.Name) && cut > 0:
+				doc.headerAt, doc.headerCut = tagEnd, cut
+			case len(path) == 3 && doc.isHeader(path[1]) && se.Name == QNameSecurity && cut > 0:
+				doc.securityAt, doc.securityCut = tagEnd, cut
+			case len(path) == 2 && se.Name == xml.Name{Space: doc.namespace, Local: "Body"}:
+				doc.bodyAt, doc.bodyAttrsAt, doc.bodyID = offset, tagEnd, attrValue(se, QNameID)
+				return doc, nil
+			}
+		case xml.EndElement:
+			switch {
+			case len(path) == 2 && doc.isHeader(path[1]) && doc.headerAt < 0:
+				doc.headerAt = offset
+			case len(path) == 3 && doc.isHeader(path[1]) && path[2] == QNameSecurity && doc.securityAt < 0:
+				doc.securityAt = offset
+			}
+			scopes, path = scopes[:len(scopes)-1], path[:len(path)-1]
+		}
+	}
+}
+
+func (doc *scannedEnvelope) isHeader(name xml.Name) bool {
+	return name == xml.Name{Space: doc.namespace, Local: "Header"}
+}
+
+// splice returns a copy of b with the cut bytes at i replaced by s, an empty
+// element tag is closed by an end tag.
+func splice(b []byte, i, cut int, s string) []byte {
+	out := make([]byte, 0, len(b)+len(s)+32)
+	out = append(out, b[:i]...)
+	if cut > 0 {
+		start := bytes.LastIndexByte(b[:i], '<')
+		name := bytes.Fields(b[start+1 : i])[0]
+		s = ">" + s + "</" + string(name) + ">"
+	}
+	out = append(out, s...)
+	return append(out, b[i+cut:]...)
+}
+
+func attrValue(se xml.StartElement, name xml.Name) string {
+	for _, a := range se.Attr {
+		if a.Name == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func prefixSuffix(prefix string) string {
+	if prefix == "" {
+		return ""
+	}
+	return ":" + prefix
+}
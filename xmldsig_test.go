@@ -0,0 +1,191 @@
+package soap
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCertificate(t *testing.T) tls.Certificate {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "soap client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// verifySignature checks the signature of envelope the way a verifier
+// would, starting from the Reference and the BinarySecurityToken.
+func verifySignature(t *testing.T, envelope []byte) {
+	var doc struct {
+		Header struct {
+			Security struct {
+				Token     string `xml:"BinarySecurityToken"`
+				Signature struct {
+					SignedInfo struct {
+						Reference struct {
+							URI    string `xml:"URI,attr"`
+							Digest string `xml:"DigestValue"`
+						}
+					}
+					Value     string `xml:"SignatureValue"`
+					Reference struct {
+						URI string `xml:"URI,attr"`
+					} `xml:"KeyInfo>SecurityTokenReference>Reference"`
+				}
+			}
+		}
+	}
+	require.NoError(t, xml.Unmarshal(envelope, &doc))
+	security := doc.Header.Security
+
+	bodyID := strings.TrimPrefix(security.Signature.SignedInfo.Reference.URI, "#")
+	body, err := excC14N(envelope, func(se xml.StartElement) bool {
+		return se.Name.Local == "Body" && attrValue(se, QNameID) == bodyID
+	})
+	require.NoError(t, err)
+	digest := sha256.Sum256(body)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(digest[:]), security.Signature.SignedInfo.Reference.Digest)
+
+	tokenID := strings.TrimPrefix(security.Signature.Reference.URI, "#")
+	_, err = excC14N(envelope, func(se xml.StartElement) bool {
+		return se.Name.Local == "BinarySecurityToken" && attrValue(se, QNameID) == tokenID
+	})
+	require.NoError(t, err, "the token reference is dangling")
+	der, err := base64.StdEncoding.DecodeString(security.Token)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	signedInfo, err := excC14N(envelope, func(se xml.StartElement) bool {
+		return se.Name == xml.Name{Space: NamespaceDS, Local: "SignedInfo"}
+	})
+	require.NoError(t, err)
+	signature, err := base64.StdEncoding.DecodeString(security.Signature.Value)
+	require.NoError(t, err)
+	hashed := sha256.Sum256(signedInfo)
+	assert.NoError(t, rsa.VerifyPKCS1v15(cert.PublicKey.(*rsa.PublicKey), crypto.SHA256, hashed[:], signature))
+}
+
+func TestClient_Signer(t *testing.T) {
+	cert := testCertificate(t)
+	tests := []struct {
+		name      string
+		soap12    bool
+		headers   []interface{}
+		wantBody  string
+		wantFirst string // the first token of the Security header
+	}{
+		{
+			name:      "without header",
+			wantBody:  `<Body xmlns="http://schemas.xmlsoap.org/soap/envelope/" xmlns:wsu="` + NamespaceWSU + `" wsu:Id="Body-element-1">`,
+			wantFirst: "<wsse:BinarySecurityToken",
+		},
+		{
+			name:      "with header",
+			soap12:    true,
+			headers:   []interface{}{authToken{Token: "t0k3n"}},
+			wantBody:  `<Body xmlns="http://www.w3.org/2003/05/soap-envelope" xmlns:wsu="` + NamespaceWSU + `" wsu:Id="Body-element-1">`,
+			wantFirst: "<wsse:BinarySecurityToken",
+		},
+		{
+			name:      "with security header",
+			headers:   []interface{}{&WSSETimestamp{IDGenerator: sequenceIDs{}}},
+			wantBody:  `wsu:Id="Body-element-1">`,
+			wantFirst: "<Timestamp",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []byte
+			c := NewClient("http://localhorst.ch", nil)
+			if tt.soap12 {
+				c.UseSoap12()
+			}
+			c.Headers = tt.headers
+			c.Signer = &X509Signer{Certificate: cert, IDGenerator: sequenceIDs{}}
+			c.HTTPClientDoFn = func(req *http.Request) (*http.Response, error) {
+				var err error
+				sent, err = ioutil.ReadAll(req.Body)
+				require.NoError(t, err)
+				return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+			}
+			_, err := c.Call(context.Background(), "foo", &FooRequest{Foo: "a < b"}, nil)
+			require.NoError(t, err)
+
+			assert.Contains(t, string(sent), tt.wantBody)
+			security := string(sent[strings.Index(string(sent), "Security"):])
+			assert.True(t, strings.HasPrefix(strings.TrimSpace(security[strings.Index(security, ">")+1:]), tt.wantFirst), security)
+			assert.Equal(t, 1, strings.Count(string(sent), "Security xmlns"), "a single Security header")
+			verifySignature(t, sent)
+		})
+	}
+}
+
+func TestX509Signer(t *testing.T) {
+	signer := &X509Signer{Certificate: testCertificate(t), IDGenerator: sequenceIDs{}}
+
+	t.Run("prefixed envelope", func(t *testing.T) {
+		envelope := `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><m:op xmlns:m="urn:m">1</m:op></s:Body></s:Envelope>`
+		signed, err := signer.SignEnvelope([]byte(envelope))
+		require.NoError(t, err)
+		assert.Contains(t, string(signed), `<s:Header xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><wsse:Security`)
+		verifySignature(t, signed)
+	})
+	t.Run("empty header and body with id", func(t *testing.T) {
+		envelope := `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Header/><Body xmlns:u="` + NamespaceWSU + `" u:Id="b"><op/></Body></Envelope>`
+		signed, err := signer.SignEnvelope([]byte(envelope))
+		require.NoError(t, err)
+		assert.Contains(t, string(signed), `<Header><wsse:Security`)
+		assert.Contains(t, string(signed), `</wsse:Security></Header><Body xmlns:u="`+NamespaceWSU+`" u:Id="b"><op/></Body>`, "the body is kept")
+		assert.Contains(t, string(signed), `<ds:Reference URI="#b">`)
+		verifySignature(t, signed)
+	})
+	t.Run("invalid key", func(t *testing.T) {
+		_, err := (&X509Signer{}).SignEnvelope([]byte(`<Envelope/>`))
+		assert.EqualError(t, err, "signing certificate missing")
+	})
+}
+
+func TestX509Signer_xmlsec1(t *testing.T) {
+	xmlsec1, err := exec.LookPath("xmlsec1")
+	if err != nil {
+		t.Skip("xmlsec1 is not installed")
+	}
+	cert := testCertificate(t)
+	signed, err := (&X509Signer{Certificate: cert}).SignEnvelope([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><op xmlns="urn:m">1</op></Body></Envelope>`))
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile, envelopeFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "envelope.xml")
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600))
+	require.NoError(t, ioutil.WriteFile(envelopeFile, signed, 0o600))
+	out, err := exec.Command(xmlsec1, "--verify", "--pubkey-cert-pem", certFile,
+		"--id-attr:Id", "http://schemas.xmlsoap.org/soap/envelope/:Body", envelopeFile).CombinedOutput()
+	assert.NoError(t, err, "%s", out)
+}
@@ -0,0 +1,81 @@
+package soap
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+)
+
+// xsdBuiltins are the built-in simple types of XML Schema Part 2.
+var xsdBuiltins = map[string]bool{
+	"string": true, "normalizedString": true, "token": true, "language": true,
+	"Name": true, "NCName": true, "NMTOKEN": true, "NMTOKENS": true,
+	"ID": true, "IDREF": true, "IDREFS": true, "ENTITY": true, "ENTITIES": true,
+	"QName": true, "NOTATION": true, "anyURI": true,
+	"boolean": true, "base64Binary": true, "hexBinary": true,
+	"float": true, "double": true, "decimal": true,
+	"integer": true, "nonPositiveInteger": true, "negativeInteger": true,
+	"nonNegativeInteger": true, "positiveInteger": true,
+	"long": true, "int": true, "short": true, "byte": true,
+	"unsignedLong": true, "unsignedInt": true, "unsignedShort": true, "unsignedByte": true,
+	"duration": true, "dateTime": true, "time": true, "date": true,
+	"gYearMonth": true, "gYear": true, "gMonthDay": true, "gDay": true, "gMonth": true,
+	"anyType": true, "anySimpleType": true,
+}
+
+// ResolveXSIType resolves the value of an xsi:type attribute to a qualified
+// name, e.g. for a BodyDecoder. namespaces maps the prefixes in scope to their
+// URIs, "" is the default namespace. The value is resolved in this order:
+//
+//  1. A declared prefix resolves to its namespace.
+//  2. An unprefixed built-in simple type, e.g. "string", resolves to the xsd
+//     namespace, as some services rely on a default namespace they never
+//     declare as XML Schema.
+//  3. Other unprefixed names resolve to the default namespace, if any.
+//  4. A built-in simple type with the undeclared prefix xsd or xs resolves to
+//     the xsd namespace.
+//
+// ok is false if the value can't be resolved, decoders should ignore the
+// attribute then.
+func ResolveXSIType(value string, namespaces map[string]string) (name xml.Name, ok bool) {
+	value = strings.TrimSpace(value)
+	prefix, local := "", value
+	if i := strings.Index(value, ":"); i >= 0 {
+		prefix, local = value[:i], value[i+1:]
+	}
+	if local == "" {
+		return xml.Name{}, false
+	}
+	if prefix != "" {
+		if ns, declared := namespaces[prefix]; declared {
+			return xml.Name{Space: ns, Local: local}, true
+		}
+		if (prefix == "xsd" || prefix == "xs") && xsdBuiltins[local] {
+			return xml.Name{Space: NamespaceXSD, Local: local}, true
+		}
+		return xml.Name{}, false
+	}
+	if xsdBuiltins[local] {
+		return xml.Name{Space: NamespaceXSD, Local: local}, true
+	}
+	return xml.Name{Space: namespaces[""], Local: local}, true
+}
+
+// IgnoresXSIType reports whether xsi:type is irrelevant for decoding into a
+// value of type t, as t is a concrete scalar, e.g. a string or an int. Only
+// interfaces and structs may need the type to select their decoding.
+func IgnoresXSIType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8 // []byte, e.g. base64Binary
+	}
+	return false
+}
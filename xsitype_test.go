@@ -0,0 +1,86 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveXSIType(t *testing.T) {
+	namespaces := map[string]string{
+		"":    "urn:example:crm",
+		"xsd": NamespaceXSD,
+		"crm": "urn:example:crm",
+	}
+	tests := []struct {
+		value string
+		want  xml.Name
+		ok    bool
+	}{
+		{value: "xsd:string", want: xml.Name{Space: NamespaceXSD, Local: "string"}, ok: true},
+		{value: "crm:SegmentCode", want: xml.Name{Space: "urn:example:crm", Local: "SegmentCode"}, ok: true},
+		{value: "string", want: xml.Name{Space: NamespaceXSD, Local: "string"}, ok: true},
+		{value: " int ", want: xml.Name{Space: NamespaceXSD, Local: "int"}, ok: true},
+		{value: "SegmentCode", want: xml.Name{Space: "urn:example:crm", Local: "SegmentCode"}, ok: true},
+		{value: "xs:dateTime", want: xml.Name{Space: NamespaceXSD, Local: "dateTime"}, ok: true},
+		{value: "xs:SegmentCode"},
+		{value: "other:string"},
+		{value: "crm:"},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			name, ok := ResolveXSIType(test.value, namespaces)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.want, name)
+		})
+	}
+
+	name, ok := ResolveXSIType("SegmentCode", nil)
+	assert.True(t, ok)
+	assert.Equal(t, xml.Name{Local: "SegmentCode"}, name)
+}
+
+func TestIgnoresXSIType(t *testing.T) {
+	for _, v := range []interface{}{"", 0, int64(0), uint8(0), 1.5, true, new(string), []byte{}} {
+		assert.True(t, IgnoresXSIType(reflect.TypeOf(v)), "%T", v)
+	}
+	for _, v := range []interface{}{struct{}{}, new(interface{}), time.Time{}, []string{}} {
+		assert.False(t, IgnoresXSIType(reflect.TypeOf(v)), "%T", v)
+	}
+}
+
+// testdata/xsitype/unprefixed_builtins.response.xml is shaped like the
+// responses of a Java service emitting xsi:type without the xsd prefix.
+func TestClient_Call_unprefixedXSIType(t *testing.T) {
+	envelope, err := ioutil.ReadFile(filepath.Join("testdata", "xsitype", "unprefixed_builtins.response.xml"))
+	require.NoError(t, err)
+	c := NewClient("http://localhorst.ch", nil)
+	c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewReader(envelope))}, nil
+	})}).Do
+
+	response := &struct {
+		XMLName xml.Name `xml:"urn:example:crm getCustomerResponse"`
+		Name    string   `xml:"name"`
+		Age     int      `xml:"age"`
+		Active  bool     `xml:"active"`
+		Balance float64  `xml:"balance"`
+		Segment string   `xml:"segment"`
+	}{}
+	_, err = c.Call(context.Background(), "getCustomer", &FooRequest{}, response)
+	require.NoError(t, err)
+	assert.Equal(t, "Ada Lovelace", response.Name)
+	assert.Equal(t, 36, response.Age)
+	assert.True(t, response.Active)
+	assert.Equal(t, 12.5, response.Balance)
+	assert.Equal(t, "B2C", response.Segment)
+}
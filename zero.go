@@ -0,0 +1,290 @@
+package soap
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Marshal is xml.Marshal honoring the soap struct tag, which controls zero
+// values beyond the omitempty option of encoding/xml:
+//
+//	Count int    `xml:"count" soap:"omitzero"`           // omitted if 0
+//	Name  string `xml:"name" soap:"omitzero"`            // omitted if ""
+//	Flag  bool   `xml:"flag,omitempty" soap:"keepzero"`  // always written
+//	Limit *int   `xml:"limit" soap:"keepzero"`           // <limit>0</limit> if nil
+//
+// The precedence rules are:
+//   - types implementing xml.Marshaler or encoding.TextMarshaler are marshalled
+//     by themselves, soap tags of their fields are ignored
+//   - soap:"omitzero" omits the element or attribute if the field is zero,
+//     including false, 0, "", empty slices and structs with only zero fields,
+//     even without omitempty
+//   - soap:"keepzero" writes the element or attribute even if the field is zero
+//     and tagged omitempty, nil pointers are written as the zero value they
+//     point to
+//   - without a soap tag the rules of encoding/xml apply
+//
+// soap tags apply to fields of nested structs, slice elements and values
+// assigned to interface fields alike. Use Nullable for optional values without
+// pointers. PropertyBag fields take their own soap tag options. Namespaced
+// attributes get the prefixes of ConventionalPrefixes, see TidyPrefixes. The
+// default Marshaller of Client and Server marshals envelopes this way.
+//
+// Embedded structs, exported or not and by value or by pointer, are flattened
+// into the element like encoding/xml does, whether or not soap tags are used;
+// nil embedded pointers contribute no fields. An XMLName of an embedded struct
+// names the element unless the embedding struct declares its own. Requests
+// marshalled by the Client and responses marshalled by the Server are
+// identical for the same value.
+func Marshal(v interface{}) ([]byte, error) {
+	return MarshalIndent(v, "", "")
+}
+
+// MarshalIndent is like Marshal, but indents like xml.MarshalIndent.
+func MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
+	var b bytes.Buffer
+	if err := encodeIndent(&b, v, prefix, indent); err != nil {
+		return nil, err
+	}
+	return TidyPrefixes(b.Bytes())
+}
+
+// encodeIndent writes v to w like MarshalIndent, but doesn't tidy prefixes.
+func encodeIndent(w io.Writer, v interface{}, prefix, indent string) error {
+	enc := xml.NewEncoder(w)
+	enc.Indent(prefix, indent)
+	rv, changed := zeroAware(reflect.ValueOf(v))
+	if !changed {
+		return enc.Encode(v)
+	}
+
+	// The generated struct type has no name, keep the name of the original
+	// type in case the element is named after it.
+	var start xml.StartElement
+	if t := indirectType(reflect.TypeOf(v)); t.Kind() == reflect.Struct && t.Name() != "" {
+		if _, ok := t.FieldByName("XMLName"); !ok {
+			start.Name.Local = t.Name()
+		}
+	}
+	if start.Name.Local != "" {
+		return enc.EncodeElement(rv.Interface(), start)
+	}
+	return enc.Encode(rv.Interface())
+}
+
+var (
+	xmlMarshalerType  = reflect.TypeOf((*xml.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	interfaceType     = reflect.TypeOf((*interface{})(nil)).Elem()
+
+	// zeroAwareTypes caches whether values of a type need to be walked by
+	// zeroAware, i.e. it contains soap tags or interfaces.
+	zeroAwareTypes sync.Map // map[reflect.Type]bool
+)
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func marshalsItself(t reflect.Type) bool {
+	if t.Kind() == reflect.Interface {
+		return false
+	}
+	pt := reflect.PtrTo(t)
+	return t.Implements(xmlMarshalerType) || pt.Implements(xmlMarshalerType) ||
+		t.Implements(textMarshalerType) || pt.Implements(textMarshalerType)
+}
+
+// needsWalk reports whether values of t may contain soap tags.
+func needsWalk(t reflect.Type) bool {
+	if walk, ok := zeroAwareTypes.Load(t); ok {
+		return walk.(bool)
+	}
+	zeroAwareTypes.Store(t, false) // breaks cycles of recursive types
+	walk := computeNeedsWalk(t)
+	zeroAwareTypes.Store(t, walk)
+	return walk
+}
+
+func computeNeedsWalk(t reflect.Type) bool {
+	if marshalsItself(t) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return needsWalk(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.Tag.Get("soap") != "" || needsWalk(f.Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// zeroAware returns v with the soap tags applied and whether it had to be
+// changed for that. Changed structs are replaced by values of generated struct
+// types with adjusted xml tags, changed slices by []interface{}.
+func zeroAware(v reflect.Value) (reflect.Value, bool) {
+	if !v.IsValid() || !needsWalk(v.Type()) {
+		return v, false
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return v, false
+		}
+		elem, changed := zeroAware(v.Elem())
+		if !changed || v.Kind() == reflect.Interface {
+			return elem, changed
+		}
+		p := reflect.New(elem.Type())
+		p.Elem().Set(elem)
+		return p, true
+	case reflect.Slice, reflect.Array:
+		var changed bool
+		elems := make([]reflect.Value, v.Len())
+		for i := range elems {
+			var c bool
+			elems[i], c = zeroAware(v.Index(i))
+			changed = changed || c
+		}
+		if !changed {
+			return v, false
+		}
+		out := reflect.MakeSlice(reflect.SliceOf(interfaceType), len(elems), len(elems))
+		for i, elem := range elems {
+			out.Index(i).Set(elem)
+		}
+		return out, true
+	case reflect.Struct:
+		fields, values, changed := zeroAwareFields(v)
+		if !changed {
+			return v, false
+		}
+		out := reflect.New(reflect.StructOf(fields)).Elem()
+		for i, value := range values {
+			out.Field(i).Set(value)
+		}
+		return out, true
+	}
+	return v, false
+}
+
+// zeroAwareFields returns the fields and values of the struct v with the soap
+// tags applied. Embedded structs are flattened like encoding/xml does, which
+// ignores xml tags of embedded structs.
+func zeroAwareFields(v reflect.Value) ([]reflect.StructField, []reflect.Value, bool) {
+	t := v.Type()
+	declared := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if !t.Field(i).Anonymous {
+			declared[t.Field(i).Name] = true
+		}
+	}
+
+	var (
+		fields  []reflect.StructField
+		values  []reflect.Value
+		changed bool
+	)
+	for i := 0; i < t.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		xmlTag := f.Tag.Get("xml")
+		if xmlTag == "-" {
+			continue
+		}
+		if f.Anonymous && !marshalsItself(f.Type) && indirectType(f.Type).Kind() == reflect.Struct {
+			for fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					break
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() != reflect.Struct {
+				continue
+			}
+			embeddedFields, embeddedValues, c := zeroAwareFields(fv)
+			changed = changed || c
+			for j, ef := range embeddedFields {
+				if !declared[ef.Name] {
+					declared[ef.Name] = true
+					fields = append(fields, ef)
+					values = append(values, embeddedValues[j])
+				}
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue // ignored by encoding/xml
+		}
+
+		soapTag := f.Tag.Get("soap")
+		if f.Type == propertyBagType && soapTag != "" {
+			fields = append(fields, reflect.StructField{Name: f.Name, Type: reflect.TypeOf(propertyBagXML{}), Tag: f.Tag})
+			values = append(values, reflect.ValueOf(newPropertyBagXML(fv.Interface().(PropertyBag), soapTag)))
+			changed = true
+			continue
+		}
+		if soapTag == "omitzero" && isZero(fv) {
+			changed = true
+			continue
+		}
+		value, c := zeroAware(fv)
+		changed = changed || c
+		field := reflect.StructField{Name: f.Name, Type: f.Type, Tag: f.Tag}
+		if c && f.Type.Kind() != reflect.Interface {
+			field.Type = value.Type()
+		}
+		if soapTag == "keepzero" {
+			if name, opts := splitTag(xmlTag); hasOption(opts, "omitempty") {
+				field.Tag = reflect.StructTag(`xml:"` + name + withoutOption(opts, "omitempty") + `"`)
+				changed = true
+			}
+			if value.Kind() == reflect.Ptr && value.IsNil() {
+				field.Type = value.Type().Elem()
+				value = reflect.Zero(field.Type)
+				changed = true
+			}
+		}
+		fields = append(fields, field)
+		values = append(values, value)
+	}
+	return fields, values, changed
+}
+
+// isZero reports whether v is zero in the sense of soap:"omitzero".
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func splitTag(tag string) (name string, opts string) {
+	if i := strings.Index(tag, ","); i >= 0 {
+		return tag[:i], tag[i:]
+	}
+	return tag, ""
+}
+
+func hasOption(opts, opt string) bool {
+	return strings.Contains(opts+",", ","+opt+",")
+}
+
+func withoutOption(opts, opt string) string {
+	return strings.TrimSuffix(strings.Replace(opts+",", ","+opt+",", ",", 1), ",")
+}
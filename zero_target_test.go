@@ -0,0 +1,68 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pooledResponse struct {
+	XMLName xml.Name `xml:"statusResponse"`
+	State   string   `xml:"state"`
+	Note    *string  `xml:"note"`
+	Items   []string `xml:"items>item"`
+	Owner   *struct {
+		Name string `xml:"name"`
+	} `xml:"owner"`
+}
+
+func TestClient_ZeroResponseTarget(t *testing.T) {
+	responses := []string{
+		`<statusResponse><state>open</state><note>first</note><items><item>a</item><item>b</item></items><owner><name>ops</name></owner></statusResponse>`,
+		`<statusResponse><state>closed</state><items><item>c</item></items></statusResponse>`,
+	}
+	newClient := func() *Client {
+		n := 0
+		c := NewClient("http://localhorst.ch", nil)
+		c.HTTPClientDoFn = (&http.Client{Transport: RoundTrip(func(r *http.Request) (*http.Response, error) {
+			body := `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body>` + responses[n] + `</Body></Envelope>`
+			n++
+			return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(body))}, nil
+		})}).Do
+		return c
+	}
+	callTwice := func(c *Client) *pooledResponse {
+		response := &pooledResponse{}
+		for range responses {
+			_, err := c.Call(context.Background(), "GetStatus", &FooRequest{}, response)
+			require.NoError(t, err)
+		}
+		return response
+	}
+
+	t.Run("bleeding without", func(t *testing.T) {
+		response := callTwice(newClient())
+		assert.Equal(t, "closed", response.State)
+		require.NotNil(t, response.Note)
+		assert.Equal(t, "first", *response.Note)
+		assert.Equal(t, []string{"a", "b", "c"}, response.Items)
+		assert.NotNil(t, response.Owner)
+	})
+
+	t.Run("zeroed", func(t *testing.T) {
+		c := newClient()
+		c.ZeroResponseTarget = true
+		response := callTwice(c)
+		assert.Equal(t, &pooledResponse{
+			XMLName: xml.Name{Space: NamespaceSoap11, Local: "statusResponse"},
+			State:   "closed",
+			Items:   []string{"c"},
+		}, response)
+	})
+}
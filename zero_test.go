@@ -0,0 +1,119 @@
+package soap
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type zeroItem struct {
+	Name  string `xml:"name" soap:"omitzero"`
+	Count int    `xml:"count,omitempty" soap:"keepzero"`
+}
+
+type zeroSelfMarshalling struct {
+	Name string `xml:"name" soap:"omitzero"`
+}
+
+func (zs zeroSelfMarshalling) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(struct {
+		Name string `xml:"name"`
+	}{zs.Name}, start)
+}
+
+type zeroEmbedded struct {
+	Embedded string `xml:"embedded" soap:"omitzero"`
+}
+
+type zeroRequest struct {
+	XMLName xml.Name `xml:"urn:zero request"`
+	zeroEmbedded
+	ID       string              `xml:"id,attr" soap:"omitzero"`
+	Plain    string              `xml:"plain"`
+	Empty    string              `xml:"empty" soap:"omitzero"`
+	Zero     int                 `xml:"zero,omitempty" soap:"keepzero"`
+	False    bool                `xml:"false,omitempty" soap:"keepzero"`
+	Limit    *int                `xml:"limit" soap:"keepzero"`
+	Nested   zeroItem            `xml:"nested" soap:"omitzero"`
+	Items    []zeroItem          `xml:"item"`
+	NoItems  []zeroItem          `xml:"noItem" soap:"omitzero"`
+	Self     zeroSelfMarshalling `xml:"self"`
+	When     time.Time           `xml:"when" soap:"omitzero"`
+	Optional Nullable[int]       `xml:"optional"`
+	Any      interface{}         `xml:"any"`
+	ignored  string
+}
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{
+			name: "zero",
+			v:    &zeroRequest{},
+			want: `<request xmlns="urn:zero"><plain></plain><zero>0</zero><false>false</false><limit>0</limit><self><name></name></self></request>`,
+		},
+		{
+			name: "set",
+			v: &zeroRequest{
+				zeroEmbedded: zeroEmbedded{Embedded: "e"},
+				ID:           "1",
+				Empty:        "not empty",
+				Nested:       zeroItem{Name: "n"},
+				Items:        []zeroItem{{Name: "a", Count: 1}, {}},
+				When:         time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+				Optional:     NewNullable(0),
+				Any:          zeroItem{},
+			},
+			want: `<request xmlns="urn:zero" id="1"><embedded>e</embedded><plain></plain><empty>not empty</empty><zero>0</zero><false>false</false><limit>0</limit>` +
+				`<nested><name>n</name><count>0</count></nested><item><name>a</name><count>1</count></item><item><count>0</count></item>` +
+				`<self><name></name></self><when>2020-01-01T00:00:00Z</when><optional>0</optional><any><count>0</count></any></request>`,
+		},
+		{
+			name: "without soap tags",
+			v:    &FooRequest{Foo: ""},
+			want: `<fooRequest><Foo></Foo></fooRequest>`,
+		},
+		{
+			name: "unnamed root",
+			v:    zeroItem{},
+			want: `<zeroItem><count>0</count></zeroItem>`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Marshal(test.v)
+			require.NoError(t, err)
+			assert.Exactly(t, test.want, string(got))
+		})
+	}
+
+	t.Run("envelope", func(t *testing.T) {
+		got, err := defaultMarshaller{}.Marshal(Envelope{Body: Body{Content: &zeroItem{}}})
+		require.NoError(t, err)
+		assert.Contains(t, string(got), "<Content>\n\t\t\t<count>0</count>\n\t\t</Content>")
+	})
+}
+
+func TestNullable(t *testing.T) {
+	type nullableResponse struct {
+		XMLName xml.Name         `xml:"response"`
+		Set     Nullable[string] `xml:"set"`
+		Empty   Nullable[string] `xml:"empty"`
+		Missing Nullable[int]    `xml:"missing"`
+	}
+	response := &nullableResponse{}
+	require.NoError(t, xml.Unmarshal([]byte(`<response><set>a</set><empty/></response>`), response))
+	assert.Exactly(t, NewNullable("a"), response.Set)
+	assert.Exactly(t, NewNullable(""), response.Empty)
+	assert.Exactly(t, Nullable[int]{}, response.Missing)
+
+	got, err := xml.Marshal(response)
+	require.NoError(t, err)
+	assert.Exactly(t, `<response><set>a</set><empty></empty></response>`, string(got))
+}